@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"context"
+	"strconv"
+
+	db "github.com/igiai/simplebank/db/sqlc"
+)
+
+func (cmd *Command) printAccounts(output string, value interface{}, accounts ...db.Account) error {
+	result := table{header: []string{"ID", "OWNER", "BALANCE", "CURRENCY", "STATUS", "CREATED AT"}}
+	for _, account := range accounts {
+		result.rows = append(result.rows, []string{
+			strconv.FormatInt(account.ID, 10),
+			account.Owner,
+			strconv.FormatInt(account.Balance, 10),
+			account.Currency,
+			account.Status,
+			formatTime(account.CreatedAt),
+		})
+	}
+	return cmd.print(output, value, result)
+}
+
+func (cmd *Command) listAccounts(ctx context.Context, args []string) error {
+	flags, output := cmd.flagSet("account list")
+	owner := flags.String("owner", "", "username of the owner of the accounts")
+	limit := flags.Int("limit", 50, "maximum number of accounts")
+	offset := flags.Int("offset", 0, "number of accounts skipped")
+	if err := parseFlags(flags, args, output, "owner"); err != nil {
+		return err
+	}
+
+	accounts, err := cmd.store.ListAccounts(ctx, db.ListAccountsParams{
+		Owner:  *owner,
+		Limit:  int32(*limit),
+		Offset: int32(*offset),
+	})
+	if err != nil {
+		return err
+	}
+
+	return cmd.printAccounts(*output, accounts, accounts...)
+}
+
+// freezeAccount stops the money of the account from moving until it is unfrozen, the transfers of the account can still be reversed
+func (cmd *Command) freezeAccount(ctx context.Context, args []string) error {
+	return cmd.setAccountStatus(ctx, "account freeze", db.AccountStatusFrozen, args)
+}
+
+func (cmd *Command) unfreezeAccount(ctx context.Context, args []string) error {
+	return cmd.setAccountStatus(ctx, "account unfreeze", db.AccountStatusActive, args)
+}
+
+// closeAccount closes the account for good, its money has to be moved out first
+func (cmd *Command) closeAccount(ctx context.Context, args []string) error {
+	return cmd.setAccountStatus(ctx, "account close", db.AccountStatusClosed, args)
+}
+
+func (cmd *Command) setAccountStatus(ctx context.Context, name string, status string, args []string) error {
+	flags, output := cmd.flagSet(name)
+	id := flags.Int64("id", 0, "id of the account")
+	if err := parseFlags(flags, args, output, "id"); err != nil {
+		return err
+	}
+
+	result, err := cmd.store.SetAccountStatusTx(ctx, db.SetAccountStatusTxParams{
+		AccountID: *id,
+		Status:    status,
+	})
+	if err != nil {
+		return notFound(err, "account %d", *id)
+	}
+
+	return cmd.printAccounts(*output, result.Account, result.Account)
+}
@@ -0,0 +1,189 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/igiai/simplebank/clock"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/token"
+)
+
+// constants for the formats the commands print their results in
+const (
+	TableOutput = "table"
+	JSONOutput  = "json"
+)
+
+// Command runs the admin commands of support staff against the store, in place of raw SQL
+// The commands go through the same store, token maker and password hasher as the server, so they keep its rules
+type Command struct {
+	config         util.Config
+	store          db.Store
+	tokenMaker     token.Maker
+	passwordHasher util.PasswordHasher
+	passwordPolicy util.PasswordPolicy
+	clock          clock.Clock
+	in             io.Reader
+	out            io.Writer
+}
+
+// NewCommand creates the admin commands which read the passwords they are given from in and print their results to out
+func NewCommand(config util.Config, store db.Store, clock clock.Clock, in io.Reader, out io.Writer) (*Command, error) {
+	tokenMaker, err := token.NewMakerFromConfig(config, clock)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create token maker: %w", err)
+	}
+
+	passwordHasher, err := util.NewPasswordHasher(config.PasswordHasher)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create password hasher: %w", err)
+	}
+
+	return &Command{
+		config:         config,
+		store:          store,
+		tokenMaker:     tokenMaker,
+		passwordHasher: passwordHasher,
+		passwordPolicy: util.PasswordPolicy{
+			MinLength:           config.PasswordMinLength,
+			MaxLength:           config.PasswordMaxLength,
+			MinCharacterClasses: config.PasswordMinCharacterClasses,
+		},
+		clock: clock,
+		in:    in,
+		out:   out,
+	}, nil
+}
+
+// action is a subcommand, it is given the arguments which follow its name
+type action func(cmd *Command, ctx context.Context, args []string) error
+
+// commands maps the name of every command to its subcommands
+var commands = map[string]map[string]action{
+	"user": {
+		"create": (*Command).createUser,
+		"show":   (*Command).showUser,
+		"lock":   (*Command).lockUser,
+	},
+	"account": {
+		"list":     (*Command).listAccounts,
+		"freeze":   (*Command).freezeAccount,
+		"unfreeze": (*Command).unfreezeAccount,
+		"close":    (*Command).closeAccount,
+	},
+	"transfer": {
+		"show":    (*Command).showTransfer,
+		"reverse": (*Command).reverseTransfer,
+	},
+	"token": {
+		"mint":    (*Command).mintToken,
+		"inspect": (*Command).inspectToken,
+	},
+}
+
+// IsCommand tells whether name is one of the admin commands
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Run runs the command and subcommand named by the first two arguments, e.g. "user show -username alice"
+func (cmd *Command) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 || !IsCommand(args[0]) {
+		return fmt.Errorf("expected one of the commands: %s", strings.Join(sortedKeys(commands), ", "))
+	}
+
+	subcommands := commands[args[0]]
+	if len(args) < 2 || subcommands[args[1]] == nil {
+		return fmt.Errorf("expected one of the %s subcommands: %s", args[0], strings.Join(sortedKeys(subcommands), ", "))
+	}
+
+	return subcommands[args[1]](cmd, ctx, args[2:])
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// flagSet creates the flags of a subcommand together with the output flag every subcommand has
+func (cmd *Command) flagSet(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(cmd.out)
+	output := flags.String("output", TableOutput, "format of the output, table or json")
+	return flags, output
+}
+
+// parseFlags parses the arguments of a subcommand and checks them before anything is changed
+// The required flags must be set to non-zero values
+func parseFlags(flags *flag.FlagSet, args []string, output *string, required ...string) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	if *output != TableOutput && *output != JSONOutput {
+		return fmt.Errorf("unknown output %q, expected %s or %s", *output, TableOutput, JSONOutput)
+	}
+
+	for _, name := range required {
+		value := flags.Lookup(name).Value.String()
+		if value == "" || value == "0" {
+			return fmt.Errorf("flag -%s is required", name)
+		}
+	}
+	return nil
+}
+
+// table is the table output of a subcommand, one row for every record
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// print writes the value as indented JSON, or its table aligned in columns
+func (cmd *Command) print(output string, value interface{}, result table) error {
+	if output == JSONOutput {
+		encoder := json.NewEncoder(cmd.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+
+	writer := tabwriter.NewWriter(cmd.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.Join(result.header, "\t"))
+	for _, row := range result.rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
+
+// formatTime leaves the zero time out of the tables, e.g. the lock of a user who was never locked
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// notFound names the record which doesn't exist, the store only tells that there is no row
+func notFound(err error, format string, args ...interface{}) error {
+	if errors.Is(err, db.ErrRecordNotFound) {
+		return fmt.Errorf(format+" not found", args...)
+	}
+	return err
+}
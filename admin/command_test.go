@@ -0,0 +1,298 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/clock"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/token"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCommand(t *testing.T) (*Command, *db.MemoryStore, *clock.Fake, *bytes.Buffer) {
+	config := util.Config{
+		TokenSymmetricKey:           util.RandomString(32),
+		TokenIssuer:                 "simplebank",
+		TokenAudience:               "simplebank-api",
+		AccessTokenDuration:         time.Minute,
+		VerifyEmailDuration:         time.Hour,
+		PasswordMinLength:           8,
+		PasswordMaxLength:           64,
+		PasswordMinCharacterClasses: 3,
+	}
+
+	clk := clock.NewFake(time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC))
+	store := db.NewMemoryStoreWithClock(clk)
+	out := &bytes.Buffer{}
+
+	cmd, err := NewCommand(config, store, clk, strings.NewReader(""), out)
+	require.NoError(t, err)
+	return cmd, store, clk, out
+}
+
+// run runs the command and decodes its JSON output into v
+func run(t *testing.T, cmd *Command, out *bytes.Buffer, v interface{}, args ...string) {
+	out.Reset()
+	require.NoError(t, cmd.Run(context.Background(), append(args, "-output", JSONOutput)))
+	require.NoError(t, json.Unmarshal(out.Bytes(), v))
+}
+
+func createTestAccount(t *testing.T, store db.Store, balance int64) db.Account {
+	user, err := store.CreateUser(context.Background(), db.CreateUserParams{
+		Username:       util.RandomOwner(),
+		HashedPassword: util.RandomString(32),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+
+	account, err := store.CreateAccount(context.Background(), db.CreateAccountParams{
+		Owner:    user.Username,
+		Balance:  balance,
+		Currency: util.USD,
+	})
+	require.NoError(t, err)
+	return account
+}
+
+func TestUserCommands(t *testing.T) {
+	cmd, store, clk, out := newTestCommand(t)
+	username := util.RandomOwner()
+
+	var user userView
+	cmd.in = strings.NewReader("Secr3t!pass\n")
+	run(t, cmd, out, &user, "user", "create", "-username", username, "-full-name", "Alice", "-email", "alice@email.com")
+	require.Equal(t, username, user.Username)
+	require.Equal(t, util.DepositorRole, user.Role)
+	require.True(t, user.IsEmailVerified)
+
+	storedUser, err := store.GetUser(context.Background(), username)
+	require.NoError(t, err)
+	require.NoError(t, util.CheckPassword("Secr3t!pass", storedUser.HashedPassword))
+
+	// The password policy of the server applies, and nothing is created when it is broken
+	cmd.in = strings.NewReader("short\n")
+	err = cmd.Run(context.Background(), []string{"user", "create", "-username", util.RandomOwner(), "-full-name", "Bob", "-email", "bob@email.com"})
+	require.ErrorContains(t, err, "password")
+	_, err = store.GetUserByEmail(context.Background(), "bob@email.com")
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	// The password is not taken from a flag
+	err = cmd.Run(context.Background(), []string{"user", "create", "-username", util.RandomOwner(), "-password", "Secr3t!pass", "-full-name", "Bob", "-email", "bob@email.com"})
+	require.ErrorContains(t, err, "flag provided but not defined: -password")
+
+	cmd.in = strings.NewReader("Secr3t!pass\n")
+	err = cmd.Run(context.Background(), []string{"user", "create", "-username", username, "-full-name", "Alice", "-email", "other@email.com"})
+	require.ErrorContains(t, err, "already taken")
+
+	run(t, cmd, out, &user, "user", "lock", "-username", username, "-duration", "2h")
+	require.True(t, clk.Now().Add(2*time.Hour).Equal(user.LockedUntil))
+
+	run(t, cmd, out, &user, "user", "show", "-username", username)
+	require.True(t, clk.Now().Add(2*time.Hour).Equal(user.LockedUntil))
+	require.NotContains(t, out.String(), storedUser.HashedPassword)
+
+	err = cmd.Run(context.Background(), []string{"user", "show", "-username", util.RandomOwner()})
+	require.ErrorContains(t, err, "not found")
+
+	err = cmd.Run(context.Background(), []string{"user", "show"})
+	require.EqualError(t, err, "flag -username is required")
+}
+
+func TestAccountCommands(t *testing.T) {
+	cmd, store, _, out := newTestCommand(t)
+	account := createTestAccount(t, store, 0)
+
+	var accounts []db.Account
+	run(t, cmd, out, &accounts, "account", "list", "-owner", account.Owner)
+	require.Len(t, accounts, 1)
+	require.Equal(t, account.ID, accounts[0].ID)
+
+	id := strconv.FormatInt(account.ID, 10)
+
+	var updatedAccount db.Account
+	run(t, cmd, out, &updatedAccount, "account", "freeze", "-id", id)
+	require.Equal(t, db.AccountStatusFrozen, updatedAccount.Status)
+
+	run(t, cmd, out, &updatedAccount, "account", "unfreeze", "-id", id)
+	require.Equal(t, db.AccountStatusActive, updatedAccount.Status)
+
+	run(t, cmd, out, &updatedAccount, "account", "close", "-id", id)
+	require.Equal(t, db.AccountStatusClosed, updatedAccount.Status)
+
+	err := cmd.Run(context.Background(), []string{"account", "freeze", "-id", id})
+	require.ErrorIs(t, err, db.ErrAccountClosed)
+
+	err = cmd.Run(context.Background(), []string{"account", "close", "-id", strconv.FormatInt(createTestAccount(t, store, 10).ID, 10)})
+	require.ErrorIs(t, err, db.ErrAccountNotEmpty)
+
+	err = cmd.Run(context.Background(), []string{"account", "close", "-id", "1000"})
+	require.EqualError(t, err, "account 1000 not found")
+}
+
+func TestTransferCommands(t *testing.T) {
+	cmd, store, _, out := newTestCommand(t)
+	account1 := createTestAccount(t, store, 100)
+	account2 := createTestAccount(t, store, 100)
+
+	result, err := store.TransferTX(context.Background(), db.TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        30,
+	})
+	require.NoError(t, err)
+	id := strconv.FormatInt(result.Transfer.ID, 10)
+
+	var transfer db.Transfer
+	run(t, cmd, out, &transfer, "transfer", "show", "-id", id)
+	require.Equal(t, result.Transfer.ID, transfer.ID)
+	require.False(t, transfer.ReversedBy.Valid)
+
+	var reversal db.ReverseTransferTxResult
+	run(t, cmd, out, &reversal, "transfer", "reverse", "-id", id)
+	require.Equal(t, reversal.Reversal.Transfer.ID, reversal.Transfer.ReversedBy.Int64)
+
+	updatedAccount1, err := store.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), updatedAccount1.Balance)
+
+	err = cmd.Run(context.Background(), []string{"transfer", "reverse", "-id", id})
+	require.ErrorIs(t, err, db.ErrTransferAlreadyReversed)
+}
+
+func TestTokenCommands(t *testing.T) {
+	cmd, store, clk, out := newTestCommand(t)
+	account := createTestAccount(t, store, 0)
+
+	var minted mintTokenResult
+	run(t, cmd, out, &minted, "token", "mint", "-username", account.Owner, "-operator", "bob", "-duration", "1m")
+	require.True(t, clk.Now().Add(time.Minute).Equal(minted.ExpiresAt))
+
+	// The token is usable against the server, its session is live and names the operator
+	session, err := store.TouchSession(context.Background(), minted.SessionID)
+	require.NoError(t, err)
+	require.Equal(t, "simplebank admin (bob)", session.UserAgent)
+
+	var payload token.Payload
+	run(t, cmd, out, &payload, "token", "inspect", "-token", minted.AccessToken)
+	require.Equal(t, minted.SessionID, payload.ID)
+	require.Equal(t, account.Owner, payload.Username)
+	require.Equal(t, "simplebank", payload.Issuer)
+
+	clk.Advance(time.Minute + time.Second)
+	err = cmd.Run(context.Background(), []string{"token", "inspect", "-token", minted.AccessToken})
+	require.ErrorIs(t, err, token.ErrExpiredToken)
+
+	err = cmd.Run(context.Background(), []string{"token", "mint", "-username", util.RandomOwner(), "-operator", "bob"})
+	require.ErrorContains(t, err, "not found")
+
+	// The token lives no longer than the ones issued on login
+	err = cmd.Run(context.Background(), []string{"token", "mint", "-username", account.Owner, "-operator", "bob", "-duration", "10m"})
+	require.EqualError(t, err, "duration cannot exceed the access token duration of 1m0s")
+
+	// An already expired token would still start a session
+	err = cmd.Run(context.Background(), []string{"token", "mint", "-username", account.Owner, "-operator", "bob", "-duration", "-1m"})
+	require.EqualError(t, err, "duration must be positive, got -1m0s")
+
+	err = cmd.Run(context.Background(), []string{"token", "mint", "-username", account.Owner, "-operator", "bob", "-duration", "0s"})
+	require.EqualError(t, err, "duration must be positive, got 0s")
+
+	err = cmd.Run(context.Background(), []string{"token", "mint", "-username", account.Owner})
+	require.EqualError(t, err, "flag -operator is required")
+
+	// Locked users get no token
+	_, err = store.LockUser(context.Background(), db.LockUserParams{Username: account.Owner, LockedUntil: clk.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	err = cmd.Run(context.Background(), []string{"token", "mint", "-username", account.Owner, "-operator", "bob"})
+	require.ErrorContains(t, err, "is locked until")
+}
+
+func TestReadPassword(t *testing.T) {
+	t.Setenv(PasswordEnv, "")
+
+	password, err := ReadPassword(strings.NewReader("Secr3t!pass\r\nignored\n"))
+	require.NoError(t, err)
+	require.Equal(t, "Secr3t!pass", password)
+
+	password, err = ReadPassword(strings.NewReader("Secr3t!pass"))
+	require.NoError(t, err)
+	require.Equal(t, "Secr3t!pass", password)
+
+	_, err = ReadPassword(strings.NewReader(""))
+	require.EqualError(t, err, "password is required, set SIMPLEBANK_PASSWORD or write it to stdin")
+
+	// The environment takes precedence over stdin
+	t.Setenv(PasswordEnv, "fr0m-the-Env")
+	password, err = ReadPassword(strings.NewReader("Secr3t!pass\n"))
+	require.NoError(t, err)
+	require.Equal(t, "fr0m-the-Env", password)
+}
+
+func TestTableOutput(t *testing.T) {
+	cmd, store, _, out := newTestCommand(t)
+	account := createTestAccount(t, store, 42)
+
+	require.NoError(t, cmd.Run(context.Background(), []string{"account", "list", "-owner", account.Owner}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Equal(t, []string{"ID", "OWNER", "BALANCE", "CURRENCY", "STATUS", "CREATED", "AT"}, strings.Fields(lines[0]))
+	require.Equal(t, []string{strconv.FormatInt(account.ID, 10), account.Owner, "42", util.USD, db.AccountStatusActive}, strings.Fields(lines[1])[:5])
+}
+
+func TestRunErrors(t *testing.T) {
+	cmd, store, _, _ := newTestCommand(t)
+	account := createTestAccount(t, store, 0)
+
+	testCases := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{
+			name: "NoCommand",
+			err:  "expected one of the commands: account, token, transfer, user",
+		},
+		{
+			name: "UnknownCommand",
+			args: []string{"entry"},
+			err:  "expected one of the commands: account, token, transfer, user",
+		},
+		{
+			name: "UnknownSubcommand",
+			args: []string{"transfer", "list"},
+			err:  "expected one of the transfer subcommands: reverse, show",
+		},
+		{
+			name: "UnknownOutput",
+			args: []string{"account", "freeze", "-id", strconv.FormatInt(account.ID, 10), "-output", "xml"},
+			err:  `unknown output "xml", expected table or json`,
+		},
+		{
+			name: "UnexpectedArguments",
+			args: []string{"user", "show", "-username", account.Owner, "extra"},
+			err:  "unexpected arguments: extra",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			err := cmd.Run(context.Background(), tc.args)
+			require.EqualError(t, err, tc.err)
+		})
+	}
+
+	// The output is checked before the account is changed
+	updatedAccount, err := store.GetAccount(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.AccountStatusActive, updatedAccount.Status)
+}
@@ -0,0 +1,33 @@
+package admin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// PasswordEnv is the environment variable the commands take the password from, when it isn't set it is read from stdin
+const PasswordEnv = "SIMPLEBANK_PASSWORD"
+
+// ReadPassword returns the password set in the PasswordEnv environment variable, or else the first line of in
+// Passwords are never taken from flags, as the arguments of a process are visible to the other users of the machine
+// and end up in the shell history
+func ReadPassword(in io.Reader) (string, error) {
+	if password := os.Getenv(PasswordEnv); password != "" {
+		return password, nil
+	}
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("cannot read password: %w", err)
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("password is required, set %s or write it to stdin", PasswordEnv)
+	}
+	return password, nil
+}
@@ -0,0 +1,109 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/token"
+)
+
+// adminUserAgent is the user agent of the sessions started by the minted tokens, the user sees it in their list of sessions
+// together with the operator who minted the token
+const adminUserAgent = "simplebank admin"
+
+type mintTokenResult struct {
+	SessionID   uuid.UUID `json:"session_id"`
+	AccessToken string    `json:"access_token"`
+	Username    string    `json:"username"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// mintToken issues an access token of the user, e.g. to reproduce an issue the customer reported
+// The server accepts only the tokens of the live sessions, so a session is started for the token like on login
+// The token lives no longer than the ones issued on login, and locked users get none
+func (cmd *Command) mintToken(ctx context.Context, args []string) error {
+	flags, output := cmd.flagSet("token mint")
+	username := flags.String("username", "", "username of the user the token is issued to")
+	operator := flags.String("operator", "", "name of the staff member the token is minted by, recorded in the session")
+	duration := flags.Duration("duration", cmd.config.AccessTokenDuration, "how long the token is valid, at most the access token duration")
+	if err := parseFlags(flags, args, output, "username", "operator", "duration"); err != nil {
+		return err
+	}
+
+	if *duration <= 0 {
+		return fmt.Errorf("duration must be positive, got %s", *duration)
+	}
+	if *duration > cmd.config.AccessTokenDuration {
+		return fmt.Errorf("duration cannot exceed the access token duration of %s", cmd.config.AccessTokenDuration)
+	}
+
+	user, err := cmd.store.GetUser(ctx, *username)
+	if err != nil {
+		return notFound(err, "user %s", *username)
+	}
+
+	if user.LockedUntil.After(cmd.clock.Now()) {
+		return fmt.Errorf("user %s is locked until %s", user.Username, formatTime(user.LockedUntil))
+	}
+
+	accessToken, payload, err := cmd.tokenMaker.CreateToken(user.Username, *duration)
+	if err != nil {
+		return err
+	}
+
+	session, err := cmd.store.CreateSession(ctx, db.CreateSessionParams{
+		ID:        payload.ID,
+		Username:  user.Username,
+		UserAgent: fmt.Sprintf("%s (%s)", adminUserAgent, *operator),
+		ExpiresAt: payload.ExpiredAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	result := mintTokenResult{
+		SessionID:   session.ID,
+		AccessToken: accessToken,
+		Username:    user.Username,
+		ExpiresAt:   session.ExpiresAt,
+	}
+	return cmd.print(*output, result, table{
+		header: []string{"SESSION ID", "USERNAME", "EXPIRES AT", "ACCESS TOKEN"},
+		rows:   [][]string{{result.SessionID.String(), result.Username, formatTime(result.ExpiresAt), result.AccessToken}},
+	})
+}
+
+// inspectToken verifies the token with the keys and claims of the server and prints its payload
+// It doesn't check the session, a valid token of a revoked session is still rejected by the server
+func (cmd *Command) inspectToken(ctx context.Context, args []string) error {
+	flags, output := cmd.flagSet("token inspect")
+	accessToken := flags.String("token", "", "access token to inspect")
+	if err := parseFlags(flags, args, output, "token"); err != nil {
+		return err
+	}
+
+	payload, err := cmd.tokenMaker.VerifyToken(*accessToken)
+	if err != nil {
+		return err
+	}
+
+	return cmd.printPayload(*output, payload)
+}
+
+func (cmd *Command) printPayload(output string, payload *token.Payload) error {
+	return cmd.print(output, payload, table{
+		header: []string{"ID", "USERNAME", "ISSUER", "AUDIENCE", "ISSUED AT", "NOT BEFORE", "EXPIRES AT"},
+		rows: [][]string{{
+			payload.ID.String(),
+			payload.Username,
+			payload.Issuer,
+			payload.Audience,
+			formatTime(payload.IssuedAt),
+			formatTime(payload.NotBefore),
+			formatTime(payload.ExpiredAt),
+		}},
+	})
+}
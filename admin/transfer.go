@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"context"
+	"strconv"
+
+	db "github.com/igiai/simplebank/db/sqlc"
+)
+
+func (cmd *Command) printTransfers(output string, value interface{}, transfers ...db.Transfer) error {
+	result := table{header: []string{"ID", "FROM ACCOUNT", "TO ACCOUNT", "AMOUNT", "REVERSED BY", "CREATED AT"}}
+	for _, transfer := range transfers {
+		reversedBy := "-"
+		if transfer.ReversedBy.Valid {
+			reversedBy = strconv.FormatInt(transfer.ReversedBy.Int64, 10)
+		}
+
+		result.rows = append(result.rows, []string{
+			strconv.FormatInt(transfer.ID, 10),
+			strconv.FormatInt(transfer.FromAccountID, 10),
+			strconv.FormatInt(transfer.ToAccountID, 10),
+			strconv.FormatInt(transfer.Amount, 10),
+			reversedBy,
+			formatTime(transfer.CreatedAt),
+		})
+	}
+	return cmd.print(output, value, result)
+}
+
+func (cmd *Command) showTransfer(ctx context.Context, args []string) error {
+	flags, output := cmd.flagSet("transfer show")
+	id := flags.Int64("id", 0, "id of the transfer")
+	if err := parseFlags(flags, args, output, "id"); err != nil {
+		return err
+	}
+
+	transfer, err := cmd.store.GetTransfer(ctx, *id)
+	if err != nil {
+		return notFound(err, "transfer %d", *id)
+	}
+
+	return cmd.printTransfers(*output, transfer, transfer)
+}
+
+// reverseTransfer gives the money of a transfer back, the table lists the reversed transfer followed by its reversal
+func (cmd *Command) reverseTransfer(ctx context.Context, args []string) error {
+	flags, output := cmd.flagSet("transfer reverse")
+	id := flags.Int64("id", 0, "id of the transfer")
+	if err := parseFlags(flags, args, output, "id"); err != nil {
+		return err
+	}
+
+	result, err := cmd.store.ReverseTransferTx(ctx, db.ReverseTransferTxParams{TransferID: *id})
+	if err != nil {
+		return notFound(err, "transfer %d", *id)
+	}
+
+	return cmd.printTransfers(*output, result, result.Transfer, result.Reversal.Transfer)
+}
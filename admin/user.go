@@ -0,0 +1,158 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+)
+
+// userView is the user as support staff sees it, without the password hash and the TOTP secret
+type userView struct {
+	Username            string    `json:"username"`
+	FullName            string    `json:"full_name"`
+	Email               string    `json:"email"`
+	Role                string    `json:"role"`
+	IsEmailVerified     bool      `json:"is_email_verified"`
+	IsTotpEnabled       bool      `json:"is_totp_enabled"`
+	FailedLoginAttempts int32     `json:"failed_login_attempts"`
+	LockoutCount        int32     `json:"lockout_count"`
+	LockedUntil         time.Time `json:"locked_until"`
+	PasswordChangedAt   time.Time `json:"password_changed_at"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+func newUserView(user db.User) userView {
+	return userView{
+		Username:            user.Username,
+		FullName:            user.FullName,
+		Email:               user.Email,
+		Role:                user.Role,
+		IsEmailVerified:     user.IsEmailVerified,
+		IsTotpEnabled:       user.IsTotpEnabled,
+		FailedLoginAttempts: user.FailedLoginAttempts,
+		LockoutCount:        user.LockoutCount,
+		LockedUntil:         user.LockedUntil,
+		PasswordChangedAt:   user.PasswordChangedAt,
+		CreatedAt:           user.CreatedAt,
+	}
+}
+
+func (cmd *Command) printUser(output string, user db.User) error {
+	return cmd.print(output, newUserView(user), table{
+		header: []string{"USERNAME", "FULL NAME", "EMAIL", "ROLE", "VERIFIED", "TOTP", "FAILED LOGINS", "LOCKED UNTIL", "CREATED AT"},
+		rows: [][]string{{
+			user.Username,
+			user.FullName,
+			user.Email,
+			user.Role,
+			strconv.FormatBool(user.IsEmailVerified),
+			strconv.FormatBool(user.IsTotpEnabled),
+			strconv.Itoa(int(user.FailedLoginAttempts)),
+			formatTime(user.LockedUntil),
+			formatTime(user.CreatedAt),
+		}},
+	})
+}
+
+// createUser creates a user on behalf of a customer, the password has to follow the policy of the server
+// The password is read with ReadPassword rather than from a flag
+// The staff checks the email of the customer themselves, so the user is verified unless told otherwise
+func (cmd *Command) createUser(ctx context.Context, args []string) error {
+	flags, output := cmd.flagSet("user create")
+	username := flags.String("username", "", "username of the new user")
+	fullName := flags.String("full-name", "", "full name of the new user")
+	email := flags.String("email", "", "email of the new user")
+	verified := flags.Bool("verified", true, "mark the email of the user as verified")
+	if err := parseFlags(flags, args, output, "username", "full-name", "email"); err != nil {
+		return err
+	}
+
+	password, err := ReadPassword(cmd.in)
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.passwordPolicy.Check(password, *username, *email); err != nil {
+		return err
+	}
+
+	hashedPassword, err := cmd.passwordHasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("cannot hash password: %w", err)
+	}
+
+	secretCode, err := util.GenerateSecret(32)
+	if err != nil {
+		return err
+	}
+
+	result, err := cmd.store.CreateUserTx(ctx, db.CreateUserTxParams{
+		CreateUserParams: db.CreateUserParams{
+			Username:       *username,
+			HashedPassword: hashedPassword,
+			FullName:       *fullName,
+			Email:          *email,
+		},
+		SecretCodeHash:     util.HashSecret(secretCode),
+		VerifyEmailExpires: cmd.clock.Now().Add(cmd.config.VerifyEmailDuration),
+	})
+	if err != nil {
+		if db.ErrorCode(err) == db.UniqueViolation {
+			return fmt.Errorf("username or email already taken: %w", err)
+		}
+		return err
+	}
+
+	user := result.User
+	if *verified {
+		user, err = cmd.store.VerifyUserEmail(ctx, user.Username)
+		if err != nil {
+			return err
+		}
+	}
+
+	return cmd.printUser(*output, user)
+}
+
+func (cmd *Command) showUser(ctx context.Context, args []string) error {
+	flags, output := cmd.flagSet("user show")
+	username := flags.String("username", "", "username of the user")
+	if err := parseFlags(flags, args, output, "username"); err != nil {
+		return err
+	}
+
+	user, err := cmd.store.GetUser(ctx, *username)
+	if err != nil {
+		return notFound(err, "user %s", *username)
+	}
+
+	return cmd.printUser(*output, user)
+}
+
+// lockUser locks the user out for the duration, the same way too many failed logins do
+// A banker lifts the lock before it expires through the unlock endpoint
+func (cmd *Command) lockUser(ctx context.Context, args []string) error {
+	flags, output := cmd.flagSet("user lock")
+	username := flags.String("username", "", "username of the user")
+	duration := flags.Duration("duration", 24*time.Hour, "how long the user is locked out")
+	if err := parseFlags(flags, args, output, "username"); err != nil {
+		return err
+	}
+	if *duration <= 0 {
+		return fmt.Errorf("duration must be positive, got %s", *duration)
+	}
+
+	user, err := cmd.store.LockUser(ctx, db.LockUserParams{
+		Username:    *username,
+		LockedUntil: cmd.clock.Now().Add(*duration),
+	})
+	if err != nil {
+		return notFound(err, "user %s", *username)
+	}
+
+	return cmd.printUser(*output, user)
+}
@@ -1,23 +1,50 @@
 package api
 
 import (
+	"io"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/igiai/simplebank/clock"
 	db "github.com/igiai/simplebank/db/sqlc"
 	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/mail"
+	"github.com/igiai/simplebank/stream"
 	"github.com/stretchr/testify/require"
 )
 
 func newTestServer(t *testing.T, store db.Store) *Server {
+	return newTestServerWithClock(t, store, clock.Real{})
+}
+
+// newTestServerWithClock creates a test server whose expiries are set and checked with the given clock
+func newTestServerWithClock(t *testing.T, store db.Store, clock clock.Clock) *Server {
 	config := util.Config{
-		TokenSymmetricKey:   util.RandomString(32),
-		AccessTokenDuration: time.Minute,
+		TokenSymmetricKey:           util.RandomString(32),
+		TokenIssuer:                 "simplebank",
+		TokenAudience:               "simplebank-api",
+		AccessTokenDuration:         time.Minute,
+		MaxFailedLogins:             3,
+		LockoutDuration:             time.Minute,
+		MaxLockoutDuration:          time.Hour,
+		ResetTokenDuration:          time.Minute,
+		PasswordChangeCacheTTL:      time.Minute,
+		SessionCacheTTL:             time.Minute,
+		VerifyEmailURL:              "http://localhost:8080/users/verify_email",
+		VerifyEmailDuration:         time.Hour,
+		MFAChallengeDuration:        time.Minute,
+		MFAMaxAttempts:              3,
+		PasswordMinLength:           8,
+		PasswordMaxLength:           64,
+		PasswordMinCharacterClasses: 3,
+		StreamBufferSize:            16,
+		StreamHeartbeatInterval:     time.Minute,
 	}
 
-	server, err := NewServer(config, store)
+	// Tests which check the emails replace the mailer of the server with a mock
+	server, err := NewServer(config, store, mail.NewLogMailer(io.Discard), stream.NewBroker(config.StreamBufferSize), clock)
 	require.NoError(t, err)
 
 	return server
@@ -1,23 +1,47 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/ratelimit"
 	"github.com/igiai/simplebank/token"
 )
 
 const (
 	authorizationHeaderKey  = "authorization"
 	authorizationTypeBearer = "bearer"
+	authorizationTypeAPIKey = "apikey"
 	authorizationPayloadKey = "authorization_payload"
+	authorizationScopesKey  = "authorization_scopes"
+	// authorizationAPIKeyHashKey is set to the hash of the api key of the request, long-lived requests check it again
+	authorizationAPIKeyHashKey = "authorization_api_key_hash"
+	// readYourWritesHeader set to true makes all the reads of a request go to the primary db
+	readYourWritesHeader = "X-Read-Your-Writes"
+)
+
+var (
+	errTokenRevoked   = errors.New("token was issued before the last password change")
+	errSessionRevoked = errors.New("session of the token has been signed out")
+	errInvalidAPIKey  = errors.New("api key is invalid or has been revoked")
+	errMissingScope   = errors.New("api key is missing the scope required by the route")
 )
 
 // authMiddleware is not a middleware function itself, it returns an authentication middleware function
-func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
+// Tokens issued before the last password change of their user are rejected
+// Tokens of revoked sessions are rejected as well
+// API keys of service accounts are accepted only when apiKeys is set, i.e. on the routes guarded by requireScope
+func authMiddleware(tokenVerifier token.Verifier, passwordChanges *passwordChangeCache, sessions *sessionCache, apiKeys db.Querier) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
 		if len(authorizationHeader) == 0 {
@@ -35,20 +59,160 @@ func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
 		}
 
 		authorizationType := strings.ToLower(fields[0])
-		if authorizationType != authorizationTypeBearer {
+		switch {
+		case authorizationType == authorizationTypeBearer:
+			authenticateBearer(ctx, tokenVerifier, passwordChanges, sessions, fields[1])
+		case authorizationType == authorizationTypeAPIKey && apiKeys != nil:
+			authenticateAPIKey(ctx, apiKeys, fields[1])
+		default:
 			err := fmt.Errorf("unsupported authorization type %s", authorizationType)
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+		}
+	}
+}
+
+// authenticateBearer lets the request through when the access token is valid and its session is not revoked
+func authenticateBearer(ctx *gin.Context, tokenVerifier token.Verifier, passwordChanges *passwordChangeCache, sessions *sessionCache, accessToken string) {
+	payload, err := tokenVerifier.VerifyToken(accessToken)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	err = checkRevocation(ctx, passwordChanges, sessions, payload)
+	if err != nil {
+		if err == db.ErrRecordNotFound || err == errTokenRevoked || err == errSessionRevoked {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
 			return
 		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
 
-		accessToken := fields[1]
-		payload, err := tokenMaker.VerifyToken(accessToken)
-		if err != nil {
+	ctx.Set(authorizationPayloadKey, payload)
+	ctx.Next()
+}
+
+// checkRevocation returns errTokenRevoked when the password of the user has changed since the token was issued,
+// and errSessionRevoked when the session of the token has been signed out
+// A sign-out takes effect right away on this instance and within the ttl of the cache on the others
+func checkRevocation(ctx context.Context, passwordChanges *passwordChangeCache, sessions *sessionCache, payload *token.Payload) error {
+	passwordChangedAt, err := passwordChanges.get(ctx, payload.Username)
+	if err != nil {
+		return err
+	}
+
+	// The change is timed with the clock of the server, like the tokens, but JWTs carry the issue time in whole seconds,
+	// so a token issued in the same second as the change is accepted, even if the change came first
+	if payload.IssuedAt.Before(passwordChangedAt.Truncate(time.Second)) {
+		return errTokenRevoked
+	}
+
+	return sessions.check(ctx, payload.ID)
+}
+
+// checkAPIKey returns errInvalidAPIKey when the api key with the given hash doesn't exist or has been revoked
+func checkAPIKey(ctx context.Context, apiKeys db.Querier, keyHash string) (db.GetAPIKeyForAuthRow, error) {
+	key, err := apiKeys.GetAPIKeyForAuth(ctx, keyHash)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			return key, errInvalidAPIKey
+		}
+		return key, err
+	}
+
+	if key.RevokedAt.Valid {
+		return key, errInvalidAPIKey
+	}
+	return key, nil
+}
+
+// authenticateAPIKey lets the request through when the api key exists and is not revoked
+// The request acts as the owner of the service account, limited to the scopes of the key
+func authenticateAPIKey(ctx *gin.Context, apiKeys db.Querier, apiKey string) {
+	keyHash := util.HashSecret(apiKey)
+	key, err := checkAPIKey(ctx, apiKeys, keyHash)
+	if err != nil {
+		if err == errInvalidAPIKey {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
 			return
 		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = apiKeys.TouchAPIKey(ctx, key.ID)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Set(authorizationPayloadKey, &token.Payload{Username: key.Owner})
+	ctx.Set(authorizationScopesKey, key.Scopes)
+	ctx.Set(authorizationAPIKeyHashKey, keyHash)
+	ctx.Next()
+}
+
+// requireScope returns a middleware function that rejects requests authenticated with an api key without the scope
+// Users logged in with an access token are not limited by scopes
+func requireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scopes, ok := ctx.Get(authorizationScopesKey)
+		if ok && !slices.Contains(scopes.([]string), scope) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(errMissingScope))
+			return
+		}
 
-		ctx.Set(authorizationPayloadKey, payload)
 		ctx.Next()
 	}
 }
+
+// readYourWritesMiddleware lets a client which has to see its own writes right away skip the db replica
+// e.g. for reading an account it has just created
+func readYourWritesMiddleware(ctx *gin.Context) {
+	if primary, _ := strconv.ParseBool(ctx.GetHeader(readYourWritesHeader)); primary {
+		ctx.Request = ctx.Request.WithContext(db.WithPrimaryReads(ctx.Request.Context()))
+	}
+
+	ctx.Next()
+}
+
+// rateLimitMiddleware returns a middleware function that rejects requests once the bucket of the key returned by keyFunc is empty
+func rateLimitMiddleware(limiter ratelimit.Limiter, keyFunc func(ctx *gin.Context) string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		result, err := limiter.Allow(ctx, keyFunc(ctx))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		if !result.Allowed {
+			// Retry-After is expressed in whole seconds, so we round up not to invite the client back too early
+			retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+			ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+
+			err := errors.New("too many requests")
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, errorResponse(err))
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// The keys of the rate limiters start with the prefix of their limiter, the limiters keeping their buckets in the db share a table
+const (
+	clientIPRateLimitKeyPrefix = "ip:"
+	usernameRateLimitKeyPrefix = "user:"
+)
+
+// clientIPRateLimitKey is used to rate limit the routes which don't require authentication
+func clientIPRateLimitKey(ctx *gin.Context) string {
+	return clientIPRateLimitKeyPrefix + ctx.ClientIP()
+}
+
+// usernameRateLimitKey is used to rate limit the routes behind authMiddleware, so the payload is always set
+func usernameRateLimitKey(ctx *gin.Context) string {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	return usernameRateLimitKeyPrefix + authPayload.Username
+}
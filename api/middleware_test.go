@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -8,7 +10,15 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/igiai/simplebank/clock"
+	mockdb "github.com/igiai/simplebank/db/mock"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/ratelimit"
 	"github.com/igiai/simplebank/token"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/require"
 )
 
@@ -20,17 +30,37 @@ func addAuthorization(
 	username string,
 	duration time.Duration,
 ) {
-	token, err := tokenMaker.CreateToken(username, duration)
+	token, _, err := tokenMaker.CreateToken(username, duration)
 	require.NoError(t, err)
 
 	authorizationHeader := fmt.Sprintf("%s %s", authorizationType, token)
 	request.Header.Set(authorizationHeaderKey, authorizationHeader)
 }
 
+// stubAuthentication lets authMiddleware accept the tokens in the tests of endpoints behind it
+func stubAuthentication(store *mockdb.MockStore) {
+	store.EXPECT().
+		GetUserPasswordChangedAt(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(time.Time{}, nil)
+	stubSession(store)
+}
+
+// stubSession reports the session of every token as active and recently used
+func stubSession(store *mockdb.MockStore) {
+	store.EXPECT().
+		GetSession(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		DoAndReturn(func(_ any, id uuid.UUID) (db.Session, error) {
+			return db.Session{ID: id, LastUsedAt: time.Now()}, nil
+		})
+}
+
 func TestAuthMiddleware(t *testing.T) {
 	testCases := []struct {
 		name          string
 		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
 		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
 	}{
 		{
@@ -38,6 +68,12 @@ func TestAuthMiddleware(t *testing.T) {
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
 				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", time.Minute)
 			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserPasswordChangedAt(gomock.Any(), gomock.Eq("user")).
+					Times(1).
+					Return(time.Time{}, nil)
+			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
 			},
@@ -46,6 +82,11 @@ func TestAuthMiddleware(t *testing.T) {
 			name: "NoAuthorization",
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
 			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserPasswordChangedAt(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
 			},
@@ -55,6 +96,11 @@ func TestAuthMiddleware(t *testing.T) {
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
 				addAuthorization(t, request, tokenMaker, "unsupported", "user", time.Minute)
 			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserPasswordChangedAt(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
 			},
@@ -64,6 +110,11 @@ func TestAuthMiddleware(t *testing.T) {
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
 				addAuthorization(t, request, tokenMaker, "", "user", time.Minute)
 			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserPasswordChangedAt(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
 			},
@@ -73,22 +124,177 @@ func TestAuthMiddleware(t *testing.T) {
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
 				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", -time.Minute)
 			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserPasswordChangedAt(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "PasswordChangedAfterIssue",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserPasswordChangedAt(gomock.Any(), gomock.Eq("user")).
+					Times(1).
+					Return(time.Now().Add(time.Second), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "PasswordChangedBeforeIssue",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserPasswordChangedAt(gomock.Any(), gomock.Eq("user")).
+					Times(1).
+					Return(time.Now().Add(-time.Second), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "UserNotFound",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserPasswordChangedAt(gomock.Any(), gomock.Eq("user")).
+					Times(1).
+					Return(time.Time{}, db.ErrRecordNotFound)
+			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
 			},
 		},
+		{
+			name: "InternalError",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserPasswordChangedAt(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(time.Time{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name: "SessionRevoked",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserPasswordChangedAt(gomock.Any(), gomock.Eq("user")).
+					Times(1).
+					Return(time.Time{}, nil)
+				store.EXPECT().
+					GetSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Session{}, db.ErrRecordNotFound)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "SessionSignedOut",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserPasswordChangedAt(gomock.Any(), gomock.Eq("user")).
+					Times(1).
+					Return(time.Time{}, nil)
+				store.EXPECT().
+					GetSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Session{RevokedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true}}, nil)
+				store.EXPECT().
+					TouchSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "StaleSessionTouched",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserPasswordChangedAt(gomock.Any(), gomock.Eq("user")).
+					Times(1).
+					Return(time.Time{}, nil)
+				store.EXPECT().
+					GetSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Session{LastUsedAt: time.Now().Add(-2 * sessionTouchInterval)}, nil)
+				store.EXPECT().
+					TouchSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Session{}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "SessionInternalError",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserPasswordChangedAt(gomock.Any(), gomock.Eq("user")).
+					Times(1).
+					Return(time.Time{}, nil)
+				store.EXPECT().
+					GetSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Session{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
 	}
 
 	for i := range testCases {
 		tc := testCases[i]
 
 		t.Run(tc.name, func(t *testing.T) {
-			server := newTestServer(t, nil)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubSession(store)
+
+			server := newTestServer(t, store)
 
 			authPath := "/auth"
 			server.router.GET(
 				authPath,
-				authMiddleware(server.tokenMaker),
+				authMiddleware(server.tokenMaker, server.passwordChanges, server.sessions, nil),
 				func(ctx *gin.Context) {
 					ctx.JSON(http.StatusOK, gin.H{})
 				},
@@ -105,3 +311,536 @@ func TestAuthMiddleware(t *testing.T) {
 	}
 
 }
+
+func TestAuthMiddlewareCachesPasswordChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Only the first request reaches the db, the next ones are served from the cache
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetUserPasswordChangedAt(gomock.Any(), gomock.Eq("user")).
+		Times(1).
+		Return(time.Time{}, nil)
+	stubSession(store)
+
+	server := newTestServer(t, store)
+
+	authPath := "/auth"
+	server.router.GET(
+		authPath,
+		authMiddleware(server.tokenMaker, server.passwordChanges, server.sessions, nil),
+		func(ctx *gin.Context) {
+			ctx.JSON(http.StatusOK, gin.H{})
+		},
+	)
+
+	sendRequest := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, authPath, nil)
+		require.NoError(t, err)
+
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "user", time.Minute)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for i := 0; i < 3; i++ {
+		recorder := sendRequest()
+		require.Equal(t, http.StatusOK, recorder.Code)
+	}
+
+	// A password change made by this server is seen immediately
+	server.passwordChanges.set("user", time.Now().Add(time.Second))
+	recorder := sendRequest()
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestPasswordChangeCacheKeepsLaterChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clk := clock.NewFake(time.Now())
+	changedAt := clk.Now().Add(-time.Hour)
+
+	// The password is changed by this instance while a miss is loading the time of the previous change
+	store := mockdb.NewMockStore(ctrl)
+	cache := newPasswordChangeCache(store, time.Minute, clk)
+	store.EXPECT().
+		GetUserPasswordChangedAt(gomock.Any(), gomock.Eq("user")).
+		Times(1).
+		DoAndReturn(func(_ interface{}, _ string) (time.Time, error) {
+			cache.set("user", clk.Now())
+			return changedAt, nil
+		})
+
+	for i := 0; i < 2; i++ {
+		got, err := cache.get(context.Background(), "user")
+		require.NoError(t, err)
+		require.True(t, clk.Now().Equal(got))
+	}
+}
+
+func TestAuthMiddlewarePasswordChangeInSecondOfIssue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	stubSession(store)
+
+	clk := clock.NewFake(time.Date(2024, time.March, 1, 9, 0, 0, 500*int(time.Millisecond), time.UTC))
+	server := newTestServerWithClock(t, store, clk)
+
+	// JWTs carry the issue time in whole seconds
+	server.config.TokenType = "jwt"
+	tokenMaker, err := token.NewMakerFromConfig(server.config, clk)
+	require.NoError(t, err)
+
+	authPath := "/auth"
+	server.router.GET(
+		authPath,
+		authMiddleware(tokenMaker, server.passwordChanges, server.sessions, nil),
+		func(ctx *gin.Context) {
+			ctx.JSON(http.StatusOK, gin.H{})
+		},
+	)
+
+	accessToken, payload, err := tokenMaker.CreateToken("user", time.Minute)
+	require.NoError(t, err)
+	require.True(t, clk.Now().Truncate(time.Second).Equal(payload.IssuedAt))
+
+	sendRequest := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, authPath, nil)
+		require.NoError(t, err)
+
+		request.Header.Set(authorizationHeaderKey, fmt.Sprintf("%s %s", authorizationTypeBearer, accessToken))
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// A token issued in the same second as the password change is not told apart from the ones issued after it
+	server.passwordChanges.set("user", clk.Now().Add(-100*time.Millisecond))
+	recorder := sendRequest()
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	server.passwordChanges.set("user", clk.Now().Add(400*time.Millisecond))
+	recorder = sendRequest()
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	server.passwordChanges.set("user", clk.Now().Add(500*time.Millisecond))
+	recorder = sendRequest()
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestAuthMiddlewareCachesSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clk := clock.NewFake(time.Now())
+	lastUsedAt := clk.Now().Add(-30 * time.Second)
+
+	// The session is looked up once per ttl, and written only once its last use is stale
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetUserPasswordChangedAt(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(time.Time{}, nil)
+	store.EXPECT().
+		GetSession(gomock.Any(), gomock.Any()).
+		Times(2).
+		DoAndReturn(func(_ any, id uuid.UUID) (db.Session, error) {
+			return db.Session{ID: id, LastUsedAt: lastUsedAt}, nil
+		})
+	store.EXPECT().
+		TouchSession(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ any, id uuid.UUID) (db.Session, error) {
+			lastUsedAt = clk.Now()
+			return db.Session{ID: id, LastUsedAt: lastUsedAt}, nil
+		})
+
+	server := newTestServerWithClock(t, store, clk)
+
+	authPath := "/auth"
+	server.router.GET(
+		authPath,
+		authMiddleware(server.tokenMaker, server.passwordChanges, server.sessions, nil),
+		func(ctx *gin.Context) {
+			ctx.JSON(http.StatusOK, gin.H{})
+		},
+	)
+
+	accessToken, payload, err := server.tokenMaker.CreateToken("user", time.Hour)
+	require.NoError(t, err)
+
+	sendRequest := func(status int) {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, authPath, nil)
+		require.NoError(t, err)
+
+		request.Header.Set(authorizationHeaderKey, fmt.Sprintf("%s %s", authorizationTypeBearer, accessToken))
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, status, recorder.Code)
+	}
+
+	// The session was used half a minute ago, it is looked up once and not written
+	sendRequest(http.StatusOK)
+	sendRequest(http.StatusOK)
+
+	// Once the entry expires the session is looked up again, its last use is stale by then and it is written
+	clk.Advance(time.Minute)
+	sendRequest(http.StatusOK)
+
+	// A sign-out through this server is effective right away, without looking up the session
+	server.sessions.forget(payload.ID)
+	sendRequest(http.StatusUnauthorized)
+}
+
+func TestSessionCacheRevokeDuringMiss(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clk := clock.NewFake(time.Now())
+	id := uuid.New()
+
+	// The session is revoked by this instance while a miss is loading it, the active session loaded before must not be cached
+	store := mockdb.NewMockStore(ctrl)
+	cache := newSessionCache(store, time.Minute, clk)
+	store.EXPECT().
+		GetSession(gomock.Any(), gomock.Eq(id)).
+		Times(1).
+		DoAndReturn(func(_ any, id uuid.UUID) (db.Session, error) {
+			cache.forget(id)
+			return db.Session{ID: id, LastUsedAt: clk.Now()}, nil
+		})
+
+	// The request which was already past the lookup goes through, the next ones are rejected without a query
+	require.NoError(t, cache.check(context.Background(), id))
+	require.ErrorIs(t, cache.check(context.Background(), id), errSessionRevoked)
+
+	clk.Advance(30 * time.Second)
+	require.ErrorIs(t, cache.check(context.Background(), id), errSessionRevoked)
+}
+
+func TestAuthMiddlewareAPIKey(t *testing.T) {
+	apiKey := apiKeyPrefix + util.RandomString(43)
+	key := db.GetAPIKeyForAuthRow{
+		ID:     util.RandomInt(1, 1000),
+		Scopes: []string{util.AccountsReadScope},
+		Owner:  util.RandomOwner(),
+	}
+
+	testCases := []struct {
+		name          string
+		acceptAPIKeys bool
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:          "OK",
+			acceptAPIKeys: true,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				request.Header.Set(authorizationHeaderKey, "ApiKey "+apiKey)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyForAuth(gomock.Any(), gomock.Eq(util.HashSecret(apiKey))).
+					Times(1).
+					Return(key, nil)
+				store.EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Eq(key.ID)).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), key.Owner)
+			},
+		},
+		{
+			name:          "MissingScope",
+			acceptAPIKeys: true,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				request.Header.Set(authorizationHeaderKey, "ApiKey "+apiKey)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				writeOnlyKey := key
+				writeOnlyKey.Scopes = []string{util.AccountsWriteScope}
+
+				store.EXPECT().
+					GetAPIKeyForAuth(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(writeOnlyKey, nil)
+				store.EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:          "UnknownKey",
+			acceptAPIKeys: true,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				request.Header.Set(authorizationHeaderKey, "ApiKey "+apiKey)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyForAuth(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.GetAPIKeyForAuthRow{}, db.ErrRecordNotFound)
+				store.EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:          "RevokedKey",
+			acceptAPIKeys: true,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				request.Header.Set(authorizationHeaderKey, "ApiKey "+apiKey)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				revokedKey := key
+				revokedKey.RevokedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+
+				store.EXPECT().
+					GetAPIKeyForAuth(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(revokedKey, nil)
+				store.EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:          "InternalError",
+			acceptAPIKeys: true,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				request.Header.Set(authorizationHeaderKey, "ApiKey "+apiKey)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyForAuth(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.GetAPIKeyForAuthRow{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name:          "UserOnlyRoute",
+			acceptAPIKeys: false,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				request.Header.Set(authorizationHeaderKey, "ApiKey "+apiKey)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyForAuth(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:          "BearerTokenWithoutScopes",
+			acceptAPIKeys: true,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubAuthentication(store)
+				store.EXPECT().
+					GetAPIKeyForAuth(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubSession(store)
+
+			server := newTestServer(t, store)
+
+			var apiKeys db.Querier
+			if tc.acceptAPIKeys {
+				apiKeys = store
+			}
+
+			authPath := "/auth"
+			server.router.GET(
+				authPath,
+				authMiddleware(server.tokenMaker, server.passwordChanges, server.sessions, apiKeys),
+				requireScope(util.AccountsReadScope),
+				func(ctx *gin.Context) {
+					authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+					ctx.JSON(http.StatusOK, gin.H{"username": authPayload.Username})
+				},
+			)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, authPath, nil)
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	testCases := []struct {
+		name           string
+		trustedProxies string
+		// remoteAddr is the address the requests of the first client come from
+		remoteAddr string
+		// forwardedFor returns the X-Forwarded-For header of the i-th request of the first client
+		forwardedFor func(i int) string
+	}{
+		{
+			name:         "NoProxy",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: func(i int) string { return "" },
+		},
+		{
+			// Without trusted proxies the header set by the client itself is ignored, it cannot reset its bucket
+			name:         "UntrustedForwardedFor",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: func(i int) string { return fmt.Sprintf("192.168.0.%d", i) },
+		},
+		{
+			name:           "TrustedProxy",
+			trustedProxies: "10.0.0.100, 10.0.1.0/24",
+			remoteAddr:     "10.0.0.100:1234",
+			forwardedFor:   func(i int) string { return "10.0.0.1" },
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, nil)
+			server.config.TrustedProxies = tc.trustedProxies
+			require.NoError(t, server.setupRouter())
+
+			limiter, err := ratelimit.NewMemoryLimiter(ratelimit.Rate{PerSecond: 0.5, Burst: 2}, server.clock)
+			require.NoError(t, err)
+
+			limitedPath := "/limited"
+			server.router.GET(
+				limitedPath,
+				rateLimitMiddleware(limiter, clientIPRateLimitKey),
+				func(ctx *gin.Context) {
+					ctx.JSON(http.StatusOK, gin.H{})
+				},
+			)
+
+			sendRequest := func(remoteAddr string, forwardedFor string) *httptest.ResponseRecorder {
+				recorder := httptest.NewRecorder()
+				request, err := http.NewRequest(http.MethodGet, limitedPath, nil)
+				require.NoError(t, err)
+
+				request.RemoteAddr = remoteAddr
+				if forwardedFor != "" {
+					request.Header.Set("X-Forwarded-For", forwardedFor)
+				}
+				server.router.ServeHTTP(recorder, request)
+				return recorder
+			}
+
+			for i := 0; i < 2; i++ {
+				recorder := sendRequest(tc.remoteAddr, tc.forwardedFor(i))
+				require.Equal(t, http.StatusOK, recorder.Code)
+			}
+
+			// The bucket is empty and it takes 2 seconds to refill one token
+			recorder := sendRequest(tc.remoteAddr, tc.forwardedFor(2))
+			require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			require.Equal(t, "2", recorder.Header().Get("Retry-After"))
+
+			// A client with a different IP is not affected
+			recorder = sendRequest("10.0.0.2:1234", "")
+			require.Equal(t, http.StatusOK, recorder.Code)
+		})
+	}
+}
+
+func TestInvalidTrustedProxies(t *testing.T) {
+	server := newTestServer(t, nil)
+	server.config.TrustedProxies = "10.0.0.1,not-an-ip"
+	require.Error(t, server.setupRouter())
+}
+
+func TestReadYourWritesMiddleware(t *testing.T) {
+	user, _ := randomUser(t)
+	account := randomAccount(user.Username)
+
+	testCases := []struct {
+		name         string
+		header       string
+		primaryReads bool
+	}{
+		{name: "NoHeader", header: "", primaryReads: false},
+		{name: "ReadYourWrites", header: "true", primaryReads: true},
+		{name: "Disabled", header: "false", primaryReads: false},
+		{name: "Invalid", header: "please", primaryReads: false},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// The store sees through the context of the handler whether the read may go to a replica
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().
+				GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+				Times(1).
+				DoAndReturn(func(ctx context.Context, id int64) (db.Account, error) {
+					require.Equal(t, tc.primaryReads, db.PrimaryReads(ctx))
+					return account, nil
+				})
+			stubAuthentication(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d", account.ID), nil)
+			require.NoError(t, err)
+			if tc.header != "" {
+				request.Header.Set(readYourWritesHeader, tc.header)
+			}
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusOK, recorder.Code)
+		})
+	}
+}
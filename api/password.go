@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/token"
+)
+
+// resetTokenSize is the number of random bytes in a password reset token
+const resetTokenSize = 32
+
+// forgotPasswordMessage is returned whether or not the email belongs to a user, so that the endpoint cannot be used to find out who has an account
+const forgotPasswordMessage = "if the email belongs to a user, a password reset token has been sent to it"
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// forgotPassword mails a password reset token to the user with the email
+// The user is looked up and the token is mailed only after the response has been sent,
+// so the response takes as long whether or not the email belongs to a user
+func (server *Server) forgotPassword(ctx *gin.Context) {
+	var req forgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	server.runInBackground(ctx, "send password reset token", func(ctx context.Context) error {
+		return server.sendPasswordResetToken(ctx, req.Email)
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+}
+
+// sendPasswordResetToken creates a password reset token of the user with the email and mails it, nothing is sent if there is no such user
+func (server *Server) sendPasswordResetToken(ctx context.Context, email string) error {
+	user, err := server.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+
+	// Only the hash of the token is stored, the token itself is known only to the owner of the mailbox
+	resetToken, err := util.GenerateSecret(resetTokenSize)
+	if err != nil {
+		return err
+	}
+
+	arg := db.CreatePasswordResetTokenParams{
+		Username:  user.Username,
+		TokenHash: util.HashSecret(resetToken),
+		ExpiresAt: server.clock.Now().Add(server.config.ResetTokenDuration),
+	}
+
+	_, err = server.store.CreatePasswordResetToken(ctx, arg)
+	if err != nil {
+		return err
+	}
+
+	subject := "Reset your Simple Bank password"
+	content := fmt.Sprintf(
+		"Hello %s,\n\nuse the token below to reset your password, it expires in %s:\n\n%s\n\nIf you didn't ask to reset your password, you can ignore this email.",
+		user.FullName,
+		server.config.ResetTokenDuration,
+		resetToken,
+	)
+
+	return server.mailer.SendEmail(ctx, user.Email, subject, content)
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+func (server *Server) resetPassword(ctx *gin.Context) {
+	var req resetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// The request has no username or email, so the user of the token is loaded to check the password against them
+	// The token is checked for expiry and use only in the transaction, which locks it
+	tokenHash := util.HashSecret(req.Token)
+	resetToken, err := server.store.GetPasswordResetToken(ctx, tokenHash)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(db.ErrInvalidResetToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	user, err := server.store.GetUser(ctx, resetToken.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if server.rejectWeakPassword(ctx, req.NewPassword, user.Username, user.Email) {
+		return
+	}
+
+	hashedPassword, err := server.passwordHasher.Hash(req.NewPassword)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	arg := db.ResetPasswordTxParams{
+		TokenHash:      tokenHash,
+		HashedPassword: hashedPassword,
+		Now:            server.clock.Now(),
+	}
+
+	result, err := server.store.ResetPasswordTx(ctx, arg)
+	if err != nil {
+		if err == db.ErrRecordNotFound || err == db.ErrInvalidResetToken {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(db.ErrInvalidResetToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.passwordChanges.set(result.User.Username, result.User.PasswordChangedAt)
+
+	ctx.JSON(http.StatusOK, newUserResponse(result.User))
+}
+
+type changePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// changePassword sets a new password of the authenticated user
+// All tokens issued before, including the one used for this request, are no longer accepted
+func (server *Server) changePassword(ctx *gin.Context) {
+	var req changePasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = util.CheckPassword(req.OldPassword, user.HashedPassword)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	// The request has no username or email, so the password is checked only now that the user is known
+	if server.rejectWeakPassword(ctx, req.NewPassword, user.Username, user.Email) {
+		return
+	}
+
+	hashedPassword, err := server.passwordHasher.Hash(req.NewPassword)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	arg := db.UpdateUserPasswordParams{
+		Username:          user.Username,
+		HashedPassword:    hashedPassword,
+		PasswordChangedAt: server.clock.Now(),
+	}
+
+	user, err = server.store.UpdateUserPassword(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.passwordChanges.set(user.Username, user.PasswordChangedAt)
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/igiai/simplebank/clock"
+	db "github.com/igiai/simplebank/db/sqlc"
+)
+
+type passwordChangeEntry struct {
+	changedAt time.Time
+	expiresAt time.Time
+}
+
+// passwordChangeCache keeps the time of the last password change of recently authenticated users,
+// so that authMiddleware doesn't have to query the db on every request
+// Changes made through another server instance are noticed at the latest after ttl
+type passwordChangeCache struct {
+	store       db.Store
+	ttl         time.Duration
+	clock       clock.Clock
+	mu          sync.Mutex
+	entries     map[string]passwordChangeEntry
+	lastCleanup time.Time
+}
+
+func newPasswordChangeCache(store db.Store, ttl time.Duration, clock clock.Clock) *passwordChangeCache {
+	return &passwordChangeCache{
+		store:       store,
+		ttl:         ttl,
+		clock:       clock,
+		entries:     make(map[string]passwordChangeEntry),
+		lastCleanup: clock.Now(),
+	}
+}
+
+// get returns the time the password of the user was last changed, loading it from the db when it isn't cached
+func (cache *passwordChangeCache) get(ctx context.Context, username string) (time.Time, error) {
+	now := cache.clock.Now()
+
+	cache.mu.Lock()
+	entry, ok := cache.entries[username]
+	cache.mu.Unlock()
+
+	if ok && now.Before(entry.expiresAt) {
+		return entry.changedAt, nil
+	}
+
+	// The lock is not held during the query, concurrent misses for the same user load the same value
+	changedAt, err := cache.store.GetUserPasswordChangedAt(ctx, username)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return cache.set(username, changedAt), nil
+}
+
+// set stores the time of a password change, it is called directly after the password is changed by this instance
+// The password only changes forward in time, so the later of the cached and the given time is kept and returned,
+// a miss which loaded the time before a change made meanwhile by this instance cannot bring back the older one
+func (cache *passwordChangeCache) set(username string, changedAt time.Time) time.Time {
+	if cache.ttl <= 0 {
+		return changedAt
+	}
+
+	now := cache.clock.Now()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.cleanup(now)
+	if entry, ok := cache.entries[username]; ok && entry.changedAt.After(changedAt) {
+		changedAt = entry.changedAt
+	}
+	cache.entries[username] = passwordChangeEntry{
+		changedAt: changedAt,
+		expiresAt: now.Add(cache.ttl),
+	}
+	return changedAt
+}
+
+// cleanup drops the expired entries, at most once per ttl
+func (cache *passwordChangeCache) cleanup(now time.Time) {
+	if now.Sub(cache.lastCleanup) < cache.ttl {
+		return
+	}
+
+	for username, entry := range cache.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(cache.entries, username)
+		}
+	}
+	cache.lastCleanup = now
+}
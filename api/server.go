@@ -1,75 +1,291 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
+	"github.com/igiai/simplebank/clock"
 	db "github.com/igiai/simplebank/db/sqlc"
 	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/mail"
+	"github.com/igiai/simplebank/ratelimit"
+	"github.com/igiai/simplebank/stream"
 	"github.com/igiai/simplebank/token"
 )
 
+// backgroundTaskTimeout bounds the work a request leaves to run after its response has been sent
+const backgroundTaskTimeout = time.Minute
+
 // Server serves HTTP requests for our banking service
 type Server struct {
-	config     util.Config
-	store      db.Store
-	tokenMaker token.Maker
-	router     *gin.Engine
+	config          util.Config
+	store           db.Store
+	tokenMaker      token.Maker
+	passwordHasher  util.PasswordHasher
+	passwordPolicy  util.PasswordPolicy
+	mailer          mail.Mailer
+	ipRateLimiter   ratelimit.Limiter
+	userRateLimiter ratelimit.Limiter
+	passwordChanges *passwordChangeCache
+	sessions        *sessionCache
+	broker          *stream.Broker
+	clock           clock.Clock
+	router          *gin.Engine
+	httpServer      *http.Server
+	shutdown        chan struct{}
+	background      sync.WaitGroup
 }
 
 // NewServer creates a new HTTP server and setup routing
-func NewServer(config util.Config, store db.Store) (*Server, error) {
-	tokenMaker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
+// The broker is fed with the transfers by its listener, the server only subscribes the clients of the account streams
+// The expiry of the tokens, codes and lockouts is set and checked with the time of the clock
+func NewServer(config util.Config, store db.Store, mailer mail.Mailer, broker *stream.Broker, clock clock.Clock) (*Server, error) {
+	tokenMaker, err := token.NewMakerFromConfig(config, clock)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create token maker: %w", err)
 	}
 
+	passwordHasher, err := util.NewPasswordHasher(config.PasswordHasher)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create password hasher: %w", err)
+	}
+
+	ipRateLimiter, err := newRateLimiter(config.RateLimitBackend, store, clock, clientIPRateLimitKeyPrefix, config.IPRateLimit, config.IPRateLimitBurst)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create ip rate limiter: %w", err)
+	}
+
+	userRateLimiter, err := newRateLimiter(config.RateLimitBackend, store, clock, usernameRateLimitKeyPrefix, config.UserRateLimit, config.UserRateLimitBurst)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create user rate limiter: %w", err)
+	}
+
 	server := &Server{
-		config:     config,
-		store:      store,
-		tokenMaker: tokenMaker,
+		config:         config,
+		store:          store,
+		tokenMaker:     tokenMaker,
+		passwordHasher: passwordHasher,
+		passwordPolicy: util.PasswordPolicy{
+			MinLength:           config.PasswordMinLength,
+			MaxLength:           config.PasswordMaxLength,
+			MinCharacterClasses: config.PasswordMinCharacterClasses,
+		},
+		mailer:          mailer,
+		ipRateLimiter:   ipRateLimiter,
+		userRateLimiter: userRateLimiter,
+		passwordChanges: newPasswordChangeCache(store, config.PasswordChangeCacheTTL, clock),
+		sessions:        newSessionCache(store, config.SessionCacheTTL, clock),
+		broker:          broker,
+		clock:           clock,
+		shutdown:        make(chan struct{}),
 	}
 
 	// here we register custom validators
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		v.RegisterValidation("currency", validCurrency)
+		v.RegisterValidation("scope", validScope)
+		v.RegisterValidation("event_type", validEventType)
+		v.RegisterValidation("webhook_url", validWebhookURL)
 	}
 
-	server.setupRouter()
+	if err := server.setupRouter(); err != nil {
+		return nil, fmt.Errorf("cannot setup router: %w", err)
+	}
+	server.httpServer = &http.Server{Handler: server.router}
 
 	return server, nil
 }
 
-func (server *Server) setupRouter() {
+func (server *Server) setupRouter() error {
 	router := gin.Default()
+	// The client IP is read from X-Forwarded-For only when the request comes from one of the configured proxies,
+	// otherwise a client could pick a new IP for every request and never run out of its rate limit
+	if err := router.SetTrustedProxies(trustedProxies(server.config.TrustedProxies)); err != nil {
+		return err
+	}
+	// The handlers pass their gin context to the store, which has to see the values of the request context
+	router.ContextWithFallback = true
+	router.Use(readYourWritesMiddleware)
 
 	// These endpoints don't require authentication middleware
 	// because everyone should be able to create user and login
-	router.POST("/users", server.createUser)
-	router.POST("/users/login", server.loginUser)
+	// There is no user known yet, so they are rate limited by the client IP
+	publicRoutes := router.Group("/")
+	if server.ipRateLimiter != nil {
+		publicRoutes.Use(rateLimitMiddleware(server.ipRateLimiter, clientIPRateLimitKey))
+	}
+
+	publicRoutes.POST("/users", server.createUser)
+	publicRoutes.POST("/users/login", server.loginUser)
+	publicRoutes.POST("/users/login/mfa", server.loginUserMFA)
+	publicRoutes.POST("/users/password/forgot", server.forgotPassword)
+	publicRoutes.POST("/users/password/reset", server.resetPassword)
+	publicRoutes.GET("/users/verify_email", server.verifyEmail)
+	publicRoutes.GET("/tokens/public_key", server.getTokenPublicKey)
+	publicRoutes.GET("/.well-known/jwks.json", server.getJSONWebKeySet)
 
 	// Here we define a group of routes that should have an authentication middleware
-	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker))
+	// They manage the user itself, so they are open only to users logged in with an access token
+	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker, server.passwordChanges, server.sessions, nil))
+	if server.userRateLimiter != nil {
+		authRoutes.Use(rateLimitMiddleware(server.userRateLimiter, usernameRateLimitKey))
+	}
+
+	authRoutes.POST("/users/password/change", server.changePassword)
+	authRoutes.POST("/users/verify_email/resend", server.resendVerifyEmail)
+	authRoutes.POST("/users/totp/enroll", server.enrollTOTP)
+	authRoutes.POST("/users/totp/confirm", server.confirmTOTP)
+	authRoutes.POST("/users/:username/unlock", server.unlockUser)
+	authRoutes.GET("/users/me/sessions", server.listSessions)
+	authRoutes.DELETE("/users/me/sessions/:id", server.revokeSession)
+
+	authRoutes.POST("/service_accounts", server.createServiceAccount)
+	authRoutes.GET("/service_accounts", server.listServiceAccounts)
+	authRoutes.POST("/service_accounts/:id/api_keys", server.createAPIKey)
+	authRoutes.GET("/service_accounts/:id/api_keys", server.listAPIKeys)
+	authRoutes.DELETE("/service_accounts/:id/api_keys/:key_id", server.revokeAPIKey)
+
+	authRoutes.POST("/webhooks", server.createWebhook)
+	authRoutes.GET("/webhooks", server.listWebhooks)
+	authRoutes.DELETE("/webhooks/:id", server.deleteWebhook)
+	authRoutes.GET("/webhooks/:id/deliveries", server.listWebhookDeliveries)
+	authRoutes.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", server.redeliverWebhook)
+
+	// Service accounts reach these routes with api keys too, each route requires its scope from the key
+	scopedRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker, server.passwordChanges, server.sessions, server.store))
+	if server.userRateLimiter != nil {
+		scopedRoutes.Use(rateLimitMiddleware(server.userRateLimiter, usernameRateLimitKey))
+	}
 
-	authRoutes.POST("/accounts", server.createAccount)
-	authRoutes.GET("/accounts/:id", server.getAccount)
-	authRoutes.GET("/accounts", server.listAccount)
-	authRoutes.DELETE("/accounts/:id", server.deleteAccount)
+	// Money can be moved only by users who have proven they own their email
+	scopedRoutes.POST("/accounts", requireScope(util.AccountsWriteScope), server.requireVerifiedEmail, server.createAccount)
+	scopedRoutes.GET("/accounts/stream", requireScope(util.AccountsReadScope), server.streamAccounts)
+	scopedRoutes.GET("/accounts/:id", requireScope(util.AccountsReadScope), server.getAccount)
+	scopedRoutes.GET("/accounts", requireScope(util.AccountsReadScope), server.listAccount)
+	scopedRoutes.DELETE("/accounts/:id", requireScope(util.AccountsWriteScope), server.deleteAccount)
 
-	authRoutes.POST("/transfers", server.createTransfer)
+	scopedRoutes.POST("/transfers", requireScope(util.TransfersWriteScope), server.requireVerifiedEmail, server.createTransfer)
 
 	server.router = router
+	return nil
+}
 
+// trustedProxies returns the comma separated IPs and CIDRs of the proxies, nil when there are none so that no proxy is trusted
+func trustedProxies(proxies string) []string {
+	var trusted []string
+	for _, proxy := range strings.Split(proxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trusted = append(trusted, proxy)
+		}
+	}
+	return trusted
 }
 
-// Start runs the HTTP server on a specific address
+// newRateLimiter creates a rate limiter with the configured backend
+// It returns nil when the rate is not set, in which case requests are not limited
+// All the keys given to the limiter start with keyPrefix
+func newRateLimiter(backend string, store db.Store, clock clock.Clock, keyPrefix string, perSecond float64, burst int) (ratelimit.Limiter, error) {
+	if perSecond <= 0 {
+		return nil, nil
+	}
+
+	rate := ratelimit.Rate{
+		PerSecond: perSecond,
+		Burst:     burst,
+	}
+
+	switch backend {
+	case "", "memory":
+		return ratelimit.NewMemoryLimiter(rate, clock)
+	case "postgres":
+		return ratelimit.NewPostgresLimiter(store, rate, keyPrefix)
+	}
+	return nil, fmt.Errorf("unsupported rate limit backend %s", backend)
+}
+
+// Start runs the HTTP server on a specific address until it is shut down
 func (server *Server) Start(address string) error {
-	return server.router.Run(address)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	err = server.httpServer.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops the server gracefully, it must be called only once
+// No new connections are accepted and the account streams are ended, then it waits until ctx is done
+// for the requests in flight to finish and for the background tasks they left, e.g. the password reset emails
+func (server *Server) Shutdown(ctx context.Context) error {
+	close(server.shutdown)
+
+	// Once the requests have finished no background task can be added anymore
+	if err := server.httpServer.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		server.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runInBackground runs the task of a request once its handler has returned, the failures of the task are only logged
+// The task keeps the values of the request context, e.g. the reads from the primary, but not its cancellation
+func (server *Server) runInBackground(ctx *gin.Context, name string, task func(ctx context.Context) error) {
+	taskCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx.Request.Context()), backgroundTaskTimeout)
+
+	server.background.Add(1)
+	go func() {
+		defer server.background.Done()
+		defer cancel()
+
+		if err := task(taskCtx); err != nil {
+			log.Printf("cannot %s: %v", name, err)
+		}
+	}()
 }
 
 // gin.H is a placeholder for whatever key-value data
 func errorResponse(err error) gin.H {
 	return gin.H{"error": err.Error()}
 }
+
+// rejectWeakPassword responds with the broken rules of the password policy and returns true if the password breaks any
+// The username and email of the user are passed as userInputs, the password must not contain them
+func (server *Server) rejectWeakPassword(ctx *gin.Context, password string, userInputs ...string) bool {
+	err := server.passwordPolicy.Check(password, userInputs...)
+	if err == nil {
+		return false
+	}
+
+	rsp := errorResponse(err)
+	var policyErr *util.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		rsp["password_policy_violations"] = policyErr.Reasons
+	}
+	ctx.JSON(http.StatusBadRequest, rsp)
+	return true
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/token"
+)
+
+const (
+	// apiKeyPrefix starts every api key, so leaked keys are easy to recognize
+	apiKeyPrefix = "sbk_"
+	// apiKeySize is the number of random bytes in an api key
+	apiKeySize = 32
+	// apiKeyDisplayLength is the number of leading characters of an api key kept to tell the keys apart in listings
+	apiKeyDisplayLength = 12
+)
+
+var errServiceAccountNotOwned = errors.New("service account does not belong to the authenticated user")
+
+type createServiceAccountRequest struct {
+	Name string `json:"name" binding:"required,alphanum"`
+}
+
+// createServiceAccount creates a service account acting on the accounts of the authenticated user
+func (server *Server) createServiceAccount(ctx *gin.Context) {
+	var req createServiceAccountRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	arg := db.CreateServiceAccountParams{
+		Owner: authPayload.Username,
+		Name:  req.Name,
+	}
+
+	serviceAccount, err := server.store.CreateServiceAccount(ctx, arg)
+	if err != nil {
+		switch db.ErrorCode(err) {
+		case db.ForeignKeyViolation, db.UniqueViolation:
+			ctx.JSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, serviceAccount)
+}
+
+func (server *Server) listServiceAccounts(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	serviceAccounts, err := server.store.ListServiceAccounts(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, serviceAccounts)
+}
+
+type serviceAccountRequest struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+// getOwnedServiceAccount loads the service account of the uri and checks it belongs to the authenticated user
+// It writes the error response itself, so the caller only has to return when it fails
+func (server *Server) getOwnedServiceAccount(ctx *gin.Context) (db.ServiceAccount, bool) {
+	var req serviceAccountRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return db.ServiceAccount{}, false
+	}
+
+	serviceAccount, err := server.store.GetServiceAccount(ctx, req.ID)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return db.ServiceAccount{}, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return db.ServiceAccount{}, false
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if serviceAccount.Owner != authPayload.Username {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errServiceAccountNotOwned))
+		return db.ServiceAccount{}, false
+	}
+
+	return serviceAccount, true
+}
+
+// apiKeyResponse leaves out the hash of the key
+type apiKeyResponse struct {
+	ID               int64      `json:"id"`
+	ServiceAccountID int64      `json:"service_account_id"`
+	KeyPrefix        string     `json:"key_prefix"`
+	Scopes           []string   `json:"scopes"`
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+func newAPIKeyResponse(apiKey db.ApiKey) apiKeyResponse {
+	rsp := apiKeyResponse{
+		ID:               apiKey.ID,
+		ServiceAccountID: apiKey.ServiceAccountID,
+		KeyPrefix:        apiKey.KeyPrefix,
+		Scopes:           apiKey.Scopes,
+		CreatedAt:        apiKey.CreatedAt,
+	}
+	if apiKey.LastUsedAt.Valid {
+		rsp.LastUsedAt = &apiKey.LastUsedAt.Time
+	}
+	if apiKey.RevokedAt.Valid {
+		rsp.RevokedAt = &apiKey.RevokedAt.Time
+	}
+	return rsp
+}
+
+type createAPIKeyRequest struct {
+	Scopes []string `json:"scopes" binding:"required,min=1,unique,dive,scope"`
+}
+
+type createAPIKeyResponse struct {
+	APIKey string         `json:"api_key"`
+	Key    apiKeyResponse `json:"key"`
+}
+
+// createAPIKey creates a long-lived api key of the service account limited to the requested scopes
+// The key is returned only once, the db keeps just its hash
+func (server *Server) createAPIKey(ctx *gin.Context) {
+	serviceAccount, ok := server.getOwnedServiceAccount(ctx)
+	if !ok {
+		return
+	}
+
+	var req createAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	secret, err := util.GenerateSecret(apiKeySize)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	apiKey := apiKeyPrefix + secret
+
+	arg := db.CreateAPIKeyParams{
+		ServiceAccountID: serviceAccount.ID,
+		KeyPrefix:        apiKey[:apiKeyDisplayLength],
+		KeyHash:          util.HashSecret(apiKey),
+		Scopes:           req.Scopes,
+	}
+
+	key, err := server.store.CreateAPIKey(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := createAPIKeyResponse{
+		APIKey: apiKey,
+		Key:    newAPIKeyResponse(key),
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+func (server *Server) listAPIKeys(ctx *gin.Context) {
+	serviceAccount, ok := server.getOwnedServiceAccount(ctx)
+	if !ok {
+		return
+	}
+
+	keys, err := server.store.ListAPIKeys(ctx, serviceAccount.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := make([]apiKeyResponse, len(keys))
+	for i, key := range keys {
+		rsp[i] = newAPIKeyResponse(key)
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type revokeAPIKeyRequest struct {
+	KeyID int64 `uri:"key_id" binding:"required,min=1"`
+}
+
+// revokeAPIKey revokes the api key right away, requests with it are rejected from then on
+func (server *Server) revokeAPIKey(ctx *gin.Context) {
+	serviceAccount, ok := server.getOwnedServiceAccount(ctx)
+	if !ok {
+		return
+	}
+
+	var req revokeAPIKeyRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	arg := db.RevokeAPIKeyParams{
+		ID:               req.KeyID,
+		ServiceAccountID: serviceAccount.ID,
+	}
+
+	key, err := server.store.RevokeAPIKey(ctx, arg)
+	if err != nil {
+		// Unknown keys, keys of other service accounts and revoked keys are all not found
+		if err == db.ErrRecordNotFound {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newAPIKeyResponse(key))
+}
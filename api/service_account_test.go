@@ -0,0 +1,599 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/igiai/simplebank/db/mock"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/token"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateServiceAccountAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	serviceAccount := randomServiceAccount(user.Username)
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"name": serviceAccount.Name},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.CreateServiceAccountParams{
+					Owner: user.Username,
+					Name:  serviceAccount.Name,
+				}
+
+				store.EXPECT().
+					CreateServiceAccount(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(serviceAccount, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchServiceAccount(t, recorder.Body, serviceAccount)
+			},
+		},
+		{
+			name: "DuplicateName",
+			body: gin.H{"name": serviceAccount.Name},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateServiceAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ServiceAccount{}, &pgconn.PgError{Code: db.UniqueViolation})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidName",
+			body: gin.H{"name": "batch job"},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateServiceAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "APIKeyAuthorization",
+			body: gin.H{"name": serviceAccount.Name},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				request.Header.Set(authorizationHeaderKey, "ApiKey "+apiKeyPrefix+util.RandomString(43))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyForAuth(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateServiceAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			body: gin.H{"name": serviceAccount.Name},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateServiceAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ServiceAccount{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthentication(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/service_accounts", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestListServiceAccountsAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	serviceAccounts := []db.ServiceAccount{
+		randomServiceAccount(user.Username),
+		randomServiceAccount(user.Username),
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		ListServiceAccounts(gomock.Any(), gomock.Eq(user.Username)).
+		Times(1).
+		Return(serviceAccounts, nil)
+	stubAuthentication(store)
+
+	server := newTestServer(t, store)
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest(http.MethodGet, "/service_accounts", nil)
+	require.NoError(t, err)
+
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var gotServiceAccounts []db.ServiceAccount
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &gotServiceAccounts))
+	require.Equal(t, serviceAccounts, gotServiceAccounts)
+}
+
+func TestCreateAPIKeyAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	serviceAccount := randomServiceAccount(user.Username)
+	scopes := []string{util.AccountsReadScope, util.TransfersWriteScope}
+
+	testCases := []struct {
+		name             string
+		serviceAccountID int64
+		body             gin.H
+		setupAuth        func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs       func(store *mockdb.MockStore)
+		checkResponse    func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:             "OK",
+			serviceAccountID: serviceAccount.ID,
+			body:             gin.H{"scopes": scopes},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetServiceAccount(gomock.Any(), gomock.Eq(serviceAccount.ID)).
+					Times(1).
+					Return(serviceAccount, nil)
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.CreateAPIKeyParams) (db.ApiKey, error) {
+						require.Equal(t, serviceAccount.ID, arg.ServiceAccountID)
+						require.Equal(t, scopes, arg.Scopes)
+						return db.ApiKey{
+							ID:               util.RandomInt(1, 1000),
+							ServiceAccountID: arg.ServiceAccountID,
+							KeyPrefix:        arg.KeyPrefix,
+							KeyHash:          arg.KeyHash,
+							Scopes:           arg.Scopes,
+							CreatedAt:        time.Now(),
+						}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.NotContains(t, recorder.Body.String(), "key_hash")
+
+				var rsp createAPIKeyResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+				require.True(t, strings.HasPrefix(rsp.APIKey, apiKeyPrefix))
+				require.True(t, strings.HasPrefix(rsp.APIKey, rsp.Key.KeyPrefix))
+				require.Equal(t, scopes, rsp.Key.Scopes)
+				require.Nil(t, rsp.Key.RevokedAt)
+			},
+		},
+		{
+			name:             "UnsupportedScope",
+			serviceAccountID: serviceAccount.ID,
+			body:             gin.H{"scopes": []string{util.AccountsReadScope, "users:write"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetServiceAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(serviceAccount, nil)
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:             "NoScopes",
+			serviceAccountID: serviceAccount.ID,
+			body:             gin.H{"scopes": []string{}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetServiceAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(serviceAccount, nil)
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:             "NotOwner",
+			serviceAccountID: serviceAccount.ID,
+			body:             gin.H{"scopes": scopes},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "unauthorized_user", time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetServiceAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(serviceAccount, nil)
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:             "ServiceAccountNotFound",
+			serviceAccountID: serviceAccount.ID,
+			body:             gin.H{"scopes": scopes},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetServiceAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ServiceAccount{}, db.ErrRecordNotFound)
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:             "InvalidID",
+			serviceAccountID: 0,
+			body:             gin.H{"scopes": scopes},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetServiceAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthentication(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := fmt.Sprintf("/service_accounts/%d/api_keys", tc.serviceAccountID)
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestListAPIKeysAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	serviceAccount := randomServiceAccount(user.Username)
+	key := randomAPIKey(serviceAccount.ID)
+	key.LastUsedAt = pgtype.Timestamptz{Time: time.Now().UTC().Truncate(time.Second), Valid: true}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetServiceAccount(gomock.Any(), gomock.Eq(serviceAccount.ID)).
+		Times(1).
+		Return(serviceAccount, nil)
+	store.EXPECT().
+		ListAPIKeys(gomock.Any(), gomock.Eq(serviceAccount.ID)).
+		Times(1).
+		Return([]db.ApiKey{key}, nil)
+	stubAuthentication(store)
+
+	server := newTestServer(t, store)
+	recorder := httptest.NewRecorder()
+
+	url := fmt.Sprintf("/service_accounts/%d/api_keys", serviceAccount.ID)
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NotContains(t, recorder.Body.String(), key.KeyHash)
+
+	var gotKeys []apiKeyResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &gotKeys))
+	require.Len(t, gotKeys, 1)
+	require.Equal(t, key.ID, gotKeys[0].ID)
+	require.Equal(t, key.KeyPrefix, gotKeys[0].KeyPrefix)
+	require.Equal(t, key.Scopes, gotKeys[0].Scopes)
+	require.NotNil(t, gotKeys[0].LastUsedAt)
+	require.WithinDuration(t, key.LastUsedAt.Time, *gotKeys[0].LastUsedAt, time.Second)
+	require.Nil(t, gotKeys[0].RevokedAt)
+}
+
+func TestRevokeAPIKeyAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	serviceAccount := randomServiceAccount(user.Username)
+	key := randomAPIKey(serviceAccount.ID)
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.RevokeAPIKeyParams{
+					ID:               key.ID,
+					ServiceAccountID: serviceAccount.ID,
+				}
+
+				revokedKey := key
+				revokedKey.RevokedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+
+				store.EXPECT().
+					RevokeAPIKey(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(revokedKey, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp apiKeyResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+				require.Equal(t, key.ID, rsp.ID)
+				require.NotNil(t, rsp.RevokedAt)
+			},
+		},
+		{
+			name: "NotFound",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					RevokeAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ApiKey{}, db.ErrRecordNotFound)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					RevokeAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ApiKey{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().
+				GetServiceAccount(gomock.Any(), gomock.Eq(serviceAccount.ID)).
+				Times(1).
+				Return(serviceAccount, nil)
+			tc.buildStubs(store)
+			stubAuthentication(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/service_accounts/%d/api_keys/%d", serviceAccount.ID, key.ID)
+			request, err := http.NewRequest(http.MethodDelete, url, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestAPIKeyScopedRoutes(t *testing.T) {
+	user, _ := randomUser(t)
+	account := randomAccount(user.Username)
+	apiKey := apiKeyPrefix + util.RandomString(43)
+
+	testCases := []struct {
+		name          string
+		scopes        []string
+		method        string
+		url           string
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "ReadScope",
+			scopes: []string{util.AccountsReadScope},
+			method: http.MethodGet,
+			url:    fmt.Sprintf("/accounts/%d", account.ID),
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchAccount(t, recorder.Body, account)
+			},
+		},
+		{
+			name:   "WriteScopeOnly",
+			scopes: []string{util.AccountsWriteScope},
+			method: http.MethodGet,
+			url:    fmt.Sprintf("/accounts/%d", account.ID),
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "TransferWithoutScope",
+			scopes: []string{util.AccountsReadScope, util.AccountsWriteScope},
+			method: http.MethodPost,
+			url:    "/transfers",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().
+				GetAPIKeyForAuth(gomock.Any(), gomock.Eq(util.HashSecret(apiKey))).
+				Times(1).
+				Return(db.GetAPIKeyForAuthRow{ID: 1, Scopes: tc.scopes, Owner: user.Username}, nil)
+			store.EXPECT().
+				TouchAPIKey(gomock.Any(), gomock.Any()).
+				Times(1).
+				Return(nil)
+			store.EXPECT().
+				GetAccount(gomock.Any(), gomock.Any()).
+				AnyTimes().
+				Return(account, nil)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(tc.method, tc.url, nil)
+			require.NoError(t, err)
+
+			request.Header.Set(authorizationHeaderKey, "ApiKey "+apiKey)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func randomServiceAccount(owner string) db.ServiceAccount {
+	return db.ServiceAccount{
+		ID:    util.RandomInt(1, 1000),
+		Owner: owner,
+		Name:  util.RandomString(8),
+	}
+}
+
+func randomAPIKey(serviceAccountID int64) db.ApiKey {
+	return db.ApiKey{
+		ID:               util.RandomInt(1, 1000),
+		ServiceAccountID: serviceAccountID,
+		KeyPrefix:        apiKeyPrefix + util.RandomString(8),
+		KeyHash:          util.HashSecret(util.RandomString(32)),
+		Scopes:           []string{util.AccountsReadScope},
+	}
+}
+
+func requireBodyMatchServiceAccount(t *testing.T, body *bytes.Buffer, serviceAccount db.ServiceAccount) {
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+
+	var gotServiceAccount db.ServiceAccount
+	err = json.Unmarshal(data, &gotServiceAccount)
+	require.NoError(t, err)
+	require.Equal(t, serviceAccount, gotServiceAccount)
+}
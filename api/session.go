@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/token"
+)
+
+// sessionResponse describes the device of a session, Current marks the session of the request itself
+type sessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	ClientIP   string    `json:"client_ip"`
+	Current    bool      `json:"current"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func newSessionResponse(session db.Session, currentID uuid.UUID) sessionResponse {
+	return sessionResponse{
+		ID:         session.ID,
+		UserAgent:  session.UserAgent,
+		ClientIP:   session.ClientIp,
+		Current:    session.ID == currentID,
+		ExpiresAt:  session.ExpiresAt,
+		LastUsedAt: session.LastUsedAt,
+		CreatedAt:  session.CreatedAt,
+	}
+}
+
+// listSessions lists the devices the authenticated user is signed in on
+func (server *Server) listSessions(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	sessions, err := server.store.ListActiveSessions(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		rsp[i] = newSessionResponse(session, authPayload.ID)
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type revokeSessionRequest struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
+
+// revokeSession signs the authenticated user out of one of their devices
+// Access tokens of the session are rejected from then on, even before they expire,
+// by the other server instances once the session drops out of their cache
+func (server *Server) revokeSession(ctx *gin.Context) {
+	var req revokeSessionRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	arg := db.RevokeSessionParams{
+		ID:       uuid.MustParse(req.ID),
+		Username: authPayload.Username,
+	}
+
+	// Sessions of other users are reported as missing, so their ids cannot be probed
+	session, err := server.store.RevokeSession(ctx, arg)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.sessions.forget(session.ID)
+
+	ctx.JSON(http.StatusOK, newSessionResponse(session, authPayload.ID))
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/igiai/simplebank/clock"
+	db "github.com/igiai/simplebank/db/sqlc"
+)
+
+// sessionTouchInterval is how stale the last use of a session gets before it is written again,
+// the list of sessions only needs it to tell the devices apart
+const sessionTouchInterval = time.Minute
+
+type sessionEntry struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+// sessionCache remembers the sessions recently found active, so that authMiddleware doesn't have to query the db on every request
+// Sessions revoked through another server instance are noticed at the latest after ttl
+type sessionCache struct {
+	store       db.Querier
+	ttl         time.Duration
+	clock       clock.Clock
+	mu          sync.Mutex
+	entries     map[uuid.UUID]sessionEntry
+	lastCleanup time.Time
+}
+
+func newSessionCache(store db.Querier, ttl time.Duration, clock clock.Clock) *sessionCache {
+	return &sessionCache{
+		store:       store,
+		ttl:         ttl,
+		clock:       clock,
+		entries:     make(map[uuid.UUID]sessionEntry),
+		lastCleanup: clock.Now(),
+	}
+}
+
+// check returns errSessionRevoked when the session has been signed out or doesn't exist
+// The last use of the session is written only when it is older than sessionTouchInterval
+func (cache *sessionCache) check(ctx context.Context, id uuid.UUID) error {
+	now := cache.clock.Now()
+
+	cache.mu.Lock()
+	entry, ok := cache.entries[id]
+	cache.mu.Unlock()
+
+	if ok && now.Before(entry.expiresAt) {
+		if entry.revoked {
+			return errSessionRevoked
+		}
+		return nil
+	}
+
+	session, err := cache.store.GetSession(ctx, id)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			return errSessionRevoked
+		}
+		return err
+	}
+
+	if session.RevokedAt.Valid {
+		return errSessionRevoked
+	}
+
+	if now.Sub(session.LastUsedAt) >= sessionTouchInterval {
+		// The session may be revoked in between, then the touch doesn't find it
+		_, err = cache.store.TouchSession(ctx, id)
+		if err != nil {
+			if err == db.ErrRecordNotFound {
+				return errSessionRevoked
+			}
+			return err
+		}
+	}
+
+	cache.set(id, now)
+	return nil
+}
+
+// forget marks the session as revoked, it is called directly after the session is revoked by this instance
+// The mark is kept for ttl, so that a miss which loaded the session before it was revoked cannot cache it as active again
+func (cache *sessionCache) forget(id uuid.UUID) {
+	if cache.ttl <= 0 {
+		return
+	}
+
+	now := cache.clock.Now()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.cleanup(now)
+	cache.entries[id] = sessionEntry{revoked: true, expiresAt: now.Add(cache.ttl)}
+}
+
+// set caches the session as active, unless it has been revoked meanwhile
+func (cache *sessionCache) set(id uuid.UUID, now time.Time) {
+	if cache.ttl <= 0 {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.cleanup(now)
+	if entry, ok := cache.entries[id]; ok && entry.revoked && now.Before(entry.expiresAt) {
+		return
+	}
+	cache.entries[id] = sessionEntry{expiresAt: now.Add(cache.ttl)}
+}
+
+// cleanup drops the expired entries, at most once per ttl
+func (cache *sessionCache) cleanup(now time.Time) {
+	if now.Sub(cache.lastCleanup) < cache.ttl {
+		return
+	}
+
+	for id, entry := range cache.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(cache.entries, id)
+		}
+	}
+	cache.lastCleanup = now
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/igiai/simplebank/token"
+)
+
+// streamAccounts streams the balance changes and transfers of the accounts of the user as Server-Sent Events
+// The stream is open until the client disconnects, browsers' EventSource reconnects on its own when the server ends it
+// It ends when the access token expires, and when the token or api key is found revoked on a heartbeat,
+// so the client has to authenticate again like it would for any other request
+// It ends as well when the server shuts down, so the client reconnects to another instance
+func (server *Server) streamAccounts(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	keyHash := ctx.GetString(authorizationAPIKeyHashKey)
+
+	// API keys don't expire, only the streams of access tokens have a deadline
+	var expired <-chan time.Time
+	if keyHash == "" {
+		expiry := time.NewTimer(authPayload.ExpiredAt.Sub(server.clock.Now()))
+		defer expiry.Stop()
+		expired = expiry.C
+	}
+
+	subscription := server.broker.Subscribe(authPayload.Username)
+	defer subscription.Close()
+
+	// The headers are sent right away, so the client knows it is subscribed before the first event
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	// Proxies buffering the response would hold the events back
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.WriteHeaderNow()
+	ctx.Writer.Flush()
+
+	heartbeat := time.NewTicker(server.config.StreamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Request.Context().Done():
+			return false
+		case <-server.shutdown:
+			return false
+		case message, ok := <-subscription.Messages():
+			if !ok {
+				return false
+			}
+			ctx.SSEvent(message.Event, message.Data)
+			return true
+		case <-expired:
+			return false
+		case <-heartbeat.C:
+			if err := server.checkStreamAuthorization(ctx, authPayload, keyHash); err != nil {
+				return false
+			}
+			// A comment line keeps idle connections from being closed by proxies
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			return err == nil
+		}
+	})
+}
+
+// checkStreamAuthorization checks again that the credentials the stream was opened with have not been revoked since
+func (server *Server) checkStreamAuthorization(ctx context.Context, authPayload *token.Payload, keyHash string) error {
+	if keyHash != "" {
+		_, err := checkAPIKey(ctx, server.store, keyHash)
+		return err
+	}
+	return checkRevocation(ctx, server.passwordChanges, server.sessions, authPayload)
+}
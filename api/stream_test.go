@@ -0,0 +1,241 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/igiai/simplebank/db/mock"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/stream"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+// serverSentEvent is a single event read from a stream
+type serverSentEvent struct {
+	Event string
+	Data  string
+}
+
+// readServerSentEvent reads the next event of the stream, skipping the comments
+func readServerSentEvent(t *testing.T, reader *bufio.Reader) serverSentEvent {
+	var event serverSentEvent
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if event.Event != "" {
+				return event
+			}
+		case strings.HasPrefix(line, "event:"):
+			event.Event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			event.Data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+}
+
+func TestStreamAccountsAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user, _ := randomUser(t)
+	otherUser, _ := randomUser(t)
+
+	store := mockdb.NewMockStore(ctrl)
+	stubAuthentication(store)
+
+	server := newTestServer(t, store)
+	httpServer := httptest.NewServer(server.router)
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/accounts/stream", nil)
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	// The headers are sent once the client is subscribed, so the transfers published now reach it
+	// The transfer between other users must not show up in the stream
+	currency := util.RandomCurrency()
+	server.broker.PublishTransfer(db.TransferNotification{
+		Transfer:    db.Transfer{ID: 1, FromAccountID: 1, ToAccountID: 2, Amount: 10},
+		FromAccount: randomAccount(otherUser.Username),
+		ToAccount:   randomAccount(util.RandomOwner()),
+	})
+
+	fromAccount := randomAccount(otherUser.Username)
+	toAccount := randomAccount(user.Username)
+	toAccount.Currency = currency
+	notification := db.TransferNotification{
+		Transfer:    db.Transfer{ID: 2, FromAccountID: fromAccount.ID, ToAccountID: toAccount.ID, Amount: 10},
+		FromAccount: fromAccount,
+		ToAccount:   toAccount,
+	}
+	server.broker.PublishTransfer(notification)
+
+	reader := bufio.NewReader(response.Body)
+
+	event := readServerSentEvent(t, reader)
+	require.Equal(t, stream.IncomingTransferEvent, event.Event)
+
+	var transferData stream.TransferData
+	err = json.Unmarshal([]byte(event.Data), &transferData)
+	require.NoError(t, err)
+	require.Equal(t, notification.Transfer.ID, transferData.Transfer.ID)
+	require.Equal(t, toAccount.ID, transferData.Account.ID)
+
+	event = readServerSentEvent(t, reader)
+	require.Equal(t, stream.BalanceEvent, event.Event)
+
+	var balanceData stream.BalanceData
+	err = json.Unmarshal([]byte(event.Data), &balanceData)
+	require.NoError(t, err)
+	require.Equal(t, stream.BalanceData{AccountID: toAccount.ID, Balance: toAccount.Balance, Currency: currency}, balanceData)
+}
+
+func TestStreamAccountsAPIUnauthorized(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, store)
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest(http.MethodGet, "/accounts/stream", nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestStreamAccountsAPIEndsWhenTokenExpires(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	stubAuthentication(store)
+
+	server := newTestServer(t, store)
+	httpServer := httptest.NewServer(server.router)
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/accounts/stream", nil)
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, util.RandomOwner(), 500*time.Millisecond)
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	// The server ends the stream once the token expires, long before the deadline of the client
+	_, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.NoError(t, ctx.Err())
+}
+
+func TestStreamAccountsAPIEndsWhenSessionRevoked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetUserPasswordChangedAt(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(time.Time{}, nil)
+	gomock.InOrder(
+		store.EXPECT().
+			GetSession(gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(db.Session{LastUsedAt: time.Now()}, nil),
+		store.EXPECT().
+			GetSession(gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(db.Session{RevokedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true}}, nil),
+	)
+
+	server := newTestServer(t, store)
+	server.config.StreamHeartbeatInterval = 50 * time.Millisecond
+	httpServer := httptest.NewServer(server.router)
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	accessToken, payload, err := server.tokenMaker.CreateToken(util.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/accounts/stream", nil)
+	require.NoError(t, err)
+	request.Header.Set(authorizationHeaderKey, fmt.Sprintf("%s %s", authorizationTypeBearer, accessToken))
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	// The session is signed out through another instance, this one notices it once the cached session expires
+	server.sessions.mu.Lock()
+	delete(server.sessions.entries, payload.ID)
+	server.sessions.mu.Unlock()
+
+	_, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.NoError(t, ctx.Err())
+}
+
+func TestStreamAccountsAPIEndsOnShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	stubAuthentication(store)
+
+	server := newTestServer(t, store)
+	httpServer := httptest.NewServer(server.router)
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/accounts/stream", nil)
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, util.RandomOwner(), time.Minute)
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	require.NoError(t, server.Shutdown(ctx))
+
+	// The stream is ended by the server, long before the deadline of the client
+	_, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.NoError(t, ctx.Err())
+}
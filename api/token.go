@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/igiai/simplebank/token"
+)
+
+var errNoTokenPublicKey = errors.New("tokens are not signed with a public key")
+
+// tokenPublicKeyExporter is implemented by the token makers which sign tokens with private keys
+type tokenPublicKeyExporter interface {
+	PublicKeys() map[string]string
+}
+
+// jsonWebKeyExporter is implemented by the JWT makers which sign tokens with private keys
+type jsonWebKeyExporter interface {
+	JSONWebKeys() []token.JSONWebKey
+}
+
+type tokenPublicKey struct {
+	KeyID     string `json:"kid"`
+	PublicKey string `json:"public_key"`
+}
+
+type tokenPublicKeyResponse struct {
+	Version string           `json:"version"`
+	Purpose string           `json:"purpose"`
+	Keys    []tokenPublicKey `json:"keys"`
+}
+
+// getTokenPublicKey returns the keys which downstream services use to verify access tokens without being able to mint them
+// Retired keys are left out, the kid in the footer of a token tells which of the keys signed it
+func (server *Server) getTokenPublicKey(ctx *gin.Context) {
+	exporter, ok := server.tokenMaker.(tokenPublicKeyExporter)
+	if !ok {
+		ctx.JSON(http.StatusNotFound, errorResponse(errNoTokenPublicKey))
+		return
+	}
+
+	rsp := tokenPublicKeyResponse{
+		Version: "v4",
+		Purpose: "public",
+		Keys:    []tokenPublicKey{},
+	}
+	for keyID, publicKey := range exporter.PublicKeys() {
+		rsp.Keys = append(rsp.Keys, tokenPublicKey{KeyID: keyID, PublicKey: publicKey})
+	}
+	sort.Slice(rsp.Keys, func(i, j int) bool { return rsp.Keys[i].KeyID < rsp.Keys[j].KeyID })
+
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type jsonWebKeySetResponse struct {
+	Keys []token.JSONWebKey `json:"keys"`
+}
+
+// getJSONWebKeySet publishes the public keys of the JWT maker, so API gateways and sibling services can validate access tokens
+// The kid in the header of a token tells which of the keys signed it
+func (server *Server) getJSONWebKeySet(ctx *gin.Context) {
+	exporter, ok := server.tokenMaker.(jsonWebKeyExporter)
+	if !ok {
+		ctx.JSON(http.StatusNotFound, errorResponse(errNoTokenPublicKey))
+		return
+	}
+
+	keys := exporter.JSONWebKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyID < keys[j].KeyID })
+
+	ctx.JSON(http.StatusOK, jsonWebKeySetResponse{Keys: keys})
+}
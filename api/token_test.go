@@ -0,0 +1,174 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/igiai/simplebank/db/mock"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/token"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTokenPublicKeyAPI(t *testing.T) {
+	testCases := []struct {
+		name          string
+		setupMaker    func(t *testing.T, server *Server)
+		checkResponse func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			setupMaker: func(t *testing.T, server *Server) {
+				key, err := token.GenerateEd25519Key()
+				require.NoError(t, err)
+
+				server.tokenMaker, err = token.NewPasetoV4Maker(key)
+				require.NoError(t, err)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				data, err := io.ReadAll(recorder.Body)
+				require.NoError(t, err)
+
+				var rsp tokenPublicKeyResponse
+				require.NoError(t, json.Unmarshal(data, &rsp))
+				require.Equal(t, "v4", rsp.Version)
+				require.Equal(t, "public", rsp.Purpose)
+
+				// A token of the server is accepted by a verifier built only from the returned keys
+				publicKeys := make(map[string]string, len(rsp.Keys))
+				for _, key := range rsp.Keys {
+					publicKeys[key.KeyID] = key.PublicKey
+				}
+				require.Len(t, publicKeys, 1)
+
+				verifier, err := token.NewPasetoV4Verifier(publicKeys, token.ClaimsPolicy{})
+				require.NoError(t, err)
+
+				username := util.RandomOwner()
+				accessToken, _, err := server.tokenMaker.CreateToken(username, time.Minute)
+				require.NoError(t, err)
+
+				payload, err := verifier.VerifyToken(accessToken)
+				require.NoError(t, err)
+				require.Equal(t, username, payload.Username)
+			},
+		},
+		{
+			name:       "SymmetricTokens",
+			setupMaker: func(t *testing.T, server *Server) {},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+
+			server := newTestServer(t, store)
+			tc.setupMaker(t, server)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/tokens/public_key", nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, server, recorder)
+		})
+	}
+}
+
+func TestGetJSONWebKeySetAPI(t *testing.T) {
+	rsaKey, err := token.GenerateRSAKey()
+	require.NoError(t, err)
+
+	ed25519Key, err := token.GenerateEd25519Key()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		setupMaker    func(t *testing.T, server *Server)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			setupMaker: func(t *testing.T, server *Server) {
+				keyring := token.Keyring{
+					CurrentID: "current",
+					Keys: []token.Key{
+						{ID: "current", Secret: rsaKey},
+						{ID: "retired", Secret: rsaKey, Retired: true},
+					},
+				}
+
+				var err error
+				server.tokenMaker, err = token.NewJWTRS256Maker(keyring, token.ClaimsPolicy{})
+				require.NoError(t, err)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp jsonWebKeySetResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+				require.Len(t, rsp.Keys, 1)
+				require.Equal(t, "current", rsp.Keys[0].KeyID)
+				require.Equal(t, "RSA", rsp.Keys[0].KeyType)
+				require.Equal(t, "RS256", rsp.Keys[0].Algorithm)
+				require.NotEmpty(t, rsp.Keys[0].N)
+				require.NotEmpty(t, rsp.Keys[0].E)
+			},
+		},
+		{
+			name: "PasetoPublicTokens",
+			setupMaker: func(t *testing.T, server *Server) {
+				var err error
+				server.tokenMaker, err = token.NewPasetoV4Maker(ed25519Key)
+				require.NoError(t, err)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:       "SymmetricTokens",
+			setupMaker: func(t *testing.T, server *Server) {},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+
+			server := newTestServer(t, store)
+			tc.setupMaker(t, server)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/token"
+)
+
+const (
+	// totpIssuer is the name authenticator apps show next to the codes
+	totpIssuer = "Simple Bank"
+	// recoveryCodeCount is the number of recovery codes handed out when two-factor authentication is enabled
+	recoveryCodeCount = 10
+	// mfaTokenSize is the number of random bytes in an MFA challenge token
+	mfaTokenSize = 32
+)
+
+var (
+	errTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	errTOTPNotEnrolled    = errors.New("two-factor authentication enrollment has not been started")
+	errInvalidTOTPCode    = errors.New("two-factor authentication code is invalid or has already been used")
+	errInvalidMFAToken    = errors.New("mfa token is invalid, has expired or has already been used")
+	errTooManyMFAAttempts = errors.New("too many codes have been tried with the mfa token, log in again")
+)
+
+type enrollTOTPResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// enrollTOTP generates a new TOTP secret of the authenticated user
+// Two-factor authentication is enabled only after a code generated from the secret is confirmed
+func (server *Server) enrollTOTP(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if user.IsTotpEnabled {
+		ctx.JSON(http.StatusForbidden, errorResponse(errTOTPAlreadyEnabled))
+		return
+	}
+
+	secret, otpAuthURL, err := util.GenerateTOTPKey(totpIssuer, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	_, err = server.store.SetUserTOTPSecret(ctx, db.SetUserTOTPSecretParams{
+		Username:   user.Username,
+		TotpSecret: secret,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := enrollTOTPResponse{
+		Secret:     secret,
+		OTPAuthURL: otpAuthURL,
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type confirmTOTPRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type confirmTOTPResponse struct {
+	RecoveryCodes []string     `json:"recovery_codes"`
+	User          userResponse `json:"user"`
+}
+
+// confirmTOTP enables two-factor authentication once the user proves their authenticator generates valid codes
+// The recovery codes are returned only once, the db keeps just their hashes
+func (server *Server) confirmTOTP(ctx *gin.Context) {
+	var req confirmTOTPRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if user.IsTotpEnabled {
+		ctx.JSON(http.StatusForbidden, errorResponse(errTOTPAlreadyEnabled))
+		return
+	}
+
+	if user.TotpSecret == "" {
+		ctx.JSON(http.StatusForbidden, errorResponse(errTOTPNotEnrolled))
+		return
+	}
+
+	step, ok := util.ValidateTOTPCode(req.Code, user.TotpSecret, server.clock.Now())
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidTOTPCode))
+		return
+	}
+
+	recoveryCodes, err := util.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	recoveryCodeHashes := make([]string, len(recoveryCodes))
+	for i, code := range recoveryCodes {
+		recoveryCodeHashes[i] = util.HashSecret(code)
+	}
+
+	arg := db.EnableTOTPTxParams{
+		Username:           user.Username,
+		Step:               step,
+		RecoveryCodeHashes: recoveryCodeHashes,
+	}
+
+	result, err := server.store.EnableTOTPTx(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := confirmTOTPResponse{
+		RecoveryCodes: recoveryCodes,
+		User:          newUserResponse(result.User),
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type mfaChallengeResponse struct {
+	MFARequired  bool      `json:"mfa_required"`
+	MFAToken     string    `json:"mfa_token"`
+	MFAExpiresAt time.Time `json:"mfa_expires_at"`
+}
+
+// startMFAChallenge is called by loginUser after the password of a user with two-factor authentication is checked
+// Instead of an access token it returns a short-lived token which loginUserMFA accepts together with a code
+func (server *Server) startMFAChallenge(ctx *gin.Context, user db.User) {
+	mfaToken, err := util.GenerateSecret(mfaTokenSize)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	arg := db.CreateMFAChallengeParams{
+		Username:  user.Username,
+		TokenHash: util.HashSecret(mfaToken),
+		ExpiresAt: server.clock.Now().Add(server.config.MFAChallengeDuration),
+	}
+
+	challenge, err := server.store.CreateMFAChallenge(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := mfaChallengeResponse{
+		MFARequired:  true,
+		MFAToken:     mfaToken,
+		MFAExpiresAt: challenge.ExpiresAt,
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type loginUserMFARequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" binding:"required_without=Code"`
+}
+
+// loginUserMFA completes the login of a user with two-factor authentication
+// Either a TOTP code or one of the recovery codes is accepted, wrong codes count as failed logins
+// Only a few codes can be tried with a challenge, even when failed logins don't lock the user
+func (server *Server) loginUserMFA(ctx *gin.Context) {
+	var req loginUserMFARequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	challenge, err := server.store.GetMFAChallenge(ctx, util.HashSecret(req.MFAToken))
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMFAToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if challenge.UsedAt.Valid || server.clock.Now().After(challenge.ExpiresAt) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMFAToken))
+		return
+	}
+
+	user, err := server.store.GetUser(ctx, challenge.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if server.rejectLockedUser(ctx, user) {
+		return
+	}
+
+	// The attempt is counted before the code is checked, so concurrent requests cannot try more codes than allowed
+	rowsAffected, err := server.store.CountMFAChallengeAttempt(ctx, db.CountMFAChallengeAttemptParams{
+		ID:          challenge.ID,
+		MaxAttempts: server.config.MFAMaxAttempts,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if rowsAffected == 0 {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errTooManyMFAAttempts))
+		return
+	}
+
+	// The challenge is used only once, a concurrent request with the same token loses before using its code
+	result, err := server.store.UseMFAChallengeTx(ctx, db.UseMFAChallengeTxParams{
+		ChallengeID: challenge.ID,
+		UseSecondFactor: func(q db.Querier) (bool, error) {
+			return server.useSecondFactor(ctx, q, user, req.Code, req.RecoveryCode)
+		},
+	})
+	if err != nil {
+		if err == db.ErrInvalidMFAChallenge {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMFAToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if !result.Valid {
+		server.rejectFailedLogin(ctx, user.Username, errInvalidTOTPCode)
+		return
+	}
+
+	server.completeLogin(ctx, user)
+}
+
+// useSecondFactor checks the TOTP code or the recovery code of the user and marks it as used with the given queries
+func (server *Server) useSecondFactor(ctx *gin.Context, q db.Querier, user db.User, code string, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := util.ValidateTOTPCode(code, user.TotpSecret, server.clock.Now())
+		if !ok {
+			return false, nil
+		}
+
+		// The update succeeds only for a step later than the last one used, so a code cannot be replayed
+		rowsAffected, err := q.UseTOTPStep(ctx, db.UseTOTPStepParams{
+			Step:     step,
+			Username: user.Username,
+		})
+		if err != nil {
+			return false, err
+		}
+		return rowsAffected > 0, nil
+	}
+
+	_, err := q.UseRecoveryCode(ctx, db.UseRecoveryCodeParams{
+		Username: user.Username,
+		CodeHash: util.HashSecret(util.NormalizeRecoveryCode(recoveryCode)),
+	})
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,663 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/igiai/simplebank/db/mock"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/token"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnrollTOTPEndpoint(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					SetUserTOTPSecret(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.SetUserTOTPSecretParams) (db.User, error) {
+						require.Equal(t, user.Username, arg.Username)
+						require.NotEmpty(t, arg.TotpSecret)
+						return user, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp enrollTOTPResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &rsp)
+				require.NoError(t, err)
+				require.NotEmpty(t, rsp.Secret)
+				require.Contains(t, rsp.OTPAuthURL, "secret="+rsp.Secret)
+			},
+		},
+		{
+			name: "AlreadyEnabled",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				enabledUser := user
+				enabledUser.IsTotpEnabled = true
+
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(enabledUser, nil)
+				store.EXPECT().
+					SetUserTOTPSecret(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "NoAuthorization",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					SetUserTOTPSecret(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					SetUserTOTPSecret(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthentication(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := "/users/totp/enroll"
+			request, err := http.NewRequest(http.MethodPost, url, nil)
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestConfirmTOTPEndpoint(t *testing.T) {
+	user, _ := randomUser(t)
+	secret, _, err := util.GenerateTOTPKey(totpIssuer, user.Username)
+	require.NoError(t, err)
+	user.TotpSecret = secret
+
+	testCases := []struct {
+		name          string
+		code          func(t *testing.T) string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			code: func(t *testing.T) string {
+				return randomTOTPCode(t, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					EnableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.EnableTOTPTxParams) (db.EnableTOTPTxResult, error) {
+						require.Equal(t, user.Username, arg.Username)
+						require.Equal(t, time.Now().Unix()/30, arg.Step)
+						require.Len(t, arg.RecoveryCodeHashes, recoveryCodeCount)
+
+						enabledUser := user
+						enabledUser.IsTotpEnabled = true
+						return db.EnableTOTPTxResult{User: enabledUser}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp confirmTOTPResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &rsp)
+				require.NoError(t, err)
+				require.Len(t, rsp.RecoveryCodes, recoveryCodeCount)
+				require.True(t, rsp.User.IsTotpEnabled)
+			},
+		},
+		{
+			name: "WrongCode",
+			code: func(t *testing.T) string {
+				return wrongTOTPCode(t, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					EnableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "NotEnrolled",
+			code: func(t *testing.T) string {
+				return randomTOTPCode(t, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				notEnrolledUser := user
+				notEnrolledUser.TotpSecret = ""
+
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(notEnrolledUser, nil)
+				store.EXPECT().
+					EnableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "AlreadyEnabled",
+			code: func(t *testing.T) string {
+				return randomTOTPCode(t, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				enabledUser := user
+				enabledUser.IsTotpEnabled = true
+
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(enabledUser, nil)
+				store.EXPECT().
+					EnableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidCodeFormat",
+			code: func(t *testing.T) string {
+				return "12ab"
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthentication(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(gin.H{"code": tc.code(t)})
+			require.NoError(t, err)
+
+			url := "/users/totp/confirm"
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestLoginUserMFAEndpoint(t *testing.T) {
+	user, _ := randomUser(t)
+	secret, _, err := util.GenerateTOTPKey(totpIssuer, user.Username)
+	require.NoError(t, err)
+	user.TotpSecret = secret
+	user.IsTotpEnabled = true
+
+	mfaToken := util.RandomString(32)
+	recoveryCode := util.RandomString(16)
+	challenge := db.MfaChallenge{
+		ID:        util.RandomInt(1, 1000),
+		Username:  user.Username,
+		TokenHash: util.HashSecret(mfaToken),
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+
+	testCases := []struct {
+		name          string
+		body          func(t *testing.T) gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OKWithCode",
+			body: func(t *testing.T) gin.H {
+				return gin.H{"mfa_token": mfaToken, "code": randomTOTPCode(t, secret)}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetMFAChallenge(gomock.Any(), gomock.Eq(challenge.TokenHash)).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				stubCountMFAChallengeAttempt(store, challenge.ID, 1)
+				stubUseMFAChallengeTx(store, challenge.ID)
+				store.EXPECT().
+					UseTOTPStep(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(1), nil)
+				stubCreateSession(store)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyHasAccessToken(t, recorder.Body)
+			},
+		},
+		{
+			name: "OKWithRecoveryCode",
+			body: func(t *testing.T) gin.H {
+				return gin.H{"mfa_token": mfaToken, "recovery_code": recoveryCode}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetMFAChallenge(gomock.Any(), gomock.Eq(challenge.TokenHash)).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				stubCountMFAChallengeAttempt(store, challenge.ID, 1)
+				stubUseMFAChallengeTx(store, challenge.ID)
+				store.EXPECT().
+					UseRecoveryCode(gomock.Any(), gomock.Eq(db.UseRecoveryCodeParams{
+						Username: user.Username,
+						CodeHash: util.HashSecret(util.NormalizeRecoveryCode(recoveryCode)),
+					})).
+					Times(1).
+					Return(db.RecoveryCode{}, nil)
+				stubCreateSession(store)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyHasAccessToken(t, recorder.Body)
+			},
+		},
+		{
+			name: "WrongCode",
+			body: func(t *testing.T) gin.H {
+				return gin.H{"mfa_token": mfaToken, "code": wrongTOTPCode(t, secret)}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetMFAChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				stubCountMFAChallengeAttempt(store, challenge.ID, 1)
+				stubUseMFAChallengeTx(store, challenge.ID)
+				store.EXPECT().
+					RecordFailedLoginTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.RecordFailedLoginTxResult{User: user}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "ReplayedCode",
+			body: func(t *testing.T) gin.H {
+				return gin.H{"mfa_token": mfaToken, "code": randomTOTPCode(t, secret)}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetMFAChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				stubCountMFAChallengeAttempt(store, challenge.ID, 1)
+				stubUseMFAChallengeTx(store, challenge.ID)
+				store.EXPECT().
+					UseTOTPStep(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(0), nil)
+				store.EXPECT().
+					RecordFailedLoginTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.RecordFailedLoginTxResult{User: user}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "UsedRecoveryCode",
+			body: func(t *testing.T) gin.H {
+				return gin.H{"mfa_token": mfaToken, "recovery_code": recoveryCode}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetMFAChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				stubCountMFAChallengeAttempt(store, challenge.ID, 1)
+				stubUseMFAChallengeTx(store, challenge.ID)
+				store.EXPECT().
+					UseRecoveryCode(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.RecoveryCode{}, db.ErrRecordNotFound)
+				store.EXPECT().
+					RecordFailedLoginTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.RecordFailedLoginTxResult{User: user}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "UnknownMFAToken",
+			body: func(t *testing.T) gin.H {
+				return gin.H{"mfa_token": mfaToken, "code": randomTOTPCode(t, secret)}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetMFAChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.MfaChallenge{}, db.ErrRecordNotFound)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "ExpiredMFAToken",
+			body: func(t *testing.T) gin.H {
+				return gin.H{"mfa_token": mfaToken, "code": randomTOTPCode(t, secret)}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				expiredChallenge := challenge
+				expiredChallenge.ExpiresAt = time.Now().Add(-time.Second)
+
+				store.EXPECT().
+					GetMFAChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(expiredChallenge, nil)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "MFATokenUsedConcurrently",
+			body: func(t *testing.T) gin.H {
+				return gin.H{"mfa_token": mfaToken, "code": randomTOTPCode(t, secret)}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetMFAChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				stubCountMFAChallengeAttempt(store, challenge.ID, 1)
+				store.EXPECT().
+					UseMFAChallengeTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UseMFAChallengeTxResult{}, db.ErrInvalidMFAChallenge)
+				store.EXPECT().
+					UseTOTPStep(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "TooManyAttempts",
+			body: func(t *testing.T) gin.H {
+				return gin.H{"mfa_token": mfaToken, "code": randomTOTPCode(t, secret)}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetMFAChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				stubCountMFAChallengeAttempt(store, challenge.ID, 0)
+				store.EXPECT().
+					UseMFAChallengeTx(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					RecordFailedLoginTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "UserLocked",
+			body: func(t *testing.T) gin.H {
+				return gin.H{"mfa_token": mfaToken, "code": randomTOTPCode(t, secret)}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				lockedUser := user
+				lockedUser.LockedUntil = time.Now().Add(time.Minute)
+
+				store.EXPECT().
+					GetMFAChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(lockedUser, nil)
+				store.EXPECT().
+					UseTOTPStep(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusLocked, recorder.Code)
+			},
+		},
+		{
+			name: "NoCode",
+			body: func(t *testing.T) gin.H {
+				return gin.H{"mfa_token": mfaToken}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetMFAChallenge(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body(t))
+			require.NoError(t, err)
+
+			url := "/users/login/mfa"
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+// stubCountMFAChallengeAttempt counts an attempt of the challenge, rowsAffected is zero once the attempts run out
+func stubCountMFAChallengeAttempt(store *mockdb.MockStore, challengeID int64, rowsAffected int64) {
+	store.EXPECT().
+		CountMFAChallengeAttempt(gomock.Any(), gomock.Eq(db.CountMFAChallengeAttemptParams{
+			ID:          challengeID,
+			MaxAttempts: 3,
+		})).
+		Times(1).
+		Return(rowsAffected, nil)
+}
+
+// stubUseMFAChallengeTx claims the challenge and uses the second factor with the queries of the mock store
+func stubUseMFAChallengeTx(store *mockdb.MockStore, challengeID int64) {
+	store.EXPECT().
+		UseMFAChallengeTx(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.UseMFAChallengeTxParams) (db.UseMFAChallengeTxResult, error) {
+			if arg.ChallengeID != challengeID {
+				return db.UseMFAChallengeTxResult{}, db.ErrInvalidMFAChallenge
+			}
+			valid, err := arg.UseSecondFactor(store)
+			return db.UseMFAChallengeTxResult{Valid: valid}, err
+		})
+}
+
+func randomTOTPCode(t *testing.T, secret string) string {
+	code, err := totp.GenerateCode(secret, time.Now())
+	require.NoError(t, err)
+	return code
+}
+
+// wrongTOTPCode returns a well-formed code which is not valid for the secret at the moment
+func wrongTOTPCode(t *testing.T, secret string) string {
+	for hours := 1; ; hours++ {
+		code, err := totp.GenerateCode(secret, time.Now().Add(-time.Duration(hours)*time.Hour))
+		require.NoError(t, err)
+
+		if _, ok := util.ValidateTOTPCode(code, secret, time.Now()); !ok {
+			return code
+		}
+	}
+}
+
+func requireBodyHasAccessToken(t *testing.T, body *bytes.Buffer) {
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+
+	var rsp loginUserResponse
+	err = json.Unmarshal(data, &rsp)
+	require.NoError(t, err)
+	require.NotEmpty(t, rsp.AccessToken)
+	require.NotZero(t, rsp.SessionID)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -100,6 +101,35 @@ func TestCreateTransferEndpoint(t *testing.T) {
 				requireBodyMatchTransfer(t, recorder.Body, transferResult)
 			},
 		},
+		{
+			name: "EmailNotVerified",
+			body: gin.H{
+				"from_account_id": fromAccount.ID,
+				"to_account_id":   toAccount.ID,
+				"amount":          amount,
+				"currency":        util.EUR,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user1.Username)).
+					Times(1).
+					Return(user1, nil)
+
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+
+				store.EXPECT().
+					TransferTX(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
 		{
 			name: "UnauthorizedUser",
 			body: gin.H{
@@ -215,7 +245,7 @@ func TestCreateTransferEndpoint(t *testing.T) {
 				store.EXPECT().
 					GetAccount(gomock.Any(), gomock.Eq(fromAccount.ID)).
 					Times(1).
-					Return(db.Account{}, sql.ErrNoRows)
+					Return(db.Account{}, db.ErrRecordNotFound)
 
 				store.EXPECT().
 					GetAccount(gomock.Any(), gomock.Eq(toAccount.ID)).
@@ -249,7 +279,7 @@ func TestCreateTransferEndpoint(t *testing.T) {
 				store.EXPECT().
 					GetAccount(gomock.Any(), gomock.Eq(toAccount.ID)).
 					Times(1).
-					Return(db.Account{}, sql.ErrNoRows)
+					Return(db.Account{}, db.ErrRecordNotFound)
 
 				store.EXPECT().
 					TransferTX(gomock.Any(), gomock.Any()).
@@ -345,6 +375,37 @@ func TestCreateTransferEndpoint(t *testing.T) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
 			},
 		},
+		{
+			name: "AccountNotActive",
+			body: gin.H{
+				"from_account_id": fromAccount.ID,
+				"to_account_id":   toAccount.ID,
+				"amount":          amount,
+				"currency":        util.EUR,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(fromAccount.ID)).
+					Times(1).
+					Return(fromAccount, nil)
+
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(toAccount.ID)).
+					Times(1).
+					Return(toAccount, nil)
+
+				store.EXPECT().
+					TransferTX(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.TransferTxResult{}, fmt.Errorf("%w: account %d is frozen", db.ErrAccountNotActive, toAccount.ID))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
 	}
 
 	for i := range testCases {
@@ -356,6 +417,8 @@ func TestCreateTransferEndpoint(t *testing.T) {
 
 			store := mockdb.NewMockStore(ctrl)
 			tc.buildStubs(store)
+			stubAuthentication(store)
+			stubVerifiedEmail(store)
 
 			server := newTestServer(t, store)
 			recorder := httptest.NewRecorder()
@@ -387,3 +450,63 @@ func requireBodyMatchTransfer(t *testing.T, body *bytes.Buffer, account db.Trans
 	require.NoError(t, err)
 	require.Equal(t, account, gotTransferResult)
 }
+
+// The in-memory store runs the real transfer transaction, so the endpoint is tested end to end without a db
+func TestCreateTransferWithMemoryStore(t *testing.T) {
+	store := db.NewMemoryStore()
+	server := newTestServer(t, store)
+	ctx := context.Background()
+
+	accounts := make([]db.Account, 2)
+	for i := range accounts {
+		user, err := store.CreateUser(ctx, db.CreateUserParams{
+			Username:       util.RandomOwner(),
+			HashedPassword: util.RandomString(32),
+			FullName:       util.RandomOwner(),
+			Email:          util.RandomEmail(),
+		})
+		require.NoError(t, err)
+		_, err = store.VerifyUserEmail(ctx, user.Username)
+		require.NoError(t, err)
+
+		accounts[i], err = store.CreateAccount(ctx, db.CreateAccountParams{
+			Owner:    user.Username,
+			Balance:  100,
+			Currency: util.USD,
+		})
+		require.NoError(t, err)
+	}
+
+	accessToken, payload, err := server.tokenMaker.CreateToken(accounts[0].Owner, time.Minute)
+	require.NoError(t, err)
+	_, err = store.CreateSession(ctx, db.CreateSessionParams{
+		ID:        payload.ID,
+		Username:  payload.Username,
+		ExpiresAt: payload.ExpiredAt,
+	})
+	require.NoError(t, err)
+
+	data, err := json.Marshal(gin.H{
+		"from_account_id": accounts[0].ID,
+		"to_account_id":   accounts[1].ID,
+		"amount":          30,
+		"currency":        util.USD,
+	})
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(http.MethodPost, "/transfers", bytes.NewReader(data))
+	require.NoError(t, err)
+	request.Header.Set(authorizationHeaderKey, fmt.Sprintf("%s %s", authorizationTypeBearer, accessToken))
+
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	fromAccount, err := store.GetAccount(ctx, accounts[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(70), fromAccount.Balance)
+
+	toAccount, err := store.GetAccount(ctx, accounts[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(130), toAccount.Balance)
+}
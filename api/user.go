@@ -1,19 +1,26 @@
 package api
 
 import (
-	"database/sql"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	db "github.com/igiai/simplebank/db/sqlc"
 	"github.com/igiai/simplebank/db/util"
-	"github.com/lib/pq"
+	"github.com/igiai/simplebank/token"
 )
 
+// maxLockoutDoublings caps the escalation of the lockout period when no maximum is configured
+const maxLockoutDoublings = 16
+
+var errUserLocked = errors.New("user is temporarily locked due to too many failed login attempts")
+
 type createUserRequest struct {
 	Username string `json:"username" binding:"required,alphanum"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"`
 	FullName string `json:"full_name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
 }
@@ -22,7 +29,10 @@ type userResponse struct {
 	Username          string    `json:"username"`
 	FullName          string    `json:"full_name"`
 	Email             string    `json:"email"`
+	IsEmailVerified   bool      `json:"is_email_verified"`
+	IsTotpEnabled     bool      `json:"is_totp_enabled"`
 	PasswordChangedAt time.Time `json:"password_changed_at"`
+	LockedUntil       time.Time `json:"locked_until"`
 	CreatedAt         time.Time `json:"created_at"`
 }
 
@@ -31,7 +41,10 @@ func newUserResponse(user db.User) userResponse {
 		Username:          user.Username,
 		FullName:          user.FullName,
 		Email:             user.Email,
+		IsEmailVerified:   user.IsEmailVerified,
+		IsTotpEnabled:     user.IsTotpEnabled,
 		PasswordChangedAt: user.PasswordChangedAt,
+		LockedUntil:       user.LockedUntil,
 		CreatedAt:         user.CreatedAt,
 	}
 }
@@ -43,33 +56,52 @@ func (server *Server) createUser(ctx *gin.Context) {
 		return
 	}
 
-	hashedPassword, err := util.HashPassword(req.Password)
+	if server.rejectWeakPassword(ctx, req.Password, req.Username, req.Email) {
+		return
+	}
+
+	hashedPassword, err := server.passwordHasher.Hash(req.Password)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
-	arg := db.CreateUserParams{
-		Username:       req.Username,
-		HashedPassword: hashedPassword,
-		FullName:       req.FullName,
-		Email:          req.Email,
+	secretCode, err := util.GenerateSecret(verifyEmailCodeSize)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	arg := db.CreateUserTxParams{
+		CreateUserParams: db.CreateUserParams{
+			Username:       req.Username,
+			HashedPassword: hashedPassword,
+			FullName:       req.FullName,
+			Email:          req.Email,
+		},
+		SecretCodeHash:     util.HashSecret(secretCode),
+		VerifyEmailExpires: server.clock.Now().Add(server.config.VerifyEmailDuration),
 	}
 
-	user, err := server.store.CreateUser(ctx, arg)
+	result, err := server.store.CreateUserTx(ctx, arg)
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok {
-			switch pqErr.Code.Name() {
-			case "unique_violation":
-				ctx.JSON(http.StatusForbidden, errorResponse(err))
-				return
-			}
+		switch db.ErrorCode(err) {
+		case db.UniqueViolation:
+			ctx.JSON(http.StatusForbidden, errorResponse(err))
+			return
 		}
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
-	rsp := newUserResponse(user)
+	// The email is sent once the user is committed, so a retried transaction doesn't send it twice
+	// The user is created even if it cannot be sent, a new one is requested with resendVerifyEmail
+	err = server.sendVerifyEmail(ctx, result.User, result.VerifyEmail, secretCode)
+	if err != nil {
+		log.Printf("cannot send verify email to user %s: %v", result.User.Username, err)
+	}
+
+	rsp := newUserResponse(result.User)
 	ctx.JSON(http.StatusOK, rsp)
 }
 
@@ -79,6 +111,7 @@ type loginUserRequest struct {
 }
 
 type loginUserResponse struct {
+	SessionID   uuid.UUID    `json:"session_id"`
 	AccessToken string       `json:"access_token"`
 	User        userResponse `json:"user"`
 }
@@ -92,7 +125,7 @@ func (server *Server) loginUser(ctx *gin.Context) {
 
 	user, err := server.store.GetUser(ctx, req.Username)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == db.ErrRecordNotFound {
 			ctx.JSON(http.StatusNotFound, errorResponse(err))
 			return
 		}
@@ -100,21 +133,187 @@ func (server *Server) loginUser(ctx *gin.Context) {
 		return
 	}
 
+	// The lock is checked before the password, so that the response of a locked user
+	// doesn't reveal whether the password was correct or not
+	if server.rejectLockedUser(ctx, user) {
+		return
+	}
+
 	err = util.CheckPassword(req.Password, user.HashedPassword)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		server.rejectFailedLogin(ctx, user.Username, err)
+		return
+	}
+
+	user, err = server.rehashPassword(ctx, user, req.Password)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// With two-factor authentication the password alone is not enough, the login is completed by loginUserMFA
+	if user.IsTotpEnabled {
+		server.startMFAChallenge(ctx, user)
+		return
+	}
+
+	server.completeLogin(ctx, user)
+}
+
+// completeLogin issues the access token once the user has proven their identity
+// The token starts a session of the device, which the user can see and sign out remotely
+func (server *Server) completeLogin(ctx *gin.Context, user db.User) {
+	// A successful login resets the counters, so the next lockout starts again from the shortest period
+	if user.FailedLoginAttempts > 0 || user.LockoutCount > 0 {
+		err := server.store.ResetFailedLogins(ctx, user.Username)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(user.Username, server.config.AccessTokenDuration)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
-	accessToken, err := server.tokenMaker.CreateToken(user.Username, server.config.AccessTokenDuration)
+	session, err := server.store.CreateSession(ctx, db.CreateSessionParams{
+		ID:        accessPayload.ID,
+		Username:  user.Username,
+		UserAgent: ctx.Request.UserAgent(),
+		ClientIp:  ctx.ClientIP(),
+		ExpiresAt: accessPayload.ExpiredAt,
+	})
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
 	rsp := loginUserResponse{
+		SessionID:   session.ID,
 		AccessToken: accessToken,
 		User:        newUserResponse(user),
 	}
 	ctx.JSON(http.StatusOK, rsp)
 }
+
+// rehashPassword replaces the stored hash of a correct password when it was created by an outdated algorithm or parameters
+// The plain password is known only during login, so this is the only chance to upgrade the hash
+func (server *Server) rehashPassword(ctx *gin.Context, user db.User, password string) (db.User, error) {
+	if !server.passwordHasher.NeedsRehash(user.HashedPassword) {
+		return user, nil
+	}
+
+	hashedPassword, err := server.passwordHasher.Hash(password)
+	if err != nil {
+		return user, err
+	}
+
+	// Unlike a password change, a new hash of the same password doesn't revoke the tokens of the user
+	return server.store.UpdateUserPasswordHash(ctx, db.UpdateUserPasswordHashParams{
+		Username:       user.Username,
+		HashedPassword: hashedPassword,
+	})
+}
+
+// rejectLockedUser responds with the end of the lock and returns true if the user is locked
+func (server *Server) rejectLockedUser(ctx *gin.Context, user db.User) bool {
+	if !user.LockedUntil.After(server.clock.Now()) {
+		return false
+	}
+
+	rsp := errorResponse(errUserLocked)
+	rsp["locked_until"] = user.LockedUntil
+	ctx.JSON(http.StatusLocked, rsp)
+	return true
+}
+
+// rejectFailedLogin counts a failed login attempt and responds with the given error
+// A concurrent attempt may have locked the user since it was loaded, the response is then the same as for a locked user
+func (server *Server) rejectFailedLogin(ctx *gin.Context, username string, loginErr error) {
+	result, err := server.recordFailedLogin(ctx, username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if result.AlreadyLocked && server.rejectLockedUser(ctx, result.User) {
+		return
+	}
+	ctx.JSON(http.StatusUnauthorized, errorResponse(loginErr))
+}
+
+// recordFailedLogin counts a failed login attempt and locks the user once the configured limit is reached
+func (server *Server) recordFailedLogin(ctx *gin.Context, username string) (db.RecordFailedLoginTxResult, error) {
+	if server.config.MaxFailedLogins <= 0 {
+		return db.RecordFailedLoginTxResult{}, nil
+	}
+
+	return server.store.RecordFailedLoginTx(ctx, db.RecordFailedLoginTxParams{
+		Username:        username,
+		MaxFailedLogins: server.config.MaxFailedLogins,
+		Now:             server.clock.Now(),
+		LockoutDuration: func(lockoutCount int32) time.Duration {
+			return lockoutDuration(server.config.LockoutDuration, server.config.MaxLockoutDuration, lockoutCount)
+		},
+	})
+}
+
+// lockoutDuration doubles the base period for every previous lockout, up to the max period if it is set
+func lockoutDuration(base time.Duration, max time.Duration, lockoutCount int32) time.Duration {
+	duration := base
+	for i := int32(0); i < lockoutCount && i < maxLockoutDoublings; i++ {
+		if max > 0 && duration >= max {
+			break
+		}
+		duration *= 2
+	}
+
+	if max > 0 && duration > max {
+		return max
+	}
+	return duration
+}
+
+type unlockUserRequest struct {
+	Username string `uri:"username" binding:"required,alphanum"`
+}
+
+func (server *Server) unlockUser(ctx *gin.Context) {
+	var req unlockUserRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// Only bankers are allowed to lift the lock before it expires
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	authUser, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if authUser.Role != util.BankerRole {
+		err := errors.New("only bankers can unlock users")
+		ctx.JSON(http.StatusForbidden, errorResponse(err))
+		return
+	}
+
+	user, err := server.store.UnlockUser(ctx, req.Username)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
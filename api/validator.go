@@ -3,6 +3,7 @@ package api
 import (
 	"github.com/go-playground/validator/v10"
 	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/webhook"
 )
 
 var validCurrency validator.Func = func(fieldLevel validator.FieldLevel) bool {
@@ -11,3 +12,24 @@ var validCurrency validator.Func = func(fieldLevel validator.FieldLevel) bool {
 	}
 	return false
 }
+
+var validScope validator.Func = func(fieldLevel validator.FieldLevel) bool {
+	if scope, ok := fieldLevel.Field().Interface().(string); ok {
+		return util.IsSupportedScope(scope)
+	}
+	return false
+}
+
+var validEventType validator.Func = func(fieldLevel validator.FieldLevel) bool {
+	if eventType, ok := fieldLevel.Field().Interface().(string); ok {
+		return util.IsSupportedEventType(eventType)
+	}
+	return false
+}
+
+var validWebhookURL validator.Func = func(fieldLevel validator.FieldLevel) bool {
+	if webhookURL, ok := fieldLevel.Field().Interface().(string); ok {
+		return webhook.ValidateURL(webhookURL) == nil
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/token"
+)
+
+// verifyEmailCodeSize is the number of random bytes in an email verification code
+const verifyEmailCodeSize = 32
+
+var (
+	errEmailNotVerified     = errors.New("email of the user is not verified yet")
+	errEmailAlreadyVerified = errors.New("email of the user is already verified")
+)
+
+// sendVerifyEmail sends the link verifying the email of a user
+func (server *Server) sendVerifyEmail(ctx context.Context, user db.User, verifyEmail db.VerifyEmail, secretCode string) error {
+	query := url.Values{}
+	query.Set("email_id", fmt.Sprint(verifyEmail.ID))
+	query.Set("secret_code", secretCode)
+	verifyURL := fmt.Sprintf("%s?%s", server.config.VerifyEmailURL, query.Encode())
+
+	subject := "Welcome to Simple Bank"
+	content := fmt.Sprintf(
+		"Hello %s,\n\nthank you for registering with us! Please verify your email address by opening the link below, it expires in %s:\n\n%s\n",
+		user.FullName,
+		server.config.VerifyEmailDuration,
+		verifyURL,
+	)
+
+	return server.mailer.SendEmail(ctx, user.Email, subject, content)
+}
+
+type verifyEmailRequest struct {
+	EmailID    int64  `form:"email_id" binding:"required,min=1"`
+	SecretCode string `form:"secret_code" binding:"required"`
+}
+
+func (server *Server) verifyEmail(ctx *gin.Context) {
+	var req verifyEmailRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	arg := db.VerifyEmailTxParams{
+		EmailID:        req.EmailID,
+		SecretCodeHash: util.HashSecret(req.SecretCode),
+		Now:            server.clock.Now(),
+	}
+
+	result, err := server.store.VerifyEmailTx(ctx, arg)
+	if err != nil {
+		if err == db.ErrRecordNotFound || err == db.ErrInvalidVerifyEmail {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(db.ErrInvalidVerifyEmail))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(result.User))
+}
+
+// resendVerifyEmail sends a new link verifying the email of the authenticated user,
+// e.g. when the first one expired or could not be sent, the links sent before stay valid until they expire
+func (server *Server) resendVerifyEmail(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if user.IsEmailVerified {
+		ctx.JSON(http.StatusForbidden, errorResponse(errEmailAlreadyVerified))
+		return
+	}
+
+	secretCode, err := util.GenerateSecret(verifyEmailCodeSize)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	verifyEmail, err := server.store.CreateVerifyEmail(ctx, db.CreateVerifyEmailParams{
+		Username:       user.Username,
+		Email:          user.Email,
+		SecretCodeHash: util.HashSecret(secretCode),
+		ExpiresAt:      server.clock.Now().Add(server.config.VerifyEmailDuration),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = server.sendVerifyEmail(ctx, user, verifyEmail, secretCode)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "a new verification link has been sent to " + user.Email})
+}
+
+// requireVerifiedEmail is registered in front of the handlers of the routes which are closed to users with an unverified email
+func (server *Server) requireVerifiedEmail(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if !user.IsEmailVerified {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(errEmailNotVerified))
+		return
+	}
+
+	ctx.Next()
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/token"
+)
+
+const (
+	// webhookSecretPrefix starts every webhook secret, so leaked secrets are easy to recognize
+	webhookSecretPrefix = "whsec_"
+	// webhookSecretSize is the number of random bytes in a webhook secret
+	webhookSecretSize = 32
+)
+
+var errWebhookNotOwned = errors.New("webhook does not belong to the authenticated user")
+
+// webhookResponse leaves out the secret, it is returned only when the webhook is created
+type webhookResponse struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func newWebhookResponse(subscription db.WebhookSubscription) webhookResponse {
+	return webhookResponse{
+		ID:         subscription.ID,
+		URL:        subscription.Url,
+		EventTypes: subscription.EventTypes,
+		CreatedAt:  subscription.CreatedAt,
+	}
+}
+
+type createWebhookRequest struct {
+	URL        string   `json:"url" binding:"required,webhook_url"`
+	EventTypes []string `json:"event_types" binding:"required,min=1,unique,dive,event_type"`
+}
+
+type createWebhookResponse struct {
+	Secret  string          `json:"secret"`
+	Webhook webhookResponse `json:"webhook"`
+}
+
+// createWebhook subscribes the url to the events of the accounts of the authenticated user
+// The deliveries are signed with the returned secret, which is shown only once
+func (server *Server) createWebhook(ctx *gin.Context) {
+	var req createWebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	secret, err := util.GenerateSecret(webhookSecretSize)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	arg := db.CreateWebhookSubscriptionParams{
+		Owner:      authPayload.Username,
+		Url:        req.URL,
+		EventTypes: req.EventTypes,
+		Secret:     webhookSecretPrefix + secret,
+	}
+
+	subscription, err := server.store.CreateWebhookSubscription(ctx, arg)
+	if err != nil {
+		switch db.ErrorCode(err) {
+		case db.ForeignKeyViolation:
+			ctx.JSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := createWebhookResponse{
+		Secret:  subscription.Secret,
+		Webhook: newWebhookResponse(subscription),
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+func (server *Server) listWebhooks(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	subscriptions, err := server.store.ListWebhookSubscriptions(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := make([]webhookResponse, len(subscriptions))
+	for i, subscription := range subscriptions {
+		rsp[i] = newWebhookResponse(subscription)
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type webhookRequest struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+// getOwnedWebhook loads the webhook of the uri and checks it belongs to the authenticated user
+// It writes the error response itself, so the caller only has to return when it fails
+func (server *Server) getOwnedWebhook(ctx *gin.Context) (db.WebhookSubscription, bool) {
+	var req webhookRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return db.WebhookSubscription{}, false
+	}
+
+	subscription, err := server.store.GetWebhookSubscription(ctx, req.ID)
+	if err != nil {
+		if err == db.ErrRecordNotFound {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return db.WebhookSubscription{}, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return db.WebhookSubscription{}, false
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if subscription.Owner != authPayload.Username {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errWebhookNotOwned))
+		return db.WebhookSubscription{}, false
+	}
+
+	return subscription, true
+}
+
+// deleteWebhook unsubscribes the webhook, its pending deliveries are dropped with it
+func (server *Server) deleteWebhook(ctx *gin.Context) {
+	subscription, ok := server.getOwnedWebhook(ctx)
+	if !ok {
+		return
+	}
+
+	err := server.store.DeleteWebhookSubscription(ctx, subscription.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{})
+}
+
+type listWebhookDeliveriesRequest struct {
+	PageID   int32 `form:"page_id" binding:"required,min=1"`
+	PageSize int32 `form:"page_size" binding:"required,min=5,max=10"`
+}
+
+// listWebhookDeliveries lists the deliveries of the webhook, the newest first
+// Dead deliveries, which failed all their attempts, are kept there until they are redelivered
+func (server *Server) listWebhookDeliveries(ctx *gin.Context) {
+	subscription, ok := server.getOwnedWebhook(ctx)
+	if !ok {
+		return
+	}
+
+	var req listWebhookDeliveriesRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	arg := db.ListWebhookDeliveriesParams{
+		SubscriptionID: subscription.ID,
+		Limit:          req.PageSize,
+		Offset:         (req.PageID - 1) * req.PageSize,
+	}
+
+	deliveries, err := server.store.ListWebhookDeliveries(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, deliveries)
+}
+
+type redeliverWebhookRequest struct {
+	DeliveryID int64 `uri:"delivery_id" binding:"required,min=1"`
+}
+
+// redeliverWebhook queues the delivery again with a fresh set of attempts
+func (server *Server) redeliverWebhook(ctx *gin.Context) {
+	subscription, ok := server.getOwnedWebhook(ctx)
+	if !ok {
+		return
+	}
+
+	var req redeliverWebhookRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	arg := db.RedeliverWebhookDeliveryParams{
+		ID:             req.DeliveryID,
+		SubscriptionID: subscription.ID,
+	}
+
+	delivery, err := server.store.RedeliverWebhookDelivery(ctx, arg)
+	if err != nil {
+		// Deliveries of other webhooks are not found
+		if err == db.ErrRecordNotFound {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, delivery)
+}
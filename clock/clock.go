@@ -0,0 +1,53 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time
+// The code deciding on expiry or scheduling reads the time from a Clock, so tests can replace it with a Fake
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is the Clock of the system
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Fake is a Clock which stands still until it is moved, it is safe for concurrent use
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake creates a Fake clock showing the given time
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (fake *Fake) Now() time.Time {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return fake.now
+}
+
+// Advance moves the clock forward by d, or back if d is negative
+func (fake *Fake) Advance(d time.Duration) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.now = fake.now.Add(d)
+}
+
+// Set moves the clock to the given time
+func (fake *Fake) Set(now time.Time) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.now = now
+}
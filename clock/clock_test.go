@@ -0,0 +1,28 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	require.Equal(t, start, fake.Now())
+	require.Equal(t, start, fake.Now())
+
+	fake.Advance(time.Minute)
+	require.Equal(t, start.Add(time.Minute), fake.Now())
+
+	fake.Advance(-2 * time.Minute)
+	require.Equal(t, start.Add(-time.Minute), fake.Now())
+
+	fake.Set(start)
+	require.Equal(t, start, fake.Now())
+}
+
+func TestReal(t *testing.T) {
+	require.WithinDuration(t, time.Now(), Real{}.Now(), time.Second)
+}
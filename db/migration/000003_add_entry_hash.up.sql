@@ -0,0 +1,7 @@
+ALTER TABLE "entries" ADD COLUMN "prev_hash" varchar NOT NULL DEFAULT '';
+
+ALTER TABLE "entries" ADD COLUMN "hash" varchar NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN "entries"."prev_hash" IS 'hash of the previous entry of the same account';
+
+COMMENT ON COLUMN "entries"."hash" IS 'sha256 over prev_hash and the entry contents';
\ No newline at end of file
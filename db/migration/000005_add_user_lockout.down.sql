@@ -0,0 +1,7 @@
+ALTER TABLE IF EXISTS "users" DROP COLUMN IF EXISTS "locked_until";
+
+ALTER TABLE IF EXISTS "users" DROP COLUMN IF EXISTS "lockout_count";
+
+ALTER TABLE IF EXISTS "users" DROP COLUMN IF EXISTS "failed_login_attempts";
+
+ALTER TABLE IF EXISTS "users" DROP COLUMN IF EXISTS "role";
\ No newline at end of file
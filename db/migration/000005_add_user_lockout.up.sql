@@ -0,0 +1,11 @@
+ALTER TABLE "users" ADD COLUMN "role" varchar NOT NULL DEFAULT 'depositor';
+
+ALTER TABLE "users" ADD COLUMN "failed_login_attempts" integer NOT NULL DEFAULT 0;
+
+ALTER TABLE "users" ADD COLUMN "lockout_count" integer NOT NULL DEFAULT 0;
+
+ALTER TABLE "users" ADD COLUMN "locked_until" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z';
+
+COMMENT ON COLUMN "users"."failed_login_attempts" IS 'failed logins since the last successful login or lockout';
+
+COMMENT ON COLUMN "users"."lockout_count" IS 'lockouts since the last successful login, used to escalate the lockout period';
\ No newline at end of file
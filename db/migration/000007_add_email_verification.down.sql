@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "verify_emails";
+
+ALTER TABLE IF EXISTS "users" DROP COLUMN IF EXISTS "is_email_verified";
\ No newline at end of file
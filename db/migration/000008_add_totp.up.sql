@@ -0,0 +1,36 @@
+ALTER TABLE "users" ADD COLUMN "totp_secret" varchar NOT NULL DEFAULT '';
+
+ALTER TABLE "users" ADD COLUMN "is_totp_enabled" bool NOT NULL DEFAULT false;
+
+ALTER TABLE "users" ADD COLUMN "totp_last_used_step" bigint NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "users"."totp_secret" IS 'base32 TOTP secret, set on enrollment and used for login once is_totp_enabled is true';
+
+COMMENT ON COLUMN "users"."totp_last_used_step" IS 'time step of the last accepted TOTP code, a code cannot be used twice';
+
+CREATE TABLE "recovery_codes" (
+  "id" bigserial PRIMARY KEY,
+  "username" varchar NOT NULL,
+  "code_hash" varchar NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE UNIQUE INDEX ON "recovery_codes" ("username", "code_hash");
+
+ALTER TABLE "recovery_codes" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+CREATE TABLE "mfa_challenges" (
+  "id" bigserial PRIMARY KEY,
+  "username" varchar NOT NULL,
+  "token_hash" varchar UNIQUE NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "mfa_challenges" ("username");
+
+COMMENT ON COLUMN "mfa_challenges"."token_hash" IS 'sha256 of the challenge token returned by the first login step';
+
+ALTER TABLE "mfa_challenges" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
\ No newline at end of file
@@ -0,0 +1,31 @@
+CREATE TABLE "service_accounts" (
+  "id" bigserial PRIMARY KEY,
+  "owner" varchar NOT NULL,
+  "name" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE UNIQUE INDEX ON "service_accounts" ("owner", "name");
+
+COMMENT ON COLUMN "service_accounts"."owner" IS 'user whose accounts the service account acts on, within the scopes of its api keys';
+
+ALTER TABLE "service_accounts" ADD FOREIGN KEY ("owner") REFERENCES "users" ("username");
+
+CREATE TABLE "api_keys" (
+  "id" bigserial PRIMARY KEY,
+  "service_account_id" bigint NOT NULL,
+  "key_prefix" varchar NOT NULL,
+  "key_hash" varchar UNIQUE NOT NULL,
+  "scopes" varchar[] NOT NULL,
+  "last_used_at" timestamptz,
+  "revoked_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "api_keys" ("service_account_id");
+
+COMMENT ON COLUMN "api_keys"."key_prefix" IS 'first characters of the key, shown in listings to tell the keys apart';
+
+COMMENT ON COLUMN "api_keys"."key_hash" IS 'sha256 of the key, the key itself is returned only once when it is created';
+
+ALTER TABLE "api_keys" ADD FOREIGN KEY ("service_account_id") REFERENCES "service_accounts" ("id");
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "outbox_checkpoints";
+
+DROP TABLE IF EXISTS "outbox_events";
+
+ALTER TABLE IF EXISTS "webhook_deliveries" DROP COLUMN IF EXISTS "event_id";
\ No newline at end of file
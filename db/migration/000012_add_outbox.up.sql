@@ -0,0 +1,26 @@
+CREATE TABLE "outbox_events" (
+  "id" bigserial PRIMARY KEY,
+  "txid" bigint NOT NULL DEFAULT (txid_current()),
+  "event_type" varchar NOT NULL,
+  "payload" jsonb NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "outbox_events" ("txid", "id");
+
+COMMENT ON COLUMN "outbox_events"."txid" IS 'transaction which wrote the event, events are dispatched in the order of their transactions once no older transaction is still running';
+
+CREATE TABLE "outbox_checkpoints" (
+  "handler" varchar PRIMARY KEY,
+  "last_txid" bigint NOT NULL,
+  "last_event_id" bigint NOT NULL,
+  "updated_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+COMMENT ON COLUMN "outbox_checkpoints"."handler" IS 'name under which the handler is registered with the dispatcher';
+
+ALTER TABLE "webhook_deliveries" ADD COLUMN "event_id" bigint;
+
+COMMENT ON COLUMN "webhook_deliveries"."event_id" IS 'outbox event the delivery was created from, an event is delivered at most once to each webhook';
+
+CREATE UNIQUE INDEX ON "webhook_deliveries" ("subscription_id", "event_type", "event_id");
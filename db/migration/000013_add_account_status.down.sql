@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS "transfers" DROP COLUMN IF EXISTS "reversed_by";
+
+ALTER TABLE IF EXISTS "accounts" DROP COLUMN IF EXISTS "status";
\ No newline at end of file
@@ -0,0 +1,9 @@
+ALTER TABLE "accounts" ADD COLUMN "status" varchar NOT NULL DEFAULT 'active';
+
+ALTER TABLE "transfers" ADD COLUMN "reversed_by" bigint;
+
+ALTER TABLE "transfers" ADD FOREIGN KEY ("reversed_by") REFERENCES "transfers" ("id");
+
+COMMENT ON COLUMN "accounts"."status" IS 'active, frozen or closed, only active accounts take part in transfers';
+
+COMMENT ON COLUMN "transfers"."reversed_by" IS 'the transfer which gave the money back, set once a transfer is reversed';
\ No newline at end of file
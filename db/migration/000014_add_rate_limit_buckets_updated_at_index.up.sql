@@ -0,0 +1 @@
+CREATE INDEX ON "rate_limit_buckets" ("updated_at");
\ No newline at end of file
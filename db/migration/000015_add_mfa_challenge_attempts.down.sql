@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS "mfa_challenges" DROP COLUMN IF EXISTS "attempts";
\ No newline at end of file
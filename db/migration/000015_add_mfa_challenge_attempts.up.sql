@@ -0,0 +1,3 @@
+ALTER TABLE "mfa_challenges" ADD COLUMN "attempts" integer NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "mfa_challenges"."attempts" IS 'codes tried with the challenge, it is rejected once the limit is reached';
\ No newline at end of file
@@ -0,0 +1,10 @@
+ALTER TABLE "accounts" ADD COLUMN "latest_entry_hash" varchar NOT NULL DEFAULT '';
+
+UPDATE "accounts" SET "latest_entry_hash" = "latest"."hash"
+FROM (
+  SELECT DISTINCT ON ("account_id") "account_id", "hash" FROM "entries"
+  ORDER BY "account_id", "id" DESC
+) AS "latest"
+WHERE "accounts"."id" = "latest"."account_id";
+
+COMMENT ON COLUMN "accounts"."latest_entry_hash" IS 'hash of the latest entry of the account, anchors the end of its hash chain';
\ No newline at end of file
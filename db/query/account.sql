@@ -23,6 +23,12 @@ ORDER BY id
 LIMIT $2
 OFFSET $3;
 
+-- name: ListAccountsAfter :many
+SELECT * FROM accounts
+WHERE id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(page_size);
+
 -- name: UpdateAccount :one
 UPDATE accounts
 SET balance = $2
@@ -35,6 +41,17 @@ SET balance = balance + sqlc.arg(amount)
 WHERE id = sqlc.arg(id)
 RETURNING *;
 
+-- name: UpdateAccountStatus :one
+UPDATE accounts
+SET status = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: SetAccountLatestEntryHash :exec
+UPDATE accounts
+SET latest_entry_hash = $2
+WHERE id = $1;
+
 -- name: DeleteAccount :exec
 DELETE FROM accounts
 WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,31 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (
+    service_account_id,
+    key_prefix,
+    key_hash,
+    scopes
+) VALUES (
+    $1, $2, $3, $4
+) RETURNING *;
+
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys
+WHERE service_account_id = $1
+ORDER BY id;
+
+-- name: GetAPIKeyForAuth :one
+SELECT api_keys.id, api_keys.scopes, api_keys.revoked_at, service_accounts.owner
+FROM api_keys
+JOIN service_accounts ON service_accounts.id = api_keys.service_account_id
+WHERE api_keys.key_hash = $1 LIMIT 1;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = now()
+WHERE id = $1;
+
+-- name: RevokeAPIKey :one
+UPDATE api_keys
+SET revoked_at = now()
+WHERE id = $1 AND service_account_id = $2 AND revoked_at IS NULL
+RETURNING *;
@@ -1,18 +1,50 @@
 -- name: CreateEntry :one
 INSERT INTO entries (
     account_id,
-    amount
+    amount,
+    prev_hash,
+    hash
 ) VALUES (
-    $1, $2
+    $1, $2, $3, $4
 ) RETURNING *;
 
+-- name: SetEntryHash :one
+UPDATE entries
+SET hash = $2
+WHERE id = $1
+RETURNING *;
+
 -- name: GetEntry :one
 SELECT * FROM entries
 WHERE id = $1 LIMIT 1;
 
+-- name: GetLatestEntry :one
+SELECT * FROM entries
+WHERE account_id = $1
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: GetFirstChainedEntryID :one
+SELECT id FROM entries
+WHERE hash <> ''
+ORDER BY id
+LIMIT 1;
+
 -- name: ListEntries :many
 SELECT * FROM entries
 WHERE account_id = $1
 ORDER BY id
 LIMIT $2
-OFFSET $3;
\ No newline at end of file
+OFFSET $3;
+
+-- name: ListEntriesAfter :many
+SELECT * FROM entries
+WHERE id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(page_size);
+
+-- name: ListAccountEntriesAfter :many
+SELECT * FROM entries
+WHERE account_id = sqlc.arg(account_id) AND id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(page_size);
\ No newline at end of file
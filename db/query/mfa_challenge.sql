@@ -0,0 +1,22 @@
+-- name: CreateMFAChallenge :one
+INSERT INTO mfa_challenges (
+    username,
+    token_hash,
+    expires_at
+) VALUES (
+    $1, $2, $3
+) RETURNING *;
+
+-- name: GetMFAChallenge :one
+SELECT * FROM mfa_challenges
+WHERE token_hash = $1 LIMIT 1;
+
+-- name: UseMFAChallenge :execrows
+UPDATE mfa_challenges
+SET used_at = now()
+WHERE id = $1 AND used_at IS NULL;
+
+-- name: CountMFAChallengeAttempt :execrows
+UPDATE mfa_challenges
+SET attempts = attempts + 1
+WHERE id = $1 AND used_at IS NULL AND attempts < sqlc.arg(max_attempts)::int;
@@ -0,0 +1,28 @@
+-- name: CreateOutboxEvent :one
+INSERT INTO outbox_events (
+    event_type,
+    payload
+) VALUES (
+    $1, $2
+) RETURNING *;
+
+-- name: ListPendingOutboxEvents :many
+SELECT * FROM outbox_events
+WHERE (txid, id) > (sqlc.arg(last_txid), sqlc.arg(last_event_id))
+    AND txid < txid_snapshot_xmin(txid_current_snapshot())
+ORDER BY txid, id
+LIMIT sqlc.arg(batch_size);
+
+-- name: GetOutboxCheckpoint :one
+SELECT * FROM outbox_checkpoints
+WHERE handler = $1 LIMIT 1;
+
+-- name: SaveOutboxCheckpoint :exec
+INSERT INTO outbox_checkpoints (
+    handler,
+    last_txid,
+    last_event_id
+) VALUES (
+    $1, $2, $3
+) ON CONFLICT (handler) DO UPDATE
+SET last_txid = EXCLUDED.last_txid, last_event_id = EXCLUDED.last_event_id, updated_at = now();
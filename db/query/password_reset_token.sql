@@ -0,0 +1,23 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (
+    username,
+    token_hash,
+    expires_at
+) VALUES (
+    $1, $2, $3
+) RETURNING *;
+
+-- name: GetPasswordResetToken :one
+SELECT * FROM password_reset_tokens
+WHERE token_hash = $1 LIMIT 1;
+
+-- name: GetPasswordResetTokenForUpdate :one
+SELECT * FROM password_reset_tokens
+WHERE token_hash = $1 LIMIT 1
+FOR UPDATE;
+
+-- name: UsePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = now()
+WHERE id = $1
+RETURNING *;
\ No newline at end of file
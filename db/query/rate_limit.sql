@@ -0,0 +1,23 @@
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets AS b (
+    key,
+    tokens,
+    allowed,
+    updated_at
+) VALUES (
+    sqlc.arg(key), sqlc.arg(burst)::float8 - 1, true, now()
+)
+ON CONFLICT (key) DO UPDATE SET
+    tokens = CASE
+        WHEN LEAST(sqlc.arg(burst)::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::float8 * sqlc.arg(per_second)::float8) >= 1
+        THEN LEAST(sqlc.arg(burst)::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::float8 * sqlc.arg(per_second)::float8) - 1
+        ELSE LEAST(sqlc.arg(burst)::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::float8 * sqlc.arg(per_second)::float8)
+    END,
+    allowed = LEAST(sqlc.arg(burst)::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::float8 * sqlc.arg(per_second)::float8) >= 1,
+    updated_at = now()
+RETURNING *;
+
+-- name: DeleteFullRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE key LIKE sqlc.arg(key_prefix)::text || '%'
+AND updated_at < now() - make_interval(secs => sqlc.arg(refill_seconds)::float8);
\ No newline at end of file
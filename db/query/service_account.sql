@@ -0,0 +1,16 @@
+-- name: CreateServiceAccount :one
+INSERT INTO service_accounts (
+    owner,
+    name
+) VALUES (
+    $1, $2
+) RETURNING *;
+
+-- name: GetServiceAccount :one
+SELECT * FROM service_accounts
+WHERE id = $1 LIMIT 1;
+
+-- name: ListServiceAccounts :many
+SELECT * FROM service_accounts
+WHERE owner = $1
+ORDER BY id;
@@ -0,0 +1,31 @@
+-- name: CreateSession :one
+INSERT INTO sessions (
+    id,
+    username,
+    user_agent,
+    client_ip,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: GetSession :one
+SELECT * FROM sessions
+WHERE id = $1 LIMIT 1;
+
+-- name: TouchSession :one
+UPDATE sessions
+SET last_used_at = now()
+WHERE id = $1 AND revoked_at IS NULL
+RETURNING *;
+
+-- name: ListActiveSessions :many
+SELECT * FROM sessions
+WHERE username = $1 AND revoked_at IS NULL AND expires_at > now()
+ORDER BY last_used_at DESC;
+
+-- name: RevokeSession :one
+UPDATE sessions
+SET revoked_at = now()
+WHERE id = $1 AND username = $2 AND revoked_at IS NULL
+RETURNING *;
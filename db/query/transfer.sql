@@ -11,6 +11,11 @@ INSERT INTO transfers (
 SELECT * FROM transfers
 WHERE id = $1 LIMIT 1;
 
+-- name: GetTransferForUpdate :one
+SELECT * FROM transfers
+WHERE id = $1 LIMIT 1
+FOR NO KEY UPDATE;
+
 -- name: ListTransfers :many
 SELECT * FROM transfers
 WHERE
@@ -18,4 +23,10 @@ WHERE
     to_account_id = $2
 ORDER BY id
 LIMIT $3
-OFFSET $4;
\ No newline at end of file
+OFFSET $4;
+
+-- name: SetTransferReversedBy :one
+UPDATE transfers
+SET reversed_by = $2
+WHERE id = $1
+RETURNING *;
\ No newline at end of file
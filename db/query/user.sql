@@ -10,4 +10,87 @@ INSERT INTO users (
 
 -- name: GetUser :one
 SELECT * FROM users
-WHERE username = $1 LIMIT 1;
\ No newline at end of file
+WHERE username = $1 LIMIT 1;
+
+-- name: GetUserForUpdate :one
+SELECT * FROM users
+WHERE username = $1 LIMIT 1
+FOR UPDATE;
+
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE email = $1 LIMIT 1;
+
+-- name: UpdateUserPassword :one
+UPDATE users
+SET
+    hashed_password = $2,
+    password_changed_at = $3
+WHERE username = $1
+RETURNING *;
+
+-- name: RecordFailedLogin :one
+UPDATE users
+SET failed_login_attempts = failed_login_attempts + 1
+WHERE username = $1
+RETURNING *;
+
+-- name: LockUser :one
+UPDATE users
+SET
+    failed_login_attempts = 0,
+    lockout_count = lockout_count + 1,
+    locked_until = $2
+WHERE username = $1
+RETURNING *;
+
+-- name: ResetFailedLogins :exec
+UPDATE users
+SET
+    failed_login_attempts = 0,
+    lockout_count = 0
+WHERE username = $1;
+
+-- name: UnlockUser :one
+UPDATE users
+SET
+    failed_login_attempts = 0,
+    lockout_count = 0,
+    locked_until = now()
+WHERE username = $1
+RETURNING *;
+
+-- name: GetUserPasswordChangedAt :one
+SELECT password_changed_at FROM users
+WHERE username = $1 LIMIT 1;
+
+-- name: VerifyUserEmail :one
+UPDATE users
+SET is_email_verified = true
+WHERE username = $1
+RETURNING *;
+
+-- name: SetUserTOTPSecret :one
+UPDATE users
+SET totp_secret = $2
+WHERE username = $1
+RETURNING *;
+
+-- name: EnableUserTOTP :one
+UPDATE users
+SET
+    is_totp_enabled = true,
+    totp_last_used_step = $2
+WHERE username = $1
+RETURNING *;
+
+-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_used_step = sqlc.arg(step)
+WHERE username = sqlc.arg(username) AND totp_last_used_step < sqlc.arg(step);
+
+-- name: UpdateUserPasswordHash :one
+UPDATE users
+SET hashed_password = $2
+WHERE username = $1
+RETURNING *;
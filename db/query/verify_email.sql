@@ -0,0 +1,20 @@
+-- name: CreateVerifyEmail :one
+INSERT INTO verify_emails (
+    username,
+    email,
+    secret_code_hash,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4
+) RETURNING *;
+
+-- name: GetVerifyEmailForUpdate :one
+SELECT * FROM verify_emails
+WHERE id = $1 LIMIT 1
+FOR UPDATE;
+
+-- name: UseVerifyEmail :one
+UPDATE verify_emails
+SET used_at = now()
+WHERE id = $1
+RETURNING *;
@@ -0,0 +1,69 @@
+-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions (
+    owner,
+    url,
+    event_types,
+    secret
+) VALUES (
+    $1, $2, $3, $4
+) RETURNING *;
+
+-- name: GetWebhookSubscription :one
+SELECT * FROM webhook_subscriptions
+WHERE id = $1 LIMIT 1;
+
+-- name: ListWebhookSubscriptions :many
+SELECT * FROM webhook_subscriptions
+WHERE owner = $1
+ORDER BY id;
+
+-- name: DeleteWebhookSubscription :exec
+DELETE FROM webhook_subscriptions
+WHERE id = $1;
+
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+SELECT id, sqlc.arg(event_id), sqlc.arg(event_type), sqlc.arg(payload)
+FROM webhook_subscriptions
+WHERE owner = sqlc.arg(owner) AND sqlc.arg(event_type) = ANY(event_types)
+ON CONFLICT DO NOTHING;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE subscription_id = $1
+ORDER BY id DESC
+LIMIT $2
+OFFSET $3;
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET next_attempt_at = sqlc.arg(locked_until)
+WHERE id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE status = 'pending' AND next_attempt_at <= now()
+    ORDER BY next_attempt_at
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkWebhookDelivered :exec
+UPDATE webhook_deliveries
+SET status = 'delivered', attempts = attempts + 1, last_error = '', delivered_at = now()
+WHERE id = $1;
+
+-- name: RetryWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET attempts = attempts + 1, next_attempt_at = $2, last_error = $3
+WHERE id = $1;
+
+-- name: DeadLetterWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = 'dead', attempts = attempts + 1, last_error = $2
+WHERE id = $1;
+
+-- name: RedeliverWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending', attempts = 0, next_attempt_at = now(), last_error = '', delivered_at = NULL
+WHERE id = $1 AND subscription_id = $2
+RETURNING *;
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// verifyPageSize is the number of entries loaded at once while walking the ledger
+const verifyPageSize = 1000
+
+// ComputeEntryHash returns the hash chaining an entry to the previous entry of the same account
+// It covers the ID and the creation time of the entry too, so an entry cannot be renumbered or backdated unnoticed
+// The first entry of an account is chained to an empty prevHash
+func ComputeEntryHash(prevHash string, entryID int64, accountID int64, amount int64, createdAt time.Time) string {
+	// The time is hashed in microseconds, the precision it is stored with
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%d|%d", prevHash, entryID, accountID, amount, createdAt.UnixMicro())))
+	return hex.EncodeToString(sum[:])
+}
+
+// createChainedEntry creates a new entry linked to the latest entry of the account and anchors it on the account
+// The account must already be locked by the calling transaction
+func createChainedEntry(ctx context.Context, q Querier, accountID int64, amount int64) (Entry, error) {
+	var prevHash string
+
+	latest, err := q.GetLatestEntry(ctx, accountID)
+	if err != nil && err != ErrRecordNotFound {
+		return Entry{}, err
+	}
+	if err == nil {
+		prevHash = latest.Hash
+	}
+
+	entry, err := q.CreateEntry(ctx, CreateEntryParams{
+		AccountID: accountID,
+		Amount:    amount,
+		PrevHash:  prevHash,
+	})
+	if err != nil {
+		return Entry{}, err
+	}
+
+	// The ID and the creation time are set by the insert, so the hash is added right after it
+	entry, err = q.SetEntryHash(ctx, SetEntryHashParams{
+		ID:   entry.ID,
+		Hash: ComputeEntryHash(prevHash, entry.ID, entry.AccountID, entry.Amount, entry.CreatedAt),
+	})
+	if err != nil {
+		return Entry{}, err
+	}
+
+	// The account keeps the hash of its latest entry, so deleting the newest entries doesn't leave a valid chain behind
+	err = q.SetAccountLatestEntryHash(ctx, SetAccountLatestEntryHashParams{
+		ID:              accountID,
+		LatestEntryHash: entry.Hash,
+	})
+	return entry, err
+}
+
+// ChainBreak describes the first entry which doesn't match the hash chain of its account
+type ChainBreak struct {
+	AccountID        int64  `json:"account_id"`
+	Entry            Entry  `json:"entry"`
+	ExpectedPrevHash string `json:"expected_prev_hash"`
+	ExpectedHash     string `json:"expected_hash"`
+	// HeadMismatch is set when the chain of the account doesn't end at the hash anchored on the account,
+	// e.g. because its latest entries were deleted, Entry is then the latest entry left, if any,
+	// and ExpectedHash the hash anchored on the account
+	HeadMismatch bool `json:"head_mismatch"`
+}
+
+// chainVerifier keeps the latest entry of every account seen so far
+type chainVerifier struct {
+	latest map[int64]Entry
+	// chainStartID is the ID of the first hashed entry of the whole ledger, every entry from it on must be hashed
+	chainStartID int64
+}
+
+func newChainVerifier(chainStartID int64) *chainVerifier {
+	return &chainVerifier{
+		latest:       make(map[int64]Entry),
+		chainStartID: chainStartID,
+	}
+}
+
+// newLedgerVerifier creates a verifier starting the chain at the first hashed entry of the ledger
+// Without it, clearing the hashes of all the entries of an account would pass them off as legacy entries
+func newLedgerVerifier(ctx context.Context, q Querier) (*chainVerifier, error) {
+	chainStartID, err := q.GetFirstChainedEntryID(ctx)
+	if err != nil && err != ErrRecordNotFound {
+		return nil, err
+	}
+	return newChainVerifier(chainStartID), nil
+}
+
+// check must be called with entries in the order they were created
+func (v *chainVerifier) check(entry Entry) *ChainBreak {
+	latest, chained := v.latest[entry.AccountID]
+	prevHash := latest.Hash
+
+	// Entries created before the hash chain was introduced have no hash,
+	// the chain of an account starts with its first hashed entry, which can't come after the start of the ledger's chain
+	if !chained && entry.Hash == "" && (v.chainStartID == 0 || entry.ID < v.chainStartID) {
+		return nil
+	}
+
+	expectedHash := ComputeEntryHash(prevHash, entry.ID, entry.AccountID, entry.Amount, entry.CreatedAt)
+	if entry.PrevHash != prevHash || entry.Hash != expectedHash {
+		return &ChainBreak{
+			AccountID:        entry.AccountID,
+			Entry:            entry,
+			ExpectedPrevHash: prevHash,
+			ExpectedHash:     expectedHash,
+		}
+	}
+
+	v.latest[entry.AccountID] = entry
+	if v.chainStartID == 0 {
+		v.chainStartID = entry.ID
+	}
+	return nil
+}
+
+// VerifyLedger walks all entries and recomputes the hash chain of every account
+// It returns the first broken link, or nil if the whole ledger is intact
+func VerifyLedger(ctx context.Context, q Querier) (*ChainBreak, error) {
+	verifier, err := newLedgerVerifier(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var afterID int64
+	for {
+		entries, err := q.ListEntriesAfter(ctx, ListEntriesAfterParams{
+			AfterID:  afterID,
+			PageSize: verifyPageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if chainBreak := verifier.check(entry); chainBreak != nil {
+				return chainBreak, nil
+			}
+		}
+
+		if len(entries) < verifyPageSize {
+			break
+		}
+		afterID = entries[len(entries)-1].ID
+	}
+
+	return verifyAccountHeads(ctx, q, verifier)
+}
+
+// verifyAccountHeads checks that the chain of every account ends at the hash anchored on the account
+// The accounts are read after the entries, so that every anchored hash is of an entry created before the account was read
+func verifyAccountHeads(ctx context.Context, q Querier, verifier *chainVerifier) (*ChainBreak, error) {
+	var afterID int64
+	for {
+		accounts, err := q.ListAccountsAfter(ctx, ListAccountsAfterParams{
+			AfterID:  afterID,
+			PageSize: verifyPageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, account := range accounts {
+			chainBreak, err := verifyAccountHead(ctx, q, verifier, account)
+			if err != nil || chainBreak != nil {
+				return chainBreak, err
+			}
+		}
+
+		if len(accounts) < verifyPageSize {
+			return nil, nil
+		}
+		afterID = accounts[len(accounts)-1].ID
+	}
+}
+
+// verifyAccountHead checks that the chain of the account ends at the hash anchored on the account
+// The entries created since the verifier has seen the account are checked up to the anchored one,
+// so the transfers made while the ledger is verified are not taken for a break
+func verifyAccountHead(ctx context.Context, q Querier, verifier *chainVerifier, account Account) (*ChainBreak, error) {
+	afterID := verifier.latest[account.ID].ID
+	for {
+		latest := verifier.latest[account.ID]
+		if latest.Hash == account.LatestEntryHash {
+			return nil, nil
+		}
+
+		entries, err := q.ListAccountEntriesAfter(ctx, ListAccountEntriesAfterParams{
+			AccountID: account.ID,
+			AfterID:   afterID,
+			PageSize:  verifyPageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(entries) == 0 {
+			return &ChainBreak{
+				AccountID:    account.ID,
+				Entry:        latest,
+				ExpectedHash: account.LatestEntryHash,
+				HeadMismatch: true,
+			}, nil
+		}
+
+		for _, entry := range entries {
+			if chainBreak := verifier.check(entry); chainBreak != nil {
+				return chainBreak, nil
+			}
+			// Entries created after the account was read come after its anchored hash and are not checked
+			if entry.Hash == account.LatestEntryHash {
+				return nil, nil
+			}
+		}
+		afterID = entries[len(entries)-1].ID
+	}
+}
+
+// VerifyAccountLedger recomputes the hash chain of a single account
+// It returns the first broken link, or nil if the chain is intact
+func VerifyAccountLedger(ctx context.Context, q Querier, accountID int64) (*ChainBreak, error) {
+	verifier, err := newLedgerVerifier(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var afterID int64
+	for {
+		entries, err := q.ListAccountEntriesAfter(ctx, ListAccountEntriesAfterParams{
+			AccountID: accountID,
+			AfterID:   afterID,
+			PageSize:  verifyPageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if chainBreak := verifier.check(entry); chainBreak != nil {
+				return chainBreak, nil
+			}
+		}
+
+		if len(entries) < verifyPageSize {
+			break
+		}
+		afterID = entries[len(entries)-1].ID
+	}
+
+	account, err := q.GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return verifyAccountHead(ctx, q, verifier, account)
+}
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+// buildChain creates n entries of an account linked the same way as they are in TransferTX, numbered from firstID
+func buildChain(accountID int64, firstID int64, n int) []Entry {
+	entries := make([]Entry, n)
+
+	var prevHash string
+	createdAt := time.Now().Add(-time.Hour)
+	for i := 0; i < n; i++ {
+		entries[i] = Entry{
+			ID:        firstID + int64(i),
+			AccountID: accountID,
+			Amount:    util.RandomMoney(),
+			CreatedAt: createdAt.Add(time.Duration(i) * time.Minute),
+			PrevHash:  prevHash,
+		}
+		entries[i].Hash = ComputeEntryHash(prevHash, entries[i].ID, accountID, entries[i].Amount, entries[i].CreatedAt)
+		prevHash = entries[i].Hash
+	}
+
+	return entries
+}
+
+func TestChainVerifier(t *testing.T) {
+	testCases := []struct {
+		name        string
+		tamper      func(entries []Entry)
+		brokenEntry int
+	}{
+		{
+			name:        "Intact",
+			tamper:      func(entries []Entry) {},
+			brokenEntry: -1,
+		},
+		{
+			name: "ChangedAmount",
+			tamper: func(entries []Entry) {
+				entries[2].Amount++
+			},
+			brokenEntry: 2,
+		},
+		{
+			name: "RecomputedHash",
+			tamper: func(entries []Entry) {
+				// even if the hash of the tampered entry is recomputed, the next entry is still linked to the old one
+				entries[2].Amount++
+				entries[2].Hash = ComputeEntryHash(entries[2].PrevHash, entries[2].ID, entries[2].AccountID, entries[2].Amount, entries[2].CreatedAt)
+			},
+			brokenEntry: 3,
+		},
+		{
+			name: "Backdated",
+			tamper: func(entries []Entry) {
+				entries[3].CreatedAt = entries[3].CreatedAt.Add(-24 * time.Hour)
+			},
+			brokenEntry: 3,
+		},
+		{
+			name: "Renumbered",
+			tamper: func(entries []Entry) {
+				entries[3].ID += 10
+				entries[4].ID += 10
+			},
+			brokenEntry: 3,
+		},
+		{
+			name: "DeletedEntry",
+			tamper: func(entries []Entry) {
+				copy(entries[1:], entries[2:])
+			},
+			brokenEntry: 1,
+		},
+		{
+			name: "ClearedHash",
+			tamper: func(entries []Entry) {
+				entries[4].Hash = ""
+			},
+			brokenEntry: 4,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			entries := buildChain(util.RandomInt(1, 1000), 1, 5)
+			tc.tamper(entries)
+
+			verifier := newChainVerifier(0)
+			var chainBreak *ChainBreak
+			for _, entry := range entries {
+				if chainBreak = verifier.check(entry); chainBreak != nil {
+					break
+				}
+			}
+
+			if tc.brokenEntry < 0 {
+				require.Nil(t, chainBreak)
+				return
+			}
+			require.NotNil(t, chainBreak)
+			require.Equal(t, entries[tc.brokenEntry], chainBreak.Entry)
+		})
+	}
+}
+
+func TestChainVerifierSkipsLegacyEntries(t *testing.T) {
+	accountID := util.RandomInt(1, 1000)
+	legacy := Entry{ID: 1, AccountID: accountID, Amount: util.RandomMoney()}
+
+	verifier := newChainVerifier(0)
+	require.Nil(t, verifier.check(legacy))
+
+	for _, entry := range buildChain(accountID, legacy.ID+1, 3) {
+		require.Nil(t, verifier.check(entry))
+	}
+
+	// once the chain of an account has started, an entry without hash breaks it
+	require.NotNil(t, verifier.check(legacy))
+}
+
+func TestChainVerifierUnhashedAfterChainStart(t *testing.T) {
+	legacy := Entry{ID: 1, AccountID: util.RandomInt(1, 1000), Amount: util.RandomMoney()}
+	entries := buildChain(util.RandomInt(1001, 2000), legacy.ID+1, 3)
+
+	verifier := newChainVerifier(0)
+	require.Nil(t, verifier.check(legacy))
+	for _, entry := range entries {
+		require.Nil(t, verifier.check(entry))
+	}
+
+	// Once the ledger's chain has started, every entry is hashed, so an account whose hashes were cleared is caught too
+	cleared := Entry{ID: entries[2].ID + 1, AccountID: util.RandomInt(2001, 3000), Amount: util.RandomMoney()}
+	chainBreak := verifier.check(cleared)
+	require.NotNil(t, chainBreak)
+	require.Equal(t, cleared, chainBreak.Entry)
+
+	// The verifier of a single account is given the start of the ledger's chain
+	verifier = newChainVerifier(cleared.ID)
+	require.Nil(t, verifier.check(legacy))
+	require.NotNil(t, verifier.check(cleared))
+}
+
+func TestVerifyLedgerAccountHead(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	owner := createConformanceUser(t, store).Username
+	account1 := createConformanceAccount(t, store, owner, util.USD)
+	account2 := createConformanceAccount(t, store, owner, util.EUR)
+
+	var results []TransferTxResult
+	for i := 0; i < 3; i++ {
+		result, err := store.TransferTX(ctx, TransferTxParams{
+			FromAccountID: account1.ID,
+			ToAccountID:   account2.ID,
+			Amount:        10,
+		})
+		require.NoError(t, err)
+		results = append(results, result)
+	}
+
+	chainBreak, err := VerifyLedger(ctx, store)
+	require.NoError(t, err)
+	require.Nil(t, chainBreak)
+
+	// An account read before its latest entries were created still ends its chain at its anchored hash
+	verifier, err := newLedgerVerifier(ctx, store)
+	require.NoError(t, err)
+	require.Nil(t, verifier.check(results[0].FromEntry))
+
+	account1.LatestEntryHash = results[1].FromEntry.Hash
+	chainBreak, err = verifyAccountHead(ctx, store, verifier, account1)
+	require.NoError(t, err)
+	require.Nil(t, chainBreak)
+
+	// The newest entry deleted leaves a valid chain, which doesn't end at the hash anchored on the account though
+	delete(store.entries, results[2].FromEntry.ID)
+	store.latestEntries[account1.ID] = results[1].FromEntry.ID
+
+	for _, verify := range []func() (*ChainBreak, error){
+		func() (*ChainBreak, error) { return VerifyLedger(ctx, store) },
+		func() (*ChainBreak, error) { return VerifyAccountLedger(ctx, store, account1.ID) },
+	} {
+		chainBreak, err := verify()
+		require.NoError(t, err)
+		require.NotNil(t, chainBreak)
+		require.True(t, chainBreak.HeadMismatch)
+		require.Equal(t, account1.ID, chainBreak.AccountID)
+		require.Equal(t, results[1].FromEntry, chainBreak.Entry)
+		require.Equal(t, results[2].FromEntry.Hash, chainBreak.ExpectedHash)
+	}
+
+	chainBreak, err = VerifyAccountLedger(ctx, store, account2.ID)
+	require.NoError(t, err)
+	require.Nil(t, chainBreak)
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SQLSTATE codes of the constraint violations the callers of the store react to
+const (
+	ForeignKeyViolation = "23503"
+	UniqueViolation     = "23505"
+)
+
+// ErrRecordNotFound is returned by the queries of a single row when there is no such row
+// The callers compare with it rather than with the error of the driver
+var ErrRecordNotFound = pgx.ErrNoRows
+
+// ErrorCode returns the SQLSTATE code of a db error, or an empty string for the errors not returned by the db
+func ErrorCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
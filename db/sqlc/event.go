@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// constants for the types of all domain events written to the outbox
+const (
+	TransferCreatedEventType = "transfer.created"
+	AccountCreatedEventType  = "account.created"
+	UserCreatedEventType     = "user.created"
+)
+
+// Event is a domain event, a record of something that happened in a transaction of the store
+// Events are written to the outbox in the transaction itself, so an event exists if and only if the change is committed
+type Event interface {
+	EventType() string
+}
+
+// TransferCreated is written by TransferTX, the accounts have the balances right after the transfer
+type TransferCreated struct {
+	Transfer    Transfer `json:"transfer"`
+	FromAccount Account  `json:"from_account"`
+	ToAccount   Account  `json:"to_account"`
+	FromEntry   Entry    `json:"from_entry"`
+	ToEntry     Entry    `json:"to_entry"`
+}
+
+func (TransferCreated) EventType() string {
+	return TransferCreatedEventType
+}
+
+// AccountCreated is written by CreateAccountTx
+type AccountCreated struct {
+	Account Account `json:"account"`
+}
+
+func (AccountCreated) EventType() string {
+	return AccountCreatedEventType
+}
+
+// UserCreated is written by CreateUserTx, it leaves out the credentials of the user
+type UserCreated struct {
+	Username  string    `json:"username"`
+	FullName  string    `json:"full_name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (UserCreated) EventType() string {
+	return UserCreatedEventType
+}
+
+// appendEvent writes the event to the outbox within the transaction of q
+func appendEvent(ctx context.Context, q Querier, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.CreateOutboxEvent(ctx, CreateOutboxEventParams{
+		EventType: event.EventType(),
+		Payload:   payload,
+	})
+	return err
+}
+
+// DecodeEvent returns the domain event stored in the outbox event
+func DecodeEvent(outboxEvent OutboxEvent) (Event, error) {
+	var event Event
+	switch outboxEvent.EventType {
+	case TransferCreatedEventType:
+		event = &TransferCreated{}
+	case AccountCreatedEventType:
+		event = &AccountCreated{}
+	case UserCreatedEventType:
+		event = &UserCreated{}
+	default:
+		return nil, fmt.Errorf("unknown event type %q", outboxEvent.EventType)
+	}
+
+	if err := json.Unmarshal(outboxEvent.Payload, event); err != nil {
+		return nil, fmt.Errorf("cannot decode %s event %d: %w", outboxEvent.EventType, outboxEvent.ID, err)
+	}
+	return event, nil
+}
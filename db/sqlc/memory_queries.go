@@ -0,0 +1,1181 @@
+package db
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var _ Querier = (*memoryQueries)(nil)
+
+// The queries below follow the queries in db/query one by one, with the defaults and constraints of db/migration
+
+func validTime(t time.Time) pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: t, Valid: true}
+}
+
+// accounts
+
+func (q *memoryQueries) CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error) {
+	defer q.lock()()
+
+	if _, ok := q.store.users[arg.Owner]; !ok {
+		return Account{}, foreignKeyViolation("accounts", "accounts_owner_fkey")
+	}
+	_, conflict := findRow(q.store.accounts, func(account Account) bool {
+		return account.Owner == arg.Owner && account.Currency == arg.Currency
+	})
+	if conflict {
+		return Account{}, uniqueViolation("accounts", "owner_currency_key")
+	}
+
+	account := Account{
+		ID:        q.store.nextID("accounts"),
+		Owner:     arg.Owner,
+		Balance:   arg.Balance,
+		Currency:  arg.Currency,
+		CreatedAt: q.now(),
+		Status:    AccountStatusActive,
+	}
+	set(q, q.store.accounts, account.ID, account)
+	return account, nil
+}
+
+func (q *memoryQueries) GetAccount(ctx context.Context, id int64) (Account, error) {
+	defer q.lock()()
+
+	account, ok := q.store.accounts[id]
+	if !ok {
+		return Account{}, ErrRecordNotFound
+	}
+	return account, nil
+}
+
+// GetAccountForUpdate needs no row lock, the transaction holds the lock of the whole store
+func (q *memoryQueries) GetAccountForUpdate(ctx context.Context, id int64) (Account, error) {
+	return q.GetAccount(ctx, id)
+}
+
+func (q *memoryQueries) ListAccounts(ctx context.Context, arg ListAccountsParams) ([]Account, error) {
+	defer q.lock()()
+
+	accounts := selectRows(q.store.accounts, func(account Account) bool {
+		return account.Owner == arg.Owner
+	}, func(a, b Account) bool {
+		return a.ID < b.ID
+	})
+	return limitRows(accounts, arg.Limit, arg.Offset), nil
+}
+
+func (q *memoryQueries) ListAccountsAfter(ctx context.Context, arg ListAccountsAfterParams) ([]Account, error) {
+	defer q.lock()()
+
+	accounts := selectRows(q.store.accounts, func(account Account) bool {
+		return account.ID > arg.AfterID
+	}, func(a, b Account) bool {
+		return a.ID < b.ID
+	})
+	return limitRows(accounts, arg.PageSize, 0), nil
+}
+
+func (q *memoryQueries) UpdateAccount(ctx context.Context, arg UpdateAccountParams) (Account, error) {
+	defer q.lock()()
+
+	account, ok := q.store.accounts[arg.ID]
+	if !ok {
+		return Account{}, ErrRecordNotFound
+	}
+	account.Balance = arg.Balance
+	set(q, q.store.accounts, account.ID, account)
+	return account, nil
+}
+
+func (q *memoryQueries) AddAccountBalance(ctx context.Context, arg AddAccountBalanceParams) (Account, error) {
+	defer q.lock()()
+
+	account, ok := q.store.accounts[arg.ID]
+	if !ok {
+		return Account{}, ErrRecordNotFound
+	}
+	account.Balance += arg.Amount
+	set(q, q.store.accounts, account.ID, account)
+	return account, nil
+}
+
+func (q *memoryQueries) UpdateAccountStatus(ctx context.Context, arg UpdateAccountStatusParams) (Account, error) {
+	defer q.lock()()
+
+	account, ok := q.store.accounts[arg.ID]
+	if !ok {
+		return Account{}, ErrRecordNotFound
+	}
+	account.Status = arg.Status
+	set(q, q.store.accounts, account.ID, account)
+	return account, nil
+}
+
+func (q *memoryQueries) SetAccountLatestEntryHash(ctx context.Context, arg SetAccountLatestEntryHashParams) error {
+	defer q.lock()()
+
+	account, ok := q.store.accounts[arg.ID]
+	if !ok {
+		return nil
+	}
+	account.LatestEntryHash = arg.LatestEntryHash
+	set(q, q.store.accounts, account.ID, account)
+	return nil
+}
+
+func (q *memoryQueries) DeleteAccount(ctx context.Context, id int64) error {
+	defer q.lock()()
+
+	if _, referenced := findRow(q.store.entries, func(entry Entry) bool {
+		return entry.AccountID == id
+	}); referenced {
+		return referencedRowViolation("accounts", "entries", "entries_account_id_fkey")
+	}
+	if _, referenced := findRow(q.store.transfers, func(transfer Transfer) bool {
+		return transfer.FromAccountID == id || transfer.ToAccountID == id
+	}); referenced {
+		return referencedRowViolation("accounts", "transfers", "transfers_from_account_id_fkey")
+	}
+
+	remove(q, q.store.accounts, id)
+	return nil
+}
+
+// entries
+
+func (q *memoryQueries) CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error) {
+	defer q.lock()()
+
+	if _, ok := q.store.accounts[arg.AccountID]; !ok {
+		return Entry{}, foreignKeyViolation("entries", "entries_account_id_fkey")
+	}
+
+	entry := Entry{
+		ID:        q.store.nextID("entries"),
+		AccountID: arg.AccountID,
+		Amount:    arg.Amount,
+		CreatedAt: q.now(),
+		PrevHash:  arg.PrevHash,
+		Hash:      arg.Hash,
+	}
+	set(q, q.store.entries, entry.ID, entry)
+	set(q, q.store.latestEntries, entry.AccountID, entry.ID)
+	return entry, nil
+}
+
+func (q *memoryQueries) GetEntry(ctx context.Context, id int64) (Entry, error) {
+	defer q.lock()()
+
+	entry, ok := q.store.entries[id]
+	if !ok {
+		return Entry{}, ErrRecordNotFound
+	}
+	return entry, nil
+}
+
+func (q *memoryQueries) SetEntryHash(ctx context.Context, arg SetEntryHashParams) (Entry, error) {
+	defer q.lock()()
+
+	entry, ok := q.store.entries[arg.ID]
+	if !ok {
+		return Entry{}, ErrRecordNotFound
+	}
+	entry.Hash = arg.Hash
+	set(q, q.store.entries, entry.ID, entry)
+	return entry, nil
+}
+
+func (q *memoryQueries) GetLatestEntry(ctx context.Context, accountID int64) (Entry, error) {
+	defer q.lock()()
+
+	id, ok := q.store.latestEntries[accountID]
+	if !ok {
+		return Entry{}, ErrRecordNotFound
+	}
+	return q.store.entries[id], nil
+}
+
+func (q *memoryQueries) GetFirstChainedEntryID(ctx context.Context) (int64, error) {
+	defer q.lock()()
+
+	entries := selectRows(q.store.entries, func(entry Entry) bool {
+		return entry.Hash != ""
+	}, func(a, b Entry) bool {
+		return a.ID < b.ID
+	})
+	if len(entries) == 0 {
+		return 0, ErrRecordNotFound
+	}
+	return entries[0].ID, nil
+}
+
+func (q *memoryQueries) ListEntries(ctx context.Context, arg ListEntriesParams) ([]Entry, error) {
+	defer q.lock()()
+
+	entries := selectRows(q.store.entries, func(entry Entry) bool {
+		return entry.AccountID == arg.AccountID
+	}, func(a, b Entry) bool {
+		return a.ID < b.ID
+	})
+	return limitRows(entries, arg.Limit, arg.Offset), nil
+}
+
+func (q *memoryQueries) ListEntriesAfter(ctx context.Context, arg ListEntriesAfterParams) ([]Entry, error) {
+	defer q.lock()()
+
+	entries := selectRows(q.store.entries, func(entry Entry) bool {
+		return entry.ID > arg.AfterID
+	}, func(a, b Entry) bool {
+		return a.ID < b.ID
+	})
+	return limitRows(entries, arg.PageSize, 0), nil
+}
+
+func (q *memoryQueries) ListAccountEntriesAfter(ctx context.Context, arg ListAccountEntriesAfterParams) ([]Entry, error) {
+	defer q.lock()()
+
+	entries := selectRows(q.store.entries, func(entry Entry) bool {
+		return entry.AccountID == arg.AccountID && entry.ID > arg.AfterID
+	}, func(a, b Entry) bool {
+		return a.ID < b.ID
+	})
+	return limitRows(entries, arg.PageSize, 0), nil
+}
+
+// transfers
+
+func (q *memoryQueries) CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error) {
+	defer q.lock()()
+
+	if _, ok := q.store.accounts[arg.FromAccountID]; !ok {
+		return Transfer{}, foreignKeyViolation("transfers", "transfers_from_account_id_fkey")
+	}
+	if _, ok := q.store.accounts[arg.ToAccountID]; !ok {
+		return Transfer{}, foreignKeyViolation("transfers", "transfers_to_account_id_fkey")
+	}
+
+	transfer := Transfer{
+		ID:            q.store.nextID("transfers"),
+		FromAccountID: arg.FromAccountID,
+		ToAccountID:   arg.ToAccountID,
+		Amount:        arg.Amount,
+		CreatedAt:     q.now(),
+	}
+	set(q, q.store.transfers, transfer.ID, transfer)
+	return transfer, nil
+}
+
+func (q *memoryQueries) GetTransfer(ctx context.Context, id int64) (Transfer, error) {
+	defer q.lock()()
+
+	transfer, ok := q.store.transfers[id]
+	if !ok {
+		return Transfer{}, ErrRecordNotFound
+	}
+	return transfer, nil
+}
+
+func (q *memoryQueries) GetTransferForUpdate(ctx context.Context, id int64) (Transfer, error) {
+	return q.GetTransfer(ctx, id)
+}
+
+func (q *memoryQueries) ListTransfers(ctx context.Context, arg ListTransfersParams) ([]Transfer, error) {
+	defer q.lock()()
+
+	transfers := selectRows(q.store.transfers, func(transfer Transfer) bool {
+		return transfer.FromAccountID == arg.FromAccountID || transfer.ToAccountID == arg.ToAccountID
+	}, func(a, b Transfer) bool {
+		return a.ID < b.ID
+	})
+	return limitRows(transfers, arg.Limit, arg.Offset), nil
+}
+
+func (q *memoryQueries) SetTransferReversedBy(ctx context.Context, arg SetTransferReversedByParams) (Transfer, error) {
+	defer q.lock()()
+
+	transfer, ok := q.store.transfers[arg.ID]
+	if !ok {
+		return Transfer{}, ErrRecordNotFound
+	}
+	if _, ok := q.store.transfers[arg.ReversedBy.Int64]; arg.ReversedBy.Valid && !ok {
+		return Transfer{}, foreignKeyViolation("transfers", "transfers_reversed_by_fkey")
+	}
+	transfer.ReversedBy = arg.ReversedBy
+	set(q, q.store.transfers, transfer.ID, transfer)
+	return transfer, nil
+}
+
+// users
+
+func (q *memoryQueries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	defer q.lock()()
+
+	if _, conflict := q.store.users[arg.Username]; conflict {
+		return User{}, uniqueViolation("users", "users_pkey")
+	}
+	if _, conflict := findRow(q.store.users, func(user User) bool {
+		return user.Email == arg.Email
+	}); conflict {
+		return User{}, uniqueViolation("users", "users_email_key")
+	}
+
+	// The password_changed_at and locked_until columns default to 0001-01-01 00:00:00Z, which is the zero time
+	user := User{
+		Username:       arg.Username,
+		HashedPassword: arg.HashedPassword,
+		FullName:       arg.FullName,
+		Email:          arg.Email,
+		CreatedAt:      q.now(),
+		Role:           "depositor",
+	}
+	set(q, q.store.users, user.Username, user)
+	return user, nil
+}
+
+func (q *memoryQueries) GetUser(ctx context.Context, username string) (User, error) {
+	defer q.lock()()
+
+	user, ok := q.store.users[username]
+	if !ok {
+		return User{}, ErrRecordNotFound
+	}
+	return user, nil
+}
+
+// GetUserForUpdate needs no row lock, the transaction holds the lock of the whole store
+func (q *memoryQueries) GetUserForUpdate(ctx context.Context, username string) (User, error) {
+	return q.GetUser(ctx, username)
+}
+
+func (q *memoryQueries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	defer q.lock()()
+
+	user, ok := findRow(q.store.users, func(user User) bool {
+		return user.Email == email
+	})
+	if !ok {
+		return User{}, ErrRecordNotFound
+	}
+	return user, nil
+}
+
+func (q *memoryQueries) GetUserPasswordChangedAt(ctx context.Context, username string) (time.Time, error) {
+	defer q.lock()()
+
+	user, ok := q.store.users[username]
+	if !ok {
+		return time.Time{}, ErrRecordNotFound
+	}
+	return user.PasswordChangedAt, nil
+}
+
+// updateUser applies the update to the user and stores it
+func (q *memoryQueries) updateUser(username string, update func(user *User)) (User, error) {
+	defer q.lock()()
+
+	user, ok := q.store.users[username]
+	if !ok {
+		return User{}, ErrRecordNotFound
+	}
+	update(&user)
+	set(q, q.store.users, user.Username, user)
+	return user, nil
+}
+
+func (q *memoryQueries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error) {
+	return q.updateUser(arg.Username, func(user *User) {
+		user.HashedPassword = arg.HashedPassword
+		user.PasswordChangedAt = arg.PasswordChangedAt
+	})
+}
+
+func (q *memoryQueries) UpdateUserPasswordHash(ctx context.Context, arg UpdateUserPasswordHashParams) (User, error) {
+	return q.updateUser(arg.Username, func(user *User) {
+		user.HashedPassword = arg.HashedPassword
+	})
+}
+
+func (q *memoryQueries) RecordFailedLogin(ctx context.Context, username string) (User, error) {
+	return q.updateUser(username, func(user *User) {
+		user.FailedLoginAttempts++
+	})
+}
+
+func (q *memoryQueries) LockUser(ctx context.Context, arg LockUserParams) (User, error) {
+	return q.updateUser(arg.Username, func(user *User) {
+		user.FailedLoginAttempts = 0
+		user.LockoutCount++
+		user.LockedUntil = arg.LockedUntil
+	})
+}
+
+func (q *memoryQueries) ResetFailedLogins(ctx context.Context, username string) error {
+	_, err := q.updateUser(username, func(user *User) {
+		user.FailedLoginAttempts = 0
+		user.LockoutCount = 0
+	})
+	if err == ErrRecordNotFound {
+		return nil
+	}
+	return err
+}
+
+func (q *memoryQueries) UnlockUser(ctx context.Context, username string) (User, error) {
+	return q.updateUser(username, func(user *User) {
+		user.FailedLoginAttempts = 0
+		user.LockoutCount = 0
+		user.LockedUntil = q.now()
+	})
+}
+
+func (q *memoryQueries) VerifyUserEmail(ctx context.Context, username string) (User, error) {
+	return q.updateUser(username, func(user *User) {
+		user.IsEmailVerified = true
+	})
+}
+
+func (q *memoryQueries) SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) (User, error) {
+	return q.updateUser(arg.Username, func(user *User) {
+		user.TotpSecret = arg.TotpSecret
+	})
+}
+
+func (q *memoryQueries) EnableUserTOTP(ctx context.Context, arg EnableUserTOTPParams) (User, error) {
+	return q.updateUser(arg.Username, func(user *User) {
+		user.IsTotpEnabled = true
+		user.TotpLastUsedStep = arg.TotpLastUsedStep
+	})
+}
+
+func (q *memoryQueries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	defer q.lock()()
+
+	user, ok := q.store.users[arg.Username]
+	if !ok || user.TotpLastUsedStep >= arg.Step {
+		return 0, nil
+	}
+	user.TotpLastUsedStep = arg.Step
+	set(q, q.store.users, user.Username, user)
+	return 1, nil
+}
+
+// verify_emails
+
+func (q *memoryQueries) CreateVerifyEmail(ctx context.Context, arg CreateVerifyEmailParams) (VerifyEmail, error) {
+	defer q.lock()()
+
+	if _, ok := q.store.users[arg.Username]; !ok {
+		return VerifyEmail{}, foreignKeyViolation("verify_emails", "verify_emails_username_fkey")
+	}
+
+	verifyEmail := VerifyEmail{
+		ID:             q.store.nextID("verify_emails"),
+		Username:       arg.Username,
+		Email:          arg.Email,
+		SecretCodeHash: arg.SecretCodeHash,
+		ExpiresAt:      arg.ExpiresAt,
+		CreatedAt:      q.now(),
+	}
+	set(q, q.store.verifyEmails, verifyEmail.ID, verifyEmail)
+	return verifyEmail, nil
+}
+
+func (q *memoryQueries) GetVerifyEmailForUpdate(ctx context.Context, id int64) (VerifyEmail, error) {
+	defer q.lock()()
+
+	verifyEmail, ok := q.store.verifyEmails[id]
+	if !ok {
+		return VerifyEmail{}, ErrRecordNotFound
+	}
+	return verifyEmail, nil
+}
+
+func (q *memoryQueries) UseVerifyEmail(ctx context.Context, id int64) (VerifyEmail, error) {
+	defer q.lock()()
+
+	verifyEmail, ok := q.store.verifyEmails[id]
+	if !ok {
+		return VerifyEmail{}, ErrRecordNotFound
+	}
+	verifyEmail.UsedAt = validTime(q.now())
+	set(q, q.store.verifyEmails, verifyEmail.ID, verifyEmail)
+	return verifyEmail, nil
+}
+
+// password_reset_tokens
+
+func (q *memoryQueries) CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (PasswordResetToken, error) {
+	defer q.lock()()
+
+	if _, ok := q.store.users[arg.Username]; !ok {
+		return PasswordResetToken{}, foreignKeyViolation("password_reset_tokens", "password_reset_tokens_username_fkey")
+	}
+	if _, conflict := findRow(q.store.passwordResetTokens, func(token PasswordResetToken) bool {
+		return token.TokenHash == arg.TokenHash
+	}); conflict {
+		return PasswordResetToken{}, uniqueViolation("password_reset_tokens", "password_reset_tokens_token_hash_key")
+	}
+
+	token := PasswordResetToken{
+		ID:        q.store.nextID("password_reset_tokens"),
+		Username:  arg.Username,
+		TokenHash: arg.TokenHash,
+		ExpiresAt: arg.ExpiresAt,
+		CreatedAt: q.now(),
+	}
+	set(q, q.store.passwordResetTokens, token.ID, token)
+	return token, nil
+}
+
+func (q *memoryQueries) GetPasswordResetToken(ctx context.Context, tokenHash string) (PasswordResetToken, error) {
+	defer q.lock()()
+
+	token, ok := findRow(q.store.passwordResetTokens, func(token PasswordResetToken) bool {
+		return token.TokenHash == tokenHash
+	})
+	if !ok {
+		return PasswordResetToken{}, ErrRecordNotFound
+	}
+	return token, nil
+}
+
+func (q *memoryQueries) GetPasswordResetTokenForUpdate(ctx context.Context, tokenHash string) (PasswordResetToken, error) {
+	defer q.lock()()
+
+	token, ok := findRow(q.store.passwordResetTokens, func(token PasswordResetToken) bool {
+		return token.TokenHash == tokenHash
+	})
+	if !ok {
+		return PasswordResetToken{}, ErrRecordNotFound
+	}
+	return token, nil
+}
+
+func (q *memoryQueries) UsePasswordResetToken(ctx context.Context, id int64) (PasswordResetToken, error) {
+	defer q.lock()()
+
+	token, ok := q.store.passwordResetTokens[id]
+	if !ok {
+		return PasswordResetToken{}, ErrRecordNotFound
+	}
+	token.UsedAt = validTime(q.now())
+	set(q, q.store.passwordResetTokens, token.ID, token)
+	return token, nil
+}
+
+// recovery_codes
+
+func (q *memoryQueries) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) (RecoveryCode, error) {
+	defer q.lock()()
+
+	if _, ok := q.store.users[arg.Username]; !ok {
+		return RecoveryCode{}, foreignKeyViolation("recovery_codes", "recovery_codes_username_fkey")
+	}
+	if _, conflict := findRow(q.store.recoveryCodes, func(code RecoveryCode) bool {
+		return code.Username == arg.Username && code.CodeHash == arg.CodeHash
+	}); conflict {
+		return RecoveryCode{}, uniqueViolation("recovery_codes", "recovery_codes_username_code_hash_idx")
+	}
+
+	code := RecoveryCode{
+		ID:        q.store.nextID("recovery_codes"),
+		Username:  arg.Username,
+		CodeHash:  arg.CodeHash,
+		CreatedAt: q.now(),
+	}
+	set(q, q.store.recoveryCodes, code.ID, code)
+	return code, nil
+}
+
+func (q *memoryQueries) DeleteRecoveryCodes(ctx context.Context, username string) error {
+	defer q.lock()()
+
+	for _, code := range selectRows(q.store.recoveryCodes, func(code RecoveryCode) bool {
+		return code.Username == username
+	}, func(a, b RecoveryCode) bool {
+		return a.ID < b.ID
+	}) {
+		remove(q, q.store.recoveryCodes, code.ID)
+	}
+	return nil
+}
+
+func (q *memoryQueries) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (RecoveryCode, error) {
+	defer q.lock()()
+
+	code, ok := findRow(q.store.recoveryCodes, func(code RecoveryCode) bool {
+		return code.Username == arg.Username && code.CodeHash == arg.CodeHash && !code.UsedAt.Valid
+	})
+	if !ok {
+		return RecoveryCode{}, ErrRecordNotFound
+	}
+	code.UsedAt = validTime(q.now())
+	set(q, q.store.recoveryCodes, code.ID, code)
+	return code, nil
+}
+
+// mfa_challenges
+
+func (q *memoryQueries) CreateMFAChallenge(ctx context.Context, arg CreateMFAChallengeParams) (MfaChallenge, error) {
+	defer q.lock()()
+
+	if _, ok := q.store.users[arg.Username]; !ok {
+		return MfaChallenge{}, foreignKeyViolation("mfa_challenges", "mfa_challenges_username_fkey")
+	}
+	if _, conflict := findRow(q.store.mfaChallenges, func(challenge MfaChallenge) bool {
+		return challenge.TokenHash == arg.TokenHash
+	}); conflict {
+		return MfaChallenge{}, uniqueViolation("mfa_challenges", "mfa_challenges_token_hash_key")
+	}
+
+	challenge := MfaChallenge{
+		ID:        q.store.nextID("mfa_challenges"),
+		Username:  arg.Username,
+		TokenHash: arg.TokenHash,
+		ExpiresAt: arg.ExpiresAt,
+		CreatedAt: q.now(),
+	}
+	set(q, q.store.mfaChallenges, challenge.ID, challenge)
+	return challenge, nil
+}
+
+func (q *memoryQueries) GetMFAChallenge(ctx context.Context, tokenHash string) (MfaChallenge, error) {
+	defer q.lock()()
+
+	challenge, ok := findRow(q.store.mfaChallenges, func(challenge MfaChallenge) bool {
+		return challenge.TokenHash == tokenHash
+	})
+	if !ok {
+		return MfaChallenge{}, ErrRecordNotFound
+	}
+	return challenge, nil
+}
+
+func (q *memoryQueries) CountMFAChallengeAttempt(ctx context.Context, arg CountMFAChallengeAttemptParams) (int64, error) {
+	defer q.lock()()
+
+	challenge, ok := q.store.mfaChallenges[arg.ID]
+	if !ok || challenge.UsedAt.Valid || challenge.Attempts >= arg.MaxAttempts {
+		return 0, nil
+	}
+	challenge.Attempts++
+	set(q, q.store.mfaChallenges, challenge.ID, challenge)
+	return 1, nil
+}
+
+func (q *memoryQueries) UseMFAChallenge(ctx context.Context, id int64) (int64, error) {
+	defer q.lock()()
+
+	challenge, ok := q.store.mfaChallenges[id]
+	if !ok || challenge.UsedAt.Valid {
+		return 0, nil
+	}
+	challenge.UsedAt = validTime(q.now())
+	set(q, q.store.mfaChallenges, challenge.ID, challenge)
+	return 1, nil
+}
+
+// service_accounts
+
+func (q *memoryQueries) CreateServiceAccount(ctx context.Context, arg CreateServiceAccountParams) (ServiceAccount, error) {
+	defer q.lock()()
+
+	if _, ok := q.store.users[arg.Owner]; !ok {
+		return ServiceAccount{}, foreignKeyViolation("service_accounts", "service_accounts_owner_fkey")
+	}
+	if _, conflict := findRow(q.store.serviceAccounts, func(serviceAccount ServiceAccount) bool {
+		return serviceAccount.Owner == arg.Owner && serviceAccount.Name == arg.Name
+	}); conflict {
+		return ServiceAccount{}, uniqueViolation("service_accounts", "service_accounts_owner_name_idx")
+	}
+
+	serviceAccount := ServiceAccount{
+		ID:        q.store.nextID("service_accounts"),
+		Owner:     arg.Owner,
+		Name:      arg.Name,
+		CreatedAt: q.now(),
+	}
+	set(q, q.store.serviceAccounts, serviceAccount.ID, serviceAccount)
+	return serviceAccount, nil
+}
+
+func (q *memoryQueries) GetServiceAccount(ctx context.Context, id int64) (ServiceAccount, error) {
+	defer q.lock()()
+
+	serviceAccount, ok := q.store.serviceAccounts[id]
+	if !ok {
+		return ServiceAccount{}, ErrRecordNotFound
+	}
+	return serviceAccount, nil
+}
+
+func (q *memoryQueries) ListServiceAccounts(ctx context.Context, owner string) ([]ServiceAccount, error) {
+	defer q.lock()()
+
+	return selectRows(q.store.serviceAccounts, func(serviceAccount ServiceAccount) bool {
+		return serviceAccount.Owner == owner
+	}, func(a, b ServiceAccount) bool {
+		return a.ID < b.ID
+	}), nil
+}
+
+// api_keys
+
+func (q *memoryQueries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error) {
+	defer q.lock()()
+
+	if _, ok := q.store.serviceAccounts[arg.ServiceAccountID]; !ok {
+		return ApiKey{}, foreignKeyViolation("api_keys", "api_keys_service_account_id_fkey")
+	}
+	if _, conflict := findRow(q.store.apiKeys, func(key ApiKey) bool {
+		return key.KeyHash == arg.KeyHash
+	}); conflict {
+		return ApiKey{}, uniqueViolation("api_keys", "api_keys_key_hash_key")
+	}
+
+	key := ApiKey{
+		ID:               q.store.nextID("api_keys"),
+		ServiceAccountID: arg.ServiceAccountID,
+		KeyPrefix:        arg.KeyPrefix,
+		KeyHash:          arg.KeyHash,
+		Scopes:           slices.Clone(arg.Scopes),
+		CreatedAt:        q.now(),
+	}
+	set(q, q.store.apiKeys, key.ID, key)
+	return key, nil
+}
+
+func (q *memoryQueries) ListAPIKeys(ctx context.Context, serviceAccountID int64) ([]ApiKey, error) {
+	defer q.lock()()
+
+	return selectRows(q.store.apiKeys, func(key ApiKey) bool {
+		return key.ServiceAccountID == serviceAccountID
+	}, func(a, b ApiKey) bool {
+		return a.ID < b.ID
+	}), nil
+}
+
+func (q *memoryQueries) GetAPIKeyForAuth(ctx context.Context, keyHash string) (GetAPIKeyForAuthRow, error) {
+	defer q.lock()()
+
+	key, ok := findRow(q.store.apiKeys, func(key ApiKey) bool {
+		return key.KeyHash == keyHash
+	})
+	if !ok {
+		return GetAPIKeyForAuthRow{}, ErrRecordNotFound
+	}
+	return GetAPIKeyForAuthRow{
+		ID:        key.ID,
+		Scopes:    key.Scopes,
+		RevokedAt: key.RevokedAt,
+		Owner:     q.store.serviceAccounts[key.ServiceAccountID].Owner,
+	}, nil
+}
+
+func (q *memoryQueries) TouchAPIKey(ctx context.Context, id int64) error {
+	defer q.lock()()
+
+	key, ok := q.store.apiKeys[id]
+	if !ok {
+		return nil
+	}
+	key.LastUsedAt = validTime(q.now())
+	set(q, q.store.apiKeys, key.ID, key)
+	return nil
+}
+
+func (q *memoryQueries) RevokeAPIKey(ctx context.Context, arg RevokeAPIKeyParams) (ApiKey, error) {
+	defer q.lock()()
+
+	key, ok := q.store.apiKeys[arg.ID]
+	if !ok || key.ServiceAccountID != arg.ServiceAccountID || key.RevokedAt.Valid {
+		return ApiKey{}, ErrRecordNotFound
+	}
+	key.RevokedAt = validTime(q.now())
+	set(q, q.store.apiKeys, key.ID, key)
+	return key, nil
+}
+
+// sessions
+
+func (q *memoryQueries) CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error) {
+	defer q.lock()()
+
+	if _, ok := q.store.users[arg.Username]; !ok {
+		return Session{}, foreignKeyViolation("sessions", "sessions_username_fkey")
+	}
+	if _, conflict := q.store.sessions[arg.ID]; conflict {
+		return Session{}, uniqueViolation("sessions", "sessions_pkey")
+	}
+
+	session := Session{
+		ID:         arg.ID,
+		Username:   arg.Username,
+		UserAgent:  arg.UserAgent,
+		ClientIp:   arg.ClientIp,
+		ExpiresAt:  arg.ExpiresAt,
+		LastUsedAt: q.now(),
+		CreatedAt:  q.now(),
+	}
+	set(q, q.store.sessions, session.ID, session)
+	return session, nil
+}
+
+func (q *memoryQueries) GetSession(ctx context.Context, id uuid.UUID) (Session, error) {
+	defer q.lock()()
+
+	session, ok := q.store.sessions[id]
+	if !ok {
+		return Session{}, ErrRecordNotFound
+	}
+	return session, nil
+}
+
+func (q *memoryQueries) TouchSession(ctx context.Context, id uuid.UUID) (Session, error) {
+	defer q.lock()()
+
+	session, ok := q.store.sessions[id]
+	if !ok || session.RevokedAt.Valid {
+		return Session{}, ErrRecordNotFound
+	}
+	session.LastUsedAt = q.now()
+	set(q, q.store.sessions, session.ID, session)
+	return session, nil
+}
+
+func (q *memoryQueries) ListActiveSessions(ctx context.Context, username string) ([]Session, error) {
+	defer q.lock()()
+
+	now := q.now()
+	return selectRows(q.store.sessions, func(session Session) bool {
+		return session.Username == username && !session.RevokedAt.Valid && session.ExpiresAt.After(now)
+	}, func(a, b Session) bool {
+		return a.LastUsedAt.After(b.LastUsedAt)
+	}), nil
+}
+
+func (q *memoryQueries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (Session, error) {
+	defer q.lock()()
+
+	session, ok := q.store.sessions[arg.ID]
+	if !ok || session.Username != arg.Username || session.RevokedAt.Valid {
+		return Session{}, ErrRecordNotFound
+	}
+	session.RevokedAt = validTime(q.now())
+	set(q, q.store.sessions, session.ID, session)
+	return session, nil
+}
+
+// rate_limit_buckets
+
+func (q *memoryQueries) TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (RateLimitBucket, error) {
+	defer q.lock()()
+
+	now := q.now()
+	bucket, ok := q.store.rateLimitBuckets[arg.Key]
+	if !ok {
+		bucket = RateLimitBucket{
+			Key:       arg.Key,
+			Tokens:    arg.Burst - 1,
+			Allowed:   true,
+			UpdatedAt: now,
+		}
+	} else {
+		// The bucket is refilled for the time since it was last updated, up to the burst
+		tokens := math.Min(arg.Burst, bucket.Tokens+now.Sub(bucket.UpdatedAt).Seconds()*arg.PerSecond)
+		bucket.Allowed = tokens >= 1
+		if bucket.Allowed {
+			tokens--
+		}
+		bucket.Tokens = tokens
+		bucket.UpdatedAt = now
+	}
+	set(q, q.store.rateLimitBuckets, bucket.Key, bucket)
+	return bucket, nil
+}
+
+func (q *memoryQueries) DeleteFullRateLimitBuckets(ctx context.Context, arg DeleteFullRateLimitBucketsParams) (int64, error) {
+	defer q.lock()()
+
+	idleBefore := q.now().Add(-time.Duration(arg.RefillSeconds * float64(time.Second)))
+	var deleted int64
+	for key, bucket := range q.store.rateLimitBuckets {
+		if strings.HasPrefix(key, arg.KeyPrefix) && bucket.UpdatedAt.Before(idleBefore) {
+			remove(q, q.store.rateLimitBuckets, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// webhook_subscriptions
+
+func (q *memoryQueries) CreateWebhookSubscription(ctx context.Context, arg CreateWebhookSubscriptionParams) (WebhookSubscription, error) {
+	defer q.lock()()
+
+	if _, ok := q.store.users[arg.Owner]; !ok {
+		return WebhookSubscription{}, foreignKeyViolation("webhook_subscriptions", "webhook_subscriptions_owner_fkey")
+	}
+
+	subscription := WebhookSubscription{
+		ID:         q.store.nextID("webhook_subscriptions"),
+		Owner:      arg.Owner,
+		Url:        arg.Url,
+		EventTypes: slices.Clone(arg.EventTypes),
+		Secret:     arg.Secret,
+		CreatedAt:  q.now(),
+	}
+	set(q, q.store.webhookSubscriptions, subscription.ID, subscription)
+	return subscription, nil
+}
+
+func (q *memoryQueries) GetWebhookSubscription(ctx context.Context, id int64) (WebhookSubscription, error) {
+	defer q.lock()()
+
+	subscription, ok := q.store.webhookSubscriptions[id]
+	if !ok {
+		return WebhookSubscription{}, ErrRecordNotFound
+	}
+	return subscription, nil
+}
+
+func (q *memoryQueries) ListWebhookSubscriptions(ctx context.Context, owner string) ([]WebhookSubscription, error) {
+	defer q.lock()()
+
+	return selectRows(q.store.webhookSubscriptions, func(subscription WebhookSubscription) bool {
+		return subscription.Owner == owner
+	}, func(a, b WebhookSubscription) bool {
+		return a.ID < b.ID
+	}), nil
+}
+
+// DeleteWebhookSubscription deletes the deliveries of the subscription too, as ON DELETE CASCADE does
+func (q *memoryQueries) DeleteWebhookSubscription(ctx context.Context, id int64) error {
+	defer q.lock()()
+
+	for _, delivery := range selectRows(q.store.webhookDeliveries, func(delivery WebhookDelivery) bool {
+		return delivery.SubscriptionID == id
+	}, func(a, b WebhookDelivery) bool {
+		return a.ID < b.ID
+	}) {
+		remove(q, q.store.webhookDeliveries, delivery.ID)
+	}
+	remove(q, q.store.webhookSubscriptions, id)
+	return nil
+}
+
+// webhook_deliveries
+
+// EnqueueWebhookDeliveries skips the subscriptions which already have a delivery of the event, as ON CONFLICT DO NOTHING does
+// A delivery without an event never conflicts, NULLs are distinct in a unique index
+func (q *memoryQueries) EnqueueWebhookDeliveries(ctx context.Context, arg EnqueueWebhookDeliveriesParams) (int64, error) {
+	defer q.lock()()
+
+	subscriptions := selectRows(q.store.webhookSubscriptions, func(subscription WebhookSubscription) bool {
+		return subscription.Owner == arg.Owner && slices.Contains(subscription.EventTypes, arg.EventType)
+	}, func(a, b WebhookSubscription) bool {
+		return a.ID < b.ID
+	})
+
+	var inserted int64
+	now := q.now()
+	for _, subscription := range subscriptions {
+		if arg.EventID.Valid {
+			_, conflict := findRow(q.store.webhookDeliveries, func(delivery WebhookDelivery) bool {
+				return delivery.SubscriptionID == subscription.ID &&
+					delivery.EventType == arg.EventType &&
+					delivery.EventID == arg.EventID
+			})
+			if conflict {
+				continue
+			}
+		}
+
+		delivery := WebhookDelivery{
+			ID:             q.store.nextID("webhook_deliveries"),
+			SubscriptionID: subscription.ID,
+			EventType:      arg.EventType,
+			Payload:        slices.Clone(arg.Payload),
+			Status:         "pending",
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			EventID:        arg.EventID,
+		}
+		set(q, q.store.webhookDeliveries, delivery.ID, delivery)
+		inserted++
+	}
+	return inserted, nil
+}
+
+func (q *memoryQueries) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	defer q.lock()()
+
+	deliveries := selectRows(q.store.webhookDeliveries, func(delivery WebhookDelivery) bool {
+		return delivery.SubscriptionID == arg.SubscriptionID
+	}, func(a, b WebhookDelivery) bool {
+		return a.ID > b.ID
+	})
+	return limitRows(deliveries, arg.Limit, arg.Offset), nil
+}
+
+func (q *memoryQueries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	defer q.lock()()
+
+	now := q.now()
+	deliveries := selectRows(q.store.webhookDeliveries, func(delivery WebhookDelivery) bool {
+		return delivery.Status == "pending" && !delivery.NextAttemptAt.After(now)
+	}, func(a, b WebhookDelivery) bool {
+		if a.NextAttemptAt.Equal(b.NextAttemptAt) {
+			return a.ID < b.ID
+		}
+		return a.NextAttemptAt.Before(b.NextAttemptAt)
+	})
+	deliveries = limitRows(deliveries, arg.BatchSize, 0)
+
+	for i := range deliveries {
+		deliveries[i].NextAttemptAt = arg.LockedUntil
+		set(q, q.store.webhookDeliveries, deliveries[i].ID, deliveries[i])
+	}
+	return deliveries, nil
+}
+
+// updateDelivery applies the update to the delivery and stores it, a missing delivery is not an error for an :exec query
+func (q *memoryQueries) updateDelivery(id int64, update func(delivery *WebhookDelivery)) error {
+	defer q.lock()()
+
+	delivery, ok := q.store.webhookDeliveries[id]
+	if !ok {
+		return nil
+	}
+	update(&delivery)
+	set(q, q.store.webhookDeliveries, delivery.ID, delivery)
+	return nil
+}
+
+func (q *memoryQueries) MarkWebhookDelivered(ctx context.Context, id int64) error {
+	return q.updateDelivery(id, func(delivery *WebhookDelivery) {
+		delivery.Status = "delivered"
+		delivery.Attempts++
+		delivery.LastError = ""
+		delivery.DeliveredAt = validTime(q.now())
+	})
+}
+
+func (q *memoryQueries) RetryWebhookDelivery(ctx context.Context, arg RetryWebhookDeliveryParams) error {
+	return q.updateDelivery(arg.ID, func(delivery *WebhookDelivery) {
+		delivery.Attempts++
+		delivery.NextAttemptAt = arg.NextAttemptAt
+		delivery.LastError = arg.LastError
+	})
+}
+
+func (q *memoryQueries) DeadLetterWebhookDelivery(ctx context.Context, arg DeadLetterWebhookDeliveryParams) error {
+	return q.updateDelivery(arg.ID, func(delivery *WebhookDelivery) {
+		delivery.Status = "dead"
+		delivery.Attempts++
+		delivery.LastError = arg.LastError
+	})
+}
+
+func (q *memoryQueries) RedeliverWebhookDelivery(ctx context.Context, arg RedeliverWebhookDeliveryParams) (WebhookDelivery, error) {
+	defer q.lock()()
+
+	delivery, ok := q.store.webhookDeliveries[arg.ID]
+	if !ok || delivery.SubscriptionID != arg.SubscriptionID {
+		return WebhookDelivery{}, ErrRecordNotFound
+	}
+	delivery.Status = "pending"
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = q.now()
+	delivery.LastError = ""
+	delivery.DeliveredAt = pgtype.Timestamptz{}
+	set(q, q.store.webhookDeliveries, delivery.ID, delivery)
+	return delivery, nil
+}
+
+// outbox_events
+
+// CreateOutboxEvent records the event with the id of its transaction, a query outside of a transaction gets an id of its own
+func (q *memoryQueries) CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) (OutboxEvent, error) {
+	defer q.lock()()
+
+	txid := q.store.nextTxid()
+	if q.tx != nil {
+		txid = q.tx.txid
+	}
+
+	event := OutboxEvent{
+		ID:        q.store.nextID("outbox_events"),
+		Txid:      txid,
+		EventType: arg.EventType,
+		Payload:   slices.Clone(arg.Payload),
+		CreatedAt: q.now(),
+	}
+	set(q, q.store.outboxEvents, event.ID, event)
+	return event, nil
+}
+
+// ListPendingOutboxEvents never sees the events of a running transaction other than its own, the transactions run one at a time,
+// and like in Postgres it leaves out the events of its own transaction, which is still running
+func (q *memoryQueries) ListPendingOutboxEvents(ctx context.Context, arg ListPendingOutboxEventsParams) ([]OutboxEvent, error) {
+	defer q.lock()()
+
+	events := selectRows(q.store.outboxEvents, func(event OutboxEvent) bool {
+		if q.tx != nil && event.Txid >= q.tx.txid {
+			return false
+		}
+		return event.Txid > arg.LastTxid || (event.Txid == arg.LastTxid && event.ID > arg.LastEventID)
+	}, func(a, b OutboxEvent) bool {
+		if a.Txid == b.Txid {
+			return a.ID < b.ID
+		}
+		return a.Txid < b.Txid
+	})
+	return limitRows(events, arg.BatchSize, 0), nil
+}
+
+// outbox_checkpoints
+
+func (q *memoryQueries) GetOutboxCheckpoint(ctx context.Context, handler string) (OutboxCheckpoint, error) {
+	defer q.lock()()
+
+	checkpoint, ok := q.store.outboxCheckpoints[handler]
+	if !ok {
+		return OutboxCheckpoint{}, ErrRecordNotFound
+	}
+	return checkpoint, nil
+}
+
+func (q *memoryQueries) SaveOutboxCheckpoint(ctx context.Context, arg SaveOutboxCheckpointParams) error {
+	defer q.lock()()
+
+	set(q, q.store.outboxCheckpoints, arg.Handler, OutboxCheckpoint{
+		Handler:     arg.Handler,
+		LastTxid:    arg.LastTxid,
+		LastEventID: arg.LastEventID,
+		UpdatedAt:   q.now(),
+	})
+	return nil
+}
+
+// notifications
+
+// Notify delivers the notification to the listeners of the store once the transaction is committed,
+// or right away outside of a transaction
+func (q *memoryQueries) Notify(ctx context.Context, arg NotifyParams) error {
+	if q.tx != nil {
+		q.tx.notifications = append(q.tx.notifications, arg)
+		return nil
+	}
+
+	q.store.deliver([]NotifyParams{arg})
+	return nil
+}
@@ -0,0 +1,307 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/igiai/simplebank/clock"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// MemoryStore is a Store keeping all the data in memory, it needs no db
+// Its queries and transactions behave like the SQL ones, including the defaults, the unique and foreign key constraints
+// and the rollback of failed transactions, so it can stand in for the SQLStore in tests and local development
+// The data is lost when the process exits
+type MemoryStore struct {
+	*memoryQueries
+	txStore
+
+	clock clock.Clock
+
+	// mu is held by every query and for the whole of every transaction, so the transactions are serializable
+	mu        sync.Mutex
+	sequences map[string]int64
+	lastTxid  int64
+	listeners map[string][]func(payload string)
+
+	accounts             map[int64]Account
+	entries              map[int64]Entry
+	latestEntries        map[int64]int64
+	transfers            map[int64]Transfer
+	users                map[string]User
+	verifyEmails         map[int64]VerifyEmail
+	passwordResetTokens  map[int64]PasswordResetToken
+	recoveryCodes        map[int64]RecoveryCode
+	mfaChallenges        map[int64]MfaChallenge
+	serviceAccounts      map[int64]ServiceAccount
+	apiKeys              map[int64]ApiKey
+	sessions             map[uuid.UUID]Session
+	rateLimitBuckets     map[string]RateLimitBucket
+	webhookSubscriptions map[int64]WebhookSubscription
+	webhookDeliveries    map[int64]WebhookDelivery
+	outboxEvents         map[int64]OutboxEvent
+	outboxCheckpoints    map[string]OutboxCheckpoint
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return NewMemoryStoreWithClock(clock.Real{})
+}
+
+// NewMemoryStoreWithClock creates an empty in-memory store whose now() reads the given clock,
+// e.g. the default created_at of the rows and the expiry of the active sessions are checked against it
+func NewMemoryStoreWithClock(clock clock.Clock) *MemoryStore {
+	store := &MemoryStore{
+		clock:                clock,
+		sequences:            make(map[string]int64),
+		listeners:            make(map[string][]func(payload string)),
+		accounts:             make(map[int64]Account),
+		entries:              make(map[int64]Entry),
+		latestEntries:        make(map[int64]int64),
+		transfers:            make(map[int64]Transfer),
+		users:                make(map[string]User),
+		verifyEmails:         make(map[int64]VerifyEmail),
+		passwordResetTokens:  make(map[int64]PasswordResetToken),
+		recoveryCodes:        make(map[int64]RecoveryCode),
+		mfaChallenges:        make(map[int64]MfaChallenge),
+		serviceAccounts:      make(map[int64]ServiceAccount),
+		apiKeys:              make(map[int64]ApiKey),
+		sessions:             make(map[uuid.UUID]Session),
+		rateLimitBuckets:     make(map[string]RateLimitBucket),
+		webhookSubscriptions: make(map[int64]WebhookSubscription),
+		webhookDeliveries:    make(map[int64]WebhookDelivery),
+		outboxEvents:         make(map[int64]OutboxEvent),
+		outboxCheckpoints:    make(map[string]OutboxCheckpoint),
+	}
+	store.memoryQueries = &memoryQueries{store: store}
+	store.txStore = txStore{store}
+	return store
+}
+
+// Listen registers fn to be called with the payload of every notification on the channel
+// Like with Postgres, the notifications of a transaction are delivered only once it is committed
+// fn is called outside of the lock of the store, on the goroutine which committed the transaction
+func (store *MemoryStore) Listen(channel string, fn func(payload string)) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.listeners[channel] = append(store.listeners[channel], fn)
+}
+
+// execTx runs fn with the queries bound to a new transaction
+// The transactions run one at a time, so there are no conflicts to retry and the isolation level is always serializable
+func (store *MemoryStore) execTx(ctx context.Context, isolation pgx.TxIsoLevel, fn func(Querier) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	notifications, err := store.runTx(fn)
+	if err != nil {
+		return err
+	}
+
+	store.deliver(notifications)
+	return nil
+}
+
+// runTx runs fn holding the lock of the store, and undoes all its changes if it fails or panics
+func (store *MemoryStore) runTx(fn func(Querier) error) (notifications []NotifyParams, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	tx := &memoryTx{txid: store.nextTxid(), now: store.now()}
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+	}()
+
+	err = fn(&memoryQueries{store: store, tx: tx})
+	if err != nil {
+		return nil, err
+	}
+
+	committed = true
+	return tx.notifications, nil
+}
+
+// deliver calls the listeners of the notifications, the store must not be locked
+func (store *MemoryStore) deliver(notifications []NotifyParams) {
+	if len(notifications) == 0 {
+		return
+	}
+
+	store.mu.Lock()
+	listeners := make([][]func(payload string), len(notifications))
+	for i, notification := range notifications {
+		listeners[i] = store.listeners[notification.Channel]
+	}
+	store.mu.Unlock()
+
+	for i, notification := range notifications {
+		for _, fn := range listeners[i] {
+			fn(notification.Payload)
+		}
+	}
+}
+
+// nextID returns the next value of the sequence of the table
+// Like in Postgres the sequences are not rolled back, the ids of a failed transaction are never used
+func (store *MemoryStore) nextID(table string) int64 {
+	store.sequences[table]++
+	return store.sequences[table]
+}
+
+func (store *MemoryStore) now() time.Time {
+	// Postgres keeps timestamps with microsecond precision
+	return store.clock.Now().Truncate(time.Microsecond)
+}
+
+func (store *MemoryStore) nextTxid() int64 {
+	store.lastTxid++
+	return store.lastTxid
+}
+
+// memoryTx is the state of a transaction of the MemoryStore
+type memoryTx struct {
+	txid          int64
+	now           time.Time
+	undo          []func()
+	notifications []NotifyParams
+}
+
+// memoryQueries runs the queries against the tables of the store
+// Without a transaction every query locks the store itself and is a transaction of its own,
+// such a query checks all the constraints before it changes anything so it has nothing to undo
+type memoryQueries struct {
+	store *MemoryStore
+	tx    *memoryTx
+}
+
+// lock locks the store for a query run outside of a transaction, and returns the function unlocking it
+func (q *memoryQueries) lock() func() {
+	if q.tx != nil {
+		return func() {}
+	}
+	q.store.mu.Lock()
+	return q.store.mu.Unlock
+}
+
+// now returns the time the transaction started at, as now() does in Postgres
+func (q *memoryQueries) now() time.Time {
+	if q.tx != nil {
+		return q.tx.now
+	}
+	return q.store.now()
+}
+
+// set writes the row under the key, within a transaction the previous row is restored on rollback
+func set[K comparable, V any](q *memoryQueries, table map[K]V, key K, row V) {
+	if q.tx != nil {
+		previous, existed := table[key]
+		q.tx.undo = append(q.tx.undo, func() {
+			if existed {
+				table[key] = previous
+			} else {
+				delete(table, key)
+			}
+		})
+	}
+	table[key] = row
+}
+
+// remove deletes the row under the key, within a transaction it is restored on rollback
+func remove[K comparable, V any](q *memoryQueries, table map[K]V, key K) {
+	previous, existed := table[key]
+	if !existed {
+		return
+	}
+	if q.tx != nil {
+		q.tx.undo = append(q.tx.undo, func() {
+			table[key] = previous
+		})
+	}
+	delete(table, key)
+}
+
+// selectRows returns the rows of the table matching the filter, sorted with less
+func selectRows[K comparable, V any](table map[K]V, match func(V) bool, less func(a, b V) bool) []V {
+	rows := []V{}
+	for _, row := range table {
+		if match(row) {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return less(rows[i], rows[j])
+	})
+	return rows
+}
+
+// findRow returns the first row of the table matching the filter
+func findRow[K comparable, V any](table map[K]V, match func(V) bool) (V, bool) {
+	for _, row := range table {
+		if match(row) {
+			return row, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// limitRows applies LIMIT and OFFSET to the sorted rows
+func limitRows[V any](rows []V, limit int32, offset int32) []V {
+	if int(offset) >= len(rows) {
+		return []V{}
+	}
+	rows = rows[offset:]
+	if int(limit) < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+// uniqueViolation is the error of Postgres for a row conflicting with the unique constraint
+func uniqueViolation(table string, constraint string) error {
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           UniqueViolation,
+		Message:        fmt.Sprintf("duplicate key value violates unique constraint %q", constraint),
+		TableName:      table,
+		ConstraintName: constraint,
+	}
+}
+
+// foreignKeyViolation is the error of Postgres for a row referencing a missing row
+func foreignKeyViolation(table string, constraint string) error {
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           ForeignKeyViolation,
+		Message:        fmt.Sprintf("insert or update on table %q violates foreign key constraint %q", table, constraint),
+		TableName:      table,
+		ConstraintName: constraint,
+	}
+}
+
+// referencedRowViolation is the error of Postgres for deleting a row which is still referenced by the table
+func referencedRowViolation(table string, referencingTable string, constraint string) error {
+	return &pgconn.PgError{
+		Severity: "ERROR",
+		Code:     ForeignKeyViolation,
+		Message: fmt.Sprintf(
+			"update or delete on table %q violates foreign key constraint %q on table %q",
+			table, constraint, referencingTable,
+		),
+		TableName:      referencingTable,
+		ConstraintName: constraint,
+	}
+}
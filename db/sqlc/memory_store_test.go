@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/clock"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreNotifiesOnCommit(t *testing.T) {
+	store := NewMemoryStore()
+
+	var payloads []string
+	store.Listen(TransferNotificationChannel, func(payload string) {
+		payloads = append(payloads, payload)
+	})
+
+	account1 := createConformanceAccount(t, store, createConformanceUser(t, store).Username, util.USD)
+	account2 := createConformanceAccount(t, store, createConformanceUser(t, store).Username, util.USD)
+
+	result, err := store.TransferTX(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        10,
+	})
+	require.NoError(t, err)
+	require.Len(t, payloads, 1)
+
+	var notification TransferNotification
+	require.NoError(t, json.Unmarshal([]byte(payloads[0]), &notification))
+	require.Equal(t, result.Transfer.ID, notification.Transfer.ID)
+	require.Equal(t, result.FromAccount.Balance, notification.FromAccount.Balance)
+}
+
+func TestMemoryStoreRollback(t *testing.T) {
+	store := NewMemoryStore()
+	account := createConformanceAccount(t, store, createConformanceUser(t, store).Username, util.USD)
+
+	var payloads []string
+	store.Listen(TransferNotificationChannel, func(payload string) {
+		payloads = append(payloads, payload)
+	})
+
+	txErr := errors.New("abort")
+	err := store.execTx(context.Background(), pgx.ReadCommitted, func(q Querier) error {
+		_, err := q.AddAccountBalance(context.Background(), AddAccountBalanceParams{ID: account.ID, Amount: 10})
+		require.NoError(t, err)
+
+		_, err = createChainedEntry(context.Background(), q, account.ID, 10)
+		require.NoError(t, err)
+
+		err = q.DeleteAccount(context.Background(), account.ID)
+		require.Equal(t, ForeignKeyViolation, ErrorCode(err))
+
+		err = q.Notify(context.Background(), NotifyParams{Channel: TransferNotificationChannel, Payload: "{}"})
+		require.NoError(t, err)
+		return txErr
+	})
+	require.ErrorIs(t, err, txErr)
+
+	// The changes of the transaction are undone and its notifications dropped
+	updatedAccount, err := store.GetAccount(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.Equal(t, account.Balance, updatedAccount.Balance)
+
+	_, err = store.GetLatestEntry(context.Background(), account.ID)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+	require.Empty(t, payloads)
+
+	// Without entries the account can be deleted
+	require.NoError(t, store.DeleteAccount(context.Background(), account.ID))
+}
+
+func TestMemoryStoreClock(t *testing.T) {
+	issuedAt := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(issuedAt)
+	store := NewMemoryStoreWithClock(clk)
+
+	user := createConformanceUser(t, store)
+	require.True(t, issuedAt.Equal(user.CreatedAt))
+
+	resetToken, err := store.CreatePasswordResetToken(context.Background(), CreatePasswordResetTokenParams{
+		Username:  user.Username,
+		TokenHash: util.HashSecret(util.RandomString(32)),
+		ExpiresAt: issuedAt.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	require.True(t, issuedAt.Equal(resetToken.CreatedAt))
+
+	gotToken, err := store.GetPasswordResetToken(context.Background(), resetToken.TokenHash)
+	require.NoError(t, err)
+	require.Equal(t, resetToken, gotToken)
+
+	// The token can be used up to the very end of its expiry
+	clk.Advance(time.Hour + time.Nanosecond)
+	_, err = store.ResetPasswordTx(context.Background(), ResetPasswordTxParams{
+		TokenHash:      resetToken.TokenHash,
+		HashedPassword: util.RandomString(32),
+		Now:            clk.Now(),
+	})
+	require.ErrorIs(t, err, ErrInvalidResetToken)
+
+	clk.Set(issuedAt.Add(time.Hour))
+	result, err := store.ResetPasswordTx(context.Background(), ResetPasswordTxParams{
+		TokenHash:      resetToken.TokenHash,
+		HashedPassword: util.RandomString(32),
+		Now:            clk.Now(),
+	})
+	require.NoError(t, err)
+	require.True(t, clk.Now().Equal(result.User.PasswordChangedAt))
+}
+
+func TestMemoryStoreDeleteFullRateLimitBuckets(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC))
+	store := NewMemoryStoreWithClock(clk)
+	arg := TakeRateLimitTokenParams{Key: util.RandomString(16), Burst: 1, PerSecond: 1}
+
+	bucket, err := store.TakeRateLimitToken(context.Background(), arg)
+	require.NoError(t, err)
+	require.True(t, bucket.Allowed)
+
+	deleted, err := store.DeleteFullRateLimitBuckets(context.Background(), DeleteFullRateLimitBucketsParams{RefillSeconds: 1})
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+
+	// Only the buckets of the prefix are deleted
+	clk.Advance(time.Second + time.Microsecond)
+	deleted, err = store.DeleteFullRateLimitBuckets(context.Background(), DeleteFullRateLimitBucketsParams{KeyPrefix: "other:", RefillSeconds: 1})
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+
+	deleted, err = store.DeleteFullRateLimitBuckets(context.Background(), DeleteFullRateLimitBucketsParams{KeyPrefix: arg.Key[:4], RefillSeconds: 1})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMFAChallenge(t *testing.T) {
+	user := createRandomUser(t)
+
+	arg := CreateMFAChallengeParams{
+		Username:  user.Username,
+		TokenHash: util.HashSecret(util.RandomString(32)),
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+
+	challenge1, err := testQueries.CreateMFAChallenge(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Username, challenge1.Username)
+	require.Equal(t, arg.TokenHash, challenge1.TokenHash)
+	require.WithinDuration(t, arg.ExpiresAt, challenge1.ExpiresAt, time.Second)
+	require.False(t, challenge1.UsedAt.Valid)
+
+	challenge2, err := testQueries.GetMFAChallenge(context.Background(), arg.TokenHash)
+	require.NoError(t, err)
+	require.Equal(t, challenge1.ID, challenge2.ID)
+
+	// A challenge can be used only once
+	rowsAffected, err := testQueries.UseMFAChallenge(context.Background(), challenge1.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), rowsAffected)
+
+	rowsAffected, err = testQueries.UseMFAChallenge(context.Background(), challenge1.ID)
+	require.NoError(t, err)
+	require.Zero(t, rowsAffected)
+}
@@ -5,7 +5,11 @@
 package db
 
 import (
+	"encoding/json"
 	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Account struct {
@@ -14,6 +18,23 @@ type Account struct {
 	Balance   int64     `json:"balance"`
 	Currency  string    `json:"currency"`
 	CreatedAt time.Time `json:"created_at"`
+	// active, frozen or closed, only active accounts take part in transfers
+	Status string `json:"status"`
+	// hash of the latest entry of the account, anchors the end of its hash chain
+	LatestEntryHash string `json:"latest_entry_hash"`
+}
+
+type ApiKey struct {
+	ID               int64 `json:"id"`
+	ServiceAccountID int64 `json:"service_account_id"`
+	// first characters of the key, shown in listings to tell the keys apart
+	KeyPrefix string `json:"key_prefix"`
+	// sha256 of the key, the key itself is returned only once when it is created
+	KeyHash    string             `json:"key_hash"`
+	Scopes     []string           `json:"scopes"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+	RevokedAt  pgtype.Timestamptz `json:"revoked_at"`
+	CreatedAt  time.Time          `json:"created_at"`
 }
 
 type Entry struct {
@@ -22,6 +43,85 @@ type Entry struct {
 	// can be negative or positive
 	Amount    int64     `json:"amount"`
 	CreatedAt time.Time `json:"created_at"`
+	// hash of the previous entry of the same account
+	PrevHash string `json:"prev_hash"`
+	// sha256 over prev_hash and the entry contents
+	Hash string `json:"hash"`
+}
+
+type MfaChallenge struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// sha256 of the challenge token returned by the first login step
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt time.Time          `json:"created_at"`
+	// codes tried with the challenge, it is rejected once the limit is reached
+	Attempts int32 `json:"attempts"`
+}
+
+type OutboxCheckpoint struct {
+	// name under which the handler is registered with the dispatcher
+	Handler     string    `json:"handler"`
+	LastTxid    int64     `json:"last_txid"`
+	LastEventID int64     `json:"last_event_id"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type OutboxEvent struct {
+	ID int64 `json:"id"`
+	// transaction which wrote the event, events are dispatched in the order of their transactions once no older transaction is still running
+	Txid      int64           `json:"txid"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type PasswordResetToken struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// sha256 of the token sent to the user, the token itself is never stored
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type RateLimitBucket struct {
+	Key    string  `json:"key"`
+	Tokens float64 `json:"tokens"`
+	// whether the last request took a token
+	Allowed   bool      `json:"allowed"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type RecoveryCode struct {
+	ID        int64              `json:"id"`
+	Username  string             `json:"username"`
+	CodeHash  string             `json:"code_hash"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type ServiceAccount struct {
+	ID int64 `json:"id"`
+	// user whose accounts the service account acts on, within the scopes of its api keys
+	Owner     string    `json:"owner"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Session struct {
+	// id of the access token issued on login, the token is rejected once the session is revoked
+	ID         uuid.UUID          `json:"id"`
+	Username   string             `json:"username"`
+	UserAgent  string             `json:"user_agent"`
+	ClientIp   string             `json:"client_ip"`
+	ExpiresAt  time.Time          `json:"expires_at"`
+	LastUsedAt time.Time          `json:"last_used_at"`
+	RevokedAt  pgtype.Timestamptz `json:"revoked_at"`
+	CreatedAt  time.Time          `json:"created_at"`
 }
 
 type Transfer struct {
@@ -31,6 +131,8 @@ type Transfer struct {
 	// must be positive
 	Amount    int64     `json:"amount"`
 	CreatedAt time.Time `json:"created_at"`
+	// the transfer which gave the money back, set once a transfer is reversed
+	ReversedBy pgtype.Int8 `json:"reversed_by"`
 }
 
 type User struct {
@@ -40,4 +142,53 @@ type User struct {
 	Email             string    `json:"email"`
 	PasswordChangedAt time.Time `json:"password_changed_at"`
 	CreatedAt         time.Time `json:"created_at"`
+	Role              string    `json:"role"`
+	// failed logins since the last successful login or lockout
+	FailedLoginAttempts int32 `json:"failed_login_attempts"`
+	// lockouts since the last successful login, used to escalate the lockout period
+	LockoutCount    int32     `json:"lockout_count"`
+	LockedUntil     time.Time `json:"locked_until"`
+	IsEmailVerified bool      `json:"is_email_verified"`
+	// base32 TOTP secret, set on enrollment and used for login once is_totp_enabled is true
+	TotpSecret    string `json:"totp_secret"`
+	IsTotpEnabled bool   `json:"is_totp_enabled"`
+	// time step of the last accepted TOTP code, a code cannot be used twice
+	TotpLastUsedStep int64 `json:"totp_last_used_step"`
+}
+
+type VerifyEmail struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	// sha256 of the code sent to the user, the code itself is never stored
+	SecretCodeHash string             `json:"secret_code_hash"`
+	ExpiresAt      time.Time          `json:"expires_at"`
+	UsedAt         pgtype.Timestamptz `json:"used_at"`
+	CreatedAt      time.Time          `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	// pending until delivered, dead once all attempts have failed
+	Status        string             `json:"status"`
+	Attempts      int32              `json:"attempts"`
+	NextAttemptAt time.Time          `json:"next_attempt_at"`
+	LastError     string             `json:"last_error"`
+	DeliveredAt   pgtype.Timestamptz `json:"delivered_at"`
+	CreatedAt     time.Time          `json:"created_at"`
+	// outbox event the delivery was created from, an event is delivered at most once to each webhook
+	EventID pgtype.Int8 `json:"event_id"`
+}
+
+type WebhookSubscription struct {
+	ID         int64    `json:"id"`
+	Owner      string   `json:"owner"`
+	Url        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	// key of the HMAC signature of the deliveries, kept in plain text since it is needed to sign them
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// TransferNotificationChannel is the Postgres channel TransferTX notifies of every committed transfer
+const TransferNotificationChannel = "transfers"
+
+// TransferNotification is the payload of a notification on TransferNotificationChannel
+// The accounts have the balances right after the transfer
+// It is kept small, the payload of a Postgres notification is limited to 8000 bytes
+type TransferNotification struct {
+	Transfer    Transfer `json:"transfer"`
+	FromAccount Account  `json:"from_account"`
+	ToAccount   Account  `json:"to_account"`
+}
+
+// notifyTransfer notifies the listeners of TransferNotificationChannel within the transaction of q
+// Postgres delivers the notification only once the transaction is committed, and drops it on rollback
+func notifyTransfer(ctx context.Context, q Querier, notification TransferNotification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	return q.Notify(ctx, NotifyParams{
+		Channel: TransferNotificationChannel,
+		Payload: string(payload),
+	})
+}
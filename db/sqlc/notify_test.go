@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// listenTransfers returns a connection listening on the transfers channel
+func listenTransfers(t *testing.T) *pgx.Conn {
+	config, err := util.LoadConfig("../..")
+	require.NoError(t, err)
+
+	conn, err := pgx.Connect(context.Background(), config.DBSource)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close(context.Background()) })
+
+	_, err = conn.Exec(context.Background(), "LISTEN "+TransferNotificationChannel)
+	require.NoError(t, err)
+	return conn
+}
+
+// waitTransferNotification returns the notification of the transfer, skipping the ones of transfers made by other tests
+func waitTransferNotification(t *testing.T, conn *pgx.Conn, transferID int64) TransferNotification {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		require.NoError(t, err, "transfer was not notified")
+
+		var transferNotification TransferNotification
+		err = json.Unmarshal([]byte(notification.Payload), &transferNotification)
+		require.NoError(t, err)
+		if transferNotification.Transfer.ID == transferID {
+			return transferNotification
+		}
+	}
+}
+
+func TestTransferTxNotifies(t *testing.T) {
+	conn := listenTransfers(t)
+	store := NewStore(testDB)
+
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+
+	result, err := store.TransferTX(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        10,
+	})
+	require.NoError(t, err)
+
+	notification := waitTransferNotification(t, conn, result.Transfer.ID)
+	require.Equal(t, result.Transfer.Amount, notification.Transfer.Amount)
+	require.Equal(t, account1.Owner, notification.FromAccount.Owner)
+	require.Equal(t, result.FromAccount.Balance, notification.FromAccount.Balance)
+	require.Equal(t, account2.Owner, notification.ToAccount.Owner)
+	require.Equal(t, result.ToAccount.Balance, notification.ToAccount.Balance)
+}
+
+func TestNotifyRolledBack(t *testing.T) {
+	conn := listenTransfers(t)
+
+	tx, err := testDB.Begin(context.Background())
+	require.NoError(t, err)
+
+	err = New(tx).Notify(context.Background(), NotifyParams{
+		Channel: TransferNotificationChannel,
+		Payload: `{"transfer":{"id":-1}}`,
+	})
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback(context.Background()))
+
+	// A notification of a rolled back transaction is never delivered
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			break
+		}
+		require.NotContains(t, notification.Payload, `"id":-1`)
+	}
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+// findOutboxEvent pages through the committed events of the outbox until the matching one is found
+func findOutboxEvent(t *testing.T, eventType string, match func(Event) bool) OutboxEvent {
+	var lastTxid, lastEventID int64
+	for {
+		outboxEvents, err := testQueries.ListPendingOutboxEvents(context.Background(), ListPendingOutboxEventsParams{
+			LastTxid:    lastTxid,
+			LastEventID: lastEventID,
+			BatchSize:   1000,
+		})
+		require.NoError(t, err)
+		if len(outboxEvents) == 0 {
+			t.Fatalf("no matching %s event in the outbox", eventType)
+		}
+
+		for _, outboxEvent := range outboxEvents {
+			lastTxid, lastEventID = outboxEvent.Txid, outboxEvent.ID
+			if outboxEvent.EventType != eventType {
+				continue
+			}
+
+			event, err := DecodeEvent(outboxEvent)
+			require.NoError(t, err)
+			if match(event) {
+				return outboxEvent
+			}
+		}
+	}
+}
+
+func TestListPendingOutboxEvents(t *testing.T) {
+	event := AccountCreated{Account: Account{ID: util.RandomInt(1, 1000), Owner: util.RandomOwner()}}
+	payload, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	outboxEvent1, err := testQueries.CreateOutboxEvent(context.Background(), CreateOutboxEventParams{
+		EventType: event.EventType(),
+		Payload:   payload,
+	})
+	require.NoError(t, err)
+	require.NotZero(t, outboxEvent1.Txid)
+
+	// An event is not listed while the transaction writing it is still running
+	tx, err := testDB.Begin(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback(context.Background())
+
+	outboxEvent2, err := New(tx).CreateOutboxEvent(context.Background(), CreateOutboxEventParams{
+		EventType: event.EventType(),
+		Payload:   payload,
+	})
+	require.NoError(t, err)
+	require.Greater(t, outboxEvent2.Txid, outboxEvent1.Txid)
+
+	outboxEvents, err := testQueries.ListPendingOutboxEvents(context.Background(), ListPendingOutboxEventsParams{
+		LastTxid:    outboxEvent1.Txid,
+		LastEventID: outboxEvent1.ID - 1,
+		BatchSize:   1000,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, outboxEvents)
+	require.Equal(t, outboxEvent1.ID, outboxEvents[0].ID)
+	for _, outboxEvent := range outboxEvents {
+		require.NotEqual(t, outboxEvent2.ID, outboxEvent.ID)
+	}
+
+	decoded, err := DecodeEvent(outboxEvents[0])
+	require.NoError(t, err)
+	require.Equal(t, &event, decoded)
+}
+
+func TestOutboxCheckpoint(t *testing.T) {
+	handler := util.RandomString(8)
+
+	_, err := testQueries.GetOutboxCheckpoint(context.Background(), handler)
+	require.EqualError(t, err, ErrRecordNotFound.Error())
+
+	for _, lastEventID := range []int64{10, 20} {
+		err = testQueries.SaveOutboxCheckpoint(context.Background(), SaveOutboxCheckpointParams{
+			Handler:     handler,
+			LastTxid:    lastEventID * 100,
+			LastEventID: lastEventID,
+		})
+		require.NoError(t, err)
+
+		checkpoint, err := testQueries.GetOutboxCheckpoint(context.Background(), handler)
+		require.NoError(t, err)
+		require.Equal(t, lastEventID*100, checkpoint.LastTxid)
+		require.Equal(t, lastEventID, checkpoint.LastEventID)
+	}
+}
+
+func TestDecodeUnknownEvent(t *testing.T) {
+	_, err := DecodeEvent(OutboxEvent{ID: 1, EventType: "account.deleted", Payload: json.RawMessage(`{}`)})
+	require.Error(t, err)
+}
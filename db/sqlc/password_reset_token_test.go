@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomPasswordResetToken(t *testing.T, user User, expiresAt time.Time) (PasswordResetToken, string) {
+	token, err := util.GenerateSecret(32)
+	require.NoError(t, err)
+
+	arg := CreatePasswordResetTokenParams{
+		Username:  user.Username,
+		TokenHash: util.HashSecret(token),
+		ExpiresAt: expiresAt,
+	}
+
+	resetToken, err := testQueries.CreatePasswordResetToken(context.Background(), arg)
+	require.NoError(t, err)
+	require.NotEmpty(t, resetToken)
+
+	require.Equal(t, arg.Username, resetToken.Username)
+	require.Equal(t, arg.TokenHash, resetToken.TokenHash)
+	require.WithinDuration(t, arg.ExpiresAt, resetToken.ExpiresAt, time.Second)
+	require.False(t, resetToken.UsedAt.Valid)
+	require.NotZero(t, resetToken.CreatedAt)
+
+	return resetToken, token
+}
+
+func TestCreatePasswordResetToken(t *testing.T) {
+	user := createRandomUser(t)
+	createRandomPasswordResetToken(t, user, time.Now().Add(time.Minute))
+}
+
+func TestGetPasswordResetToken(t *testing.T) {
+	user := createRandomUser(t)
+	resetToken1, token := createRandomPasswordResetToken(t, user, time.Now().Add(time.Minute))
+
+	resetToken2, err := testQueries.GetPasswordResetToken(context.Background(), util.HashSecret(token))
+	require.NoError(t, err)
+	require.Equal(t, resetToken1, resetToken2)
+
+	_, err = testQueries.GetPasswordResetToken(context.Background(), util.HashSecret(util.RandomString(32)))
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestResetPasswordTx(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+	_, token := createRandomPasswordResetToken(t, user, time.Now().Add(time.Minute))
+
+	hashedPassword, err := util.HashPassword(util.RandomString(8))
+	require.NoError(t, err)
+
+	arg := ResetPasswordTxParams{
+		TokenHash:      util.HashSecret(token),
+		HashedPassword: hashedPassword,
+		Now:            time.Now(),
+	}
+
+	result, err := store.ResetPasswordTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, result.User.Username)
+	require.Equal(t, hashedPassword, result.User.HashedPassword)
+	require.True(t, result.User.PasswordChangedAt.After(user.PasswordChangedAt))
+
+	// The token can be used only once
+	_, err = store.ResetPasswordTx(context.Background(), arg)
+	require.ErrorIs(t, err, ErrInvalidResetToken)
+}
+
+func TestResetPasswordTxExpiredToken(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+	_, token := createRandomPasswordResetToken(t, user, time.Now().Add(-time.Minute))
+
+	_, err := store.ResetPasswordTx(context.Background(), ResetPasswordTxParams{
+		TokenHash:      util.HashSecret(token),
+		HashedPassword: user.HashedPassword,
+		Now:            time.Now(),
+	})
+	require.ErrorIs(t, err, ErrInvalidResetToken)
+}
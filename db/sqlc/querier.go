@@ -6,24 +6,95 @@ package db
 
 import (
 	"context"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type Querier interface {
 	AddAccountBalance(ctx context.Context, arg AddAccountBalanceParams) (Account, error)
+	ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]WebhookDelivery, error)
+	CountMFAChallengeAttempt(ctx context.Context, arg CountMFAChallengeAttemptParams) (int64, error)
+	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error)
 	CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error)
 	CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error)
+	CreateMFAChallenge(ctx context.Context, arg CreateMFAChallengeParams) (MfaChallenge, error)
+	CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) (OutboxEvent, error)
+	CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (PasswordResetToken, error)
+	CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) (RecoveryCode, error)
+	CreateServiceAccount(ctx context.Context, arg CreateServiceAccountParams) (ServiceAccount, error)
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
 	CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateVerifyEmail(ctx context.Context, arg CreateVerifyEmailParams) (VerifyEmail, error)
+	CreateWebhookSubscription(ctx context.Context, arg CreateWebhookSubscriptionParams) (WebhookSubscription, error)
+	DeadLetterWebhookDelivery(ctx context.Context, arg DeadLetterWebhookDeliveryParams) error
 	DeleteAccount(ctx context.Context, id int64) error
+	DeleteFullRateLimitBuckets(ctx context.Context, arg DeleteFullRateLimitBucketsParams) (int64, error)
+	DeleteRecoveryCodes(ctx context.Context, username string) error
+	DeleteWebhookSubscription(ctx context.Context, id int64) error
+	EnableUserTOTP(ctx context.Context, arg EnableUserTOTPParams) (User, error)
+	EnqueueWebhookDeliveries(ctx context.Context, arg EnqueueWebhookDeliveriesParams) (int64, error)
+	GetAPIKeyForAuth(ctx context.Context, keyHash string) (GetAPIKeyForAuthRow, error)
 	GetAccount(ctx context.Context, id int64) (Account, error)
 	GetAccountForUpdate(ctx context.Context, id int64) (Account, error)
 	GetEntry(ctx context.Context, id int64) (Entry, error)
+	GetFirstChainedEntryID(ctx context.Context) (int64, error)
+	GetLatestEntry(ctx context.Context, accountID int64) (Entry, error)
+	GetMFAChallenge(ctx context.Context, tokenHash string) (MfaChallenge, error)
+	GetOutboxCheckpoint(ctx context.Context, handler string) (OutboxCheckpoint, error)
+	GetPasswordResetToken(ctx context.Context, tokenHash string) (PasswordResetToken, error)
+	GetPasswordResetTokenForUpdate(ctx context.Context, tokenHash string) (PasswordResetToken, error)
+	GetServiceAccount(ctx context.Context, id int64) (ServiceAccount, error)
+	GetSession(ctx context.Context, id uuid.UUID) (Session, error)
 	GetTransfer(ctx context.Context, id int64) (Transfer, error)
+	GetTransferForUpdate(ctx context.Context, id int64) (Transfer, error)
 	GetUser(ctx context.Context, username string) (User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserForUpdate(ctx context.Context, username string) (User, error)
+	GetUserPasswordChangedAt(ctx context.Context, username string) (time.Time, error)
+	GetVerifyEmailForUpdate(ctx context.Context, id int64) (VerifyEmail, error)
+	GetWebhookSubscription(ctx context.Context, id int64) (WebhookSubscription, error)
+	ListAPIKeys(ctx context.Context, serviceAccountID int64) ([]ApiKey, error)
+	ListAccountEntriesAfter(ctx context.Context, arg ListAccountEntriesAfterParams) ([]Entry, error)
 	ListAccounts(ctx context.Context, arg ListAccountsParams) ([]Account, error)
+	ListAccountsAfter(ctx context.Context, arg ListAccountsAfterParams) ([]Account, error)
+	ListActiveSessions(ctx context.Context, username string) ([]Session, error)
 	ListEntries(ctx context.Context, arg ListEntriesParams) ([]Entry, error)
+	ListEntriesAfter(ctx context.Context, arg ListEntriesAfterParams) ([]Entry, error)
+	ListPendingOutboxEvents(ctx context.Context, arg ListPendingOutboxEventsParams) ([]OutboxEvent, error)
+	ListServiceAccounts(ctx context.Context, owner string) ([]ServiceAccount, error)
 	ListTransfers(ctx context.Context, arg ListTransfersParams) ([]Transfer, error)
+	ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error)
+	ListWebhookSubscriptions(ctx context.Context, owner string) ([]WebhookSubscription, error)
+	LockUser(ctx context.Context, arg LockUserParams) (User, error)
+	MarkWebhookDelivered(ctx context.Context, id int64) error
+	Notify(ctx context.Context, arg NotifyParams) error
+	RecordFailedLogin(ctx context.Context, username string) (User, error)
+	RedeliverWebhookDelivery(ctx context.Context, arg RedeliverWebhookDeliveryParams) (WebhookDelivery, error)
+	ResetFailedLogins(ctx context.Context, username string) error
+	RetryWebhookDelivery(ctx context.Context, arg RetryWebhookDeliveryParams) error
+	RevokeAPIKey(ctx context.Context, arg RevokeAPIKeyParams) (ApiKey, error)
+	RevokeSession(ctx context.Context, arg RevokeSessionParams) (Session, error)
+	SaveOutboxCheckpoint(ctx context.Context, arg SaveOutboxCheckpointParams) error
+	SetAccountLatestEntryHash(ctx context.Context, arg SetAccountLatestEntryHashParams) error
+	SetEntryHash(ctx context.Context, arg SetEntryHashParams) (Entry, error)
+	SetTransferReversedBy(ctx context.Context, arg SetTransferReversedByParams) (Transfer, error)
+	SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) (User, error)
+	TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (RateLimitBucket, error)
+	TouchAPIKey(ctx context.Context, id int64) error
+	TouchSession(ctx context.Context, id uuid.UUID) (Session, error)
+	UnlockUser(ctx context.Context, username string) (User, error)
 	UpdateAccount(ctx context.Context, arg UpdateAccountParams) (Account, error)
+	UpdateAccountStatus(ctx context.Context, arg UpdateAccountStatusParams) (Account, error)
+	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error)
+	UpdateUserPasswordHash(ctx context.Context, arg UpdateUserPasswordHashParams) (User, error)
+	UseMFAChallenge(ctx context.Context, id int64) (int64, error)
+	UsePasswordResetToken(ctx context.Context, id int64) (PasswordResetToken, error)
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (RecoveryCode, error)
+	UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error)
+	UseVerifyEmail(ctx context.Context, id int64) (VerifyEmail, error)
+	VerifyUserEmail(ctx context.Context, username string) (User, error)
 }
 
 var _ Querier = (*Queries)(nil)
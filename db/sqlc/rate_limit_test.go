@@ -0,0 +1,32 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTakeRateLimitToken(t *testing.T) {
+	arg := TakeRateLimitTokenParams{
+		Key:   util.RandomString(12),
+		Burst: 3,
+		// the bucket is refilled so slowly that it stays empty for the duration of the test
+		PerSecond: 0.001,
+	}
+
+	for i := 0; i < int(arg.Burst); i++ {
+		bucket, err := testQueries.TakeRateLimitToken(context.Background(), arg)
+		require.NoError(t, err)
+		require.Equal(t, arg.Key, bucket.Key)
+		require.True(t, bucket.Allowed)
+		require.InDelta(t, arg.Burst-float64(i+1), bucket.Tokens, 0.01)
+		require.NotZero(t, bucket.UpdatedAt)
+	}
+
+	bucket, err := testQueries.TakeRateLimitToken(context.Background(), arg)
+	require.NoError(t, err)
+	require.False(t, bucket.Allowed)
+	require.True(t, bucket.Tokens < 1)
+}
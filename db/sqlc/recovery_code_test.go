@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnableTOTPTx(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+
+	recoveryCodes, err := util.GenerateRecoveryCodes(3)
+	require.NoError(t, err)
+
+	arg := EnableTOTPTxParams{
+		Username: user.Username,
+		Step:     100,
+	}
+	for _, code := range recoveryCodes {
+		arg.RecoveryCodeHashes = append(arg.RecoveryCodeHashes, util.HashSecret(code))
+	}
+
+	result, err := store.EnableTOTPTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.True(t, result.User.IsTotpEnabled)
+	require.Equal(t, arg.Step, result.User.TotpLastUsedStep)
+
+	// Every recovery code can be used once
+	useArg := UseRecoveryCodeParams{
+		Username: user.Username,
+		CodeHash: arg.RecoveryCodeHashes[0],
+	}
+
+	recoveryCode, err := testQueries.UseRecoveryCode(context.Background(), useArg)
+	require.NoError(t, err)
+	require.True(t, recoveryCode.UsedAt.Valid)
+
+	_, err = testQueries.UseRecoveryCode(context.Background(), useArg)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	// Enabling again replaces the previous recovery codes
+	_, err = store.EnableTOTPTx(context.Background(), EnableTOTPTxParams{
+		Username:           user.Username,
+		Step:               101,
+		RecoveryCodeHashes: []string{util.HashSecret(util.RandomString(16))},
+	})
+	require.NoError(t, err)
+
+	_, err = testQueries.UseRecoveryCode(context.Background(), UseRecoveryCodeParams{
+		Username: user.Username,
+		CodeHash: arg.RecoveryCodeHashes[1],
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
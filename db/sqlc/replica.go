@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+)
+
+type primaryReadKey struct{}
+
+// WithPrimaryReads returns a context in which a ReplicaStore serves all the reads from the primary
+// It is the escape hatch for the clients which have to read their own writes, which the replica may not have yet
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadKey{}, true)
+}
+
+// PrimaryReads reports whether the reads made with the context have to be served by the primary
+func PrimaryReads(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryReadKey{}).(bool)
+	return primary
+}
+
+// ReplicaStore serves the reads which tolerate replication lag from a replica and everything else from the primary store
+// Only the plain reads listed below go to the replica, the transactions, the reads locking rows and the reads
+// behind authentication and credentials, e.g. sessions, api keys and lockouts, always see the latest state of the primary
+type ReplicaStore struct {
+	Store
+	replica Querier
+}
+
+// NewReplicaStore creates a store sending the replica-safe reads to the replica and the rest to the primary
+func NewReplicaStore(primary Store, replica Querier) Store {
+	return &ReplicaStore{
+		Store:   primary,
+		replica: replica,
+	}
+}
+
+// reader returns the querier serving the reads made with the context
+func (store *ReplicaStore) reader(ctx context.Context) Querier {
+	if PrimaryReads(ctx) {
+		return store.Store
+	}
+	return store.replica
+}
+
+func (store *ReplicaStore) GetAccount(ctx context.Context, id int64) (Account, error) {
+	return store.reader(ctx).GetAccount(ctx, id)
+}
+
+func (store *ReplicaStore) ListAccounts(ctx context.Context, arg ListAccountsParams) ([]Account, error) {
+	return store.reader(ctx).ListAccounts(ctx, arg)
+}
+
+func (store *ReplicaStore) ListAccountsAfter(ctx context.Context, arg ListAccountsAfterParams) ([]Account, error) {
+	return store.reader(ctx).ListAccountsAfter(ctx, arg)
+}
+
+func (store *ReplicaStore) GetEntry(ctx context.Context, id int64) (Entry, error) {
+	return store.reader(ctx).GetEntry(ctx, id)
+}
+
+func (store *ReplicaStore) ListEntries(ctx context.Context, arg ListEntriesParams) ([]Entry, error) {
+	return store.reader(ctx).ListEntries(ctx, arg)
+}
+
+func (store *ReplicaStore) ListEntriesAfter(ctx context.Context, arg ListEntriesAfterParams) ([]Entry, error) {
+	return store.reader(ctx).ListEntriesAfter(ctx, arg)
+}
+
+func (store *ReplicaStore) ListAccountEntriesAfter(ctx context.Context, arg ListAccountEntriesAfterParams) ([]Entry, error) {
+	return store.reader(ctx).ListAccountEntriesAfter(ctx, arg)
+}
+
+func (store *ReplicaStore) GetFirstChainedEntryID(ctx context.Context) (int64, error) {
+	return store.reader(ctx).GetFirstChainedEntryID(ctx)
+}
+
+func (store *ReplicaStore) GetTransfer(ctx context.Context, id int64) (Transfer, error) {
+	return store.reader(ctx).GetTransfer(ctx, id)
+}
+
+func (store *ReplicaStore) ListTransfers(ctx context.Context, arg ListTransfersParams) ([]Transfer, error) {
+	return store.reader(ctx).ListTransfers(ctx, arg)
+}
+
+func (store *ReplicaStore) ListServiceAccounts(ctx context.Context, owner string) ([]ServiceAccount, error) {
+	return store.reader(ctx).ListServiceAccounts(ctx, owner)
+}
+
+func (store *ReplicaStore) ListAPIKeys(ctx context.Context, serviceAccountID int64) ([]ApiKey, error) {
+	return store.reader(ctx).ListAPIKeys(ctx, serviceAccountID)
+}
+
+func (store *ReplicaStore) ListWebhookSubscriptions(ctx context.Context, owner string) ([]WebhookSubscription, error) {
+	return store.reader(ctx).ListWebhookSubscriptions(ctx, owner)
+}
+
+func (store *ReplicaStore) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	return store.reader(ctx).ListWebhookDeliveries(ctx, arg)
+}
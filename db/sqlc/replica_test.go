@@ -0,0 +1,99 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/igiai/simplebank/db/mock"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+// The tests of the routing use mocks, which import the db package, so they are kept in a package of their own
+
+func TestReplicaStoreReads(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := mockdb.NewMockStore(ctrl)
+	replica := mockdb.NewMockStore(ctrl)
+	store := db.NewReplicaStore(primary, replica)
+
+	account := db.Account{ID: util.RandomInt(1, 1000), Owner: util.RandomOwner()}
+
+	// Plain reads are served by the replica
+	replica.EXPECT().
+		GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+		Times(1).
+		Return(account, nil)
+	replica.EXPECT().
+		ListAccounts(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return([]db.Account{account}, nil)
+
+	// So are all the reads of the ledger verification, for it not to mix the states of the primary and the replica
+	replica.EXPECT().
+		GetFirstChainedEntryID(gomock.Any()).
+		Times(1)
+	replica.EXPECT().
+		ListEntriesAfter(gomock.Any(), gomock.Any()).
+		Times(1)
+	replica.EXPECT().
+		ListAccountsAfter(gomock.Any(), gomock.Any()).
+		Times(1)
+
+	// The reads behind authentication and the transactions are not
+	primary.EXPECT().
+		GetUserPasswordChangedAt(gomock.Any(), gomock.Eq(account.Owner)).
+		Times(1)
+	primary.EXPECT().
+		TransferTX(gomock.Any(), gomock.Any()).
+		Times(1)
+
+	ctx := context.Background()
+
+	gotAccount, err := store.GetAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.Equal(t, account, gotAccount)
+
+	accounts, err := store.ListAccounts(ctx, db.ListAccountsParams{Owner: account.Owner, Limit: 5})
+	require.NoError(t, err)
+	require.Equal(t, []db.Account{account}, accounts)
+
+	chainBreak, err := db.VerifyLedger(ctx, store)
+	require.NoError(t, err)
+	require.Nil(t, chainBreak)
+
+	_, err = store.GetUserPasswordChangedAt(ctx, account.Owner)
+	require.NoError(t, err)
+
+	_, err = store.TransferTX(ctx, db.TransferTxParams{FromAccountID: account.ID, ToAccountID: account.ID + 1, Amount: 10})
+	require.NoError(t, err)
+}
+
+func TestReplicaStorePrimaryReads(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := mockdb.NewMockStore(ctrl)
+	replica := mockdb.NewMockStore(ctrl)
+	store := db.NewReplicaStore(primary, replica)
+
+	id := util.RandomInt(1, 1000)
+
+	replica.EXPECT().
+		GetAccount(gomock.Any(), gomock.Any()).
+		Times(0)
+	primary.EXPECT().
+		GetAccount(gomock.Any(), gomock.Eq(id)).
+		Times(1)
+
+	ctx := db.WithPrimaryReads(context.Background())
+	require.True(t, db.PrimaryReads(ctx))
+	require.False(t, db.PrimaryReads(context.Background()))
+
+	_, err := store.GetAccount(ctx, id)
+	require.NoError(t, err)
+}
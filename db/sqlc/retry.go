@@ -0,0 +1,61 @@
+package db
+
+import (
+	"expvar"
+	"math/rand"
+	"time"
+)
+
+// SQLSTATE codes of the errors after which a transaction can succeed when it is run again
+const (
+	serializationFailureCode = "40001"
+	deadlockDetectedCode     = "40P01"
+)
+
+var (
+	// txRetries counts the retried transactions by the SQLSTATE code of the error which aborted them
+	txRetries = expvar.NewMap("db_tx_retries")
+	// txRetriesExhausted counts the transactions which failed even after the last attempt allowed by the retry policy
+	txRetriesExhausted = expvar.NewInt("db_tx_retries_exhausted")
+)
+
+// RetryPolicy bounds the retries of the transactions aborted by a serialization failure or a deadlock
+// The delay before a retry is random, up to BaseDelay doubled with every attempt and capped by MaxDelay,
+// so the transactions which have conflicted once are unlikely to conflict again
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy of the stores created by NewStore
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   10 * time.Millisecond,
+	MaxDelay:    500 * time.Millisecond,
+}
+
+// delay returns the random delay before the attempt following the given one
+func (policy RetryPolicy) delay(attempt int) time.Duration {
+	backoff := policy.BaseDelay
+	for i := 1; i < attempt && backoff < policy.MaxDelay; i++ {
+		backoff *= 2
+	}
+	if policy.MaxDelay > 0 && backoff > policy.MaxDelay {
+		backoff = policy.MaxDelay
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// retryableTxError reports whether the transaction which failed with err can be run again, and the SQLSTATE code of err
+func retryableTxError(err error) (string, bool) {
+	code := ErrorCode(err)
+	switch code {
+	case serializationFailureCode, deadlockDetectedCode:
+		return code, true
+	}
+	return "", false
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryableTxError(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       error
+		code      string
+		retryable bool
+	}{
+		{name: "SerializationFailure", err: &pgconn.PgError{Code: "40001"}, code: "40001", retryable: true},
+		{name: "DeadlockDetected", err: &pgconn.PgError{Code: "40P01"}, code: "40P01", retryable: true},
+		{name: "Wrapped", err: fmt.Errorf("tx err: %w, rb err: %v", &pgconn.PgError{Code: "40001"}, pgx.ErrTxClosed), code: "40001", retryable: true},
+		{name: "UniqueViolation", err: &pgconn.PgError{Code: UniqueViolation}},
+		{name: "NoRows", err: ErrRecordNotFound},
+		{name: "NoError", err: nil},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			code, retryable := retryableTxError(tc.err)
+			require.Equal(t, tc.retryable, retryable)
+			require.Equal(t, tc.code, code)
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts: 10,
+		BaseDelay:   10 * time.Millisecond,
+		MaxDelay:    50 * time.Millisecond,
+	}
+
+	// The delay is jittered up to the doubled base delay, never above the maximum
+	limits := []time.Duration{10, 20, 40, 50, 50, 50}
+	for i, limit := range limits {
+		for j := 0; j < 100; j++ {
+			delay := policy.delay(i + 1)
+			require.GreaterOrEqual(t, delay, time.Duration(0))
+			require.LessOrEqual(t, delay, limit*time.Millisecond)
+		}
+	}
+
+	require.Zero(t, RetryPolicy{}.delay(3))
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomServiceAccount(t *testing.T, owner string) ServiceAccount {
+	arg := CreateServiceAccountParams{
+		Owner: owner,
+		Name:  util.RandomString(8),
+	}
+
+	serviceAccount, err := testQueries.CreateServiceAccount(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Owner, serviceAccount.Owner)
+	require.Equal(t, arg.Name, serviceAccount.Name)
+	require.NotZero(t, serviceAccount.ID)
+	require.NotZero(t, serviceAccount.CreatedAt)
+
+	return serviceAccount
+}
+
+func TestServiceAccount(t *testing.T) {
+	user := createRandomUser(t)
+	serviceAccount1 := createRandomServiceAccount(t, user.Username)
+	serviceAccount2 := createRandomServiceAccount(t, user.Username)
+
+	serviceAccount, err := testQueries.GetServiceAccount(context.Background(), serviceAccount1.ID)
+	require.NoError(t, err)
+	require.Equal(t, serviceAccount1, serviceAccount)
+
+	serviceAccounts, err := testQueries.ListServiceAccounts(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Equal(t, []ServiceAccount{serviceAccount1, serviceAccount2}, serviceAccounts)
+
+	// Names are unique per owner
+	_, err = testQueries.CreateServiceAccount(context.Background(), CreateServiceAccountParams{
+		Owner: user.Username,
+		Name:  serviceAccount1.Name,
+	})
+	require.Error(t, err)
+}
+
+func TestAPIKey(t *testing.T) {
+	user := createRandomUser(t)
+	serviceAccount := createRandomServiceAccount(t, user.Username)
+
+	arg := CreateAPIKeyParams{
+		ServiceAccountID: serviceAccount.ID,
+		KeyPrefix:        util.RandomString(12),
+		KeyHash:          util.HashSecret(util.RandomString(32)),
+		Scopes:           []string{util.AccountsReadScope, util.TransfersWriteScope},
+	}
+
+	key, err := testQueries.CreateAPIKey(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.ServiceAccountID, key.ServiceAccountID)
+	require.Equal(t, arg.KeyPrefix, key.KeyPrefix)
+	require.Equal(t, arg.KeyHash, key.KeyHash)
+	require.Equal(t, arg.Scopes, key.Scopes)
+	require.False(t, key.LastUsedAt.Valid)
+	require.False(t, key.RevokedAt.Valid)
+
+	authKey, err := testQueries.GetAPIKeyForAuth(context.Background(), arg.KeyHash)
+	require.NoError(t, err)
+	require.Equal(t, key.ID, authKey.ID)
+	require.Equal(t, arg.Scopes, authKey.Scopes)
+	require.Equal(t, user.Username, authKey.Owner)
+	require.False(t, authKey.RevokedAt.Valid)
+
+	err = testQueries.TouchAPIKey(context.Background(), key.ID)
+	require.NoError(t, err)
+
+	keys, err := testQueries.ListAPIKeys(context.Background(), serviceAccount.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.True(t, keys[0].LastUsedAt.Valid)
+
+	// A key is revoked only once and only through its own service account
+	otherServiceAccount := createRandomServiceAccount(t, user.Username)
+	_, err = testQueries.RevokeAPIKey(context.Background(), RevokeAPIKeyParams{ID: key.ID, ServiceAccountID: otherServiceAccount.ID})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	revokedKey, err := testQueries.RevokeAPIKey(context.Background(), RevokeAPIKeyParams{ID: key.ID, ServiceAccountID: serviceAccount.ID})
+	require.NoError(t, err)
+	require.True(t, revokedKey.RevokedAt.Valid)
+
+	_, err = testQueries.RevokeAPIKey(context.Background(), RevokeAPIKeyParams{ID: key.ID, ServiceAccountID: serviceAccount.ID})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	authKey, err = testQueries.GetAPIKeyForAuth(context.Background(), arg.KeyHash)
+	require.NoError(t, err)
+	require.True(t, authKey.RevokedAt.Valid)
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomSession(t *testing.T, username string) Session {
+	arg := CreateSessionParams{
+		ID:        uuid.New(),
+		Username:  username,
+		UserAgent: util.RandomString(10),
+		ClientIp:  "127.0.0.1",
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+
+	session, err := testQueries.CreateSession(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.ID, session.ID)
+	require.Equal(t, arg.Username, session.Username)
+	require.Equal(t, arg.UserAgent, session.UserAgent)
+	require.Equal(t, arg.ClientIp, session.ClientIp)
+	require.WithinDuration(t, arg.ExpiresAt, session.ExpiresAt, time.Second)
+	require.False(t, session.RevokedAt.Valid)
+	require.NotZero(t, session.LastUsedAt)
+	require.NotZero(t, session.CreatedAt)
+
+	return session
+}
+
+func TestSession(t *testing.T) {
+	user := createRandomUser(t)
+	session1 := createRandomSession(t, user.Username)
+	session2 := createRandomSession(t, user.Username)
+
+	// The session used most recently is listed first
+	touchedSession, err := testQueries.TouchSession(context.Background(), session1.ID)
+	require.NoError(t, err)
+	require.True(t, touchedSession.LastUsedAt.After(session1.LastUsedAt))
+
+	sessions, err := testQueries.ListActiveSessions(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, session1.ID, sessions[0].ID)
+	require.Equal(t, session2.ID, sessions[1].ID)
+
+	// Sessions can only be revoked by their user
+	_, err = testQueries.RevokeSession(context.Background(), RevokeSessionParams{
+		ID:       session1.ID,
+		Username: util.RandomOwner(),
+	})
+	require.EqualError(t, err, ErrRecordNotFound.Error())
+
+	revokedSession, err := testQueries.RevokeSession(context.Background(), RevokeSessionParams{
+		ID:       session1.ID,
+		Username: user.Username,
+	})
+	require.NoError(t, err)
+	require.True(t, revokedSession.RevokedAt.Valid)
+
+	_, err = testQueries.TouchSession(context.Background(), session1.ID)
+	require.EqualError(t, err, ErrRecordNotFound.Error())
+
+	sessions, err = testQueries.ListActiveSessions(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, session2.ID, sessions[0].ID)
+}
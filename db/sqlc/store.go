@@ -2,14 +2,38 @@ package db
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // Store provides all functions to execute db queries and transactions
 type Store interface {
 	Querier
 	TransferTX(ctx context.Context, arg TransferTxParams) (TransferTxResult, error)
+	CreateAccountTx(ctx context.Context, arg CreateAccountTxParams) (CreateAccountTxResult, error)
+	ResetPasswordTx(ctx context.Context, arg ResetPasswordTxParams) (ResetPasswordTxResult, error)
+	CreateUserTx(ctx context.Context, arg CreateUserTxParams) (CreateUserTxResult, error)
+	VerifyEmailTx(ctx context.Context, arg VerifyEmailTxParams) (VerifyEmailTxResult, error)
+	EnableTOTPTx(ctx context.Context, arg EnableTOTPTxParams) (EnableTOTPTxResult, error)
+	SetAccountStatusTx(ctx context.Context, arg SetAccountStatusTxParams) (SetAccountStatusTxResult, error)
+	ReverseTransferTx(ctx context.Context, arg ReverseTransferTxParams) (ReverseTransferTxResult, error)
+	RecordFailedLoginTx(ctx context.Context, arg RecordFailedLoginTxParams) (RecordFailedLoginTxResult, error)
+	UseMFAChallengeTx(ctx context.Context, arg UseMFAChallengeTxParams) (UseMFAChallengeTxResult, error)
+}
+
+// transactor runs a function within a db transaction of the given isolation level,
+// the function is given the queries bound to the transaction
+type transactor interface {
+	execTx(ctx context.Context, isolation pgx.TxIsoLevel, fn func(Querier) error) error
+}
+
+// txStore provides the transactions of the Store interface on top of a transactor
+// Every store embeds it, so the transactions are written once and run the same way against each of them
+type txStore struct {
+	transactor
 }
 
 // SQLStore provides all functions to execute SQL queries and transactions
@@ -17,21 +41,56 @@ type SQLStore struct {
 	// This is composition - thanks to that we get all the methods available for the Queries type
 	// and we can extend these functionalities by adding new methods
 	*Queries
-	db *sql.DB
+	txStore
+	connPool    *pgxpool.Pool
+	retryPolicy RetryPolicy
+}
+
+// NewStore creates a store retrying the failed transactions with the DefaultRetryPolicy
+func NewStore(connPool *pgxpool.Pool) Store {
+	return NewStoreWithRetryPolicy(connPool, DefaultRetryPolicy)
 }
 
-func NewStore(db *sql.DB) Store {
-	return &SQLStore{
-		db:      db,
-		Queries: New(db),
+// NewStoreWithRetryPolicy creates a store retrying the failed transactions with the given policy
+func NewStoreWithRetryPolicy(connPool *pgxpool.Pool, retryPolicy RetryPolicy) Store {
+	store := &SQLStore{
+		connPool:    connPool,
+		Queries:     New(connPool),
+		retryPolicy: retryPolicy,
 	}
+	store.txStore = txStore{store}
+	return store
 }
 
 // This function is used as a generic base for a db transaction
-// It wraps a set of db queries defined in the input fn function with the transaction begin and commit/rollback
-// It executes a function within a database transaction
-func (store *SQLStore) execTx(ctx context.Context, fn func(*Queries) error) error {
-	tx, err := store.db.BeginTx(ctx, nil)
+// It executes a function within a database transaction of the given isolation level
+// A transaction aborted by a serialization failure or a deadlock is run again as the retry policy allows,
+// so fn may be called more than once and must not have effects outside of the transaction it is given
+func (store *SQLStore) execTx(ctx context.Context, isolation pgx.TxIsoLevel, fn func(Querier) error) error {
+	for attempt := 1; ; attempt++ {
+		err := store.runTx(ctx, isolation, fn)
+
+		code, retryable := retryableTxError(err)
+		if !retryable {
+			return err
+		}
+		if attempt >= store.retryPolicy.MaxAttempts {
+			txRetriesExhausted.Add(1)
+			return err
+		}
+		txRetries.Add(code, 1)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(store.retryPolicy.delay(attempt)):
+		}
+	}
+}
+
+// runTx wraps a set of db queries defined in the input fn function with the transaction begin and commit/rollback
+func (store *SQLStore) runTx(ctx context.Context, isolation pgx.TxIsoLevel, fn func(Querier) error) error {
+	tx, err := store.connPool.BeginTx(ctx, pgx.TxOptions{IsoLevel: isolation})
 	if err != nil {
 		return err
 	}
@@ -42,15 +101,15 @@ func (store *SQLStore) execTx(ctx context.Context, fn func(*Queries) error) erro
 
 	err = fn(q)
 	if err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
 			// This is a case when both the fn function threw an error and tx.Rollback threw an error while rolling back
 			// in that case we want to combine those errors and return them together
-			return fmt.Errorf("tx err: %v, rb err: %v", err, rbErr)
+			return fmt.Errorf("tx err: %w, rb err: %v", err, rbErr)
 		}
 		return err
 	}
 
-	return tx.Commit()
+	return tx.Commit(ctx)
 }
 
 // TransferTxParams contains the input parameters of the transfer transaction
@@ -71,57 +130,90 @@ type TransferTxResult struct {
 
 // TransferTx performs a money transfer from one account to the other
 // It creates a transfer record, add account entries and update accounts' balance within a single db transaction
-func (store *SQLStore) TransferTX(ctx context.Context, arg TransferTxParams) (TransferTxResult, error) {
+// The TransferCreated event is written to the outbox in the same transaction, and the listeners of the transfers channel are notified on commit
+func (store txStore) TransferTX(ctx context.Context, arg TransferTxParams) (TransferTxResult, error) {
 	var result TransferTxResult
 
 	// The callback function defined below is also a closure since it accesses the values from the outer function and then uses them when being called inside the execTx function
-	err := store.execTx(ctx, func(q *Queries) error {
+	// Read committed is enough, the accounts are locked by the updates of their balances before the entries are chained
+	err := store.execTx(ctx, pgx.ReadCommitted, func(q Querier) error {
 		var err error
+		result, err = transferMoney(ctx, q, arg, requireActiveAccount)
+		return err
+	})
 
-		// This is the list of db queries that will be included within the transaction
-		result.Transfer, err = q.CreateTransfer(ctx, CreateTransferParams{
-			FromAccountID: arg.FromAccountID,
-			ToAccountID:   arg.ToAccountID,
-			Amount:        arg.Amount,
-		})
-		if err != nil {
-			return err
-		}
+	return result, err
+}
 
-		result.FromEntry, err = q.CreateEntry(ctx, CreateEntryParams{
-			AccountID: arg.FromAccountID,
-			Amount:    -arg.Amount,
-		})
-		if err != nil {
-			return err
-		}
+// transferMoney moves the money within the transaction of q, the accounts are checked once they are locked
+// The check of the account decides which statuses the transfer is allowed for
+func transferMoney(ctx context.Context, q Querier, arg TransferTxParams, checkAccount func(Account) error) (TransferTxResult, error) {
+	var result TransferTxResult
+	var err error
 
-		result.ToEntry, err = q.CreateEntry(ctx, CreateEntryParams{
-			AccountID: arg.ToAccountID,
-			Amount:    arg.Amount,
-		})
-		if err != nil {
-			return err
-		}
+	// This is the list of db queries that will be included within the transaction
+	result.Transfer, err = q.CreateTransfer(ctx, CreateTransferParams{
+		FromAccountID: arg.FromAccountID,
+		ToAccountID:   arg.ToAccountID,
+		Amount:        arg.Amount,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// To protect ourselves from deadlocks we need to ensure that the locks in transactions are always acquired in a consistent order
+	// Here we make sure that accounts are accessed and locked in transactions always starting from the smallest account id value
+	// eg. if account1 and account2 are affected, always account1 will be accessed and locked first so the chance for the db to get stuck waiting for resources is gone
+	if arg.FromAccountID < arg.ToAccountID {
+		result.FromAccount, result.ToAccount, err = addMoney(ctx, q, arg.FromAccountID, -arg.Amount, arg.ToAccountID, arg.Amount)
+	} else {
+		result.ToAccount, result.FromAccount, err = addMoney(ctx, q, arg.ToAccountID, arg.Amount, arg.FromAccountID, -arg.Amount)
+	}
+	if err != nil {
+		return result, err
+	}
 
-		// To protect ourselves from deadlocks we need to ensure that the locks in transactions are always acquired in a consistent order
-		// Here we make sure that accounts are accessed and locked in transactions always starting from the smallest account id value
-		// eg. if account1 and account2 are affected, always account1 will be accessed and locked first so the chance for the db to get stuck waiting for resources is gone
-		if arg.FromAccountID < arg.ToAccountID {
-			result.FromAccount, result.ToAccount, err = addMoney(ctx, q, arg.FromAccountID, -arg.Amount, arg.ToAccountID, arg.Amount)
-		} else {
-			result.ToAccount, result.FromAccount, err = addMoney(ctx, q, arg.ToAccountID, arg.Amount, arg.FromAccountID, -arg.Amount)
+	// The statuses are read from the locked rows, so an account cannot be frozen or closed while its money is moving
+	for _, account := range []Account{result.FromAccount, result.ToAccount} {
+		if err := checkAccount(account); err != nil {
+			return result, err
 		}
+	}
+
+	// Entries are created only after both accounts are locked, so that concurrent transactions
+	// cannot read the same latest entry of an account and fork its hash chain
+	result.FromEntry, err = createChainedEntry(ctx, q, arg.FromAccountID, -arg.Amount)
+	if err != nil {
+		return result, err
+	}
 
-		return nil
+	result.ToEntry, err = createChainedEntry(ctx, q, arg.ToAccountID, arg.Amount)
+	if err != nil {
+		return result, err
+	}
+
+	err = appendEvent(ctx, q, TransferCreated{
+		Transfer:    result.Transfer,
+		FromAccount: result.FromAccount,
+		ToAccount:   result.ToAccount,
+		FromEntry:   result.FromEntry,
+		ToEntry:     result.ToEntry,
 	})
+	if err != nil {
+		return result, err
+	}
 
+	err = notifyTransfer(ctx, q, TransferNotification{
+		Transfer:    result.Transfer,
+		FromAccount: result.FromAccount,
+		ToAccount:   result.ToAccount,
+	})
 	return result, err
 }
 
 func addMoney(
 	ctx context.Context,
-	q *Queries,
+	q Querier,
 	accountID1 int64,
 	amount1 int64,
 	accountID2 int64,
@@ -0,0 +1,769 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+// The conformance suite runs the same tests against every implementation of the Store,
+// so the stores used in place of the SQLStore behave like it does
+
+func TestSQLStoreConformance(t *testing.T) {
+	testStoreConformance(t, NewStore(testDB))
+}
+
+func TestMemoryStoreConformance(t *testing.T) {
+	testStoreConformance(t, NewMemoryStore())
+}
+
+func testStoreConformance(t *testing.T, store Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store Store)
+	}{
+		{"Accounts", testConformanceAccounts},
+		{"AccountConstraints", testConformanceAccountConstraints},
+		{"Users", testConformanceUsers},
+		{"TransferTx", testConformanceTransferTx},
+		{"TransferTxRollback", testConformanceTransferTxRollback},
+		{"AccountStatus", testConformanceAccountStatus},
+		{"ReverseTransferTx", testConformanceReverseTransferTx},
+		{"CreateUserTxRollback", testConformanceCreateUserTxRollback},
+		{"RecordFailedLoginTx", testConformanceRecordFailedLoginTx},
+		{"UseMFAChallengeTx", testConformanceUseMFAChallengeTx},
+		{"Sessions", testConformanceSessions},
+		{"APIKeys", testConformanceAPIKeys},
+		{"WebhookDeliveries", testConformanceWebhookDeliveries},
+		{"Outbox", testConformanceOutbox},
+		{"RateLimit", testConformanceRateLimit},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, store)
+		})
+	}
+}
+
+func createConformanceUser(t *testing.T, store Store) User {
+	user, err := store.CreateUser(context.Background(), CreateUserParams{
+		Username:       util.RandomOwner(),
+		HashedPassword: util.RandomString(32),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+	return user
+}
+
+func createConformanceAccount(t *testing.T, store Store, owner string, currency string) Account {
+	account, err := store.CreateAccount(context.Background(), CreateAccountParams{
+		Owner:    owner,
+		Balance:  1000,
+		Currency: currency,
+	})
+	require.NoError(t, err)
+	return account
+}
+
+func testConformanceAccounts(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createConformanceUser(t, store)
+
+	account1 := createConformanceAccount(t, store, user.Username, util.USD)
+	account2 := createConformanceAccount(t, store, user.Username, util.EUR)
+	account3 := createConformanceAccount(t, store, user.Username, util.CAD)
+	require.Equal(t, user.Username, account1.Owner)
+	require.Equal(t, int64(1000), account1.Balance)
+	require.NotZero(t, account1.CreatedAt)
+
+	account, err := store.GetAccount(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.ID, account.ID)
+	require.WithinDuration(t, account1.CreatedAt, account.CreatedAt, time.Millisecond)
+
+	_, err = store.GetAccount(ctx, -1)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	accounts, err := store.ListAccounts(ctx, ListAccountsParams{Owner: user.Username, Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+	require.Equal(t, account2.ID, accounts[0].ID)
+	require.Equal(t, account3.ID, accounts[1].ID)
+
+	accounts, err = store.ListAccounts(ctx, ListAccountsParams{Owner: util.RandomOwner(), Limit: 5})
+	require.NoError(t, err)
+	require.NotNil(t, accounts)
+	require.Empty(t, accounts)
+
+	account, err = store.AddAccountBalance(ctx, AddAccountBalanceParams{ID: account1.ID, Amount: -300})
+	require.NoError(t, err)
+	require.Equal(t, int64(700), account.Balance)
+
+	account, err = store.UpdateAccount(ctx, UpdateAccountParams{ID: account1.ID, Balance: 50})
+	require.NoError(t, err)
+	require.Equal(t, int64(50), account.Balance)
+
+	_, err = store.UpdateAccount(ctx, UpdateAccountParams{ID: -1, Balance: 50})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	require.NoError(t, store.DeleteAccount(ctx, account3.ID))
+	_, err = store.GetAccount(ctx, account3.ID)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func testConformanceAccountConstraints(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createConformanceUser(t, store)
+	account := createConformanceAccount(t, store, user.Username, util.USD)
+
+	// A user has a single account in every currency
+	_, err := store.CreateAccount(ctx, CreateAccountParams{Owner: user.Username, Currency: util.USD})
+	require.Equal(t, UniqueViolation, ErrorCode(err))
+
+	_, err = store.CreateAccount(ctx, CreateAccountParams{Owner: util.RandomOwner(), Currency: util.USD})
+	require.Equal(t, ForeignKeyViolation, ErrorCode(err))
+
+	_, err = store.CreateTransfer(ctx, CreateTransferParams{FromAccountID: account.ID, ToAccountID: -1, Amount: 10})
+	require.Equal(t, ForeignKeyViolation, ErrorCode(err))
+
+	// An account with entries cannot be deleted
+	_, err = store.CreateEntry(ctx, CreateEntryParams{AccountID: account.ID, Amount: 10})
+	require.NoError(t, err)
+	err = store.DeleteAccount(ctx, account.ID)
+	require.Equal(t, ForeignKeyViolation, ErrorCode(err))
+}
+
+func testConformanceUsers(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createConformanceUser(t, store)
+
+	require.Equal(t, util.DepositorRole, user.Role)
+	require.True(t, user.PasswordChangedAt.IsZero())
+	require.True(t, user.LockedUntil.IsZero())
+	require.Zero(t, user.FailedLoginAttempts)
+	require.False(t, user.IsEmailVerified)
+	require.False(t, user.IsTotpEnabled)
+
+	_, err := store.CreateUser(ctx, CreateUserParams{Username: user.Username, Email: util.RandomEmail()})
+	require.Equal(t, UniqueViolation, ErrorCode(err))
+
+	_, err = store.CreateUser(ctx, CreateUserParams{Username: util.RandomOwner(), Email: user.Email})
+	require.Equal(t, UniqueViolation, ErrorCode(err))
+
+	byEmail, err := store.GetUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, byEmail.Username)
+
+	_, err = store.GetUser(ctx, util.RandomOwner())
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	failed, err := store.RecordFailedLogin(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), failed.FailedLoginAttempts)
+
+	lockedUntil := time.Now().Add(time.Minute).Truncate(time.Microsecond)
+	locked, err := store.LockUser(ctx, LockUserParams{Username: user.Username, LockedUntil: lockedUntil})
+	require.NoError(t, err)
+	require.Zero(t, locked.FailedLoginAttempts)
+	require.Equal(t, int32(1), locked.LockoutCount)
+	require.True(t, lockedUntil.Equal(locked.LockedUntil))
+
+	unlocked, err := store.UnlockUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Zero(t, unlocked.LockoutCount)
+	require.True(t, unlocked.LockedUntil.Before(lockedUntil))
+
+	// The password is changed at the time given by the server, the tokens are issued with the same clock
+	passwordChangedAt := time.Now().Add(-time.Minute)
+	updated, err := store.UpdateUserPassword(ctx, UpdateUserPasswordParams{
+		Username:          user.Username,
+		HashedPassword:    util.RandomString(32),
+		PasswordChangedAt: passwordChangedAt,
+	})
+	require.NoError(t, err)
+	require.WithinDuration(t, passwordChangedAt, updated.PasswordChangedAt, time.Microsecond)
+
+	// A TOTP step is accepted only once
+	rows, err := store.UseTOTPStep(ctx, UseTOTPStepParams{Username: user.Username, Step: 100})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), rows)
+
+	rows, err = store.UseTOTPStep(ctx, UseTOTPStepParams{Username: user.Username, Step: 100})
+	require.NoError(t, err)
+	require.Zero(t, rows)
+}
+
+func testConformanceRecordFailedLoginTx(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createConformanceUser(t, store)
+
+	// Concurrent failed attempts are counted until one of them locks the user, the ones after it find the user locked
+	const maxFailedLogins = 3
+	n := 2 * maxFailedLogins
+	errs := make(chan error, n)
+	results := make(chan RecordFailedLoginTxResult, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			result, err := store.RecordFailedLoginTx(ctx, RecordFailedLoginTxParams{
+				Username:        user.Username,
+				MaxFailedLogins: maxFailedLogins,
+				Now:             time.Now(),
+				LockoutDuration: func(lockoutCount int32) time.Duration {
+					return time.Duration(lockoutCount+1) * time.Minute
+				},
+			})
+			errs <- err
+			results <- result
+		}()
+	}
+
+	locks, alreadyLocked := 0, 0
+	for i := 0; i < n; i++ {
+		require.NoError(t, <-errs)
+		result := <-results
+		if result.Locked {
+			locks++
+		}
+		if result.AlreadyLocked {
+			alreadyLocked++
+		}
+	}
+	require.Equal(t, 1, locks)
+	require.Equal(t, n-maxFailedLogins, alreadyLocked)
+
+	updated, err := store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Zero(t, updated.FailedLoginAttempts)
+	require.Equal(t, int32(1), updated.LockoutCount)
+	require.WithinDuration(t, time.Now().Add(time.Minute), updated.LockedUntil, time.Second)
+}
+
+func testConformanceUseMFAChallengeTx(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createConformanceUser(t, store)
+
+	challenge, err := store.CreateMFAChallenge(ctx, CreateMFAChallengeParams{
+		Username:  user.Username,
+		TokenHash: util.HashSecret(util.RandomString(32)),
+		ExpiresAt: time.Now().Add(time.Minute),
+	})
+	require.NoError(t, err)
+
+	// The attempts are counted up to the limit
+	const maxAttempts = 2
+	for i := 0; i < maxAttempts; i++ {
+		rows, err := store.CountMFAChallengeAttempt(ctx, CountMFAChallengeAttemptParams{ID: challenge.ID, MaxAttempts: maxAttempts})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), rows)
+	}
+	rows, err := store.CountMFAChallengeAttempt(ctx, CountMFAChallengeAttemptParams{ID: challenge.ID, MaxAttempts: maxAttempts})
+	require.NoError(t, err)
+	require.Zero(t, rows)
+
+	// A wrong second factor rolls back the claim of the challenge and whatever the check wrote
+	result, err := store.UseMFAChallengeTx(ctx, UseMFAChallengeTxParams{
+		ChallengeID: challenge.ID,
+		UseSecondFactor: func(q Querier) (bool, error) {
+			_, err := q.UseTOTPStep(ctx, UseTOTPStepParams{Username: user.Username, Step: 100})
+			return false, err
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, result.Valid)
+
+	unused, err := store.GetMFAChallenge(ctx, challenge.TokenHash)
+	require.NoError(t, err)
+	require.False(t, unused.UsedAt.Valid)
+
+	result, err = store.UseMFAChallengeTx(ctx, UseMFAChallengeTxParams{
+		ChallengeID: challenge.ID,
+		UseSecondFactor: func(q Querier) (bool, error) {
+			rows, err := q.UseTOTPStep(ctx, UseTOTPStepParams{Username: user.Username, Step: 100})
+			return rows > 0, err
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, result.Valid)
+
+	// Once used the challenge is not claimed again, and the second factor is not checked
+	_, err = store.UseMFAChallengeTx(ctx, UseMFAChallengeTxParams{
+		ChallengeID: challenge.ID,
+		UseSecondFactor: func(q Querier) (bool, error) {
+			t.Fatal("second factor checked for a used challenge")
+			return false, nil
+		},
+	})
+	require.ErrorIs(t, err, ErrInvalidMFAChallenge)
+
+	rows, err = store.CountMFAChallengeAttempt(ctx, CountMFAChallengeAttemptParams{ID: challenge.ID, MaxAttempts: maxAttempts + 1})
+	require.NoError(t, err)
+	require.Zero(t, rows)
+}
+
+func testConformanceTransferTx(t *testing.T, store Store) {
+	ctx := context.Background()
+	account1 := createConformanceAccount(t, store, createConformanceUser(t, store).Username, util.USD)
+	account2 := createConformanceAccount(t, store, createConformanceUser(t, store).Username, util.USD)
+
+	// Transfers in both directions run concurrently, half of them from account1 and half from account2
+	n := 10
+	amount := int64(10)
+	errs := make(chan error)
+	for i := 0; i < n; i++ {
+		fromAccountID, toAccountID := account1.ID, account2.ID
+		if i%2 == 1 {
+			fromAccountID, toAccountID = account2.ID, account1.ID
+		}
+
+		go func() {
+			_, err := store.TransferTX(ctx, TransferTxParams{
+				FromAccountID: fromAccountID,
+				ToAccountID:   toAccountID,
+				Amount:        amount,
+			})
+			errs <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		require.NoError(t, <-errs)
+	}
+
+	result, err := store.TransferTX(ctx, TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        amount,
+	})
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance-amount, result.FromAccount.Balance)
+	require.Equal(t, account2.Balance+amount, result.ToAccount.Balance)
+	require.Equal(t, -amount, result.FromEntry.Amount)
+	require.Equal(t, amount, result.ToEntry.Amount)
+
+	transfer, err := store.GetTransfer(ctx, result.Transfer.ID)
+	require.NoError(t, err)
+	require.Equal(t, result.Transfer.ID, transfer.ID)
+
+	transfers, err := store.ListTransfers(ctx, ListTransfersParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account1.ID,
+		Limit:         100,
+	})
+	require.NoError(t, err)
+	require.Len(t, transfers, n+1)
+
+	entries, err := store.ListEntries(ctx, ListEntriesParams{AccountID: account1.ID, Limit: 100})
+	require.NoError(t, err)
+	require.Len(t, entries, n+1)
+	require.Equal(t, result.FromEntry.ID, entries[n].ID)
+
+	latest, err := store.GetLatestEntry(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, result.FromEntry.ID, latest.ID)
+
+	// The hash of the latest entry is anchored on the account
+	updated, err := store.GetAccount(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, latest.Hash, updated.LatestEntryHash)
+
+	for _, accountID := range []int64{account1.ID, account2.ID} {
+		chainBreak, err := VerifyAccountLedger(ctx, store, accountID)
+		require.NoError(t, err)
+		require.Nil(t, chainBreak)
+	}
+
+	// An entry without hash created after the start of the chain can't pass as a legacy entry, even in an account without chain
+	chainStartID, err := store.GetFirstChainedEntryID(ctx)
+	require.NoError(t, err)
+	require.LessOrEqual(t, chainStartID, result.FromEntry.ID)
+
+	account3 := createConformanceAccount(t, store, account1.Owner, util.EUR)
+	unhashed, err := store.CreateEntry(ctx, CreateEntryParams{AccountID: account3.ID, Amount: amount})
+	require.NoError(t, err)
+
+	chainBreak, err := VerifyAccountLedger(ctx, store, account3.ID)
+	require.NoError(t, err)
+	require.NotNil(t, chainBreak)
+	require.Equal(t, unhashed.ID, chainBreak.Entry.ID)
+}
+
+func testConformanceTransferTxRollback(t *testing.T, store Store) {
+	ctx := context.Background()
+	account := createConformanceAccount(t, store, createConformanceUser(t, store).Username, util.USD)
+
+	// The transfer to the missing account fails, and leaves nothing behind
+	_, err := store.TransferTX(ctx, TransferTxParams{
+		FromAccountID: account.ID,
+		ToAccountID:   account.ID + 1_000_000,
+		Amount:        10,
+	})
+	require.Error(t, err)
+
+	updatedAccount, err := store.GetAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.Equal(t, account.Balance, updatedAccount.Balance)
+
+	transfers, err := store.ListTransfers(ctx, ListTransfersParams{
+		FromAccountID: account.ID,
+		ToAccountID:   account.ID,
+		Limit:         10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, transfers)
+
+	_, err = store.GetLatestEntry(ctx, account.ID)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func testConformanceCreateUserTxRollback(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createConformanceUser(t, store)
+
+	arg := CreateUserTxParams{
+		CreateUserParams: CreateUserParams{
+			Username:       util.RandomOwner(),
+			HashedPassword: util.RandomString(32),
+			FullName:       util.RandomOwner(),
+			Email:          user.Email,
+		},
+		SecretCodeHash:     util.HashSecret(util.RandomString(32)),
+		VerifyEmailExpires: time.Now().Add(time.Hour),
+	}
+
+	// The email is taken, so nothing of the new user is created
+	_, err := store.CreateUserTx(ctx, arg)
+	require.Equal(t, UniqueViolation, ErrorCode(err))
+
+	_, err = store.GetUser(ctx, arg.Username)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	arg.Email = util.RandomEmail()
+	result, err := store.CreateUserTx(ctx, arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Username, result.User.Username)
+	require.Equal(t, arg.Username, result.VerifyEmail.Username)
+
+	verifyEmail, err := store.UseVerifyEmail(ctx, result.VerifyEmail.ID)
+	require.NoError(t, err)
+	require.True(t, verifyEmail.UsedAt.Valid)
+}
+
+func testConformanceSessions(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createConformanceUser(t, store)
+
+	createSession := func(expiresAt time.Time) Session {
+		session, err := store.CreateSession(ctx, CreateSessionParams{
+			ID:        uuid.New(),
+			Username:  user.Username,
+			UserAgent: "conformance",
+			ClientIp:  "127.0.0.1",
+			ExpiresAt: expiresAt,
+		})
+		require.NoError(t, err)
+		return session
+	}
+
+	session1 := createSession(time.Now().Add(time.Hour))
+	session2 := createSession(time.Now().Add(time.Hour))
+	createSession(time.Now().Add(-time.Minute))
+
+	_, err := store.CreateSession(ctx, CreateSessionParams{ID: uuid.New(), Username: util.RandomOwner()})
+	require.Equal(t, ForeignKeyViolation, ErrorCode(err))
+
+	time.Sleep(time.Millisecond)
+	_, err = store.TouchSession(ctx, session1.ID)
+	require.NoError(t, err)
+
+	// The expired session is left out, the most recently used one comes first
+	sessions, err := store.ListActiveSessions(ctx, user.Username)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, session1.ID, sessions[0].ID)
+	require.Equal(t, session2.ID, sessions[1].ID)
+
+	revoked, err := store.RevokeSession(ctx, RevokeSessionParams{ID: session1.ID, Username: user.Username})
+	require.NoError(t, err)
+	require.True(t, revoked.RevokedAt.Valid)
+
+	_, err = store.RevokeSession(ctx, RevokeSessionParams{ID: session1.ID, Username: user.Username})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	_, err = store.TouchSession(ctx, session1.ID)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	// A revoked session is still found, with the time it was revoked
+	fetched, err := store.GetSession(ctx, session1.ID)
+	require.NoError(t, err)
+	require.True(t, fetched.RevokedAt.Valid)
+
+	_, err = store.GetSession(ctx, uuid.New())
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func testConformanceAPIKeys(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createConformanceUser(t, store)
+
+	serviceAccount, err := store.CreateServiceAccount(ctx, CreateServiceAccountParams{Owner: user.Username, Name: "ci"})
+	require.NoError(t, err)
+
+	_, err = store.CreateServiceAccount(ctx, CreateServiceAccountParams{Owner: user.Username, Name: "ci"})
+	require.Equal(t, UniqueViolation, ErrorCode(err))
+
+	keyHash := util.HashSecret(util.RandomString(32))
+	key, err := store.CreateAPIKey(ctx, CreateAPIKeyParams{
+		ServiceAccountID: serviceAccount.ID,
+		KeyPrefix:        "sb_test",
+		KeyHash:          keyHash,
+		Scopes:           []string{"accounts:read"},
+	})
+	require.NoError(t, err)
+	require.False(t, key.LastUsedAt.Valid)
+
+	_, err = store.CreateAPIKey(ctx, CreateAPIKeyParams{ServiceAccountID: serviceAccount.ID, KeyHash: keyHash})
+	require.Equal(t, UniqueViolation, ErrorCode(err))
+
+	auth, err := store.GetAPIKeyForAuth(ctx, keyHash)
+	require.NoError(t, err)
+	require.Equal(t, key.ID, auth.ID)
+	require.Equal(t, user.Username, auth.Owner)
+	require.Equal(t, []string{"accounts:read"}, auth.Scopes)
+
+	require.NoError(t, store.TouchAPIKey(ctx, key.ID))
+
+	revoked, err := store.RevokeAPIKey(ctx, RevokeAPIKeyParams{ID: key.ID, ServiceAccountID: serviceAccount.ID})
+	require.NoError(t, err)
+	require.True(t, revoked.LastUsedAt.Valid)
+	require.True(t, revoked.RevokedAt.Valid)
+
+	_, err = store.RevokeAPIKey(ctx, RevokeAPIKeyParams{ID: key.ID, ServiceAccountID: serviceAccount.ID})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func testConformanceWebhookDeliveries(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createConformanceUser(t, store)
+
+	subscription, err := store.CreateWebhookSubscription(ctx, CreateWebhookSubscriptionParams{
+		Owner:      user.Username,
+		Url:        "https://example.com/webhook",
+		EventTypes: []string{TransferCreatedEventType},
+		Secret:     util.RandomString(32),
+	})
+	require.NoError(t, err)
+
+	arg := EnqueueWebhookDeliveriesParams{
+		EventID:   pgtype.Int8{Int64: util.RandomInt(1, 1_000_000_000), Valid: true},
+		EventType: TransferCreatedEventType,
+		Payload:   json.RawMessage(`{}`),
+		Owner:     user.Username,
+	}
+	enqueued, err := store.EnqueueWebhookDeliveries(ctx, arg)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), enqueued)
+
+	// An event is delivered at most once to every subscription
+	enqueued, err = store.EnqueueWebhookDeliveries(ctx, arg)
+	require.NoError(t, err)
+	require.Zero(t, enqueued)
+
+	arg.EventType = AccountCreatedEventType
+	enqueued, err = store.EnqueueWebhookDeliveries(ctx, arg)
+	require.NoError(t, err)
+	require.Zero(t, enqueued)
+
+	deliveries, err := store.ListWebhookDeliveries(ctx, ListWebhookDeliveriesParams{SubscriptionID: subscription.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, "pending", deliveries[0].Status)
+	require.Zero(t, deliveries[0].Attempts)
+
+	require.NoError(t, store.DeadLetterWebhookDelivery(ctx, DeadLetterWebhookDeliveryParams{
+		ID:        deliveries[0].ID,
+		LastError: "status 500",
+	}))
+
+	redelivered, err := store.RedeliverWebhookDelivery(ctx, RedeliverWebhookDeliveryParams{
+		ID:             deliveries[0].ID,
+		SubscriptionID: subscription.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "pending", redelivered.Status)
+	require.Zero(t, redelivered.Attempts)
+	require.Empty(t, redelivered.LastError)
+
+	// The deliveries go away with their subscription
+	require.NoError(t, store.DeleteWebhookSubscription(ctx, subscription.ID))
+	deliveries, err = store.ListWebhookDeliveries(ctx, ListWebhookDeliveriesParams{SubscriptionID: subscription.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, deliveries)
+}
+
+func testConformanceOutbox(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createConformanceUser(t, store)
+
+	result, err := store.CreateAccountTx(ctx, CreateAccountTxParams{
+		CreateAccountParams: CreateAccountParams{Owner: user.Username, Currency: util.USD},
+	})
+	require.NoError(t, err)
+
+	// Page through the outbox from the start until the event of the account
+	var lastTxid, lastEventID int64
+	var found *AccountCreated
+	for found == nil {
+		outboxEvents, err := store.ListPendingOutboxEvents(ctx, ListPendingOutboxEventsParams{
+			LastTxid:    lastTxid,
+			LastEventID: lastEventID,
+			BatchSize:   1000,
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, outboxEvents, "no AccountCreated event in the outbox")
+
+		for _, outboxEvent := range outboxEvents {
+			require.True(t, outboxEvent.Txid > lastTxid || outboxEvent.Txid == lastTxid && outboxEvent.ID > lastEventID)
+			lastTxid, lastEventID = outboxEvent.Txid, outboxEvent.ID
+
+			if outboxEvent.EventType != AccountCreatedEventType {
+				continue
+			}
+			event, err := DecodeEvent(outboxEvent)
+			require.NoError(t, err)
+			if event.(*AccountCreated).Account.ID == result.Account.ID {
+				found = event.(*AccountCreated)
+			}
+		}
+	}
+	require.Equal(t, user.Username, found.Account.Owner)
+
+	handler := util.RandomString(12)
+	_, err = store.GetOutboxCheckpoint(ctx, handler)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	for _, eventID := range []int64{lastEventID - 1, lastEventID} {
+		err = store.SaveOutboxCheckpoint(ctx, SaveOutboxCheckpointParams{
+			Handler:     handler,
+			LastTxid:    lastTxid,
+			LastEventID: eventID,
+		})
+		require.NoError(t, err)
+	}
+
+	checkpoint, err := store.GetOutboxCheckpoint(ctx, handler)
+	require.NoError(t, err)
+	require.Equal(t, lastTxid, checkpoint.LastTxid)
+	require.Equal(t, lastEventID, checkpoint.LastEventID)
+}
+
+func testConformanceRateLimit(t *testing.T, store Store) {
+	arg := TakeRateLimitTokenParams{
+		Key:       util.RandomString(16),
+		Burst:     2,
+		PerSecond: 0.001,
+	}
+
+	// The burst is taken right away, then the bucket refills far too slowly for another token
+	for _, allowed := range []bool{true, true, false} {
+		bucket, err := store.TakeRateLimitToken(context.Background(), arg)
+		require.NoError(t, err)
+		require.Equal(t, allowed, bucket.Allowed)
+	}
+
+	// The cleanup keeps the buckets which are not full again, or the limit would be lifted
+	_, err := store.DeleteFullRateLimitBuckets(context.Background(), DeleteFullRateLimitBucketsParams{RefillSeconds: arg.Burst / arg.PerSecond})
+	require.NoError(t, err)
+
+	bucket, err := store.TakeRateLimitToken(context.Background(), arg)
+	require.NoError(t, err)
+	require.False(t, bucket.Allowed)
+}
+
+func testConformanceAccountStatus(t *testing.T, store Store) {
+	ctx := context.Background()
+	account1 := createConformanceAccount(t, store, createConformanceUser(t, store).Username, util.USD)
+	account2 := createConformanceAccount(t, store, createConformanceUser(t, store).Username, util.USD)
+	require.Equal(t, AccountStatusActive, account1.Status)
+
+	result, err := store.SetAccountStatusTx(ctx, SetAccountStatusTxParams{AccountID: account2.ID, Status: AccountStatusFrozen})
+	require.NoError(t, err)
+	require.Equal(t, AccountStatusFrozen, result.Account.Status)
+
+	// Money moves neither from nor to a frozen account, and nothing of the transfer is left behind
+	for _, arg := range []TransferTxParams{
+		{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10},
+		{FromAccountID: account2.ID, ToAccountID: account1.ID, Amount: 10},
+	} {
+		_, err = store.TransferTX(ctx, arg)
+		require.ErrorIs(t, err, ErrAccountNotActive)
+	}
+
+	transfers, err := store.ListTransfers(ctx, ListTransfersParams{FromAccountID: account1.ID, ToAccountID: account1.ID, Limit: 5})
+	require.NoError(t, err)
+	require.Empty(t, transfers)
+
+	// An account with money on it cannot be closed
+	_, err = store.SetAccountStatusTx(ctx, SetAccountStatusTxParams{AccountID: account1.ID, Status: AccountStatusClosed})
+	require.ErrorIs(t, err, ErrAccountNotEmpty)
+
+	_, err = store.SetAccountStatusTx(ctx, SetAccountStatusTxParams{AccountID: account2.ID, Status: AccountStatusActive})
+	require.NoError(t, err)
+
+	_, err = store.TransferTX(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: account1.Balance})
+	require.NoError(t, err)
+
+	result, err = store.SetAccountStatusTx(ctx, SetAccountStatusTxParams{AccountID: account1.ID, Status: AccountStatusClosed})
+	require.NoError(t, err)
+	require.Equal(t, AccountStatusClosed, result.Account.Status)
+
+	// Closing is final
+	_, err = store.SetAccountStatusTx(ctx, SetAccountStatusTxParams{AccountID: account1.ID, Status: AccountStatusActive})
+	require.ErrorIs(t, err, ErrAccountClosed)
+
+	_, err = store.SetAccountStatusTx(ctx, SetAccountStatusTxParams{AccountID: account1.ID, Status: "suspended"})
+	require.Error(t, err)
+
+	_, err = store.SetAccountStatusTx(ctx, SetAccountStatusTxParams{AccountID: 0, Status: AccountStatusFrozen})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func testConformanceReverseTransferTx(t *testing.T, store Store) {
+	ctx := context.Background()
+	account1 := createConformanceAccount(t, store, createConformanceUser(t, store).Username, util.USD)
+	account2 := createConformanceAccount(t, store, createConformanceUser(t, store).Username, util.USD)
+
+	transfer, err := store.TransferTX(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 30})
+	require.NoError(t, err)
+
+	// A transfer to a frozen account is still reversed, that is how the money of a fraud is given back
+	_, err = store.SetAccountStatusTx(ctx, SetAccountStatusTxParams{AccountID: account2.ID, Status: AccountStatusFrozen})
+	require.NoError(t, err)
+
+	result, err := store.ReverseTransferTx(ctx, ReverseTransferTxParams{TransferID: transfer.Transfer.ID})
+	require.NoError(t, err)
+	require.Equal(t, transfer.Transfer.ID, result.Transfer.ID)
+	require.Equal(t, pgtype.Int8{Int64: result.Reversal.Transfer.ID, Valid: true}, result.Transfer.ReversedBy)
+	require.Equal(t, account2.ID, result.Reversal.Transfer.FromAccountID)
+	require.Equal(t, account1.ID, result.Reversal.Transfer.ToAccountID)
+	require.Equal(t, int64(30), result.Reversal.Transfer.Amount)
+	require.Equal(t, account1.Balance, result.Reversal.ToAccount.Balance)
+	require.Equal(t, account2.Balance, result.Reversal.FromAccount.Balance)
+
+	_, err = store.ReverseTransferTx(ctx, ReverseTransferTxParams{TransferID: transfer.Transfer.ID})
+	require.ErrorIs(t, err, ErrTransferAlreadyReversed)
+
+	_, err = store.ReverseTransferTx(ctx, ReverseTransferTxParams{TransferID: 0})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	// The failed reversals leave the balances alone
+	updatedAccount1, err := store.GetAccount(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance, updatedAccount1.Balance)
+}
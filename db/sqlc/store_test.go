@@ -2,8 +2,14 @@ package db
 
 import (
 	"context"
+	"expvar"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/igiai/simplebank/db/util"
+	"github.com/jackc/pgx/v5"
 	"github.com/stretchr/testify/require"
 )
 
@@ -77,6 +83,8 @@ func TestTransferTx(t *testing.T) {
 		require.NotZero(t, fromEntry.ID)
 		require.NotZero(t, fromEntry.CreatedAt)
 
+		require.Equal(t, ComputeEntryHash(fromEntry.PrevHash, fromEntry.ID, account1.ID, -amount, fromEntry.CreatedAt), fromEntry.Hash)
+
 		_, err = store.GetEntry(context.Background(), fromEntry.ID)
 		require.NoError(t, err)
 
@@ -87,6 +95,8 @@ func TestTransferTx(t *testing.T) {
 		require.NotZero(t, toEntry.ID)
 		require.NotZero(t, toEntry.CreatedAt)
 
+		require.Equal(t, ComputeEntryHash(toEntry.PrevHash, toEntry.ID, account2.ID, amount, toEntry.CreatedAt), toEntry.Hash)
+
 		_, err = store.GetEntry(context.Background(), toEntry.ID)
 		require.NoError(t, err)
 
@@ -124,6 +134,15 @@ func TestTransferTx(t *testing.T) {
 
 	require.Equal(t, account1.Balance-int64(n)*amount, updatedAccount1.Balance)
 	require.Equal(t, account2.Balance+int64(n)*amount, updatedAccount2.Balance)
+
+	// Even though the transfers ran concurrently, the entries of both accounts must form unbroken hash chains
+	chainBreak, err := VerifyAccountLedger(context.Background(), store, account1.ID)
+	require.NoError(t, err)
+	require.Nil(t, chainBreak)
+
+	chainBreak, err = VerifyAccountLedger(context.Background(), store, account2.ID)
+	require.NoError(t, err)
+	require.Nil(t, chainBreak)
 }
 
 func TestTransferTxDeadlock(t *testing.T) {
@@ -179,3 +198,165 @@ func TestTransferTxDeadlock(t *testing.T) {
 	require.Equal(t, account1.Balance, updatedAccount1.Balance)
 	require.Equal(t, account2.Balance, updatedAccount2.Balance)
 }
+
+func TestTransferTxWritesEvent(t *testing.T) {
+	store := NewStore(testDB)
+
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+
+	result, err := store.TransferTX(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        10,
+	})
+	require.NoError(t, err)
+
+	outboxEvent := findOutboxEvent(t, TransferCreatedEventType, func(event Event) bool {
+		return event.(*TransferCreated).Transfer.ID == result.Transfer.ID
+	})
+
+	event, err := DecodeEvent(outboxEvent)
+	require.NoError(t, err)
+
+	transferCreated := event.(*TransferCreated)
+	require.Equal(t, result.FromAccount.Balance, transferCreated.FromAccount.Balance)
+	require.Equal(t, result.ToAccount.Balance, transferCreated.ToAccount.Balance)
+	require.Equal(t, result.FromEntry.ID, transferCreated.FromEntry.ID)
+	require.Equal(t, result.ToEntry.ID, transferCreated.ToEntry.ID)
+}
+
+func TestCreateAccountTx(t *testing.T) {
+	store := NewStore(testDB)
+
+	user := createRandomUser(t)
+
+	result, err := store.CreateAccountTx(context.Background(), CreateAccountTxParams{
+		CreateAccountParams: CreateAccountParams{
+			Owner:    user.Username,
+			Balance:  0,
+			Currency: util.RandomCurrency(),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, user.Username, result.Account.Owner)
+
+	findOutboxEvent(t, AccountCreatedEventType, func(event Event) bool {
+		return event.(*AccountCreated).Account.ID == result.Account.ID
+	})
+}
+
+// conflictingTx reads and then increments the balance of the account in a serializable transaction
+// On the first attempt it waits for the other conflicting transactions to read the balance too,
+// so all but one of them fail with a serialization failure
+func conflictingTx(store *SQLStore, accountID int64, reads *sync.WaitGroup, attempts *int32) error {
+	return store.execTx(context.Background(), pgx.Serializable, func(q Querier) error {
+		_, err := q.GetAccount(context.Background(), accountID)
+		if err != nil {
+			return err
+		}
+
+		if atomic.AddInt32(attempts, 1) == 1 {
+			reads.Done()
+			reads.Wait()
+		}
+
+		_, err = q.AddAccountBalance(context.Background(), AddAccountBalanceParams{
+			ID:     accountID,
+			Amount: 1,
+		})
+		return err
+	})
+}
+
+func TestExecTxRetriesSerializationFailure(t *testing.T) {
+	store := NewStoreWithRetryPolicy(testDB, RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    10 * time.Millisecond,
+	}).(*SQLStore)
+
+	account := createRandomAccount(t)
+	retriesBefore := txRetryCount(serializationFailureCode)
+
+	n := 2
+	var reads sync.WaitGroup
+	reads.Add(n)
+	attempts := make([]int32, n)
+	errs := make(chan error)
+
+	for i := 0; i < n; i++ {
+		i := i
+		go func() {
+			errs <- conflictingTx(store, account.ID, &reads, &attempts[i])
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		require.NoError(t, <-errs)
+	}
+
+	// One of the transactions has been run again after the conflict
+	require.ElementsMatch(t, []int32{1, 2}, attempts)
+	require.Equal(t, retriesBefore+1, txRetryCount(serializationFailureCode))
+
+	updatedAccount, err := testQueries.GetAccount(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.Equal(t, account.Balance+int64(n), updatedAccount.Balance)
+}
+
+func TestExecTxRetriesExhausted(t *testing.T) {
+	store := NewStoreWithRetryPolicy(testDB, RetryPolicy{MaxAttempts: 1}).(*SQLStore)
+
+	account := createRandomAccount(t)
+	exhaustedBefore := txRetriesExhausted.Value()
+
+	n := 2
+	var reads sync.WaitGroup
+	reads.Add(n)
+	attempts := make([]int32, n)
+	errs := make(chan error)
+
+	for i := 0; i < n; i++ {
+		i := i
+		go func() {
+			errs <- conflictingTx(store, account.ID, &reads, &attempts[i])
+		}()
+	}
+
+	var failures []error
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			failures = append(failures, err)
+		}
+	}
+
+	// Without retries the conflict reaches the caller
+	require.Len(t, failures, 1)
+	code, retryable := retryableTxError(failures[0])
+	require.True(t, retryable)
+	require.Equal(t, serializationFailureCode, code)
+	require.Equal(t, []int32{1, 1}, attempts)
+	require.Equal(t, exhaustedBefore+1, txRetriesExhausted.Value())
+}
+
+func TestExecTxDoesNotRetryOtherErrors(t *testing.T) {
+	store := NewStore(testDB).(*SQLStore)
+
+	attempts := 0
+	err := store.execTx(context.Background(), pgx.Serializable, func(q Querier) error {
+		attempts++
+		_, err := q.GetAccount(context.Background(), -1)
+		return err
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+	require.Equal(t, 1, attempts)
+}
+
+func txRetryCount(code string) int64 {
+	count, ok := txRetries.Get(code).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+	return count.Value()
+}
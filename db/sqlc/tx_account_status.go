@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// constants for the statuses of the accounts
+const (
+	AccountStatusActive = "active"
+	AccountStatusFrozen = "frozen"
+	AccountStatusClosed = "closed"
+)
+
+var (
+	// ErrAccountNotActive is returned when a transfer involves a frozen or closed account
+	ErrAccountNotActive = errors.New("account is not active")
+	// ErrAccountClosed is returned when a closed account is changed, closing an account is final
+	ErrAccountClosed = errors.New("account is closed")
+	// ErrAccountNotEmpty is returned when an account is closed while money is left on it
+	ErrAccountNotEmpty = errors.New("account balance is not zero")
+)
+
+// requireActiveAccount lets only the active accounts take part in a transfer
+func requireActiveAccount(account Account) error {
+	if account.Status != AccountStatusActive {
+		return fmt.Errorf("%w: account %d is %s", ErrAccountNotActive, account.ID, account.Status)
+	}
+	return nil
+}
+
+// requireOpenAccount lets the frozen accounts take part in a transfer too, only the closed ones are rejected
+func requireOpenAccount(account Account) error {
+	if account.Status == AccountStatusClosed {
+		return fmt.Errorf("%w: account %d", ErrAccountClosed, account.ID)
+	}
+	return nil
+}
+
+// SetAccountStatusTxParams contains the input parameters of the set account status transaction
+type SetAccountStatusTxParams struct {
+	AccountID int64
+	Status    string
+}
+
+// SetAccountStatusTxResult is the result of the set account status transaction
+type SetAccountStatusTxResult struct {
+	Account Account
+}
+
+// SetAccountStatusTx freezes, reactivates or closes an account within a single db transaction
+// A closed account cannot be changed anymore and only an account without money can be closed
+func (store txStore) SetAccountStatusTx(ctx context.Context, arg SetAccountStatusTxParams) (SetAccountStatusTxResult, error) {
+	var result SetAccountStatusTxResult
+
+	switch arg.Status {
+	case AccountStatusActive, AccountStatusFrozen, AccountStatusClosed:
+	default:
+		return result, fmt.Errorf("unknown account status %q", arg.Status)
+	}
+
+	err := store.execTx(ctx, pgx.ReadCommitted, func(q Querier) error {
+		// The account row is locked, so that its balance cannot change between the check and the update of the status
+		account, err := q.GetAccountForUpdate(ctx, arg.AccountID)
+		if err != nil {
+			return err
+		}
+
+		if account.Status == AccountStatusClosed {
+			return fmt.Errorf("%w: account %d", ErrAccountClosed, account.ID)
+		}
+		if arg.Status == AccountStatusClosed && account.Balance != 0 {
+			return fmt.Errorf("%w: account %d has %d %s", ErrAccountNotEmpty, account.ID, account.Balance, account.Currency)
+		}
+
+		result.Account, err = q.UpdateAccountStatus(ctx, UpdateAccountStatusParams{
+			ID:     account.ID,
+			Status: arg.Status,
+		})
+		return err
+	})
+
+	return result, err
+}
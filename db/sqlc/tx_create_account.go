@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateAccountTxParams contains the input parameters of the create account transaction
+type CreateAccountTxParams struct {
+	CreateAccountParams
+}
+
+// CreateAccountTxResult is the result of the create account transaction
+type CreateAccountTxResult struct {
+	Account Account
+}
+
+// CreateAccountTx creates a new account and writes its AccountCreated event to the outbox within a single db transaction
+func (store txStore) CreateAccountTx(ctx context.Context, arg CreateAccountTxParams) (CreateAccountTxResult, error) {
+	var result CreateAccountTxResult
+
+	err := store.execTx(ctx, pgx.ReadCommitted, func(q Querier) error {
+		var err error
+
+		result.Account, err = q.CreateAccount(ctx, arg.CreateAccountParams)
+		if err != nil {
+			return err
+		}
+
+		return appendEvent(ctx, q, AccountCreated{Account: result.Account})
+	})
+
+	return result, err
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateUserTxParams contains the input parameters of the create user transaction
+type CreateUserTxParams struct {
+	CreateUserParams
+	SecretCodeHash     string
+	VerifyEmailExpires time.Time
+}
+
+// CreateUserTxResult is the result of the create user transaction
+type CreateUserTxResult struct {
+	User        User
+	VerifyEmail VerifyEmail
+}
+
+// CreateUserTx creates a new user together with the code verifying their email within a single db transaction
+// The UserCreated event is written to the outbox in the same transaction
+// The transaction may be retried, so the verification email is sent by the caller once it has been committed
+func (store txStore) CreateUserTx(ctx context.Context, arg CreateUserTxParams) (CreateUserTxResult, error) {
+	var result CreateUserTxResult
+
+	err := store.execTx(ctx, pgx.ReadCommitted, func(q Querier) error {
+		var err error
+
+		result.User, err = q.CreateUser(ctx, arg.CreateUserParams)
+		if err != nil {
+			return err
+		}
+
+		result.VerifyEmail, err = q.CreateVerifyEmail(ctx, CreateVerifyEmailParams{
+			Username:       result.User.Username,
+			Email:          result.User.Email,
+			SecretCodeHash: arg.SecretCodeHash,
+			ExpiresAt:      arg.VerifyEmailExpires,
+		})
+		if err != nil {
+			return err
+		}
+
+		return appendEvent(ctx, q, UserCreated{
+			Username:  result.User.Username,
+			FullName:  result.User.FullName,
+			Email:     result.User.Email,
+			CreatedAt: result.User.CreatedAt,
+		})
+	})
+
+	return result, err
+}
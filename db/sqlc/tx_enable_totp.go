@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// EnableTOTPTxParams contains the input parameters of the enable TOTP transaction
+type EnableTOTPTxParams struct {
+	Username string
+	// Step is the time step of the code which confirmed the enrollment
+	Step               int64
+	RecoveryCodeHashes []string
+}
+
+// EnableTOTPTxResult is the result of the enable TOTP transaction
+type EnableTOTPTxResult struct {
+	User User
+}
+
+// EnableTOTPTx turns on two-factor authentication of a user and replaces their recovery codes within a single db transaction
+func (store txStore) EnableTOTPTx(ctx context.Context, arg EnableTOTPTxParams) (EnableTOTPTxResult, error) {
+	var result EnableTOTPTxResult
+
+	// Concurrent enrollments must not mix their recovery codes, the codes are replaced without locking any row
+	err := store.execTx(ctx, pgx.Serializable, func(q Querier) error {
+		var err error
+
+		result.User, err = q.EnableUserTOTP(ctx, EnableUserTOTPParams{
+			Username:         arg.Username,
+			TotpLastUsedStep: arg.Step,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = q.DeleteRecoveryCodes(ctx, arg.Username)
+		if err != nil {
+			return err
+		}
+
+		for _, codeHash := range arg.RecoveryCodeHashes {
+			_, err = q.CreateRecoveryCode(ctx, CreateRecoveryCodeParams{
+				Username: arg.Username,
+				CodeHash: codeHash,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return result, err
+}
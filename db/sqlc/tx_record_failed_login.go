@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RecordFailedLoginTxParams contains the input parameters of the record failed login transaction
+type RecordFailedLoginTxParams struct {
+	Username string
+	// MaxFailedLogins is the number of failed attempts locking the user
+	MaxFailedLogins int32
+	// Now is the time the lockout starts at, the attempt is not counted if the user is locked at that time
+	Now time.Time
+	// LockoutDuration returns how long the user is locked given the number of their previous lockouts
+	LockoutDuration func(lockoutCount int32) time.Duration
+}
+
+// RecordFailedLoginTxResult is the result of the record failed login transaction
+type RecordFailedLoginTxResult struct {
+	User User
+	// Locked is true if this attempt locked the user
+	Locked bool
+	// AlreadyLocked is true if the user was found locked, the attempt is not counted then
+	AlreadyLocked bool
+}
+
+// RecordFailedLoginTx counts a failed login attempt and locks the user once the limit is reached within a single db transaction
+// The row of the user is locked until the commit, so concurrent failed attempts are counted one after another,
+// exactly one of them locks the user and the ones coming after it are not counted against the next lockout
+func (store txStore) RecordFailedLoginTx(ctx context.Context, arg RecordFailedLoginTxParams) (RecordFailedLoginTxResult, error) {
+	var result RecordFailedLoginTxResult
+
+	err := store.execTx(ctx, pgx.ReadCommitted, func(q Querier) error {
+		var err error
+
+		result.User, err = q.GetUserForUpdate(ctx, arg.Username)
+		if err != nil {
+			return err
+		}
+
+		result.AlreadyLocked = result.User.LockedUntil.After(arg.Now)
+		if result.AlreadyLocked {
+			return nil
+		}
+
+		result.User, err = q.RecordFailedLogin(ctx, arg.Username)
+		if err != nil {
+			return err
+		}
+
+		result.Locked = result.User.FailedLoginAttempts >= arg.MaxFailedLogins
+		if !result.Locked {
+			return nil
+		}
+
+		result.User, err = q.LockUser(ctx, LockUserParams{
+			Username:    arg.Username,
+			LockedUntil: arg.Now.Add(arg.LockoutDuration(result.User.LockoutCount)),
+		})
+		return err
+	})
+
+	return result, err
+}
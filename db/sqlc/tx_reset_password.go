@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidResetToken is returned when a password reset token has expired or has already been used
+var ErrInvalidResetToken = errors.New("password reset token has expired or has already been used")
+
+// ResetPasswordTxParams contains the input parameters of the reset password transaction
+type ResetPasswordTxParams struct {
+	TokenHash      string
+	HashedPassword string
+	// Now is the time the expiry of the token is checked against, and the time the password is changed at
+	Now time.Time
+}
+
+// ResetPasswordTxResult is the result of the reset password transaction
+type ResetPasswordTxResult struct {
+	User User
+}
+
+// ResetPasswordTx consumes a password reset token and sets a new password of its user within a single db transaction
+func (store txStore) ResetPasswordTx(ctx context.Context, arg ResetPasswordTxParams) (ResetPasswordTxResult, error) {
+	var result ResetPasswordTxResult
+
+	err := store.execTx(ctx, pgx.ReadCommitted, func(q Querier) error {
+		// The token row is locked, so that two concurrent requests cannot both use the same token
+		resetToken, err := q.GetPasswordResetTokenForUpdate(ctx, arg.TokenHash)
+		if err != nil {
+			return err
+		}
+
+		if resetToken.UsedAt.Valid || arg.Now.After(resetToken.ExpiresAt) {
+			return ErrInvalidResetToken
+		}
+
+		_, err = q.UsePasswordResetToken(ctx, resetToken.ID)
+		if err != nil {
+			return err
+		}
+
+		result.User, err = q.UpdateUserPassword(ctx, UpdateUserPasswordParams{
+			Username:          resetToken.Username,
+			HashedPassword:    arg.HashedPassword,
+			PasswordChangedAt: arg.Now,
+		})
+		return err
+	})
+
+	return result, err
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ErrTransferAlreadyReversed is returned when a transfer is reversed for the second time
+var ErrTransferAlreadyReversed = errors.New("transfer has already been reversed")
+
+// ReverseTransferTxParams contains the input parameters of the reverse transfer transaction
+type ReverseTransferTxParams struct {
+	TransferID int64
+}
+
+// ReverseTransferTxResult is the result of the reverse transfer transaction
+type ReverseTransferTxResult struct {
+	// Transfer is the reversed transfer, linked to its reversal
+	Transfer Transfer `json:"reversed_transfer"`
+	// Reversal is the transfer which gave the money back
+	Reversal TransferTxResult `json:"reversal"`
+}
+
+// ReverseTransferTx gives the money of a transfer back with a transfer in the opposite direction within a single db transaction
+// The reversal is a regular transfer, with its entries, event and notification, except that frozen accounts are allowed
+// A transfer can be reversed only once
+func (store txStore) ReverseTransferTx(ctx context.Context, arg ReverseTransferTxParams) (ReverseTransferTxResult, error) {
+	var result ReverseTransferTxResult
+
+	err := store.execTx(ctx, pgx.ReadCommitted, func(q Querier) error {
+		// The transfer row is locked, so that two concurrent reversals cannot both see it not reversed yet
+		transfer, err := q.GetTransferForUpdate(ctx, arg.TransferID)
+		if err != nil {
+			return err
+		}
+
+		if transfer.ReversedBy.Valid {
+			return fmt.Errorf("%w: transfer %d by transfer %d", ErrTransferAlreadyReversed, transfer.ID, transfer.ReversedBy.Int64)
+		}
+
+		result.Reversal, err = transferMoney(ctx, q, TransferTxParams{
+			FromAccountID: transfer.ToAccountID,
+			ToAccountID:   transfer.FromAccountID,
+			Amount:        transfer.Amount,
+		}, requireOpenAccount)
+		if err != nil {
+			return err
+		}
+
+		result.Transfer, err = q.SetTransferReversedBy(ctx, SetTransferReversedByParams{
+			ID:         transfer.ID,
+			ReversedBy: pgtype.Int8{Int64: result.Reversal.Transfer.ID, Valid: true},
+		})
+		return err
+	})
+
+	return result, err
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidMFAChallenge is returned when an MFA challenge has already been used by another request
+var ErrInvalidMFAChallenge = errors.New("mfa challenge has already been used")
+
+// errSecondFactorRejected rolls back the claim of the challenge when the second factor is wrong
+var errSecondFactorRejected = errors.New("second factor rejected")
+
+// UseMFAChallengeTxParams contains the input parameters of the use mfa challenge transaction
+type UseMFAChallengeTxParams struct {
+	ChallengeID int64
+	// UseSecondFactor checks the TOTP code or the recovery code within the transaction and marks it as used,
+	// it returns false if the code is wrong
+	UseSecondFactor func(q Querier) (bool, error)
+}
+
+// UseMFAChallengeTxResult is the result of the use mfa challenge transaction
+type UseMFAChallengeTxResult struct {
+	// Valid is false if the second factor was wrong, the challenge is left unused then
+	Valid bool
+}
+
+// UseMFAChallengeTx claims an MFA challenge and uses the second factor given with it within a single db transaction
+// The challenge is claimed first, so a concurrent request with the same challenge cannot consume a recovery code
+// without completing the login, and a wrong code rolls the claim back, so the challenge can be tried again
+func (store txStore) UseMFAChallengeTx(ctx context.Context, arg UseMFAChallengeTxParams) (UseMFAChallengeTxResult, error) {
+	var result UseMFAChallengeTxResult
+
+	err := store.execTx(ctx, pgx.ReadCommitted, func(q Querier) error {
+		rowsAffected, err := q.UseMFAChallenge(ctx, arg.ChallengeID)
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrInvalidMFAChallenge
+		}
+
+		result.Valid, err = arg.UseSecondFactor(q)
+		if err != nil {
+			return err
+		}
+		if !result.Valid {
+			return errSecondFactorRejected
+		}
+		return nil
+	})
+
+	if err == errSecondFactorRejected {
+		return result, nil
+	}
+	return result, err
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidVerifyEmail is returned when an email verification code is wrong, has expired or has already been used
+var ErrInvalidVerifyEmail = errors.New("email verification code is invalid, has expired or has already been used")
+
+// VerifyEmailTxParams contains the input parameters of the verify email transaction
+type VerifyEmailTxParams struct {
+	EmailID        int64
+	SecretCodeHash string
+	// Now is the time the expiry of the code is checked against
+	Now time.Time
+}
+
+// VerifyEmailTxResult is the result of the verify email transaction
+type VerifyEmailTxResult struct {
+	User        User
+	VerifyEmail VerifyEmail
+}
+
+// VerifyEmailTx consumes an email verification code and marks the email of its user as verified within a single db transaction
+func (store txStore) VerifyEmailTx(ctx context.Context, arg VerifyEmailTxParams) (VerifyEmailTxResult, error) {
+	var result VerifyEmailTxResult
+
+	err := store.execTx(ctx, pgx.ReadCommitted, func(q Querier) error {
+		verifyEmail, err := q.GetVerifyEmailForUpdate(ctx, arg.EmailID)
+		if err != nil {
+			return err
+		}
+
+		codeMatches := subtle.ConstantTimeCompare([]byte(verifyEmail.SecretCodeHash), []byte(arg.SecretCodeHash)) == 1
+		if !codeMatches || verifyEmail.UsedAt.Valid || arg.Now.After(verifyEmail.ExpiresAt) {
+			return ErrInvalidVerifyEmail
+		}
+
+		result.VerifyEmail, err = q.UseVerifyEmail(ctx, verifyEmail.ID)
+		if err != nil {
+			return err
+		}
+
+		result.User, err = q.VerifyUserEmail(ctx, verifyEmail.Username)
+		return err
+	})
+
+	return result, err
+}
@@ -7,6 +7,7 @@ package db
 
 import (
 	"context"
+	"time"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -17,7 +18,7 @@ INSERT INTO users (
     email
 ) VALUES (
     $1, $2, $3, $4
-) RETURNING username, hashed_password, full_name, email, password_changed_at, created_at
+) RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, lockout_count, locked_until, is_email_verified, totp_secret, is_totp_enabled, totp_last_used_step
 `
 
 type CreateUserParams struct {
@@ -28,7 +29,7 @@ type CreateUserParams struct {
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser,
+	row := q.db.QueryRow(ctx, createUser,
 		arg.Username,
 		arg.HashedPassword,
 		arg.FullName,
@@ -42,17 +43,392 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.PasswordChangedAt,
 		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockoutCount,
+		&i.LockedUntil,
+		&i.IsEmailVerified,
+		&i.TotpSecret,
+		&i.IsTotpEnabled,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const enableUserTOTP = `-- name: EnableUserTOTP :one
+UPDATE users
+SET
+    is_totp_enabled = true,
+    totp_last_used_step = $2
+WHERE username = $1
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, lockout_count, locked_until, is_email_verified, totp_secret, is_totp_enabled, totp_last_used_step
+`
+
+type EnableUserTOTPParams struct {
+	Username         string `json:"username"`
+	TotpLastUsedStep int64  `json:"totp_last_used_step"`
+}
+
+func (q *Queries) EnableUserTOTP(ctx context.Context, arg EnableUserTOTPParams) (User, error) {
+	row := q.db.QueryRow(ctx, enableUserTOTP, arg.Username, arg.TotpLastUsedStep)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockoutCount,
+		&i.LockedUntil,
+		&i.IsEmailVerified,
+		&i.TotpSecret,
+		&i.IsTotpEnabled,
+		&i.TotpLastUsedStep,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT username, hashed_password, full_name, email, password_changed_at, created_at FROM users
+SELECT username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, lockout_count, locked_until, is_email_verified, totp_secret, is_totp_enabled, totp_last_used_step FROM users
 WHERE username = $1 LIMIT 1
 `
 
 func (q *Queries) GetUser(ctx context.Context, username string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUser, username)
+	row := q.db.QueryRow(ctx, getUser, username)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockoutCount,
+		&i.LockedUntil,
+		&i.IsEmailVerified,
+		&i.TotpSecret,
+		&i.IsTotpEnabled,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, lockout_count, locked_until, is_email_verified, totp_secret, is_totp_enabled, totp_last_used_step FROM users
+WHERE email = $1 LIMIT 1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockoutCount,
+		&i.LockedUntil,
+		&i.IsEmailVerified,
+		&i.TotpSecret,
+		&i.IsTotpEnabled,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const getUserForUpdate = `-- name: GetUserForUpdate :one
+SELECT username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, lockout_count, locked_until, is_email_verified, totp_secret, is_totp_enabled, totp_last_used_step FROM users
+WHERE username = $1 LIMIT 1
+FOR UPDATE
+`
+
+func (q *Queries) GetUserForUpdate(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserForUpdate, username)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockoutCount,
+		&i.LockedUntil,
+		&i.IsEmailVerified,
+		&i.TotpSecret,
+		&i.IsTotpEnabled,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const getUserPasswordChangedAt = `-- name: GetUserPasswordChangedAt :one
+SELECT password_changed_at FROM users
+WHERE username = $1 LIMIT 1
+`
+
+func (q *Queries) GetUserPasswordChangedAt(ctx context.Context, username string) (time.Time, error) {
+	row := q.db.QueryRow(ctx, getUserPasswordChangedAt, username)
+	var passwordChangedAt time.Time
+	err := row.Scan(&passwordChangedAt)
+	return passwordChangedAt, err
+}
+
+const lockUser = `-- name: LockUser :one
+UPDATE users
+SET
+    failed_login_attempts = 0,
+    lockout_count = lockout_count + 1,
+    locked_until = $2
+WHERE username = $1
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, lockout_count, locked_until, is_email_verified, totp_secret, is_totp_enabled, totp_last_used_step
+`
+
+type LockUserParams struct {
+	Username    string    `json:"username"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+func (q *Queries) LockUser(ctx context.Context, arg LockUserParams) (User, error) {
+	row := q.db.QueryRow(ctx, lockUser, arg.Username, arg.LockedUntil)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockoutCount,
+		&i.LockedUntil,
+		&i.IsEmailVerified,
+		&i.TotpSecret,
+		&i.IsTotpEnabled,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const recordFailedLogin = `-- name: RecordFailedLogin :one
+UPDATE users
+SET failed_login_attempts = failed_login_attempts + 1
+WHERE username = $1
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, lockout_count, locked_until, is_email_verified, totp_secret, is_totp_enabled, totp_last_used_step
+`
+
+func (q *Queries) RecordFailedLogin(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRow(ctx, recordFailedLogin, username)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockoutCount,
+		&i.LockedUntil,
+		&i.IsEmailVerified,
+		&i.TotpSecret,
+		&i.IsTotpEnabled,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const resetFailedLogins = `-- name: ResetFailedLogins :exec
+UPDATE users
+SET
+    failed_login_attempts = 0,
+    lockout_count = 0
+WHERE username = $1
+`
+
+func (q *Queries) ResetFailedLogins(ctx context.Context, username string) error {
+	_, err := q.db.Exec(ctx, resetFailedLogins, username)
+	return err
+}
+
+const setUserTOTPSecret = `-- name: SetUserTOTPSecret :one
+UPDATE users
+SET totp_secret = $2
+WHERE username = $1
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, lockout_count, locked_until, is_email_verified, totp_secret, is_totp_enabled, totp_last_used_step
+`
+
+type SetUserTOTPSecretParams struct {
+	Username   string `json:"username"`
+	TotpSecret string `json:"totp_secret"`
+}
+
+func (q *Queries) SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) (User, error) {
+	row := q.db.QueryRow(ctx, setUserTOTPSecret, arg.Username, arg.TotpSecret)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockoutCount,
+		&i.LockedUntil,
+		&i.IsEmailVerified,
+		&i.TotpSecret,
+		&i.IsTotpEnabled,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const unlockUser = `-- name: UnlockUser :one
+UPDATE users
+SET
+    failed_login_attempts = 0,
+    lockout_count = 0,
+    locked_until = now()
+WHERE username = $1
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, lockout_count, locked_until, is_email_verified, totp_secret, is_totp_enabled, totp_last_used_step
+`
+
+func (q *Queries) UnlockUser(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRow(ctx, unlockUser, username)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockoutCount,
+		&i.LockedUntil,
+		&i.IsEmailVerified,
+		&i.TotpSecret,
+		&i.IsTotpEnabled,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :one
+UPDATE users
+SET
+    hashed_password = $2,
+    password_changed_at = $3
+WHERE username = $1
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, lockout_count, locked_until, is_email_verified, totp_secret, is_totp_enabled, totp_last_used_step
+`
+
+type UpdateUserPasswordParams struct {
+	Username          string    `json:"username"`
+	HashedPassword    string    `json:"hashed_password"`
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserPassword, arg.Username, arg.HashedPassword, arg.PasswordChangedAt)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockoutCount,
+		&i.LockedUntil,
+		&i.IsEmailVerified,
+		&i.TotpSecret,
+		&i.IsTotpEnabled,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const updateUserPasswordHash = `-- name: UpdateUserPasswordHash :one
+UPDATE users
+SET hashed_password = $2
+WHERE username = $1
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, lockout_count, locked_until, is_email_verified, totp_secret, is_totp_enabled, totp_last_used_step
+`
+
+type UpdateUserPasswordHashParams struct {
+	Username       string `json:"username"`
+	HashedPassword string `json:"hashed_password"`
+}
+
+func (q *Queries) UpdateUserPasswordHash(ctx context.Context, arg UpdateUserPasswordHashParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserPasswordHash, arg.Username, arg.HashedPassword)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockoutCount,
+		&i.LockedUntil,
+		&i.IsEmailVerified,
+		&i.TotpSecret,
+		&i.IsTotpEnabled,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_used_step = $1
+WHERE username = $2 AND totp_last_used_step < $1
+`
+
+type UseTOTPStepParams struct {
+	Step     int64  `json:"step"`
+	Username string `json:"username"`
+}
+
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useTOTPStep, arg.Step, arg.Username)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users
+SET is_email_verified = true
+WHERE username = $1
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, lockout_count, locked_until, is_email_verified, totp_secret, is_totp_enabled, totp_last_used_step
+`
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRow(ctx, verifyUserEmail, username)
 	var i User
 	err := row.Scan(
 		&i.Username,
@@ -61,6 +437,14 @@ func (q *Queries) GetUser(ctx context.Context, username string) (User, error) {
 		&i.Email,
 		&i.PasswordChangedAt,
 		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockoutCount,
+		&i.LockedUntil,
+		&i.IsEmailVerified,
+		&i.TotpSecret,
+		&i.IsTotpEnabled,
+		&i.TotpLastUsedStep,
 	)
 	return i, err
 }
@@ -33,6 +33,11 @@ func createRandomUser(t *testing.T) User {
 	require.True(t, user.PasswordChangedAt.IsZero())
 	require.NotZero(t, user.CreatedAt)
 
+	require.Equal(t, util.DepositorRole, user.Role)
+	require.Zero(t, user.FailedLoginAttempts)
+	require.True(t, user.LockedUntil.IsZero())
+	require.False(t, user.IsEmailVerified)
+
 	return user
 }
 
@@ -53,3 +58,97 @@ func TestGetUser(t *testing.T) {
 	require.WithinDuration(t, user1.PasswordChangedAt, user2.PasswordChangedAt, time.Second)
 	require.WithinDuration(t, user1.CreatedAt, user2.CreatedAt, time.Second)
 }
+
+func TestLockUser(t *testing.T) {
+	user1 := createRandomUser(t)
+
+	user2, err := testQueries.RecordFailedLogin(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), user2.FailedLoginAttempts)
+
+	lockedUntil := time.Now().Add(time.Hour)
+	user3, err := testQueries.LockUser(context.Background(), LockUserParams{
+		Username:    user1.Username,
+		LockedUntil: lockedUntil,
+	})
+	require.NoError(t, err)
+	require.Zero(t, user3.FailedLoginAttempts)
+	require.Equal(t, int32(1), user3.LockoutCount)
+	require.WithinDuration(t, lockedUntil, user3.LockedUntil, time.Second)
+
+	user4, err := testQueries.UnlockUser(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.Zero(t, user4.LockoutCount)
+	require.False(t, user4.LockedUntil.After(time.Now()))
+}
+
+func TestResetFailedLogins(t *testing.T) {
+	user1 := createRandomUser(t)
+
+	_, err := testQueries.RecordFailedLogin(context.Background(), user1.Username)
+	require.NoError(t, err)
+
+	err = testQueries.ResetFailedLogins(context.Background(), user1.Username)
+	require.NoError(t, err)
+
+	user2, err := testQueries.GetUser(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.Zero(t, user2.FailedLoginAttempts)
+	require.Zero(t, user2.LockoutCount)
+}
+
+func TestUpdateUserPassword(t *testing.T) {
+	user1 := createRandomUser(t)
+
+	hashedPassword, err := util.HashPassword(util.RandomString(8))
+	require.NoError(t, err)
+
+	passwordChangedAt := time.Now()
+	user2, err := testQueries.UpdateUserPassword(context.Background(), UpdateUserPasswordParams{
+		Username:          user1.Username,
+		HashedPassword:    hashedPassword,
+		PasswordChangedAt: passwordChangedAt,
+	})
+	require.NoError(t, err)
+	require.Equal(t, hashedPassword, user2.HashedPassword)
+	require.WithinDuration(t, passwordChangedAt, user2.PasswordChangedAt, time.Microsecond)
+
+	passwordChangedAt, err = testQueries.GetUserPasswordChangedAt(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.WithinDuration(t, user2.PasswordChangedAt, passwordChangedAt, time.Microsecond)
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	user := createRandomUser(t)
+
+	arg := UseTOTPStepParams{
+		Step:     util.RandomInt(1, 1000),
+		Username: user.Username,
+	}
+
+	rowsAffected, err := testQueries.UseTOTPStep(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), rowsAffected)
+
+	// The same step cannot be used twice
+	rowsAffected, err = testQueries.UseTOTPStep(context.Background(), arg)
+	require.NoError(t, err)
+	require.Zero(t, rowsAffected)
+}
+
+func TestUpdateUserPasswordHash(t *testing.T) {
+	user1 := createRandomUser(t)
+
+	hashedPassword, err := util.HashPassword(util.RandomString(8))
+	require.NoError(t, err)
+
+	user2, err := testQueries.UpdateUserPasswordHash(context.Background(), UpdateUserPasswordHashParams{
+		Username:       user1.Username,
+		HashedPassword: hashedPassword,
+	})
+	require.NoError(t, err)
+	require.Equal(t, hashedPassword, user2.HashedPassword)
+
+	// A new hash of the same password is not a password change
+	require.WithinDuration(t, user1.PasswordChangedAt, user2.PasswordChangedAt, time.Microsecond)
+}
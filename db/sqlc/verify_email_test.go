@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomUserTx(t *testing.T, store Store, verifyEmailExpires time.Time) (CreateUserTxResult, string) {
+	hashedPassword, err := util.HashPassword(util.RandomString(6))
+	require.NoError(t, err)
+
+	secretCode, err := util.GenerateSecret(32)
+	require.NoError(t, err)
+
+	arg := CreateUserTxParams{
+		CreateUserParams: CreateUserParams{
+			Username:       util.RandomOwner(),
+			HashedPassword: hashedPassword,
+			FullName:       util.RandomOwner(),
+			Email:          util.RandomEmail(),
+		},
+		SecretCodeHash:     util.HashSecret(secretCode),
+		VerifyEmailExpires: verifyEmailExpires,
+	}
+
+	result, err := store.CreateUserTx(context.Background(), arg)
+	require.NoError(t, err)
+
+	require.Equal(t, arg.Username, result.User.Username)
+	require.False(t, result.User.IsEmailVerified)
+
+	require.NotZero(t, result.VerifyEmail.ID)
+	require.Equal(t, arg.Username, result.VerifyEmail.Username)
+	require.Equal(t, arg.Email, result.VerifyEmail.Email)
+	require.Equal(t, arg.SecretCodeHash, result.VerifyEmail.SecretCodeHash)
+	require.False(t, result.VerifyEmail.UsedAt.Valid)
+
+	return result, secretCode
+}
+
+func TestCreateUserTx(t *testing.T) {
+	store := NewStore(testDB)
+	createRandomUserTx(t, store, time.Now().Add(time.Hour))
+}
+
+func TestVerifyEmailTx(t *testing.T) {
+	store := NewStore(testDB)
+	created, secretCode := createRandomUserTx(t, store, time.Now().Add(time.Hour))
+
+	// A wrong code doesn't use up the verification
+	_, err := store.VerifyEmailTx(context.Background(), VerifyEmailTxParams{
+		EmailID:        created.VerifyEmail.ID,
+		SecretCodeHash: util.HashSecret(util.RandomString(32)),
+		Now:            time.Now(),
+	})
+	require.ErrorIs(t, err, ErrInvalidVerifyEmail)
+
+	arg := VerifyEmailTxParams{
+		EmailID:        created.VerifyEmail.ID,
+		SecretCodeHash: util.HashSecret(secretCode),
+		Now:            time.Now(),
+	}
+
+	result, err := store.VerifyEmailTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.True(t, result.User.IsEmailVerified)
+	require.True(t, result.VerifyEmail.UsedAt.Valid)
+
+	// The code can be used only once
+	_, err = store.VerifyEmailTx(context.Background(), arg)
+	require.ErrorIs(t, err, ErrInvalidVerifyEmail)
+}
+
+func TestVerifyEmailTxExpiredCode(t *testing.T) {
+	store := NewStore(testDB)
+	created, secretCode := createRandomUserTx(t, store, time.Now().Add(-time.Minute))
+
+	_, err := store.VerifyEmailTx(context.Background(), VerifyEmailTxParams{
+		EmailID:        created.VerifyEmail.ID,
+		SecretCodeHash: util.HashSecret(secretCode),
+		Now:            time.Now(),
+	})
+	require.ErrorIs(t, err, ErrInvalidVerifyEmail)
+}
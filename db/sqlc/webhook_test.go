@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomWebhookSubscription(t *testing.T, owner string, eventTypes ...string) WebhookSubscription {
+	arg := CreateWebhookSubscriptionParams{
+		Owner:      owner,
+		Url:        "https://example.com/" + util.RandomString(8),
+		EventTypes: eventTypes,
+		Secret:     util.RandomString(32),
+	}
+
+	subscription, err := testQueries.CreateWebhookSubscription(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Owner, subscription.Owner)
+	require.Equal(t, arg.Url, subscription.Url)
+	require.Equal(t, arg.EventTypes, subscription.EventTypes)
+	require.Equal(t, arg.Secret, subscription.Secret)
+	require.NotZero(t, subscription.ID)
+	require.NotZero(t, subscription.CreatedAt)
+
+	return subscription
+}
+
+func TestWebhookSubscription(t *testing.T) {
+	user := createRandomUser(t)
+	subscription1 := createRandomWebhookSubscription(t, user.Username, util.TransferReceivedEvent)
+	subscription2 := createRandomWebhookSubscription(t, user.Username, util.AccountCreatedEvent)
+
+	subscription, err := testQueries.GetWebhookSubscription(context.Background(), subscription1.ID)
+	require.NoError(t, err)
+	require.Equal(t, subscription1.ID, subscription.ID)
+
+	subscriptions, err := testQueries.ListWebhookSubscriptions(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 2)
+	require.Equal(t, subscription2.ID, subscriptions[1].ID)
+
+	err = testQueries.DeleteWebhookSubscription(context.Background(), subscription1.ID)
+	require.NoError(t, err)
+
+	_, err = testQueries.GetWebhookSubscription(context.Background(), subscription1.ID)
+	require.EqualError(t, err, ErrRecordNotFound.Error())
+}
+
+func TestEnqueueWebhookDeliveries(t *testing.T) {
+	user := createRandomUser(t)
+	subscription1 := createRandomWebhookSubscription(t, user.Username, util.TransferReceivedEvent, util.TransferSentEvent)
+	subscription2 := createRandomWebhookSubscription(t, user.Username, util.AccountCreatedEvent)
+
+	arg := EnqueueWebhookDeliveriesParams{
+		EventID:   pgtype.Int8{Int64: util.RandomInt(1, 1000), Valid: true},
+		EventType: util.TransferReceivedEvent,
+		Payload:   json.RawMessage(`{"transfer":{"id":1}}`),
+		Owner:     user.Username,
+	}
+
+	// Only the webhooks subscribed to the event type get a delivery
+	n, err := testQueries.EnqueueWebhookDeliveries(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	// The same event is not queued twice
+	n, err = testQueries.EnqueueWebhookDeliveries(context.Background(), arg)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	deliveries, err := testQueries.ListWebhookDeliveries(context.Background(), ListWebhookDeliveriesParams{
+		SubscriptionID: subscription1.ID,
+		Limit:          5,
+		Offset:         0,
+	})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, util.TransferReceivedEvent, deliveries[0].EventType)
+	require.JSONEq(t, `{"transfer":{"id":1}}`, string(deliveries[0].Payload))
+	require.Equal(t, arg.EventID, deliveries[0].EventID)
+	require.Equal(t, "pending", deliveries[0].Status)
+	require.Zero(t, deliveries[0].Attempts)
+
+	deliveries, err = testQueries.ListWebhookDeliveries(context.Background(), ListWebhookDeliveriesParams{
+		SubscriptionID: subscription2.ID,
+		Limit:          5,
+		Offset:         0,
+	})
+	require.NoError(t, err)
+	require.Empty(t, deliveries)
+}
+
+func TestWebhookDeliveryAttempts(t *testing.T) {
+	user := createRandomUser(t)
+	subscription := createRandomWebhookSubscription(t, user.Username, util.AccountCreatedEvent)
+
+	_, err := testQueries.EnqueueWebhookDeliveries(context.Background(), EnqueueWebhookDeliveriesParams{
+		EventID:   pgtype.Int8{Int64: util.RandomInt(1, 1000), Valid: true},
+		EventType: util.AccountCreatedEvent,
+		Payload:   json.RawMessage(`{}`),
+		Owner:     user.Username,
+	})
+	require.NoError(t, err)
+
+	delivery := claimWebhookDelivery(t, subscription.ID)
+
+	// A claimed delivery is not claimed again until its lock expires
+	deliveries, err := testQueries.ClaimWebhookDeliveries(context.Background(), ClaimWebhookDeliveriesParams{
+		LockedUntil: time.Now().Add(time.Minute),
+		BatchSize:   100,
+	})
+	require.NoError(t, err)
+	for _, claimed := range deliveries {
+		require.NotEqual(t, delivery.ID, claimed.ID)
+	}
+
+	err = testQueries.RetryWebhookDelivery(context.Background(), RetryWebhookDeliveryParams{
+		ID:            delivery.ID,
+		NextAttemptAt: time.Now().Add(-time.Second),
+		LastError:     "unexpected status 500",
+	})
+	require.NoError(t, err)
+
+	delivery = claimWebhookDelivery(t, subscription.ID)
+	require.Equal(t, int32(1), delivery.Attempts)
+	require.Equal(t, "unexpected status 500", delivery.LastError)
+
+	err = testQueries.DeadLetterWebhookDelivery(context.Background(), DeadLetterWebhookDeliveryParams{
+		ID:        delivery.ID,
+		LastError: "unexpected status 410",
+	})
+	require.NoError(t, err)
+
+	redelivered, err := testQueries.RedeliverWebhookDelivery(context.Background(), RedeliverWebhookDeliveryParams{
+		ID:             delivery.ID,
+		SubscriptionID: subscription.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "pending", redelivered.Status)
+	require.Zero(t, redelivered.Attempts)
+
+	delivery = claimWebhookDelivery(t, subscription.ID)
+	err = testQueries.MarkWebhookDelivered(context.Background(), delivery.ID)
+	require.NoError(t, err)
+
+	deliveries, err = testQueries.ListWebhookDeliveries(context.Background(), ListWebhookDeliveriesParams{
+		SubscriptionID: subscription.ID,
+		Limit:          5,
+		Offset:         0,
+	})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, "delivered", deliveries[0].Status)
+	require.Equal(t, int32(1), deliveries[0].Attempts)
+	require.True(t, deliveries[0].DeliveredAt.Valid)
+}
+
+// claimWebhookDelivery claims the due deliveries and returns the one of the subscription
+func claimWebhookDelivery(t *testing.T, subscriptionID int64) WebhookDelivery {
+	deliveries, err := testQueries.ClaimWebhookDeliveries(context.Background(), ClaimWebhookDeliveriesParams{
+		LockedUntil: time.Now().Add(time.Minute),
+		BatchSize:   100,
+	})
+	require.NoError(t, err)
+
+	for _, delivery := range deliveries {
+		if delivery.SubscriptionID == subscriptionID {
+			return delivery
+		}
+	}
+	t.Fatalf("no delivery of subscription %d was claimed", subscriptionID)
+	return WebhookDelivery{}
+}
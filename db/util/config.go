@@ -9,11 +9,61 @@ import (
 // Config stores all configuration of the application
 // The values are read by viper from a config file or environment variables
 type Config struct {
-	DBDriver            string        `mapstructure:"DB_DRIVER"`
-	DBSource            string        `mapstructure:"DB_SOURCE"`
-	ServerAddress       string        `mapstructure:"SERVER_ADDRESS"`
-	TokenSymmetricKey   string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
-	AccessTokenDuration time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	DBDriver                    string        `mapstructure:"DB_DRIVER"`
+	DBSource                    string        `mapstructure:"DB_SOURCE"`
+	DBReplicaSource             string        `mapstructure:"DB_REPLICA_SOURCE"`
+	DBMaxConns                  int32         `mapstructure:"DB_MAX_CONNS"`
+	DBMinConns                  int32         `mapstructure:"DB_MIN_CONNS"`
+	DBMaxConnLifetime           time.Duration `mapstructure:"DB_MAX_CONN_LIFETIME"`
+	DBMaxConnIdleTime           time.Duration `mapstructure:"DB_MAX_CONN_IDLE_TIME"`
+	DBHealthCheckPeriod         time.Duration `mapstructure:"DB_HEALTH_CHECK_PERIOD"`
+	DBTxMaxAttempts             int           `mapstructure:"DB_TX_MAX_ATTEMPTS"`
+	DBTxRetryBaseDelay          time.Duration `mapstructure:"DB_TX_RETRY_BASE_DELAY"`
+	DBTxRetryMaxDelay           time.Duration `mapstructure:"DB_TX_RETRY_MAX_DELAY"`
+	ServerAddress               string        `mapstructure:"SERVER_ADDRESS"`
+	MetricsAddress              string        `mapstructure:"METRICS_ADDRESS"`
+	TrustedProxies              string        `mapstructure:"TRUSTED_PROXIES"`
+	TokenType                   string        `mapstructure:"TOKEN_TYPE"`
+	TokenSymmetricKey           string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
+	TokenPrivateKey             string        `mapstructure:"TOKEN_PRIVATE_KEY"`
+	TokenKeys                   string        `mapstructure:"TOKEN_KEYS"`
+	TokenCurrentKeyID           string        `mapstructure:"TOKEN_CURRENT_KEY_ID"`
+	TokenRetiredKeyIDs          string        `mapstructure:"TOKEN_RETIRED_KEY_IDS"`
+	TokenIssuer                 string        `mapstructure:"TOKEN_ISSUER"`
+	TokenAudience               string        `mapstructure:"TOKEN_AUDIENCE"`
+	TokenLeeway                 time.Duration `mapstructure:"TOKEN_LEEWAY"`
+	AccessTokenDuration         time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	RateLimitBackend            string        `mapstructure:"RATE_LIMIT_BACKEND"`
+	IPRateLimit                 float64       `mapstructure:"IP_RATE_LIMIT"`
+	IPRateLimitBurst            int           `mapstructure:"IP_RATE_LIMIT_BURST"`
+	UserRateLimit               float64       `mapstructure:"USER_RATE_LIMIT"`
+	UserRateLimitBurst          int           `mapstructure:"USER_RATE_LIMIT_BURST"`
+	MaxFailedLogins             int32         `mapstructure:"MAX_FAILED_LOGINS"`
+	LockoutDuration             time.Duration `mapstructure:"LOCKOUT_DURATION"`
+	MaxLockoutDuration          time.Duration `mapstructure:"MAX_LOCKOUT_DURATION"`
+	MailFile                    string        `mapstructure:"MAIL_FILE"`
+	ResetTokenDuration          time.Duration `mapstructure:"RESET_TOKEN_DURATION"`
+	PasswordChangeCacheTTL      time.Duration `mapstructure:"PASSWORD_CHANGE_CACHE_TTL"`
+	SessionCacheTTL             time.Duration `mapstructure:"SESSION_CACHE_TTL"`
+	VerifyEmailURL              string        `mapstructure:"VERIFY_EMAIL_URL"`
+	VerifyEmailDuration         time.Duration `mapstructure:"VERIFY_EMAIL_DURATION"`
+	MFAChallengeDuration        time.Duration `mapstructure:"MFA_CHALLENGE_DURATION"`
+	MFAMaxAttempts              int32         `mapstructure:"MFA_MAX_ATTEMPTS"`
+	PasswordHasher              string        `mapstructure:"PASSWORD_HASHER"`
+	PasswordMinLength           int           `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength           int           `mapstructure:"PASSWORD_MAX_LENGTH"`
+	PasswordMinCharacterClasses int           `mapstructure:"PASSWORD_MIN_CHARACTER_CLASSES"`
+	OutboxPollInterval          time.Duration `mapstructure:"OUTBOX_POLL_INTERVAL"`
+	OutboxBatchSize             int32         `mapstructure:"OUTBOX_BATCH_SIZE"`
+	WebhookPollInterval         time.Duration `mapstructure:"WEBHOOK_POLL_INTERVAL"`
+	WebhookBatchSize            int32         `mapstructure:"WEBHOOK_BATCH_SIZE"`
+	WebhookTimeout              time.Duration `mapstructure:"WEBHOOK_TIMEOUT"`
+	WebhookMaxAttempts          int32         `mapstructure:"WEBHOOK_MAX_ATTEMPTS"`
+	WebhookBackoff              time.Duration `mapstructure:"WEBHOOK_BACKOFF"`
+	WebhookMaxBackoff           time.Duration `mapstructure:"WEBHOOK_MAX_BACKOFF"`
+	StreamBufferSize            int           `mapstructure:"STREAM_BUFFER_SIZE"`
+	StreamHeartbeatInterval     time.Duration `mapstructure:"STREAM_HEARTBEAT_INTERVAL"`
+	ShutdownTimeout             time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
 }
 
 // LoadConfig reads configuration from file or environment variables
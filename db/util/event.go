@@ -0,0 +1,17 @@
+package util
+
+// constants for all event types webhooks can subscribe to
+const (
+	AccountCreatedEvent   = "account.created"
+	TransferSentEvent     = "transfer.sent"
+	TransferReceivedEvent = "transfer.received"
+)
+
+// IsSupportedEventType returns true if the event type is supported
+func IsSupportedEventType(eventType string) bool {
+	switch eventType {
+	case AccountCreatedEvent, TransferSentEvent, TransferReceivedEvent:
+		return true
+	}
+	return false
+}
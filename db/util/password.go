@@ -1,21 +1,86 @@
 package util
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword returns the bcrypt hash of the password
+// Names of the supported password hashing algorithms
+const (
+	Argon2idAlgorithm = "argon2id"
+	BcryptAlgorithm   = "bcrypt"
+)
+
+// ErrPasswordMismatch is returned when a password doesn't match its hash
+var ErrPasswordMismatch = errors.New("hashed password is not the hash of the given password")
+
+// PasswordHasher is an interface for hashing new passwords
+// Hashes of all supported algorithms are verified by CheckPassword regardless of the hasher in use
+type PasswordHasher interface {
+	// Hash returns the hash of the password in the format of the algorithm
+	Hash(password string) (string, error)
+	// NeedsRehash reports whether the hash was created by another algorithm or with other parameters than the hasher uses
+	NeedsRehash(hashedPassword string) bool
+}
+
+// defaultPasswordHasher is used by HashPassword
+var defaultPasswordHasher = NewArgon2idHasher(DefaultArgon2idParams)
+
+// NewPasswordHasher creates a hasher of the algorithm with its default parameters
+func NewPasswordHasher(algorithm string) (PasswordHasher, error) {
+	switch algorithm {
+	case "", Argon2idAlgorithm:
+		return NewArgon2idHasher(DefaultArgon2idParams), nil
+	case BcryptAlgorithm:
+		return NewBcryptHasher(bcrypt.DefaultCost), nil
+	}
+	return nil, fmt.Errorf("unsupported password hashing algorithm %s", algorithm)
+}
+
+// HashPassword returns the hash of the password created by the default hasher
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return defaultPasswordHasher.Hash(password)
+}
+
+// CheckPassword checks if the provided password is correct or not
+// The algorithm is recognized from the format of the hash, so that hashes created before a change of the hasher keep working
+func CheckPassword(password string, hashedPassword string) error {
+	if strings.HasPrefix(hashedPassword, argon2idPrefix) {
+		return checkArgon2idPassword(password, hashedPassword)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+// BcryptHasher hashes passwords with bcrypt
+// bcrypt ignores everything after the first 72 bytes of a password, it is kept for the hashes created before Argon2id
+type BcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher creates a new BcryptHasher
+func NewBcryptHasher(cost int) PasswordHasher {
+	return &BcryptHasher{cost: cost}
+}
+
+// Hash returns the bcrypt hash of the password
+func (hasher *BcryptHasher) Hash(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), hasher.cost)
 	if err != nil {
 		return "", fmt.Errorf("failed to hash password: %w", err)
 	}
 	return string(hashedPassword), nil
 }
 
-// CheckPassword checks if the provided password is correct or not
-func CheckPassword(password string, hashedPassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+// NeedsRehash reports whether the hash is not a bcrypt hash of the configured cost
+func (hasher *BcryptHasher) NeedsRehash(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	return err != nil || cost != hasher.cost
 }
@@ -0,0 +1,147 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2idPrefix starts every Argon2id hash in the PHC string format
+const argon2idPrefix = "$argon2id$"
+
+// The parameters of a stored hash are bounded, so that a tampered or imported hash can neither make the check panic
+// nor make it take more memory or CPU than the server has; Argon2id needs at least 8 KiB per lane
+const (
+	argon2idMinMemoryPerLane = 8
+	argon2idMaxMemory        = 1024 * 1024
+	argon2idMaxIterations    = 16
+	argon2idMaxParallelism   = 16
+	argon2idMaxSaltLength    = 64
+	argon2idMaxKeyLength     = 64
+)
+
+var errInvalidArgon2idHash = errors.New("invalid argon2id hash")
+
+// Argon2idParams contains the cost parameters of Argon2id
+type Argon2idParams struct {
+	// Memory is expressed in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follow the OWASP recommendation for Argon2id
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher hashes passwords with Argon2id into the PHC string format
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+// NewArgon2idHasher creates a new Argon2idHasher
+func NewArgon2idHasher(params Argon2idParams) PasswordHasher {
+	return &Argon2idHasher{params: params}
+}
+
+// Hash returns the Argon2id hash of the password
+func (hasher *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, hasher.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, hasher.params.Iterations, hasher.params.Memory, hasher.params.Parallelism, hasher.params.KeyLength)
+	return encodeArgon2idHash(hasher.params, salt, key), nil
+}
+
+// NeedsRehash reports whether the hash is not an Argon2id hash of the configured parameters
+func (hasher *Argon2idHasher) NeedsRehash(hashedPassword string) bool {
+	params, salt, key, err := decodeArgon2idHash(hashedPassword)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != hasher.params.Memory ||
+		params.Iterations != hasher.params.Iterations ||
+		params.Parallelism != hasher.params.Parallelism ||
+		uint32(len(salt)) != hasher.params.SaltLength ||
+		uint32(len(key)) != hasher.params.KeyLength
+}
+
+// checkArgon2idPassword recomputes the key with the parameters and salt stored in the hash
+func checkArgon2idPassword(password string, hashedPassword string) error {
+	params, salt, key, err := decodeArgon2idHash(hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func encodeArgon2idHash(params Argon2idParams, salt []byte, key []byte) string {
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2idHash(hashedPassword string) (params Argon2idParams, salt []byte, key []byte, err error) {
+	// The hash starts with a $, so the first field is empty
+	fields := strings.Split(hashedPassword, "$")
+	if len(fields) != 6 || fields[1] != "argon2id" {
+		return params, nil, nil, errInvalidArgon2idHash
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(fields[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errInvalidArgon2idHash
+	}
+
+	if _, err = fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, errInvalidArgon2idHash
+	}
+
+	if params.Iterations < 1 || params.Iterations > argon2idMaxIterations ||
+		params.Parallelism < 1 || params.Parallelism > argon2idMaxParallelism ||
+		params.Memory < argon2idMinMemoryPerLane*uint32(params.Parallelism) || params.Memory > argon2idMaxMemory {
+		return params, nil, nil, errInvalidArgon2idHash
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil || len(salt) > argon2idMaxSaltLength {
+		return params, nil, nil, errInvalidArgon2idHash
+	}
+
+	key, err = base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil || len(key) == 0 || len(key) > argon2idMaxKeyLength {
+		return params, nil, nil, errInvalidArgon2idHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
@@ -0,0 +1,148 @@
+package util
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// commonPasswordsFile is the deny-list of the password policy
+//
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// commonPasswords is the parsed deny-list, passwords are stored in lower case
+var commonPasswords = parseCommonPasswords(commonPasswordsFile)
+
+// leetReplacer undoes the substitutions of letters by look-alike digits and symbols
+var leetReplacer = strings.NewReplacer("@", "a", "4", "a", "3", "e", "1", "i", "0", "o", "$", "s", "5", "s", "7", "t")
+
+// minUserInputLength is the length below which the username and email are not looked for in the password,
+// as short values would reject too many unrelated passwords
+const minUserInputLength = 3
+
+// PasswordPolicy defines the rules a new password has to follow
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength is not enforced if it is not positive
+	MaxLength int
+	// MinCharacterClasses is the number of classes out of lowercase letters, uppercase letters, digits and symbols the password has to use
+	MinCharacterClasses int
+}
+
+// PasswordPolicyError lists the reasons why a password was rejected, one for every rule it breaks
+type PasswordPolicyError struct {
+	Reasons []string
+}
+
+func (err *PasswordPolicyError) Error() string {
+	return "password " + strings.Join(err.Reasons, ", ")
+}
+
+// Check returns an error listing all the rules the password breaks, or nil if it follows the policy
+// The username and email of the user are passed as userInputs, the password must not contain them
+func (policy PasswordPolicy) Check(password string, userInputs ...string) error {
+	var reasons []string
+
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		reasons = append(reasons, fmt.Sprintf("must be at least %d characters long", policy.MinLength))
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		reasons = append(reasons, fmt.Sprintf("must be at most %d characters long", policy.MaxLength))
+	}
+
+	if countCharacterClasses(password) < policy.MinCharacterClasses {
+		reasons = append(reasons, fmt.Sprintf(
+			"must contain characters of at least %d of these classes: lowercase letters, uppercase letters, digits, symbols",
+			policy.MinCharacterClasses,
+		))
+	}
+
+	lowerPassword := strings.ToLower(password)
+	if isCommonPassword(lowerPassword) {
+		reasons = append(reasons, "is too common")
+	}
+
+	for _, input := range userInputs {
+		if containsUserInput(lowerPassword, input) {
+			reasons = append(reasons, "must not contain the username or email")
+			break
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &PasswordPolicyError{Reasons: reasons}
+	}
+	return nil
+}
+
+func countCharacterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// containsUserInput checks the whole input and, for an email, its local part
+func containsUserInput(lowerPassword string, input string) bool {
+	input = strings.ToLower(input)
+	candidates := []string{input}
+	if at := strings.LastIndex(input, "@"); at >= 0 {
+		candidates = append(candidates, input[:at])
+	}
+
+	for _, candidate := range candidates {
+		if len(candidate) >= minUserInputLength && strings.Contains(lowerPassword, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCommonPassword also finds the common passwords dressed up to follow the rules about characters,
+// e.g. "P@ssw0rd2024!" is "password" with the case changed, digits and symbols put in place of letters and added after it
+// The substitutions are undone both before and after trimming, as the added digits and symbols may look like letters too
+func isCommonPassword(lowerPassword string) bool {
+	if commonPasswords[lowerPassword] {
+		return true
+	}
+
+	word := trimNonLetters(lowerPassword)
+	for _, candidate := range []string{word, leetReplacer.Replace(word), trimNonLetters(leetReplacer.Replace(lowerPassword))} {
+		if candidate != "" && commonPasswords[candidate] {
+			return true
+		}
+	}
+	return false
+}
+
+func trimNonLetters(password string) string {
+	return strings.TrimFunc(password, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
+
+func parseCommonPasswords(file string) map[string]bool {
+	passwords := make(map[string]bool)
+	for _, line := range strings.Split(file, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = true
+	}
+	return passwords
+}
@@ -0,0 +1,119 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:           8,
+		MaxLength:           16,
+		MinCharacterClasses: 3,
+	}
+
+	testCases := []struct {
+		name       string
+		password   string
+		userInputs []string
+		reasons    []string
+	}{
+		{
+			name:     "OK",
+			password: "Correct-Horse7",
+		},
+		{
+			name:     "OKUnicode",
+			password: "Źdźbło-trawy9",
+		},
+		{
+			name:     "TooShort",
+			password: "Ab1!",
+			reasons:  []string{"must be at least 8 characters long"},
+		},
+		{
+			name:     "TooLong",
+			password: "Correct-Horse-Battery7",
+			reasons:  []string{"must be at most 16 characters long"},
+		},
+		{
+			name:     "TooFewCharacterClasses",
+			password: "correcthorse7",
+			reasons:  []string{"must contain characters of at least 3 of these classes: lowercase letters, uppercase letters, digits, symbols"},
+		},
+		{
+			name:     "Common",
+			password: "Password123",
+			reasons:  []string{"is too common"},
+		},
+		{
+			name:     "CommonWithDigitsAndSymbols",
+			password: "Summer2024!",
+			reasons:  []string{"is too common"},
+		},
+		{
+			name:     "CommonWithLeetspeak",
+			password: "!P@ssw0rd1",
+			reasons:  []string{"is too common"},
+		},
+		{
+			name:     "CommonWordWithinPassword",
+			password: "Summer-Rain-24",
+		},
+		{
+			name:       "ContainsUsername",
+			password:   "Hi-Alice-2024",
+			userInputs: []string{"alice", "bob@email.com"},
+			reasons:    []string{"must not contain the username or email"},
+		},
+		{
+			name:       "ContainsEmailLocalPart",
+			password:   "Hi-Bob-2024",
+			userInputs: []string{"alice", "bob@email.com"},
+			reasons:    []string{"must not contain the username or email"},
+		},
+		{
+			name:       "ShortUserInputIgnored",
+			password:   "Hi-Al-2024!",
+			userInputs: []string{"al"},
+		},
+		{
+			name:     "ManyRules",
+			password: "qwerty",
+			reasons: []string{
+				"must be at least 8 characters long",
+				"must contain characters of at least 3 of these classes: lowercase letters, uppercase letters, digits, symbols",
+				"is too common",
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.Check(tc.password, tc.userInputs...)
+			if len(tc.reasons) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			var policyErr *PasswordPolicyError
+			require.ErrorAs(t, err, &policyErr)
+			require.Equal(t, tc.reasons, policyErr.Reasons)
+		})
+	}
+}
+
+func TestCommonPasswords(t *testing.T) {
+	require.True(t, commonPasswords["password"])
+	require.True(t, commonPasswords["qwerty123"])
+	require.False(t, commonPasswords[""])
+	require.False(t, commonPasswords["# one password per line, compared case-insensitively"])
+
+	require.True(t, isCommonPassword("qwerty123!"))
+	require.True(t, isCommonPassword("$h@dow99"))
+	require.False(t, isCommonPassword("2024!"))
+	require.False(t, isCommonPassword("correct-horse7"))
+}
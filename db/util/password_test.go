@@ -1,6 +1,8 @@
 package util
 
 import (
+	"encoding/base64"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -13,13 +15,14 @@ func TestPassword(t *testing.T) {
 	hashedPassword1, err := HashPassword(password)
 	require.NoError(t, err)
 	require.NotEmpty(t, hashedPassword1)
+	require.True(t, strings.HasPrefix(hashedPassword1, "$argon2id$v=19$m=19456,t=2,p=1$"))
 
 	err = CheckPassword(password, hashedPassword1)
 	require.NoError(t, err)
 
 	wrongPassword := RandomString(6)
 	err = CheckPassword(wrongPassword, hashedPassword1)
-	require.EqualError(t, err, bcrypt.ErrMismatchedHashAndPassword.Error())
+	require.ErrorIs(t, err, ErrPasswordMismatch)
 
 	// here we check that the same password hashed two times will have different hash values
 	hashedPassword2, err := HashPassword(password)
@@ -27,3 +30,81 @@ func TestPassword(t *testing.T) {
 	require.NotEmpty(t, hashedPassword2)
 	require.NotEqual(t, hashedPassword1, hashedPassword2)
 }
+
+func TestLongPassword(t *testing.T) {
+	// bcrypt would consider these two passwords equal, as they differ only after the first 72 bytes
+	password := strings.Repeat("a", 72) + "b"
+	otherPassword := strings.Repeat("a", 72) + "c"
+
+	hashedPassword, err := HashPassword(password)
+	require.NoError(t, err)
+
+	require.NoError(t, CheckPassword(password, hashedPassword))
+	require.ErrorIs(t, CheckPassword(otherPassword, hashedPassword), ErrPasswordMismatch)
+}
+
+func TestCheckBcryptPassword(t *testing.T) {
+	password := RandomString(6)
+
+	hasher, err := NewPasswordHasher(BcryptAlgorithm)
+	require.NoError(t, err)
+
+	hashedPassword, err := hasher.Hash(password)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hashedPassword, "$2a$"))
+
+	require.NoError(t, CheckPassword(password, hashedPassword))
+	require.ErrorIs(t, CheckPassword(RandomString(6), hashedPassword), ErrPasswordMismatch)
+}
+
+func TestNeedsRehash(t *testing.T) {
+	password := RandomString(6)
+
+	argon2idHasher, err := NewPasswordHasher(Argon2idAlgorithm)
+	require.NoError(t, err)
+	bcryptHasher, err := NewPasswordHasher(BcryptAlgorithm)
+	require.NoError(t, err)
+
+	argon2idHash, err := argon2idHasher.Hash(password)
+	require.NoError(t, err)
+	bcryptHash, err := bcryptHasher.Hash(password)
+	require.NoError(t, err)
+
+	require.False(t, argon2idHasher.NeedsRehash(argon2idHash))
+	require.True(t, argon2idHasher.NeedsRehash(bcryptHash))
+	require.False(t, bcryptHasher.NeedsRehash(bcryptHash))
+	require.True(t, bcryptHasher.NeedsRehash(argon2idHash))
+
+	// A change of the parameters requires a rehash as well
+	strongerParams := DefaultArgon2idParams
+	strongerParams.Iterations++
+	require.True(t, NewArgon2idHasher(strongerParams).NeedsRehash(argon2idHash))
+	require.True(t, NewBcryptHasher(bcrypt.DefaultCost+1).NeedsRehash(bcryptHash))
+
+	_, err = NewPasswordHasher("md5")
+	require.Error(t, err)
+}
+
+func TestInvalidArgon2idHash(t *testing.T) {
+	for _, hashedPassword := range []string{
+		"$argon2id$",
+		"$argon2id$v=18$m=19456,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=1$!!!$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$",
+		// Parameters the check would panic on or that would exhaust the memory
+		"$argon2id$v=19$m=19456,t=0,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=0$c2FsdA$a2V5",
+		"$argon2id$v=19$m=0,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=15,t=2,p=2$c2FsdA$a2V5",
+		"$argon2id$v=19$m=4194304,t=2,p=1$c2FsdA$a2V5",
+		// Parameters that would keep the server busy without bound
+		"$argon2id$v=19$m=19456,t=4294967295,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=17,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=17$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=1$" + base64.RawStdEncoding.EncodeToString(make([]byte, 65)) + "$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$" + base64.RawStdEncoding.EncodeToString(make([]byte, 65)),
+	} {
+		require.ErrorIs(t, CheckPassword("password", hashedPassword), errInvalidArgon2idHash, hashedPassword)
+	}
+}
@@ -0,0 +1,17 @@
+package util
+
+// constants for all scopes of api keys
+const (
+	AccountsReadScope   = "accounts:read"
+	AccountsWriteScope  = "accounts:write"
+	TransfersWriteScope = "transfers:write"
+)
+
+// IsSupportedScope returns true if the scope is supported
+func IsSupportedScope(scope string) bool {
+	switch scope {
+	case AccountsReadScope, AccountsWriteScope, TransfersWriteScope:
+		return true
+	}
+	return false
+}
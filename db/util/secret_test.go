@@ -0,0 +1,21 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecret(t *testing.T) {
+	secret1, err := GenerateSecret(32)
+	require.NoError(t, err)
+	require.Len(t, secret1, 43)
+
+	secret2, err := GenerateSecret(32)
+	require.NoError(t, err)
+	require.NotEqual(t, secret1, secret2)
+
+	require.Equal(t, HashSecret(secret1), HashSecret(secret1))
+	require.NotEqual(t, HashSecret(secret1), HashSecret(secret2))
+	require.NotContains(t, HashSecret(secret1), secret1)
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// totpPeriod is the number of seconds a TOTP code is valid for
+	totpPeriod = 30
+	// totpSkew is the number of periods before and after the current one whose codes are still accepted
+	totpSkew = 1
+	// recoveryCodeSize is the number of random bytes in a recovery code
+	recoveryCodeSize = 10
+)
+
+var totpOpts = totp.ValidateOpts{
+	Period:    totpPeriod,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// GenerateTOTPKey returns a new TOTP secret and the otpauth URI which authenticator apps read from a QR code
+func GenerateTOTPKey(issuer string, accountName string) (secret string, uri string, err error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: accountName,
+		Period:      totpPeriod,
+		Digits:      totpOpts.Digits,
+		Algorithm:   totpOpts.Algorithm,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate totp key: %w", err)
+	}
+	return key.Secret(), key.URL(), nil
+}
+
+// ValidateTOTPCode checks the code against the secret at the given time
+// It returns the time step the code belongs to, so that the caller can reject a code which has already been used
+func ValidateTOTPCode(code string, secret string, t time.Time) (int64, bool) {
+	for skew := -totpSkew; skew <= totpSkew; skew++ {
+		stepTime := t.Add(time.Duration(skew*totpPeriod) * time.Second)
+
+		expected, err := totp.GenerateCodeCustom(secret, stepTime, totpOpts)
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return stepTime.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns n single-use codes which replace a TOTP code when the authenticator is lost
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		buf := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		codes[i] = strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf))
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode undoes the changes users tend to make when typing a recovery code
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,58 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateTOTPKey(t *testing.T) {
+	secret, uri, err := GenerateTOTPKey("Simple Bank", "alice")
+	require.NoError(t, err)
+	require.NotEmpty(t, secret)
+	require.Contains(t, uri, "otpauth://totp/")
+	require.Contains(t, uri, "secret="+secret)
+	require.Contains(t, uri, "issuer=Simple%20Bank")
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	secret, _, err := GenerateTOTPKey("Simple Bank", "alice")
+	require.NoError(t, err)
+
+	now := time.Now()
+	code, err := totp.GenerateCodeCustom(secret, now, totpOpts)
+	require.NoError(t, err)
+
+	step, ok := ValidateTOTPCode(code, secret, now)
+	require.True(t, ok)
+	require.Equal(t, now.Unix()/totpPeriod, step)
+
+	// The code of the previous period is still accepted to allow for clock drift
+	step, ok = ValidateTOTPCode(code, secret, now.Add(totpPeriod*time.Second))
+	require.True(t, ok)
+	require.Equal(t, now.Unix()/totpPeriod, step)
+
+	_, ok = ValidateTOTPCode(code, secret, now.Add(3*totpPeriod*time.Second))
+	require.False(t, ok)
+
+	_, ok = ValidateTOTPCode("000000", "not a base32 secret!", now)
+	require.False(t, ok)
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		require.Len(t, code, 16)
+		require.Equal(t, code, NormalizeRecoveryCode(code))
+		require.False(t, seen[code])
+		seen[code] = true
+	}
+
+	require.Equal(t, "abcdefgh", NormalizeRecoveryCode(" ABCD-EFGH "))
+}
@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer is a Mailer for local development, instead of sending emails it writes them to a log
+type LogMailer struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewLogMailer creates a new LogMailer writing emails to out
+func NewLogMailer(out io.Writer) Mailer {
+	return &LogMailer{out: out}
+}
+
+// NewFileMailer creates a new LogMailer appending emails to the file at path
+func NewFileMailer(path string) (Mailer, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open mail file: %w", err)
+	}
+	return NewLogMailer(file), nil
+}
+
+// SendEmail writes the email to the log
+func (mailer *LogMailer) SendEmail(ctx context.Context, to string, subject string, content string) error {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+
+	_, err := fmt.Fprintf(mailer.out, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC1123Z), to, subject, content)
+	return err
+}
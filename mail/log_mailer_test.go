@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogMailer(t *testing.T) {
+	var out bytes.Buffer
+	mailer := NewLogMailer(&out)
+
+	to := util.RandomEmail()
+	subject := util.RandomString(10)
+	content := util.RandomString(30)
+
+	err := mailer.SendEmail(context.Background(), to, subject, content)
+	require.NoError(t, err)
+
+	require.Contains(t, out.String(), "To: "+to)
+	require.Contains(t, out.String(), "Subject: "+subject)
+	require.Contains(t, out.String(), content)
+}
+
+func TestFileMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	mailer, err := NewFileMailer(path)
+	require.NoError(t, err)
+
+	to1 := util.RandomEmail()
+	to2 := util.RandomEmail()
+	require.NoError(t, mailer.SendEmail(context.Background(), to1, "subject", "content"))
+	require.NoError(t, mailer.SendEmail(context.Background(), to2, "subject", "content"))
+
+	// Emails are appended to the file, so both of them are kept
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "To: "+to1)
+	require.Contains(t, string(data), "To: "+to2)
+}
@@ -0,0 +1,9 @@
+package mail
+
+import "context"
+
+// Mailer is an interface for sending emails to users
+type Mailer interface {
+	// SendEmail sends an email with the given subject and plain text content to a single recipient
+	SendEmail(ctx context.Context, to string, subject string, content string) error
+}
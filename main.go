@@ -1,13 +1,28 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"expvar"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
+	"github.com/igiai/simplebank/admin"
 	"github.com/igiai/simplebank/api"
+	"github.com/igiai/simplebank/clock"
 	db "github.com/igiai/simplebank/db/sqlc"
 	"github.com/igiai/simplebank/db/util"
-	_ "github.com/lib/pq"
+	"github.com/igiai/simplebank/mail"
+	"github.com/igiai/simplebank/outbox"
+	"github.com/igiai/simplebank/seed"
+	"github.com/igiai/simplebank/stream"
+	"github.com/igiai/simplebank/webhook"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func main() {
@@ -16,19 +31,274 @@ func main() {
 		log.Fatal("cannot load config: ", err)
 	}
 
-	conn, err := sql.Open(config.DBDriver, config.DBSource)
+	store, err := newStore(config)
 	if err != nil {
-		log.Fatal("cannot connect to db: ", err)
+		log.Fatal("cannot create store: ", err)
 	}
 
-	store := db.NewStore(conn)
-	server, err := api.NewServer(config, store)
+	// Without arguments the binary runs the HTTP server, otherwise the first argument selects a maintenance or admin command
+	if len(os.Args) > 1 && os.Args[1] == "verify-ledger" {
+		runVerifyLedger(store, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		runSeed(config, store, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && admin.IsCommand(os.Args[1]) {
+		runAdmin(config, store, os.Args[1:])
+		return
+	}
+
+	mailer, err := newMailer(config)
+	if err != nil {
+		log.Fatal("cannot create mailer: ", err)
+	}
+
+	// Transfers made through any instance are notified by the db, every instance forwards them to its own streams
+	broker := stream.NewBroker(config.StreamBufferSize)
+	if memoryStore, ok := store.(*db.MemoryStore); ok {
+		// Without a db there is a single instance, the notifications come straight from its store
+		memoryStore.Listen(db.TransferNotificationChannel, func(payload string) {
+			if err := broker.HandleNotification(payload); err != nil {
+				log.Printf("cannot handle transfer notification: %v", err)
+			}
+		})
+	} else {
+		go func() {
+			err := stream.Listen(context.Background(), config.DBSource, broker)
+			if err != nil {
+				log.Fatal("cannot listen to transfer notifications: ", err)
+			}
+		}()
+	}
+
+	server, err := api.NewServer(config, store, mailer, broker, clock.Real{})
 	if err != nil {
 		log.Fatal("cannot create server:", err)
 	}
 
-	err = server.Start(config.ServerAddress)
+	// The side effects of the transactions are run in the background from the events they write to the outbox
+	dispatcher := outbox.NewDispatcher(store, config)
+	dispatcher.Register("webhooks", webhook.NewEventHandler(store))
+	go dispatcher.Run(context.Background())
+
+	// Webhooks are delivered in the background, the deliveries are queued by the webhooks handler of the outbox
+	go webhook.NewWorker(store, config, clock.Real{}).Run(context.Background())
+
+	// The metrics, e.g. the retries of the db transactions, are served apart from the API, on an address not exposed to the clients
+	if config.MetricsAddress != "" {
+		go func() {
+			err := http.ListenAndServe(config.MetricsAddress, expvar.Handler())
+			if err != nil {
+				log.Fatal("cannot start metrics server: ", err)
+			}
+		}()
+	}
+
+	go func() {
+		err := server.Start(config.ServerAddress)
+		if err != nil {
+			log.Fatal("cannot start server: ", err)
+		}
+	}()
+
+	// On SIGTERM the requests in flight and the emails they queued are finished before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	log.Println("shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	err = server.Shutdown(shutdownCtx)
 	if err != nil {
-		log.Fatal("cannot start server: ", err)
+		log.Fatal("cannot shut down server gracefully: ", err)
+	}
+}
+
+// newStore creates the store of the configured driver
+// The memory driver keeps all the data in the process and loses it on exit, it is meant for local development and demos
+func newStore(config util.Config) (db.Store, error) {
+	if config.DBDriver == "memory" {
+		return db.NewMemoryStore(), nil
+	}
+	if config.DBDriver != "postgres" {
+		return nil, fmt.Errorf("unknown db driver %q", config.DBDriver)
+	}
+
+	connPool, err := newConnPool(config.DBSource, config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to db: %w", err)
+	}
+
+	store := db.NewStoreWithRetryPolicy(connPool, db.RetryPolicy{
+		MaxAttempts: config.DBTxMaxAttempts,
+		BaseDelay:   config.DBTxRetryBaseDelay,
+		MaxDelay:    config.DBTxRetryMaxDelay,
+	})
+
+	// With a replica configured the reads which tolerate replication lag are taken off the primary
+	if config.DBReplicaSource != "" {
+		replicaPool, err := newConnPool(config.DBReplicaSource, config)
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to db replica: %w", err)
+		}
+		store = db.NewReplicaStore(store, db.New(replicaPool))
+	}
+
+	return store, nil
+}
+
+// newConnPool creates a pool of connections to the db at the source with the configured limits
+// The limits which are not set keep the defaults of pgxpool
+func newConnPool(source string, config util.Config) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.DBMaxConns > 0 {
+		poolConfig.MaxConns = config.DBMaxConns
+	}
+	if config.DBMinConns > 0 {
+		poolConfig.MinConns = config.DBMinConns
+	}
+	if config.DBMaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = config.DBMaxConnLifetime
+	}
+	if config.DBMaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = config.DBMaxConnIdleTime
+	}
+	if config.DBHealthCheckPeriod > 0 {
+		poolConfig.HealthCheckPeriod = config.DBHealthCheckPeriod
+	}
+
+	return pgxpool.NewWithConfig(context.Background(), poolConfig)
+}
+
+// newMailer creates a mailer writing emails to the configured file, or to the standard output if there is none
+func newMailer(config util.Config) (mail.Mailer, error) {
+	if config.MailFile == "" {
+		return mail.NewLogMailer(os.Stdout), nil
 	}
+	return mail.NewFileMailer(config.MailFile)
+}
+
+// runVerifyLedger walks the hash chain of the entries and exits with non-zero status on the first broken link
+func runVerifyLedger(store db.Store, args []string) {
+	flags := flag.NewFlagSet("verify-ledger", flag.ExitOnError)
+	accountID := flags.Int64("account", 0, "verify only the entries of this account")
+	flags.Parse(args)
+
+	var chainBreak *db.ChainBreak
+	var err error
+	if *accountID > 0 {
+		chainBreak, err = db.VerifyAccountLedger(context.Background(), store, *accountID)
+	} else {
+		chainBreak, err = db.VerifyLedger(context.Background(), store)
+	}
+	if err != nil {
+		log.Fatal("cannot verify ledger: ", err)
+	}
+
+	if chainBreak != nil && chainBreak.HeadMismatch {
+		log.Fatalf(
+			"chain of account %d ends at entry %d with hash %q, the account expects %q",
+			chainBreak.AccountID,
+			chainBreak.Entry.ID,
+			chainBreak.Entry.Hash,
+			chainBreak.ExpectedHash,
+		)
+	}
+
+	if chainBreak != nil {
+		log.Fatalf(
+			"broken link at entry %d of account %d: prev_hash %q (expected %q), hash %q (expected %q)",
+			chainBreak.Entry.ID,
+			chainBreak.Entry.AccountID,
+			chainBreak.Entry.PrevHash,
+			chainBreak.ExpectedPrevHash,
+			chainBreak.Entry.Hash,
+			chainBreak.ExpectedHash,
+		)
+	}
+
+	log.Println("ledger hash chain is intact")
+}
+
+// runAdmin runs an admin command of the support staff, e.g. "user show -username alice -output json"
+func runAdmin(config util.Config, store db.Store, args []string) {
+	command, err := admin.NewCommand(config, store, clock.Real{}, os.Stdin, os.Stdout)
+	if err != nil {
+		log.Fatal("cannot create admin command: ", err)
+	}
+
+	err = command.Run(context.Background(), args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// seedAllowEnv lets the seed command run without the -allow flag, e.g. in the scripts setting up QA environments
+const seedAllowEnv = "SIMPLEBANK_ALLOW_SEED"
+
+// runSeed populates the db with generated users, accounts and transfers for QA and demos
+// The same seed on a fresh db gives the same data, all the users share the password read with admin.ReadPassword
+// It refuses to run unless it is explicitly allowed, so it isn't run against a production db by mistake
+func runSeed(config util.Config, store db.Store, args []string) {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	seedValue := flags.Int64("seed", 1, "seed of the generated data")
+	users := flags.Int("users", 20, "number of users")
+	currencies := flags.String("currencies", strings.Join([]string{util.USD, util.EUR, util.CAD}, ","), "comma separated currencies of the accounts")
+	maxBalance := flags.Int64("max-balance", 10000, "largest initial balance of an account")
+	transfers := flags.Int("transfers", 200, "number of transfers")
+	allow := flags.Bool("allow", false, "confirm that the db may be filled with generated data")
+	flags.Parse(args)
+
+	if !*allow && os.Getenv(seedAllowEnv) != "true" {
+		log.Fatalf("the seed command fills the db with generated data, pass -allow or set %s=true to run it", seedAllowEnv)
+	}
+
+	password, err := admin.ReadPassword(os.Stdin)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, ok := store.(*db.MemoryStore); ok {
+		log.Println("the memory store is lost once the seed command exits, seed a postgres db instead")
+	}
+
+	passwordPolicy := util.PasswordPolicy{
+		MinLength:           config.PasswordMinLength,
+		MaxLength:           config.PasswordMaxLength,
+		MinCharacterClasses: config.PasswordMinCharacterClasses,
+	}
+	if err := passwordPolicy.Check(password); err != nil {
+		log.Fatal("invalid password: ", err)
+	}
+
+	passwordHasher, err := util.NewPasswordHasher(config.PasswordHasher)
+	if err != nil {
+		log.Fatal("cannot create password hasher: ", err)
+	}
+	hashedPassword, err := passwordHasher.Hash(password)
+	if err != nil {
+		log.Fatal("cannot hash password: ", err)
+	}
+
+	result, err := seed.Seed(context.Background(), store, seed.Options{
+		Seed:           *seedValue,
+		Users:          *users,
+		Currencies:     strings.Split(*currencies, ","),
+		MaxBalance:     *maxBalance,
+		Transfers:      *transfers,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		log.Fatal("cannot seed db: ", err)
+	}
+
+	log.Printf("seeded %d users, %d accounts and %d transfers", len(result.Users), len(result.Accounts), len(result.Transfers))
 }
@@ -0,0 +1,146 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+)
+
+// Envelope is an event read from the outbox
+type Envelope struct {
+	ID        int64
+	CreatedAt time.Time
+	Event     db.Event
+}
+
+// Handler reacts to the events of the outbox
+// An event may be handled more than once, e.g. when the server stops before the checkpoint is saved,
+// so handlers have to be idempotent
+type Handler interface {
+	HandleEvent(ctx context.Context, envelope Envelope) error
+}
+
+// HandlerFunc lets ordinary functions be used as handlers
+type HandlerFunc func(ctx context.Context, envelope Envelope) error
+
+func (f HandlerFunc) HandleEvent(ctx context.Context, envelope Envelope) error {
+	return f(ctx, envelope)
+}
+
+type registeredHandler struct {
+	name    string
+	handler Handler
+}
+
+// Dispatcher polls the outbox and delivers the events to the registered handlers
+// Every handler has its own checkpoint, so a failing handler is retried without holding the others back
+type Dispatcher struct {
+	store    db.Querier
+	config   util.Config
+	handlers []registeredHandler
+}
+
+// NewDispatcher creates a dispatcher without any handlers
+func NewDispatcher(store db.Querier, config util.Config) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		config: config,
+	}
+}
+
+// Register adds a handler under a name, which keys its checkpoint and so must not change between releases
+// A new handler starts with the oldest event still in the outbox
+func (dispatcher *Dispatcher) Register(name string, handler Handler) {
+	dispatcher.handlers = append(dispatcher.handlers, registeredHandler{name: name, handler: handler})
+}
+
+// Run dispatches the pending events every poll interval until the context is canceled
+func (dispatcher *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(dispatcher.config.OutboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, registered := range dispatcher.handlers {
+			for {
+				n, err := dispatcher.dispatch(ctx, registered)
+				if err != nil {
+					log.Printf("cannot dispatch events to %s: %v", registered.name, err)
+				}
+				// A full batch means there may be more events waiting
+				if err != nil || n == 0 || n < int(dispatcher.config.OutboxBatchSize) {
+					break
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchPending delivers a batch of pending events to every handler, it returns the number of dispatched events
+// It stops at the first error, the failed event is dispatched again on the next call
+func (dispatcher *Dispatcher) DispatchPending(ctx context.Context) (int, error) {
+	total := 0
+	for _, registered := range dispatcher.handlers {
+		n, err := dispatcher.dispatch(ctx, registered)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("cannot dispatch events to %s: %w", registered.name, err)
+		}
+	}
+	return total, nil
+}
+
+// dispatch delivers the events after the checkpoint of the handler, moving the checkpoint after every handled event
+func (dispatcher *Dispatcher) dispatch(ctx context.Context, registered registeredHandler) (int, error) {
+	checkpoint, err := dispatcher.store.GetOutboxCheckpoint(ctx, registered.name)
+	if err != nil && err != db.ErrRecordNotFound {
+		return 0, err
+	}
+
+	events, err := dispatcher.store.ListPendingOutboxEvents(ctx, db.ListPendingOutboxEventsParams{
+		LastTxid:    checkpoint.LastTxid,
+		LastEventID: checkpoint.LastEventID,
+		BatchSize:   dispatcher.config.OutboxBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	dispatched := 0
+	for _, outboxEvent := range events {
+		event, err := db.DecodeEvent(outboxEvent)
+		if err != nil {
+			// An event which cannot be decoded never will be, retrying it would block the handler forever
+			log.Printf("skipping outbox event %d: %v", outboxEvent.ID, err)
+		} else {
+			err = registered.handler.HandleEvent(ctx, Envelope{
+				ID:        outboxEvent.ID,
+				CreatedAt: outboxEvent.CreatedAt,
+				Event:     event,
+			})
+			if err != nil {
+				return dispatched, fmt.Errorf("cannot handle event %d: %w", outboxEvent.ID, err)
+			}
+		}
+
+		err = dispatcher.store.SaveOutboxCheckpoint(ctx, db.SaveOutboxCheckpointParams{
+			Handler:     registered.name,
+			LastTxid:    outboxEvent.Txid,
+			LastEventID: outboxEvent.ID,
+		})
+		if err != nil {
+			return dispatched, err
+		}
+		dispatched++
+	}
+	return dispatched, nil
+}
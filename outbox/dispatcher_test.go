@@ -0,0 +1,223 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/igiai/simplebank/db/mock"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConfig() util.Config {
+	return util.Config{
+		OutboxPollInterval: time.Second,
+		OutboxBatchSize:    10,
+	}
+}
+
+func randomOutboxEvent(t *testing.T, id int64, event db.Event) db.OutboxEvent {
+	payload, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	return db.OutboxEvent{
+		ID:        id,
+		Txid:      id * 10,
+		EventType: event.EventType(),
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	}
+}
+
+func randomAccountCreated() db.AccountCreated {
+	return db.AccountCreated{
+		Account: db.Account{
+			ID:       util.RandomInt(1, 1000),
+			Owner:    util.RandomOwner(),
+			Currency: util.RandomCurrency(),
+		},
+	}
+}
+
+// recordingHandler remembers the events it handled and fails on the ids in failOn
+type recordingHandler struct {
+	handled []int64
+	failOn  map[int64]bool
+}
+
+func (handler *recordingHandler) HandleEvent(ctx context.Context, envelope Envelope) error {
+	if handler.failOn[envelope.ID] {
+		return errors.New("handler failed")
+	}
+	handler.handled = append(handler.handled, envelope.ID)
+	return nil
+}
+
+func TestDispatchPending(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	event1 := randomAccountCreated()
+	outboxEvents := []db.OutboxEvent{
+		randomOutboxEvent(t, 1, event1),
+		randomOutboxEvent(t, 2, randomAccountCreated()),
+	}
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetOutboxCheckpoint(gomock.Any(), gomock.Eq("test")).
+		Times(1).
+		Return(db.OutboxCheckpoint{}, db.ErrRecordNotFound)
+	store.EXPECT().
+		ListPendingOutboxEvents(gomock.Any(), gomock.Eq(db.ListPendingOutboxEventsParams{
+			LastTxid:    0,
+			LastEventID: 0,
+			BatchSize:   10,
+		})).
+		Times(1).
+		Return(outboxEvents, nil)
+	// The checkpoint moves after every event, in the order of the outbox
+	gomock.InOrder(
+		store.EXPECT().
+			SaveOutboxCheckpoint(gomock.Any(), gomock.Eq(db.SaveOutboxCheckpointParams{Handler: "test", LastTxid: 10, LastEventID: 1})).
+			Times(1).
+			Return(nil),
+		store.EXPECT().
+			SaveOutboxCheckpoint(gomock.Any(), gomock.Eq(db.SaveOutboxCheckpointParams{Handler: "test", LastTxid: 20, LastEventID: 2})).
+			Times(1).
+			Return(nil),
+	)
+
+	var envelopes []Envelope
+	dispatcher := NewDispatcher(store, newTestConfig())
+	dispatcher.Register("test", HandlerFunc(func(ctx context.Context, envelope Envelope) error {
+		envelopes = append(envelopes, envelope)
+		return nil
+	}))
+
+	n, err := dispatcher.DispatchPending(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	require.Len(t, envelopes, 2)
+	require.Equal(t, int64(1), envelopes[0].ID)
+	require.Equal(t, &event1, envelopes[0].Event)
+	require.Equal(t, int64(2), envelopes[1].ID)
+}
+
+func TestDispatchPendingHandlerError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	outboxEvents := []db.OutboxEvent{
+		randomOutboxEvent(t, 11, randomAccountCreated()),
+		randomOutboxEvent(t, 12, randomAccountCreated()),
+		randomOutboxEvent(t, 13, randomAccountCreated()),
+	}
+	checkpoint := db.OutboxCheckpoint{Handler: "failing", LastTxid: 100, LastEventID: 10}
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetOutboxCheckpoint(gomock.Any(), gomock.Eq("failing")).
+		Times(1).
+		Return(checkpoint, nil)
+	store.EXPECT().
+		ListPendingOutboxEvents(gomock.Any(), gomock.Eq(db.ListPendingOutboxEventsParams{
+			LastTxid:    100,
+			LastEventID: 10,
+			BatchSize:   10,
+		})).
+		Times(1).
+		Return(outboxEvents, nil)
+	// The failed event and the ones after it stay pending
+	store.EXPECT().
+		SaveOutboxCheckpoint(gomock.Any(), gomock.Eq(db.SaveOutboxCheckpointParams{Handler: "failing", LastTxid: 110, LastEventID: 11})).
+		Times(1).
+		Return(nil)
+
+	handler := &recordingHandler{failOn: map[int64]bool{12: true}}
+	dispatcher := NewDispatcher(store, newTestConfig())
+	dispatcher.Register("failing", handler)
+
+	n, err := dispatcher.DispatchPending(context.Background())
+	require.Error(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, []int64{11}, handler.handled)
+}
+
+func TestDispatchPendingCheckpointPerHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	outboxEvent := randomOutboxEvent(t, 21, randomAccountCreated())
+
+	// The second handler has already handled the event, so only the first one gets it
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetOutboxCheckpoint(gomock.Any(), gomock.Eq("behind")).
+		Times(1).
+		Return(db.OutboxCheckpoint{Handler: "behind", LastTxid: 200, LastEventID: 20}, nil)
+	store.EXPECT().
+		ListPendingOutboxEvents(gomock.Any(), gomock.Eq(db.ListPendingOutboxEventsParams{LastTxid: 200, LastEventID: 20, BatchSize: 10})).
+		Times(1).
+		Return([]db.OutboxEvent{outboxEvent}, nil)
+	store.EXPECT().
+		SaveOutboxCheckpoint(gomock.Any(), gomock.Eq(db.SaveOutboxCheckpointParams{Handler: "behind", LastTxid: 210, LastEventID: 21})).
+		Times(1).
+		Return(nil)
+	store.EXPECT().
+		GetOutboxCheckpoint(gomock.Any(), gomock.Eq("up_to_date")).
+		Times(1).
+		Return(db.OutboxCheckpoint{Handler: "up_to_date", LastTxid: 210, LastEventID: 21}, nil)
+	store.EXPECT().
+		ListPendingOutboxEvents(gomock.Any(), gomock.Eq(db.ListPendingOutboxEventsParams{LastTxid: 210, LastEventID: 21, BatchSize: 10})).
+		Times(1).
+		Return([]db.OutboxEvent{}, nil)
+
+	behind := &recordingHandler{}
+	upToDate := &recordingHandler{}
+	dispatcher := NewDispatcher(store, newTestConfig())
+	dispatcher.Register("behind", behind)
+	dispatcher.Register("up_to_date", upToDate)
+
+	n, err := dispatcher.DispatchPending(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, []int64{21}, behind.handled)
+	require.Empty(t, upToDate.handled)
+}
+
+func TestDispatchPendingSkipsUnknownEvent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	unknownEvent := db.OutboxEvent{ID: 31, Txid: 310, EventType: "account.deleted", Payload: json.RawMessage(`{}`)}
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetOutboxCheckpoint(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(db.OutboxCheckpoint{}, db.ErrRecordNotFound)
+	store.EXPECT().
+		ListPendingOutboxEvents(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return([]db.OutboxEvent{unknownEvent}, nil)
+	// The handler never sees the event, but the checkpoint moves past it
+	store.EXPECT().
+		SaveOutboxCheckpoint(gomock.Any(), gomock.Eq(db.SaveOutboxCheckpointParams{Handler: "test", LastTxid: 310, LastEventID: 31})).
+		Times(1).
+		Return(nil)
+
+	handler := &recordingHandler{}
+	dispatcher := NewDispatcher(store, newTestConfig())
+	dispatcher.Register("test", handler)
+
+	_, err := dispatcher.DispatchPending(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, handler.handled)
+}
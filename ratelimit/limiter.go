@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Limiter is an interface for token bucket rate limiters
+type Limiter interface {
+	// Allow takes a token from the bucket of the key and reports whether the request can proceed
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// Rate configures a token bucket: it holds up to Burst tokens and is refilled with PerSecond tokens every second
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed bool
+	// RetryAfter is the time after which the next token will be available, it is set only when the request is not allowed
+	RetryAfter time.Duration
+}
+
+func (rate Rate) validate() error {
+	if rate.PerSecond <= 0 {
+		return fmt.Errorf("invalid rate: must be greater than 0")
+	}
+	if rate.Burst < 1 {
+		return fmt.Errorf("invalid burst: must be at least 1")
+	}
+	return nil
+}
+
+// retryAfter returns how long it takes to refill a bucket holding the given number of tokens up to one token
+func (rate Rate) retryAfter(tokens float64) time.Duration {
+	return time.Duration((1 - tokens) / rate.PerSecond * float64(time.Second))
+}
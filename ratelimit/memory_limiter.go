@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/igiai/simplebank/clock"
+)
+
+// cleanupInterval defines how often buckets which are full again are dropped from memory
+const cleanupInterval = time.Minute
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// MemoryLimiter is a rate limiter keeping buckets in the memory of a single server instance
+type MemoryLimiter struct {
+	rate        Rate
+	clock       clock.Clock
+	mu          sync.Mutex
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+}
+
+// NewMemoryLimiter creates a new MemoryLimiter, the buckets are refilled with the time of the clock
+func NewMemoryLimiter(rate Rate, clock clock.Clock) (Limiter, error) {
+	if err := rate.validate(); err != nil {
+		return nil, err
+	}
+
+	limiter := &MemoryLimiter{
+		rate:        rate,
+		clock:       clock,
+		buckets:     make(map[string]*bucket),
+		lastCleanup: clock.Now(),
+	}
+	return limiter, nil
+}
+
+// Allow takes a token from the bucket of the key and reports whether the request can proceed
+func (limiter *MemoryLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	now := limiter.clock.Now()
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	limiter.cleanup(now)
+
+	b, ok := limiter.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limiter.rate.Burst), updatedAt: now}
+		limiter.buckets[key] = b
+	}
+
+	b.tokens = limiter.refill(b, now)
+	b.updatedAt = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return Result{Allowed: true}, nil
+	}
+
+	return Result{Allowed: false, RetryAfter: limiter.rate.retryAfter(b.tokens)}, nil
+}
+
+// refill returns the number of tokens in the bucket at the given time
+func (limiter *MemoryLimiter) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.updatedAt).Seconds()*limiter.rate.PerSecond
+	return math.Min(float64(limiter.rate.Burst), tokens)
+}
+
+// cleanup drops the buckets which are full again, as they behave the same as the buckets that don't exist yet
+func (limiter *MemoryLimiter) cleanup(now time.Time) {
+	if now.Sub(limiter.lastCleanup) < cleanupInterval {
+		return
+	}
+
+	for key, b := range limiter.buckets {
+		if limiter.refill(b, now) >= float64(limiter.rate.Burst) {
+			delete(limiter.buckets, key)
+		}
+	}
+	limiter.lastCleanup = now
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/clock"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	rate := Rate{PerSecond: 10, Burst: 3}
+	clk := clock.NewFake(time.Now())
+	limiter, err := NewMemoryLimiter(rate, clk)
+	require.NoError(t, err)
+
+	key := util.RandomOwner()
+
+	// The bucket starts full, so a burst of requests is allowed at once
+	for i := 0; i < rate.Burst; i++ {
+		result, err := limiter.Allow(context.Background(), key)
+		require.NoError(t, err)
+		require.True(t, result.Allowed)
+		require.Zero(t, result.RetryAfter)
+	}
+
+	result, err := limiter.Allow(context.Background(), key)
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Equal(t, 100*time.Millisecond, result.RetryAfter)
+
+	// Other keys have their own buckets
+	result, err = limiter.Allow(context.Background(), util.RandomOwner())
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+
+	// Once the bucket is refilled with a token, the request is allowed again
+	clk.Advance(99 * time.Millisecond)
+	result, err = limiter.Allow(context.Background(), key)
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+
+	clk.Advance(time.Millisecond)
+	result, err = limiter.Allow(context.Background(), key)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+}
+
+func TestMemoryLimiterCleanup(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	limiter, err := NewMemoryLimiter(Rate{PerSecond: 0.01, Burst: 2}, clk)
+	require.NoError(t, err)
+
+	memoryLimiter := limiter.(*MemoryLimiter)
+	memoryLimiter.buckets["full"] = &bucket{tokens: 2, updatedAt: clk.Now()}
+	memoryLimiter.buckets["empty"] = &bucket{tokens: 0, updatedAt: clk.Now()}
+
+	// The buckets are cleaned up on the first request after the cleanup interval
+	clk.Advance(cleanupInterval)
+	_, err = limiter.Allow(context.Background(), util.RandomOwner())
+	require.NoError(t, err)
+	require.Contains(t, memoryLimiter.buckets, "empty")
+	require.NotContains(t, memoryLimiter.buckets, "full")
+}
+
+func TestInvalidRateForMemoryLimiter(t *testing.T) {
+	limiter, err := NewMemoryLimiter(Rate{PerSecond: 0, Burst: 1}, clock.Real{})
+	require.Error(t, err)
+	require.Nil(t, limiter)
+
+	limiter, err = NewMemoryLimiter(Rate{PerSecond: 1, Burst: 0}, clock.Real{})
+	require.Error(t, err)
+	require.Nil(t, limiter)
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	db "github.com/igiai/simplebank/db/sqlc"
+)
+
+// PostgresLimiter is a rate limiter keeping buckets in the database, so that they are shared by all server instances
+// The limiters share the table, each one is given the keys starting with its own prefix
+type PostgresLimiter struct {
+	rate        Rate
+	store       db.Store
+	keyPrefix   string
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+// NewPostgresLimiter creates a new PostgresLimiter for the keys starting with keyPrefix
+func NewPostgresLimiter(store db.Store, rate Rate, keyPrefix string) (Limiter, error) {
+	if err := rate.validate(); err != nil {
+		return nil, err
+	}
+
+	limiter := &PostgresLimiter{
+		rate:        rate,
+		store:       store,
+		keyPrefix:   keyPrefix,
+		lastCleanup: time.Now(),
+	}
+	return limiter, nil
+}
+
+// Allow takes a token from the bucket of the key and reports whether the request can proceed
+func (limiter *PostgresLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	// The cleanup is only housekeeping, the request is limited all the same when it fails
+	if err := limiter.cleanup(ctx, time.Now()); err != nil {
+		log.Printf("cannot clean up rate limit buckets: %v", err)
+	}
+
+	// The bucket is refilled and a token is taken in a single statement, so concurrent requests cannot take the same token
+	b, err := limiter.store.TakeRateLimitToken(ctx, db.TakeRateLimitTokenParams{
+		Key:       key,
+		Burst:     float64(limiter.rate.Burst),
+		PerSecond: limiter.rate.PerSecond,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	if b.Allowed {
+		return Result{Allowed: true}, nil
+	}
+
+	return Result{Allowed: false, RetryAfter: limiter.rate.retryAfter(b.Tokens)}, nil
+}
+
+// cleanup deletes the buckets which are full again, as they behave the same as the buckets that don't exist yet
+// Without it the table would keep a row for every IP and username ever seen
+// Every instance cleans up on its own, the deletes of concurrent instances don't conflict
+// Only the buckets of the limiter's prefix are deleted, the buckets of other limiters take another time to refill
+func (limiter *PostgresLimiter) cleanup(ctx context.Context, now time.Time) error {
+	limiter.mu.Lock()
+	if now.Sub(limiter.lastCleanup) < cleanupInterval {
+		limiter.mu.Unlock()
+		return nil
+	}
+	limiter.lastCleanup = now
+	limiter.mu.Unlock()
+
+	// An empty bucket is full again once it has been refilled for burst/rate seconds
+	_, err := limiter.store.DeleteFullRateLimitBuckets(ctx, db.DeleteFullRateLimitBucketsParams{
+		KeyPrefix:     limiter.keyPrefix,
+		RefillSeconds: float64(limiter.rate.Burst) / limiter.rate.PerSecond,
+	})
+	return err
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/igiai/simplebank/db/mock"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresLimiter(t *testing.T) {
+	rate := Rate{PerSecond: 2, Burst: 5}
+	key := util.RandomOwner()
+	arg := db.TakeRateLimitTokenParams{
+		Key:       key,
+		Burst:     float64(rate.Burst),
+		PerSecond: rate.PerSecond,
+	}
+
+	testCases := []struct {
+		name        string
+		buildStubs  func(store *mockdb.MockStore)
+		checkResult func(t *testing.T, result Result, err error)
+	}{
+		{
+			name: "Allowed",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					TakeRateLimitToken(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(db.RateLimitBucket{Key: key, Tokens: 3, Allowed: true}, nil)
+			},
+			checkResult: func(t *testing.T, result Result, err error) {
+				require.NoError(t, err)
+				require.True(t, result.Allowed)
+				require.Zero(t, result.RetryAfter)
+			},
+		},
+		{
+			name: "NotAllowed",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					TakeRateLimitToken(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(db.RateLimitBucket{Key: key, Tokens: 0.5, Allowed: false}, nil)
+			},
+			checkResult: func(t *testing.T, result Result, err error) {
+				require.NoError(t, err)
+				require.False(t, result.Allowed)
+				// half of the token is missing and the bucket is refilled with 2 tokens per second
+				require.Equal(t, 250*time.Millisecond, result.RetryAfter)
+			},
+		},
+		{
+			name: "InternalError",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					TakeRateLimitToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.RateLimitBucket{}, sql.ErrConnDone)
+			},
+			checkResult: func(t *testing.T, result Result, err error) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			limiter, err := NewPostgresLimiter(store, rate, "user:")
+			require.NoError(t, err)
+
+			result, err := limiter.Allow(context.Background(), key)
+			tc.checkResult(t, result, err)
+		})
+	}
+}
+
+func TestPostgresLimiterCleanup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	limiter, err := NewPostgresLimiter(store, Rate{PerSecond: 2, Burst: 5}, "user:")
+	require.NoError(t, err)
+
+	// The buckets are cleaned up at most once per interval, a bucket is full again after burst/rate seconds
+	// Only the buckets of the limiter are deleted, the other limiters refill theirs at another rate
+	gomock.InOrder(
+		store.EXPECT().
+			DeleteFullRateLimitBuckets(gomock.Any(), gomock.Eq(db.DeleteFullRateLimitBucketsParams{KeyPrefix: "user:", RefillSeconds: 2.5})).
+			Times(1).
+			Return(int64(3), nil),
+		store.EXPECT().
+			TakeRateLimitToken(gomock.Any(), gomock.Any()).
+			Times(2).
+			Return(db.RateLimitBucket{Tokens: 3, Allowed: true}, nil),
+	)
+
+	limiter.(*PostgresLimiter).lastCleanup = time.Now().Add(-cleanupInterval)
+	for i := 0; i < 2; i++ {
+		result, err := limiter.Allow(context.Background(), util.RandomOwner())
+		require.NoError(t, err)
+		require.True(t, result.Allowed)
+	}
+}
+
+func TestPostgresLimiterCleanupError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	limiter, err := NewPostgresLimiter(store, Rate{PerSecond: 2, Burst: 5}, "user:")
+	require.NoError(t, err)
+
+	// A failed cleanup doesn't fail the request, the bucket is still taken from
+	store.EXPECT().
+		DeleteFullRateLimitBuckets(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(int64(0), sql.ErrConnDone)
+	store.EXPECT().
+		TakeRateLimitToken(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(db.RateLimitBucket{Tokens: 3, Allowed: true}, nil)
+
+	limiter.(*PostgresLimiter).lastCleanup = time.Now().Add(-cleanupInterval)
+	result, err := limiter.Allow(context.Background(), "user:"+util.RandomOwner())
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+}
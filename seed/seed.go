@@ -0,0 +1,230 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+)
+
+// maxPickAttempts bounds the search for a pair of accounts able to make a transfer,
+// once it is exhausted the history ends early as the money has run out
+const maxPickAttempts = 100
+
+var (
+	firstNames = []string{"olivia", "liam", "emma", "noah", "amelia", "oliver", "sophia", "elijah", "mia", "lucas", "ava", "mateo", "isla", "leo", "zoe", "hugo", "maya", "felix", "nora", "oscar"}
+	lastNames  = []string{"smith", "garcia", "muller", "rossi", "kowalski", "dubois", "jansen", "silva", "novak", "larsen", "brown", "tanaka", "kim", "nguyen", "wilson", "martin", "lopez", "weber", "costa", "walsh"}
+)
+
+// Options configure the generated data, the same options give the same data on a fresh db
+type Options struct {
+	// Seed seeds the random choices, every user, account and transfer follows from it
+	Seed int64
+	// Users is the number of users, each of them has an account in one or more of the currencies
+	Users int
+	// Currencies are the currencies the accounts are opened in
+	Currencies []string
+	// MaxBalance is the largest initial balance of an account, the balances spread log-uniformly up to it
+	MaxBalance int64
+	// Transfers is the number of transfers in the history
+	Transfers int
+	// HashedPassword is the password hash every user is created with, so QA can log in as any of them
+	HashedPassword string
+}
+
+// Result lists what was created, the accounts with their balances at the end of the history
+type Result struct {
+	Users     []db.User
+	Accounts  []db.Account
+	Transfers []db.Transfer
+}
+
+// Seed populates the store with users, their accounts and a history of transfers between them
+// Everything is created through the transactions of the store, so the entries, events and notifications are the same as for real traffic
+// The usernames and emails are derived from the seed, so a db is seeded once with a given seed
+func Seed(ctx context.Context, store db.Store, options Options) (Result, error) {
+	if options.Users < 2 {
+		return Result{}, errors.New("at least 2 users are needed for transfers between them")
+	}
+	if len(options.Currencies) == 0 {
+		return Result{}, errors.New("at least 1 currency is needed")
+	}
+	for _, currency := range options.Currencies {
+		if !util.IsSupportedCurrency(currency) {
+			return Result{}, fmt.Errorf("unsupported currency %s", currency)
+		}
+	}
+	if options.MaxBalance < 1 {
+		return Result{}, errors.New("max balance must be positive")
+	}
+	if options.HashedPassword == "" {
+		return Result{}, errors.New("hashed password is required")
+	}
+
+	rng := rand.New(rand.NewSource(options.Seed))
+	var result Result
+
+	for i := 0; i < options.Users; i++ {
+		user, err := createUser(ctx, store, rng, i, options.HashedPassword)
+		if err != nil {
+			return result, err
+		}
+		result.Users = append(result.Users, user)
+
+		// Every user has an account in at least one currency, fewer users have accounts in all of them
+		currencies := make([]string, len(options.Currencies))
+		for j, k := range rng.Perm(len(options.Currencies)) {
+			currencies[j] = options.Currencies[k]
+		}
+		for _, currency := range currencies[:1+rng.Intn(len(currencies))] {
+			created, err := store.CreateAccountTx(ctx, db.CreateAccountTxParams{
+				CreateAccountParams: db.CreateAccountParams{
+					Owner:    user.Username,
+					Balance:  logUniform(rng, 1, options.MaxBalance),
+					Currency: currency,
+				},
+			})
+			if err != nil {
+				return result, fmt.Errorf("cannot create account of %s: %w", user.Username, err)
+			}
+			result.Accounts = append(result.Accounts, created.Account)
+		}
+	}
+
+	history := newHistory(rng, result.Accounts)
+	for len(result.Transfers) < options.Transfers {
+		arg, ok := history.next()
+		if !ok {
+			break
+		}
+
+		transfer, err := store.TransferTX(ctx, arg)
+		if err != nil {
+			return result, fmt.Errorf("cannot transfer from account %d to account %d: %w", arg.FromAccountID, arg.ToAccountID, err)
+		}
+		history.record(transfer)
+		result.Transfers = append(result.Transfers, transfer.Transfer)
+	}
+
+	result.Accounts = history.accounts
+	return result, nil
+}
+
+// createUser creates the i-th user with a name picked from the lists, the index keeps the usernames and emails unique
+// The email is marked as verified, unverified users cannot make transfers
+func createUser(ctx context.Context, store db.Store, rng *rand.Rand, i int, hashedPassword string) (db.User, error) {
+	firstName := firstNames[rng.Intn(len(firstNames))]
+	lastName := lastNames[rng.Intn(len(lastNames))]
+	username := fmt.Sprintf("%s%s%d", firstName, lastName, i+1)
+
+	result, err := store.CreateUserTx(ctx, db.CreateUserTxParams{
+		CreateUserParams: db.CreateUserParams{
+			Username:       username,
+			HashedPassword: hashedPassword,
+			FullName:       capitalize(firstName) + " " + capitalize(lastName),
+			Email:          fmt.Sprintf("%s.%s%d@example.com", firstName, lastName, i+1),
+		},
+	})
+	if err != nil {
+		return db.User{}, fmt.Errorf("cannot create user %s: %w", username, err)
+	}
+
+	return store.VerifyUserEmail(ctx, result.User.Username)
+}
+
+func capitalize(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// history picks the transfers, like in real traffic a few accounts take part in most of them
+// The accounts are ranked by a random permutation and picked with a Zipf distribution over the ranks
+type history struct {
+	rng      *rand.Rand
+	accounts []db.Account
+	// ranked lists the indexes of the accounts of every currency, the most active first
+	ranked map[string][]int
+	// currencies lists the currencies with accounts of at least two owners, in a stable order
+	currencies []string
+	zipfs      map[string]*rand.Zipf
+	indexes    map[int64]int
+}
+
+func newHistory(rng *rand.Rand, accounts []db.Account) *history {
+	h := &history{
+		rng:      rng,
+		accounts: append([]db.Account(nil), accounts...),
+		ranked:   map[string][]int{},
+		zipfs:    map[string]*rand.Zipf{},
+		indexes:  map[int64]int{},
+	}
+
+	for _, i := range rng.Perm(len(accounts)) {
+		currency := accounts[i].Currency
+		if _, ok := h.ranked[currency]; !ok {
+			h.currencies = append(h.currencies, currency)
+		}
+		h.ranked[currency] = append(h.ranked[currency], i)
+		h.indexes[accounts[i].ID] = i
+	}
+
+	// Each owner has a single account of a currency, so two accounts of a currency belong to different owners
+	currencies := h.currencies[:0]
+	for _, currency := range h.currencies {
+		if len(h.ranked[currency]) < 2 {
+			continue
+		}
+		currencies = append(currencies, currency)
+		h.zipfs[currency] = rand.NewZipf(rng, 1.2, 1, uint64(len(h.ranked[currency])-1))
+	}
+	h.currencies = currencies
+	return h
+}
+
+// next picks the accounts and the amount of the next transfer, it returns false when no account has money to send
+// Most transfers are small, the amount spreads log-uniformly up to half of the balance of the sender
+func (h *history) next() (db.TransferTxParams, bool) {
+	if len(h.currencies) == 0 {
+		return db.TransferTxParams{}, false
+	}
+
+	for attempt := 0; attempt < maxPickAttempts; attempt++ {
+		currency := h.currencies[h.rng.Intn(len(h.currencies))]
+		ranked := h.ranked[currency]
+		from := ranked[h.zipfs[currency].Uint64()]
+		to := ranked[h.zipfs[currency].Uint64()]
+		if from == to || h.accounts[from].Balance < 2 {
+			continue
+		}
+
+		return db.TransferTxParams{
+			FromAccountID: h.accounts[from].ID,
+			ToAccountID:   h.accounts[to].ID,
+			Amount:        logUniform(h.rng, 1, h.accounts[from].Balance/2),
+		}, true
+	}
+	return db.TransferTxParams{}, false
+}
+
+// record keeps the balances of the accounts up to date with the transfer
+func (h *history) record(result db.TransferTxResult) {
+	h.accounts[h.indexes[result.FromAccount.ID]] = result.FromAccount
+	h.accounts[h.indexes[result.ToAccount.ID]] = result.ToAccount
+}
+
+// logUniform returns an integer in [min, max] whose logarithm is uniformly distributed,
+// so small values are as frequent as the large ones are rare
+func logUniform(rng *rand.Rand, min int64, max int64) int64 {
+	if max <= min {
+		return min
+	}
+	value := int64(math.Exp(math.Log(float64(min)) + rng.Float64()*(math.Log(float64(max+1))-math.Log(float64(min)))))
+	if value > max {
+		return max
+	}
+	return value
+}
@@ -0,0 +1,174 @@
+package seed
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func testOptions(seed int64) Options {
+	return Options{
+		Seed:           seed,
+		Users:          20,
+		Currencies:     []string{util.USD, util.EUR, util.CAD},
+		MaxBalance:     10000,
+		Transfers:      200,
+		HashedPassword: util.RandomString(32),
+	}
+}
+
+func TestSeed(t *testing.T) {
+	store := db.NewMemoryStore()
+	options := testOptions(1)
+
+	result, err := Seed(context.Background(), store, options)
+	require.NoError(t, err)
+	require.Len(t, result.Users, options.Users)
+	require.Len(t, result.Transfers, options.Transfers)
+	require.GreaterOrEqual(t, len(result.Accounts), options.Users)
+
+	initialTotals := map[string]int64{}
+	finalTotals := map[string]int64{}
+	currencies := map[int64]string{}
+	for _, account := range result.Accounts {
+		storedAccount, err := store.GetAccount(context.Background(), account.ID)
+		require.NoError(t, err)
+		require.Equal(t, storedAccount.Balance, account.Balance)
+		require.GreaterOrEqual(t, account.Balance, int64(0))
+
+		currencies[account.ID] = account.Currency
+		finalTotals[account.Currency] += account.Balance
+	}
+
+	// The transfers move the money between the accounts of a currency, the total of every currency is kept
+	for _, user := range result.Users {
+		require.True(t, user.IsEmailVerified)
+
+		accounts, err := store.ListAccounts(context.Background(), db.ListAccountsParams{Owner: user.Username, Limit: 5})
+		require.NoError(t, err)
+		require.NotEmpty(t, accounts)
+	}
+	for _, transfer := range result.Transfers {
+		require.Equal(t, currencies[transfer.FromAccountID], currencies[transfer.ToAccountID])
+		require.NotEqual(t, transfer.FromAccountID, transfer.ToAccountID)
+		require.Positive(t, transfer.Amount)
+	}
+	for _, account := range result.Accounts {
+		entries, err := store.ListEntries(context.Background(), db.ListEntriesParams{AccountID: account.ID, Limit: int32(options.Transfers)})
+		require.NoError(t, err)
+
+		initialBalance := account.Balance
+		for _, entry := range entries {
+			initialBalance -= entry.Amount
+		}
+		initialTotals[account.Currency] += initialBalance
+	}
+	require.Equal(t, initialTotals, finalTotals)
+
+	// A few accounts take part in most of the transfers
+	transfersByAccount := map[int64]int{}
+	for _, transfer := range result.Transfers {
+		transfersByAccount[transfer.FromAccountID]++
+	}
+	busiest := 0
+	for _, count := range transfersByAccount {
+		busiest = max(busiest, count)
+	}
+	require.Greater(t, busiest, options.Transfers/len(result.Accounts)*3)
+}
+
+func TestSeedIsDeterministic(t *testing.T) {
+	result1, err := Seed(context.Background(), db.NewMemoryStore(), testOptions(42))
+	require.NoError(t, err)
+
+	result2, err := Seed(context.Background(), db.NewMemoryStore(), testOptions(42))
+	require.NoError(t, err)
+
+	result3, err := Seed(context.Background(), db.NewMemoryStore(), testOptions(43))
+	require.NoError(t, err)
+
+	// The stores are fresh, so the ids are the same too, only the creation times differ
+	for i := range result1.Users {
+		require.Equal(t, result1.Users[i].Username, result2.Users[i].Username)
+		require.Equal(t, result1.Users[i].Email, result2.Users[i].Email)
+	}
+	require.Equal(t, len(result1.Accounts), len(result2.Accounts))
+	for i := range result1.Accounts {
+		require.Equal(t, result1.Accounts[i].ID, result2.Accounts[i].ID)
+		require.Equal(t, result1.Accounts[i].Currency, result2.Accounts[i].Currency)
+		require.Equal(t, result1.Accounts[i].Balance, result2.Accounts[i].Balance)
+	}
+	for i := range result1.Transfers {
+		require.Equal(t, result1.Transfers[i].FromAccountID, result2.Transfers[i].FromAccountID)
+		require.Equal(t, result1.Transfers[i].ToAccountID, result2.Transfers[i].ToAccountID)
+		require.Equal(t, result1.Transfers[i].Amount, result2.Transfers[i].Amount)
+	}
+
+	require.NotEqual(t, result1.Users[0].Username+result1.Users[1].Username, result3.Users[0].Username+result3.Users[1].Username)
+}
+
+func TestSeedSameSeedTwice(t *testing.T) {
+	store := db.NewMemoryStore()
+
+	_, err := Seed(context.Background(), store, testOptions(1))
+	require.NoError(t, err)
+
+	_, err = Seed(context.Background(), store, testOptions(1))
+	require.Equal(t, db.UniqueViolation, db.ErrorCode(err))
+}
+
+func TestSeedOptions(t *testing.T) {
+	testCases := []struct {
+		name   string
+		update func(options *Options)
+	}{
+		{
+			name:   "TooFewUsers",
+			update: func(options *Options) { options.Users = 1 },
+		},
+		{
+			name:   "NoCurrencies",
+			update: func(options *Options) { options.Currencies = nil },
+		},
+		{
+			name:   "UnsupportedCurrency",
+			update: func(options *Options) { options.Currencies = []string{util.USD, "GBP"} },
+		},
+		{
+			name:   "NoMaxBalance",
+			update: func(options *Options) { options.MaxBalance = 0 },
+		},
+		{
+			name:   "NoPassword",
+			update: func(options *Options) { options.HashedPassword = "" },
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			options := testOptions(1)
+			tc.update(&options)
+
+			_, err := Seed(context.Background(), db.NewMemoryStore(), options)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLogUniform(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for _, bounds := range [][2]int64{{1, 1}, {1, 2}, {1, 10000}, {5, 7}} {
+		for i := 0; i < 1000; i++ {
+			value := logUniform(rng, bounds[0], bounds[1])
+			require.GreaterOrEqual(t, value, bounds[0])
+			require.LessOrEqual(t, value, bounds[1])
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package stream
+
+import (
+	"encoding/json"
+	"sync"
+
+	db "github.com/igiai/simplebank/db/sqlc"
+)
+
+// constants for the events streamed to the clients
+const (
+	BalanceEvent          = "balance"
+	IncomingTransferEvent = "transfer.incoming"
+	OutgoingTransferEvent = "transfer.outgoing"
+	// ResyncEvent tells the clients that updates may have been lost and they should fetch their accounts again
+	ResyncEvent = "resync"
+)
+
+// Message is a single event sent to a subscriber
+type Message struct {
+	Event string
+	Data  interface{}
+}
+
+// BalanceData is the data of a balance event
+type BalanceData struct {
+	AccountID int64  `json:"account_id"`
+	Balance   int64  `json:"balance"`
+	Currency  string `json:"currency"`
+}
+
+// TransferData is the data of the transfer events, the account is the one of the subscriber
+type TransferData struct {
+	Transfer db.Transfer `json:"transfer"`
+	Account  db.Account  `json:"account"`
+}
+
+// Subscription receives the messages about the accounts of a single user
+type Subscription struct {
+	broker   *Broker
+	username string
+	messages chan Message
+}
+
+// Messages returns the channel of the messages, it is closed when the subscription ends
+// The broker ends the subscriptions of subscribers too slow to keep up, the client is expected to reconnect
+func (subscription *Subscription) Messages() <-chan Message {
+	return subscription.messages
+}
+
+// Close ends the subscription, it is safe to call it more than once
+func (subscription *Subscription) Close() {
+	subscription.broker.mu.Lock()
+	defer subscription.broker.mu.Unlock()
+
+	subscription.broker.remove(subscription)
+}
+
+// Broker fans the transfer notifications out to the subscriptions of the owners of the accounts
+type Broker struct {
+	mu          sync.Mutex
+	bufferSize  int
+	subscribers map[string]map[*Subscription]struct{}
+}
+
+// NewBroker creates a broker buffering up to bufferSize messages for every subscription
+func NewBroker(bufferSize int) *Broker {
+	return &Broker{
+		bufferSize:  bufferSize,
+		subscribers: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe starts a subscription to the updates of the accounts of the user
+func (broker *Broker) Subscribe(username string) *Subscription {
+	subscription := &Subscription{
+		broker:   broker,
+		username: username,
+		messages: make(chan Message, broker.bufferSize),
+	}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	if broker.subscribers[username] == nil {
+		broker.subscribers[username] = make(map[*Subscription]struct{})
+	}
+	broker.subscribers[username][subscription] = struct{}{}
+
+	return subscription
+}
+
+// HandleNotification publishes the transfer of a notification payload
+func (broker *Broker) HandleNotification(payload string) error {
+	var notification db.TransferNotification
+	if err := json.Unmarshal([]byte(payload), &notification); err != nil {
+		return err
+	}
+
+	broker.PublishTransfer(notification)
+	return nil
+}
+
+// PublishTransfer sends the transfer and the new balance of each side to the owner of its account
+// A transfer between two accounts of the same user sends both sides to that user
+func (broker *Broker) PublishTransfer(notification db.TransferNotification) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	broker.send(notification.FromAccount.Owner, Message{
+		Event: OutgoingTransferEvent,
+		Data:  TransferData{Transfer: notification.Transfer, Account: notification.FromAccount},
+	})
+	broker.send(notification.FromAccount.Owner, balanceMessage(notification.FromAccount))
+
+	broker.send(notification.ToAccount.Owner, Message{
+		Event: IncomingTransferEvent,
+		Data:  TransferData{Transfer: notification.Transfer, Account: notification.ToAccount},
+	})
+	broker.send(notification.ToAccount.Owner, balanceMessage(notification.ToAccount))
+}
+
+// Resync tells every subscriber to fetch its accounts again
+func (broker *Broker) Resync() {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	for username := range broker.subscribers {
+		broker.send(username, Message{Event: ResyncEvent, Data: struct{}{}})
+	}
+}
+
+func balanceMessage(account db.Account) Message {
+	return Message{
+		Event: BalanceEvent,
+		Data: BalanceData{
+			AccountID: account.ID,
+			Balance:   account.Balance,
+			Currency:  account.Currency,
+		},
+	}
+}
+
+// send must be called with the lock held
+// It never blocks, a subscriber with a full buffer is dropped instead of holding back the others
+func (broker *Broker) send(username string, message Message) {
+	for subscription := range broker.subscribers[username] {
+		select {
+		case subscription.messages <- message:
+		default:
+			broker.remove(subscription)
+		}
+	}
+}
+
+// remove must be called with the lock held
+func (broker *Broker) remove(subscription *Subscription) {
+	subscriptions := broker.subscribers[subscription.username]
+	if _, ok := subscriptions[subscription]; !ok {
+		return
+	}
+
+	delete(subscriptions, subscription)
+	if len(subscriptions) == 0 {
+		delete(broker.subscribers, subscription.username)
+	}
+	close(subscription.messages)
+}
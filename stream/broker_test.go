@@ -0,0 +1,167 @@
+package stream
+
+import (
+	"encoding/json"
+	"testing"
+
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func randomNotification(fromOwner, toOwner string) db.TransferNotification {
+	currency := util.RandomCurrency()
+	return db.TransferNotification{
+		Transfer: db.Transfer{
+			ID:            util.RandomInt(1, 1000),
+			FromAccountID: 1,
+			ToAccountID:   2,
+			Amount:        util.RandomMoney(),
+		},
+		FromAccount: db.Account{ID: 1, Owner: fromOwner, Balance: util.RandomMoney(), Currency: currency},
+		ToAccount:   db.Account{ID: 2, Owner: toOwner, Balance: util.RandomMoney(), Currency: currency},
+	}
+}
+
+// receive returns the messages already sent to the subscription
+func receive(subscription *Subscription) []Message {
+	var messages []Message
+	for {
+		select {
+		case message, ok := <-subscription.Messages():
+			if !ok {
+				return messages
+			}
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+}
+
+func TestPublishTransfer(t *testing.T) {
+	broker := NewBroker(16)
+
+	sender := broker.Subscribe("sender")
+	defer sender.Close()
+	recipient := broker.Subscribe("recipient")
+	defer recipient.Close()
+	other := broker.Subscribe("other")
+	defer other.Close()
+
+	notification := randomNotification("sender", "recipient")
+	broker.PublishTransfer(notification)
+
+	require.Equal(t, []Message{
+		{Event: OutgoingTransferEvent, Data: TransferData{Transfer: notification.Transfer, Account: notification.FromAccount}},
+		{Event: BalanceEvent, Data: BalanceData{AccountID: 1, Balance: notification.FromAccount.Balance, Currency: notification.FromAccount.Currency}},
+	}, receive(sender))
+
+	require.Equal(t, []Message{
+		{Event: IncomingTransferEvent, Data: TransferData{Transfer: notification.Transfer, Account: notification.ToAccount}},
+		{Event: BalanceEvent, Data: BalanceData{AccountID: 2, Balance: notification.ToAccount.Balance, Currency: notification.ToAccount.Currency}},
+	}, receive(recipient))
+
+	require.Empty(t, receive(other))
+}
+
+func TestPublishTransferBetweenOwnAccounts(t *testing.T) {
+	broker := NewBroker(16)
+
+	subscription := broker.Subscribe("owner")
+	defer subscription.Close()
+
+	broker.PublishTransfer(randomNotification("owner", "owner"))
+
+	messages := receive(subscription)
+	require.Len(t, messages, 4)
+	require.Equal(t, OutgoingTransferEvent, messages[0].Event)
+	require.Equal(t, IncomingTransferEvent, messages[2].Event)
+}
+
+func TestPublishTransferToEverySubscription(t *testing.T) {
+	broker := NewBroker(16)
+
+	// The same user can watch the accounts from several devices
+	subscription1 := broker.Subscribe("sender")
+	defer subscription1.Close()
+	subscription2 := broker.Subscribe("sender")
+	defer subscription2.Close()
+
+	broker.PublishTransfer(randomNotification("sender", "recipient"))
+
+	require.Len(t, receive(subscription1), 2)
+	require.Len(t, receive(subscription2), 2)
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	broker := NewBroker(2)
+
+	slow := broker.Subscribe("sender")
+	defer slow.Close()
+
+	broker.PublishTransfer(randomNotification("sender", "recipient"))
+	broker.PublishTransfer(randomNotification("sender", "recipient"))
+
+	// The buffer held the first transfer, the subscription ended on the second one
+	messages := receive(slow)
+	require.Len(t, messages, 2)
+	_, ok := <-slow.Messages()
+	require.False(t, ok)
+
+	// A new subscription of the user is served again
+	subscription := broker.Subscribe("sender")
+	defer subscription.Close()
+	broker.PublishTransfer(randomNotification("sender", "recipient"))
+	require.Len(t, receive(subscription), 2)
+}
+
+func TestCloseSubscription(t *testing.T) {
+	broker := NewBroker(16)
+
+	subscription := broker.Subscribe("sender")
+	subscription.Close()
+	subscription.Close()
+
+	_, ok := <-subscription.Messages()
+	require.False(t, ok)
+
+	broker.PublishTransfer(randomNotification("sender", "recipient"))
+	require.Empty(t, broker.subscribers)
+}
+
+func TestHandleNotification(t *testing.T) {
+	broker := NewBroker(16)
+
+	subscription := broker.Subscribe("recipient")
+	defer subscription.Close()
+
+	notification := randomNotification("sender", "recipient")
+	payload, err := json.Marshal(notification)
+	require.NoError(t, err)
+
+	err = broker.HandleNotification(string(payload))
+	require.NoError(t, err)
+
+	messages := receive(subscription)
+	require.Len(t, messages, 2)
+	require.Equal(t, notification.Transfer.ID, messages[0].Data.(TransferData).Transfer.ID)
+
+	err = broker.HandleNotification("not json")
+	require.Error(t, err)
+	require.Empty(t, receive(subscription))
+}
+
+func TestResync(t *testing.T) {
+	broker := NewBroker(16)
+
+	subscription1 := broker.Subscribe("user1")
+	defer subscription1.Close()
+	subscription2 := broker.Subscribe("user2")
+	defer subscription2.Close()
+
+	broker.Resync()
+
+	require.Equal(t, []Message{{Event: ResyncEvent, Data: struct{}{}}}, receive(subscription1))
+	require.Equal(t, []Message{{Event: ResyncEvent, Data: struct{}{}}}, receive(subscription2))
+}
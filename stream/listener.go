@@ -0,0 +1,79 @@
+package stream
+
+import (
+	"context"
+	"log"
+	"time"
+
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	minReconnectInterval = 10 * time.Second
+	maxReconnectInterval = time.Minute
+)
+
+// Listen feeds the broker with the transfer notifications of the db until the context is canceled
+// Every server instance listens on its own connection, so a transfer made through any instance
+// reaches the subscribers connected to all of them
+// The connection is kept apart from the pool of the store, it is busy waiting for the notifications all the time
+func Listen(ctx context.Context, dataSource string, broker *Broker) error {
+	conn, err := pgx.Connect(ctx, dataSource)
+	if err != nil {
+		return err
+	}
+
+	for {
+		err = listen(ctx, conn, broker)
+		conn.Close(context.Background())
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("transfer notifications listener: %v", err)
+
+		conn, err = reconnect(ctx, dataSource)
+		if err != nil {
+			return nil
+		}
+		// The notifications sent while the listener was disconnected are lost
+		broker.Resync()
+	}
+}
+
+// listen handles the notifications received on the connection until it fails
+func listen(ctx context.Context, conn *pgx.Conn, broker *Broker) error {
+	_, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{db.TransferNotificationChannel}.Sanitize())
+	if err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := broker.HandleNotification(notification.Payload); err != nil {
+			log.Printf("cannot handle transfer notification: %v", err)
+		}
+	}
+}
+
+// reconnect connects to the db again, waiting longer after every failed attempt
+// It fails only when the context is canceled
+func reconnect(ctx context.Context, dataSource string) (*pgx.Conn, error) {
+	for delay := minReconnectInterval; ; delay = min(2*delay, maxReconnectInterval) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		conn, err := pgx.Connect(ctx, dataSource)
+		if err == nil {
+			return conn, nil
+		}
+		log.Printf("transfer notifications listener cannot reconnect: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package token
+
+import (
+	"fmt"
+
+	"github.com/igiai/simplebank/clock"
+	"github.com/igiai/simplebank/db/util"
+)
+
+// NewMakerFromConfig creates a token maker of the configured type, the server and the admin commands share it
+// Symmetric tokens use the shared keys, public tokens are signed with the private keys and verifiable with the exported public keys
+// The single key of the older config is kept in the keyring under an empty ID, so the tokens it signed stay valid after moving to the keyring,
+// once they have expired it is retired by listing LegacyKeyID in the retired key IDs
+func NewMakerFromConfig(config util.Config, clock clock.Clock) (Maker, error) {
+	keys, err := ParseKeys(config.TokenKeys, config.TokenRetiredKeyIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	legacyKey := config.TokenSymmetricKey
+	switch config.TokenType {
+	case "paseto_v4_public", "jwt_rs256", "jwt_eddsa":
+		legacyKey = config.TokenPrivateKey
+	}
+	if legacyKey != "" {
+		keys = append(keys, LegacyKey(legacyKey, config.TokenRetiredKeyIDs))
+	}
+
+	keyring := Keyring{
+		CurrentID: config.TokenCurrentKeyID,
+		Keys:      keys,
+	}
+
+	policy := ClaimsPolicy{
+		Issuer:   config.TokenIssuer,
+		Audience: config.TokenAudience,
+		Leeway:   config.TokenLeeway,
+		Clock:    clock,
+	}
+
+	switch config.TokenType {
+	case "", "paseto":
+		return NewPasetoKeyringMaker(keyring, policy)
+	case "jwt":
+		return NewJWTKeyringMaker(keyring, policy)
+	case "jwt_rs256":
+		return NewJWTRS256Maker(keyring, policy)
+	case "jwt_eddsa":
+		return NewJWTEdDSAMaker(keyring, policy)
+	case "paseto_v4_public":
+		return NewPasetoV4KeyringMaker(keyring, policy)
+	}
+	return nil, fmt.Errorf("unsupported token type %s", config.TokenType)
+}
@@ -0,0 +1,143 @@
+package token
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/clock"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMakerFromConfig(t *testing.T) {
+	ed25519Key, err := GenerateEd25519Key()
+	require.NoError(t, err)
+
+	rsaKey, err := GenerateRSAKey()
+	require.NoError(t, err)
+
+	privateKeys := map[string]string{
+		"":                 "",
+		"paseto":           "",
+		"jwt":              "",
+		"jwt_rs256":        rsaKey,
+		"jwt_eddsa":        ed25519Key,
+		"paseto_v4_public": ed25519Key,
+	}
+
+	for tokenType, privateKey := range privateKeys {
+		config := util.Config{
+			TokenType:         tokenType,
+			TokenSymmetricKey: util.RandomString(32),
+			TokenPrivateKey:   privateKey,
+		}
+
+		maker, err := NewMakerFromConfig(config, clock.Real{})
+		require.NoError(t, err)
+
+		accessToken, _, err := maker.CreateToken(util.RandomOwner(), time.Minute)
+		require.NoError(t, err)
+
+		_, err = maker.VerifyToken(accessToken)
+		require.NoError(t, err)
+	}
+
+	config := util.Config{
+		TokenType:         "unknown",
+		TokenSymmetricKey: util.RandomString(32),
+	}
+	maker, err := NewMakerFromConfig(config, clock.Real{})
+	require.Error(t, err)
+	require.Nil(t, maker)
+}
+
+func TestNewMakerFromConfigWithKeyring(t *testing.T) {
+	legacyConfig := util.Config{
+		TokenSymmetricKey: util.RandomString(32),
+	}
+
+	legacyMaker, err := NewMakerFromConfig(legacyConfig, clock.Real{})
+	require.NoError(t, err)
+	legacyToken, _, err := legacyMaker.CreateToken(util.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	// The keyring is introduced next to the old key, which keeps its tokens valid until it is removed
+	config := legacyConfig
+	config.TokenKeys = fmt.Sprintf("new:%s,old:%s", util.RandomString(32), util.RandomString(32))
+	config.TokenCurrentKeyID = "new"
+
+	maker, err := NewMakerFromConfig(config, clock.Real{})
+	require.NoError(t, err)
+	_, err = maker.VerifyToken(legacyToken)
+	require.NoError(t, err)
+
+	newToken, _, err := maker.CreateToken(util.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+	_, err = legacyMaker.VerifyToken(newToken)
+	require.Error(t, err)
+
+	// Once its tokens have expired the old key is retired, even though it is still set
+	config.TokenRetiredKeyIDs = LegacyKeyID
+	maker, err = NewMakerFromConfig(config, clock.Real{})
+	require.NoError(t, err)
+	_, err = maker.VerifyToken(legacyToken)
+	require.Error(t, err)
+	_, err = maker.VerifyToken(newToken)
+	require.NoError(t, err)
+
+	// The old key cannot stay current when it is retired
+	config.TokenCurrentKeyID = ""
+	maker, err = NewMakerFromConfig(config, clock.Real{})
+	require.Error(t, err)
+	require.Nil(t, maker)
+
+	config.TokenCurrentKeyID = "new"
+	config.TokenRetiredKeyIDs = ""
+	config.TokenSymmetricKey = ""
+	maker, err = NewMakerFromConfig(config, clock.Real{})
+	require.NoError(t, err)
+	_, err = maker.VerifyToken(legacyToken)
+	require.Error(t, err)
+	_, err = maker.VerifyToken(newToken)
+	require.NoError(t, err)
+
+	config.TokenRetiredKeyIDs = "new"
+	maker, err = NewMakerFromConfig(config, clock.Real{})
+	require.Error(t, err)
+	require.Nil(t, maker)
+
+	config.TokenKeys = "invalid"
+	maker, err = NewMakerFromConfig(config, clock.Real{})
+	require.Error(t, err)
+	require.Nil(t, maker)
+}
+
+func TestNewMakerFromConfigWithClaimsPolicy(t *testing.T) {
+	config := util.Config{
+		TokenSymmetricKey: util.RandomString(32),
+		TokenIssuer:       "simplebank",
+		TokenAudience:     "simplebank-api",
+	}
+
+	maker, err := NewMakerFromConfig(config, clock.Real{})
+	require.NoError(t, err)
+
+	accessToken, _, err := maker.CreateToken(util.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	payload, err := maker.VerifyToken(accessToken)
+	require.NoError(t, err)
+	require.Equal(t, config.TokenIssuer, payload.Issuer)
+	require.Equal(t, config.TokenAudience, payload.Audience)
+
+	// Another environment sharing the key by mistake still can't have its tokens accepted
+	otherConfig := config
+	otherConfig.TokenIssuer = "simplebank-staging"
+
+	otherMaker, err := NewMakerFromConfig(otherConfig, clock.Real{})
+	require.NoError(t, err)
+
+	_, err = otherMaker.VerifyToken(accessToken)
+	require.EqualError(t, err, ErrInvalidToken.Error())
+}
@@ -0,0 +1,202 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// minRSAKeyBits is the smallest RSA key accepted for signing tokens
+const minRSAKeyBits = 2048
+
+// JWTAsymmetricMaker is a JSON Web Token maker which signs tokens with a private key
+// The public keys are published as a JSON Web Key Set, so other services can verify the tokens without being able to mint them
+type JWTAsymmetricMaker struct {
+	method       jwt.SigningMethod
+	policy       ClaimsPolicy
+	currentKeyID string
+	privateKey   crypto.Signer
+	// publicKeys are the keys which are not retired by their IDs
+	publicKeys map[string]crypto.PublicKey
+}
+
+// JSONWebKey is a public key in the JWK format of RFC 7517
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid,omitempty"`
+	// N and E are the modulus and the exponent of RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and X are the curve and the public key of Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// NewJWTRS256Maker creates a new JWTAsymmetricMaker signing tokens with RS256
+// The secrets of the keys are base64 encoded PKCS #1 or PKCS #8 private keys, i.e. the body of a PEM block
+func NewJWTRS256Maker(keyring Keyring, policy ClaimsPolicy) (Maker, error) {
+	return newJWTAsymmetricMaker(jwt.SigningMethodRS256, keyring, policy, parseRSAPrivateKey)
+}
+
+// NewJWTEdDSAMaker creates a new JWTAsymmetricMaker signing tokens with EdDSA
+// The secrets of the keys are hex encoded Ed25519 seeds
+func NewJWTEdDSAMaker(keyring Keyring, policy ClaimsPolicy) (Maker, error) {
+	return newJWTAsymmetricMaker(jwt.SigningMethodEdDSA, keyring, policy, parseEd25519Seed)
+}
+
+func newJWTAsymmetricMaker(method jwt.SigningMethod, keyring Keyring, policy ClaimsPolicy, parseKey func(secret string) (crypto.Signer, error)) (Maker, error) {
+	keys, err := keyring.activeKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	maker := &JWTAsymmetricMaker{
+		method:       method,
+		policy:       policy,
+		currentKeyID: keyring.CurrentID,
+		publicKeys:   make(map[string]crypto.PublicKey, len(keys)),
+	}
+
+	for id, secret := range keys {
+		privateKey, err := parseKey(secret)
+		if err != nil {
+			return nil, err
+		}
+
+		maker.publicKeys[id] = privateKey.Public()
+		if id == keyring.CurrentID {
+			maker.privateKey = privateKey
+		}
+	}
+	return maker, nil
+}
+
+// CreateToken creates new token for a specific username and duration
+func (maker *JWTAsymmetricMaker) CreateToken(username string, duration time.Duration) (string, *Payload, error) {
+	claims, payload, err := newJWTPayload(maker.policy, username, duration)
+	if err != nil {
+		return "", nil, err
+	}
+
+	jwtToken := jwt.NewWithClaims(maker.method, claims)
+	if maker.currentKeyID != "" {
+		jwtToken.Header["kid"] = maker.currentKeyID
+	}
+	token, err := jwtToken.SignedString(maker.privateKey)
+	return token, payload, err
+}
+
+// VerifyToken checks if the token is valid or not
+func (maker *JWTAsymmetricMaker) VerifyToken(token string) (*Payload, error) {
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		// Only the algorithm of the maker is accepted, otherwise the public key could be used as an HMAC secret
+		if token.Method.Alg() != maker.method.Alg() {
+			return nil, ErrInvalidToken
+		}
+
+		keyID, _ := token.Header["kid"].(string)
+		publicKey, ok := maker.publicKeys[keyID]
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		return publicKey, nil
+	}
+
+	// The claims are validated below with the leeway and the expected issuer and audience
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	jwtToken, err := parser.ParseWithClaims(token, &jwtClaims{}, keyFunc)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return parseJWTClaims(jwtToken, maker.policy)
+}
+
+// JSONWebKeys returns the public keys which are not retired in the JWK format
+func (maker *JWTAsymmetricMaker) JSONWebKeys() []JSONWebKey {
+	keys := make([]JSONWebKey, 0, len(maker.publicKeys))
+	for id, publicKey := range maker.publicKeys {
+		key := JSONWebKey{
+			Use:       "sig",
+			Algorithm: maker.method.Alg(),
+			KeyID:     id,
+		}
+
+		switch publicKey := publicKey.(type) {
+		case *rsa.PublicKey:
+			key.KeyType = "RSA"
+			key.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			key.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			key.KeyType = "OKP"
+			key.Curve = "Ed25519"
+			key.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// GenerateRSAKey generates a new base64 encoded PKCS #8 RSA private key accepted by NewJWTRS256Maker
+func GenerateRSAKey() (string, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+func parseRSAPrivateKey(secret string) (crypto.Signer, error) {
+	der, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+
+	privateKey, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		key, pkcs8Err := x509.ParsePKCS8PrivateKey(der)
+		if pkcs8Err != nil {
+			return nil, fmt.Errorf("invalid private key: %w", pkcs8Err)
+		}
+
+		var ok bool
+		privateKey, ok = key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("invalid private key: not an RSA key")
+		}
+	}
+
+	if privateKey.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("invalid key size: must be at least %d bits", minRSAKeyBits)
+	}
+	return privateKey, nil
+}
+
+func parseEd25519Seed(secret string) (crypto.Signer, error) {
+	seed, err := hex.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid key size: must be exactly %d bytes long", ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
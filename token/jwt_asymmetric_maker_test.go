@@ -0,0 +1,200 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+// asymmetricJWTMakers are the constructors of the asymmetric JWT makers together with a generator of their secrets
+var asymmetricJWTMakers = []struct {
+	name      string
+	alg       string
+	newMaker  func(keyring Keyring, policy ClaimsPolicy) (Maker, error)
+	newSecret func() (string, error)
+}{
+	{
+		name:      "RS256",
+		alg:       "RS256",
+		newMaker:  NewJWTRS256Maker,
+		newSecret: GenerateRSAKey,
+	},
+	{
+		name:      "EdDSA",
+		alg:       "EdDSA",
+		newMaker:  NewJWTEdDSAMaker,
+		newSecret: GenerateEd25519Key,
+	},
+}
+
+func newTestAsymmetricJWTMaker(t *testing.T, newMaker func(keyring Keyring, policy ClaimsPolicy) (Maker, error), newSecret func() (string, error)) *JWTAsymmetricMaker {
+	secret, err := newSecret()
+	require.NoError(t, err)
+
+	maker, err := newMaker(Keyring{CurrentID: "current", Keys: []Key{{ID: "current", Secret: secret}}}, ClaimsPolicy{})
+	require.NoError(t, err)
+	return maker.(*JWTAsymmetricMaker)
+}
+
+func TestJWTAsymmetricMaker(t *testing.T) {
+	for _, tc := range asymmetricJWTMakers {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			maker := newTestAsymmetricJWTMaker(t, tc.newMaker, tc.newSecret)
+
+			username := util.RandomOwner()
+			duration := time.Minute
+
+			issuedAt := time.Now()
+			expiredAt := time.Now().Add(duration)
+
+			token, _, err := maker.CreateToken(username, duration)
+			require.NoError(t, err)
+			require.NotEmpty(t, token)
+
+			payload, err := maker.VerifyToken(token)
+			require.NoError(t, err)
+			require.NotEmpty(t, payload)
+
+			require.NotZero(t, payload.ID)
+			require.Equal(t, username, payload.Username)
+			require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
+			require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
+
+			parsed, _, err := new(jwt.Parser).ParseUnverified(token, &jwtClaims{})
+			require.NoError(t, err)
+			require.Equal(t, tc.alg, parsed.Header["alg"])
+			require.Equal(t, "current", parsed.Header["kid"])
+		})
+	}
+}
+
+func TestExpiredJWTAsymmetricToken(t *testing.T) {
+	for _, tc := range asymmetricJWTMakers {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			maker := newTestAsymmetricJWTMaker(t, tc.newMaker, tc.newSecret)
+
+			token, _, err := maker.CreateToken(util.RandomOwner(), -time.Minute)
+			require.NoError(t, err)
+
+			payload, err := maker.VerifyToken(token)
+			require.EqualError(t, err, ErrExpiredToken.Error())
+			require.Nil(t, payload)
+		})
+	}
+}
+
+func TestInvalidJWTAsymmetricToken(t *testing.T) {
+	for _, tc := range asymmetricJWTMakers {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			maker := newTestAsymmetricJWTMaker(t, tc.newMaker, tc.newSecret)
+			otherMaker := newTestAsymmetricJWTMaker(t, tc.newMaker, tc.newSecret)
+
+			payload, err := NewPayload(util.RandomOwner(), time.Minute)
+			require.NoError(t, err)
+
+			noneToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, newJWTClaims(payload)).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			require.NoError(t, err)
+
+			// An HMAC token with the public key as the secret must not pass as a token of the maker
+			hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, newJWTClaims(payload))
+			hmacToken.Header["kid"] = "current"
+			hmacTokenString, err := hmacToken.SignedString([]byte(util.RandomString(32)))
+			require.NoError(t, err)
+
+			otherToken, _, err := otherMaker.CreateToken(util.RandomOwner(), time.Minute)
+			require.NoError(t, err)
+
+			for _, token := range []string{noneToken, hmacTokenString, otherToken} {
+				payload, err := maker.VerifyToken(token)
+				require.EqualError(t, err, ErrInvalidToken.Error())
+				require.Nil(t, payload)
+			}
+		})
+	}
+}
+
+func TestJSONWebKeys(t *testing.T) {
+	for _, tc := range asymmetricJWTMakers {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			maker := newTestAsymmetricJWTMaker(t, tc.newMaker, tc.newSecret)
+
+			username := util.RandomOwner()
+			token, _, err := maker.CreateToken(username, time.Minute)
+			require.NoError(t, err)
+
+			keys := maker.JSONWebKeys()
+			require.Len(t, keys, 1)
+			require.Equal(t, "current", keys[0].KeyID)
+			require.Equal(t, tc.alg, keys[0].Algorithm)
+			require.Equal(t, "sig", keys[0].Use)
+
+			// The token is verified with the key rebuilt only from its JWK, and its times with the checks of the library
+			publicKey := publicKeyFromJWK(t, keys[0])
+			jwtToken, err := jwt.ParseWithClaims(token, &jwtClaims{}, func(token *jwt.Token) (interface{}, error) {
+				return publicKey, nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, username, jwtToken.Claims.(*jwtClaims).Username)
+		})
+	}
+}
+
+func TestInvalidKeyForJWTAsymmetricMaker(t *testing.T) {
+	ed25519Key, err := GenerateEd25519Key()
+	require.NoError(t, err)
+
+	// A 1024 bit RSA key in PKCS #1 is parsed but too short
+	shortRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	shortKey := base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PrivateKey(shortRSAKey))
+
+	for _, secret := range []string{ed25519Key, shortKey, "not base64"} {
+		maker, err := NewJWTRS256Maker(Keyring{Keys: []Key{{Secret: secret}}}, ClaimsPolicy{})
+		require.Error(t, err)
+		require.Nil(t, maker)
+	}
+
+	rsaKey, err := GenerateRSAKey()
+	require.NoError(t, err)
+
+	for _, secret := range []string{rsaKey, util.RandomString(64)} {
+		maker, err := NewJWTEdDSAMaker(Keyring{Keys: []Key{{Secret: secret}}}, ClaimsPolicy{})
+		require.Error(t, err)
+		require.Nil(t, maker)
+	}
+}
+
+func publicKeyFromJWK(t *testing.T, key JSONWebKey) interface{} {
+	switch key.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		require.NoError(t, err)
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		require.NoError(t, err)
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "OKP":
+		require.Equal(t, "Ed25519", key.Curve)
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		require.NoError(t, err)
+		return ed25519.PublicKey(x)
+	}
+	t.Fatalf("unexpected key type %s", key.KeyType)
+	return nil
+}
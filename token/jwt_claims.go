@@ -0,0 +1,86 @@
+package token
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+// jwtClaims is the payload as it is put in JWTs, the times are the registered claims in seconds since the epoch,
+// so other JWT libraries can check the expiry of the tokens
+type jwtClaims struct {
+	jwt.StandardClaims
+	Username string `json:"username"`
+}
+
+func newJWTClaims(payload *Payload) *jwtClaims {
+	return &jwtClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        payload.ID.String(),
+			Issuer:    payload.Issuer,
+			Audience:  payload.Audience,
+			IssuedAt:  payload.IssuedAt.Unix(),
+			NotBefore: payload.NotBefore.Unix(),
+			ExpiresAt: payload.ExpiredAt.Unix(),
+		},
+		Username: payload.Username,
+	}
+}
+
+// payload converts the claims back, the times are only as precise as the second
+func (claims *jwtClaims) payload() (*Payload, error) {
+	tokenID, err := uuid.Parse(claims.Id)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	payload := &Payload{
+		ID:        tokenID,
+		Username:  claims.Username,
+		Issuer:    claims.Issuer,
+		Audience:  claims.Audience,
+		IssuedAt:  time.Unix(claims.IssuedAt, 0),
+		ExpiredAt: time.Unix(claims.ExpiresAt, 0),
+	}
+	if claims.NotBefore != 0 {
+		payload.NotBefore = time.Unix(claims.NotBefore, 0)
+	}
+	return payload, nil
+}
+
+// newJWTPayload creates a new payload for a JWT, its times are truncated to the second like in the token,
+// so the payload returned with a token is the same as the one it is verified to
+func newJWTPayload(policy ClaimsPolicy, username string, duration time.Duration) (*jwtClaims, *Payload, error) {
+	payload, err := newPolicyPayload(policy, username, duration)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims := newJWTClaims(payload)
+	payload, err = claims.payload()
+	if err != nil {
+		return nil, nil, err
+	}
+	return claims, payload, nil
+}
+
+// parseJWTClaims extracts the payload from the claims of a parsed token and validates it against the policy
+func parseJWTClaims(jwtToken *jwt.Token, policy ClaimsPolicy) (*Payload, error) {
+	claims, ok := jwtToken.Claims.(*jwtClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := claims.payload()
+	if err != nil {
+		return nil, err
+	}
+
+	err = payload.validate(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
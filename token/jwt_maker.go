@@ -1,7 +1,6 @@
 package token
 
 import (
-	"errors"
 	"fmt"
 	"time"
 
@@ -12,28 +11,48 @@ const minSecretKeySize = 32
 
 // JWTMaker is a JSON Web Token maker
 type JWTMaker struct {
-	secretKey string
+	policy       ClaimsPolicy
+	currentKeyID string
+	// secretKeys are the keys which are not retired by their IDs
+	secretKeys map[string]string
 }
 
 // NewJWTMaker creates a new JWTMaker
 // Here we return Maker interface not the JWTMaker struct itself to ensure that
 // JWTMaker implements Maker interface
 func NewJWTMaker(secretKey string) (Maker, error) {
-	if len(secretKey) < minSecretKeySize {
-		return nil, fmt.Errorf("invalid key size: must be at least %d characters", minSecretKeySize)
+	return NewJWTKeyringMaker(Keyring{Keys: []Key{{Secret: secretKey}}}, ClaimsPolicy{})
+}
+
+// NewJWTKeyringMaker creates a new JWTMaker which signs tokens with the current key of the keyring
+// The ID of the key is put in the kid header of the token, tokens without it are checked with the key with an empty ID
+func NewJWTKeyringMaker(keyring Keyring, policy ClaimsPolicy) (Maker, error) {
+	keys, err := keyring.activeKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, secretKey := range keys {
+		if len(secretKey) < minSecretKeySize {
+			return nil, fmt.Errorf("invalid key size: must be at least %d characters", minSecretKeySize)
+		}
 	}
-	return &JWTMaker{secretKey}, nil
+	return &JWTMaker{policy: policy, currentKeyID: keyring.CurrentID, secretKeys: keys}, nil
 }
 
 // CreateToken creates new token for a specific username and duration
-func (maker *JWTMaker) CreateToken(username string, duration time.Duration) (string, error) {
-	payload, err := NewPayload(username, duration)
+func (maker *JWTMaker) CreateToken(username string, duration time.Duration) (string, *Payload, error) {
+	claims, payload, err := newJWTPayload(maker.policy, username, duration)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
-	return jwtToken.SignedString([]byte(maker.secretKey))
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if maker.currentKeyID != "" {
+		jwtToken.Header["kid"] = maker.currentKeyID
+	}
+	token, err := jwtToken.SignedString([]byte(maker.secretKeys[maker.currentKeyID]))
+	return token, payload, err
 }
 
 // VerifyToken checks if the token is valid or not
@@ -51,26 +70,25 @@ func (maker *JWTMaker) VerifyToken(token string) (*Payload, error) {
 		if !ok {
 			return nil, ErrInvalidToken
 		}
-		return []byte(maker.secretKey), nil
+
+		// The header is signed together with the claims, so the key ID can't be swapped
+		keyID, _ := token.Header["kid"].(string)
+		secretKey, ok := maker.secretKeys[keyID]
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		return []byte(secretKey), nil
 	}
 
 	// Parsing is a process of extracting information from a string, so in this case a token string is split into 3 parts
 	// as JWT token is composed of 3 parts, that is already parsing and then information will be extracted from these parts
-	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keyFunc)
+	// The Valid method of Payload knows nothing about the leeway and the expected issuer and audience,
+	// so the parser only checks the signature and the claims are validated below
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	jwtToken, err := parser.ParseWithClaims(token, &jwtClaims{}, keyFunc)
 	if err != nil {
-		// Inside the ParseWithClaims method a Valid method on Payload is called and if it returns an error it is embedded in
-		// jwt.ValidationError and not returned explicitly, so we have to extract it here
-		verr, ok := err.(*jwt.ValidationError)
-		if ok && errors.Is(verr.Inner, ErrExpiredToken) {
-			return nil, ErrExpiredToken
-		}
-		return nil, ErrInvalidToken
-	}
-
-	payload, ok := jwtToken.Claims.(*Payload)
-	if !ok {
 		return nil, ErrInvalidToken
 	}
 
-	return payload, nil
+	return parseJWTClaims(jwtToken, maker.policy)
 }
@@ -19,9 +19,10 @@ func TestJWTMaker(t *testing.T) {
 	issuedAt := time.Now()
 	expiredAt := time.Now().Add(duration)
 
-	token, err := maker.CreateToken(username, duration)
+	token, createdPayload, err := maker.CreateToken(username, duration)
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
+	require.NotEmpty(t, createdPayload)
 
 	payload, err := maker.VerifyToken(token)
 	require.NoError(t, err)
@@ -31,13 +32,33 @@ func TestJWTMaker(t *testing.T) {
 	require.Equal(t, username, payload.Username)
 	require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
 	require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
+	require.Equal(t, createdPayload.ID, payload.ID)
+	require.True(t, createdPayload.ExpiredAt.Equal(payload.ExpiredAt))
+}
+
+func TestJWTRegisteredTimeClaims(t *testing.T) {
+	maker, err := NewJWTMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	token, payload, err := maker.CreateToken(util.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	// The times are numbers of seconds, like other JWT libraries expect them
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(token, claims)
+	require.NoError(t, err)
+	require.Equal(t, float64(payload.IssuedAt.Unix()), claims["iat"])
+	require.Equal(t, float64(payload.NotBefore.Unix()), claims["nbf"])
+	require.Equal(t, float64(payload.ExpiredAt.Unix()), claims["exp"])
+	require.Equal(t, payload.ID.String(), claims["jti"])
+	require.NoError(t, claims.Valid())
 }
 
 func TestExpiredJWTToken(t *testing.T) {
 	maker, err := NewJWTMaker(util.RandomString(32))
 	require.NoError(t, err)
 
-	token, err := maker.CreateToken(util.RandomOwner(), -time.Minute)
+	token, _, err := maker.CreateToken(util.RandomOwner(), -time.Minute)
 	require.NoError(t, err)
 
 	payload, err := maker.VerifyToken(token)
@@ -52,7 +73,7 @@ func TestInvalidJWTTokenAlgNone(t *testing.T) {
 	payload, err := NewPayload(util.RandomOwner(), time.Minute)
 	require.NoError(t, err)
 
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodNone, payload)
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodNone, newJWTClaims(payload))
 	// Here we cannot use any string as a secret to sign the token because go forbid using SigningMethodNone
 	// for normal purposes, it can be only used for testing and then it needs to be used with UnsafeAllowNoneSignatureType as secret
 	token, err := jwtToken.SignedString(jwt.UnsafeAllowNoneSignatureType)
@@ -0,0 +1,101 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Key is a key of a keyring, its ID is embedded in the tokens it signs
+// Secret is interpreted by the maker, e.g. a symmetric key or a hex encoded Ed25519 seed
+type Key struct {
+	ID      string
+	Secret  string
+	Retired bool
+}
+
+// LegacyKeyID stands for the single key of the older config in the retired key IDs
+// The key itself has an empty ID, as the tokens it signed carry none
+const LegacyKeyID = "legacy"
+
+// Keyring holds the keys of a token maker
+// New tokens are signed with the current key while tokens signed with any other key which is not retired are still accepted,
+// so a key can be rotated without logging everyone out
+type Keyring struct {
+	CurrentID string
+	Keys      []Key
+}
+
+// pasetoFooter is the footer of PASETO tokens, it carries the ID of the signing key
+type pasetoFooter struct {
+	KeyID string `json:"kid"`
+}
+
+// activeKeys validates the keyring and returns the secrets of the keys which are not retired by their IDs
+func (keyring Keyring) activeKeys() (map[string]string, error) {
+	keys := make(map[string]string, len(keyring.Keys))
+	seen := make(map[string]bool, len(keyring.Keys))
+
+	for _, key := range keyring.Keys {
+		if seen[key.ID] {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		seen[key.ID] = true
+
+		if !key.Retired {
+			keys[key.ID] = key.Secret
+		}
+	}
+
+	if _, ok := keys[keyring.CurrentID]; !ok {
+		return nil, fmt.Errorf("current key %q is missing from the keyring or retired", keyring.CurrentID)
+	}
+	return keys, nil
+}
+
+// ParseKeys parses keys in the id:secret,id:secret format of the config
+// The secret is everything after the first colon, the IDs listed in retiredIDs are marked as retired
+func ParseKeys(spec string, retiredIDs string) ([]Key, error) {
+	retired := parseRetiredIDs(retiredIDs)
+
+	var keys []Key
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, errors.New("invalid key format: must be id:secret")
+		}
+		if id == LegacyKeyID {
+			return nil, fmt.Errorf("key id %q is reserved for the key of the older config", LegacyKeyID)
+		}
+
+		keys = append(keys, Key{
+			ID:      id,
+			Secret:  secret,
+			Retired: retired[id],
+		})
+	}
+	return keys, nil
+}
+
+// LegacyKey returns the single key of the older config, retired when retiredIDs lists LegacyKeyID
+func LegacyKey(secret string, retiredIDs string) Key {
+	return Key{
+		Secret:  secret,
+		Retired: parseRetiredIDs(retiredIDs)[LegacyKeyID],
+	}
+}
+
+func parseRetiredIDs(retiredIDs string) map[string]bool {
+	retired := make(map[string]bool)
+	for _, id := range strings.Split(retiredIDs, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			retired[id] = true
+		}
+	}
+	return retired
+}
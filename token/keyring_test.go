@@ -0,0 +1,188 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+// keyringMakers are the constructors of the makers supporting keyrings together with a generator of their secrets
+var keyringMakers = []struct {
+	name      string
+	newMaker  func(keyring Keyring, policy ClaimsPolicy) (Maker, error)
+	newSecret func(t *testing.T) string
+}{
+	{
+		name:      "Paseto",
+		newMaker:  NewPasetoKeyringMaker,
+		newSecret: func(t *testing.T) string { return util.RandomString(32) },
+	},
+	{
+		name:      "JWT",
+		newMaker:  NewJWTKeyringMaker,
+		newSecret: func(t *testing.T) string { return util.RandomString(32) },
+	},
+	{
+		name:     "JWTRS256",
+		newMaker: NewJWTRS256Maker,
+		newSecret: func(t *testing.T) string {
+			key, err := GenerateRSAKey()
+			require.NoError(t, err)
+			return key
+		},
+	},
+	{
+		name:     "JWTEdDSA",
+		newMaker: NewJWTEdDSAMaker,
+		newSecret: func(t *testing.T) string {
+			key, err := GenerateEd25519Key()
+			require.NoError(t, err)
+			return key
+		},
+	},
+	{
+		name:     "PasetoV4",
+		newMaker: NewPasetoV4KeyringMaker,
+		newSecret: func(t *testing.T) string {
+			key, err := GenerateEd25519Key()
+			require.NoError(t, err)
+			return key
+		},
+	},
+}
+
+func TestKeyRotation(t *testing.T) {
+	for _, tc := range keyringMakers {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			legacyKey := Key{Secret: tc.newSecret(t)}
+			oldKey := Key{ID: "old", Secret: tc.newSecret(t)}
+			newKey := Key{ID: "new", Secret: tc.newSecret(t)}
+
+			legacyMaker, err := tc.newMaker(Keyring{Keys: []Key{legacyKey}}, ClaimsPolicy{})
+			require.NoError(t, err)
+			legacyToken, _, err := legacyMaker.CreateToken(util.RandomOwner(), time.Minute)
+			require.NoError(t, err)
+
+			oldMaker, err := tc.newMaker(Keyring{CurrentID: oldKey.ID, Keys: []Key{oldKey, legacyKey}}, ClaimsPolicy{})
+			require.NoError(t, err)
+			oldToken, _, err := oldMaker.CreateToken(util.RandomOwner(), time.Minute)
+			require.NoError(t, err)
+
+			// After the rotation tokens are signed with the new key while the ones signed with the old key are still accepted
+			rotatedMaker, err := tc.newMaker(Keyring{CurrentID: newKey.ID, Keys: []Key{newKey, oldKey, legacyKey}}, ClaimsPolicy{})
+			require.NoError(t, err)
+			newToken, _, err := rotatedMaker.CreateToken(util.RandomOwner(), time.Minute)
+			require.NoError(t, err)
+
+			for _, token := range []string{legacyToken, oldToken, newToken} {
+				_, err = rotatedMaker.VerifyToken(token)
+				require.NoError(t, err)
+			}
+
+			_, err = oldMaker.VerifyToken(newToken)
+			require.EqualError(t, err, ErrInvalidToken.Error())
+
+			// Once the old keys are retired their tokens are rejected
+			oldKey.Retired = true
+			legacyKey.Retired = true
+			retiredMaker, err := tc.newMaker(Keyring{CurrentID: newKey.ID, Keys: []Key{newKey, oldKey, legacyKey}}, ClaimsPolicy{})
+			require.NoError(t, err)
+
+			_, err = retiredMaker.VerifyToken(newToken)
+			require.NoError(t, err)
+
+			for _, token := range []string{legacyToken, oldToken} {
+				payload, err := retiredMaker.VerifyToken(token)
+				require.EqualError(t, err, ErrInvalidToken.Error())
+				require.Nil(t, payload)
+			}
+		})
+	}
+}
+
+func TestSameKeyUnderOtherID(t *testing.T) {
+	for _, tc := range keyringMakers {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			secret := tc.newSecret(t)
+
+			maker, err := tc.newMaker(Keyring{CurrentID: "a", Keys: []Key{{ID: "a", Secret: secret}}}, ClaimsPolicy{})
+			require.NoError(t, err)
+			token, _, err := maker.CreateToken(util.RandomOwner(), time.Minute)
+			require.NoError(t, err)
+
+			// The key ID is a part of the signed data, so it has to match the one the token was signed under
+			otherMaker, err := tc.newMaker(Keyring{CurrentID: "b", Keys: []Key{{ID: "b", Secret: secret}}}, ClaimsPolicy{})
+			require.NoError(t, err)
+
+			payload, err := otherMaker.VerifyToken(token)
+			require.EqualError(t, err, ErrInvalidToken.Error())
+			require.Nil(t, payload)
+		})
+	}
+}
+
+func TestInvalidKeyring(t *testing.T) {
+	secret := util.RandomString(32)
+
+	testCases := []struct {
+		name    string
+		keyring Keyring
+	}{
+		{
+			name:    "MissingCurrentKey",
+			keyring: Keyring{CurrentID: "b", Keys: []Key{{ID: "a", Secret: secret}}},
+		},
+		{
+			name:    "RetiredCurrentKey",
+			keyring: Keyring{CurrentID: "a", Keys: []Key{{ID: "a", Secret: secret, Retired: true}}},
+		},
+		{
+			name:    "DuplicateKeyID",
+			keyring: Keyring{CurrentID: "a", Keys: []Key{{ID: "a", Secret: secret}, {ID: "a", Secret: secret}}},
+		},
+		{
+			name:    "InvalidKeySize",
+			keyring: Keyring{CurrentID: "a", Keys: []Key{{ID: "a", Secret: secret}, {ID: "b", Secret: util.RandomString(16)}}},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			maker, err := NewPasetoKeyringMaker(tc.keyring, ClaimsPolicy{})
+			require.Error(t, err)
+			require.Nil(t, maker)
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys(" 2024-01:first:secret , 2023-06:second ", "2023-06")
+	require.NoError(t, err)
+	require.Equal(t, []Key{
+		{ID: "2024-01", Secret: "first:secret"},
+		{ID: "2023-06", Secret: "second", Retired: true},
+	}, keys)
+
+	keys, err = ParseKeys("", "")
+	require.NoError(t, err)
+	require.Empty(t, keys)
+
+	for _, spec := range []string{"secret", ":secret", "id:", LegacyKeyID + ":secret"} {
+		keys, err = ParseKeys(spec, "")
+		require.Error(t, err)
+		require.Nil(t, keys)
+	}
+}
+
+func TestLegacyKey(t *testing.T) {
+	require.Equal(t, Key{Secret: "secret"}, LegacyKey("secret", "2023-06"))
+	require.Equal(t, Key{Secret: "secret", Retired: true}, LegacyKey("secret", "2023-06, "+LegacyKeyID))
+}
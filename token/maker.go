@@ -4,9 +4,15 @@ import "time"
 
 // Maker is an interface for managing tokens
 type Maker interface {
-	// CreateToken creates new token for a specific username and duration
-	CreateToken(username string, duration time.Duration) (string, error)
+	// CreateToken creates new token for a specific username and duration and returns it together with its payload
+	CreateToken(username string, duration time.Duration) (string, *Payload, error)
 
+	Verifier
+}
+
+// Verifier is an interface for checking tokens
+// Services which only accept tokens depend on it, so they don't need to hold a key able to mint them
+type Verifier interface {
 	// VerifyToken checks if the token is valid or not and in positive case returns token claims
 	VerifyToken(token string) (*Payload, error)
 }
@@ -12,45 +12,83 @@ import (
 // PasetoMaker is a PASETO token maker
 type PasetoMaker struct {
 	paseto       *paseto.V2
-	symmetricKey []byte
+	policy       ClaimsPolicy
+	currentKeyID string
+	// symmetricKeys are the keys which are not retired by their IDs
+	symmetricKeys map[string][]byte
 }
 
 // NewPasetoMaker creates a new PasetoMaker
 func NewPasetoMaker(symmetricKey string) (Maker, error) {
-	// chacha20poly1305 is the algorithm used by paseto v2 to encrypt a payload, so the key must be of a size which is required by this algorithm
-	if len(symmetricKey) != chacha20poly1305.KeySize {
-		return nil, fmt.Errorf("invalid key size: must be exactly %d characters long", chacha20poly1305.KeySize)
+	return NewPasetoKeyringMaker(Keyring{Keys: []Key{{Secret: symmetricKey}}}, ClaimsPolicy{})
+}
+
+// NewPasetoKeyringMaker creates a new PasetoMaker which signs tokens with the current key of the keyring
+// The ID of the key is put in the footer of the token, tokens without it are checked with the key with an empty ID
+func NewPasetoKeyringMaker(keyring Keyring, policy ClaimsPolicy) (Maker, error) {
+	keys, err := keyring.activeKeys()
+	if err != nil {
+		return nil, err
 	}
 
 	maker := &PasetoMaker{
-		paseto:       paseto.NewV2(),
-		symmetricKey: []byte(symmetricKey),
+		paseto:        paseto.NewV2(),
+		policy:        policy,
+		currentKeyID:  keyring.CurrentID,
+		symmetricKeys: make(map[string][]byte, len(keys)),
+	}
+
+	for id, symmetricKey := range keys {
+		// chacha20poly1305 is the algorithm used by paseto v2 to encrypt a payload, so the key must be of a size which is required by this algorithm
+		if len(symmetricKey) != chacha20poly1305.KeySize {
+			return nil, fmt.Errorf("invalid key size: must be exactly %d characters long", chacha20poly1305.KeySize)
+		}
+		maker.symmetricKeys[id] = []byte(symmetricKey)
 	}
 	return maker, nil
 }
 
 // CreateToken creates new token for a specific username and duration
-func (maker *PasetoMaker) CreateToken(username string, duration time.Duration) (string, error) {
-	payload, err := NewPayload(username, duration)
+func (maker *PasetoMaker) CreateToken(username string, duration time.Duration) (string, *Payload, error) {
+	payload, err := newPolicyPayload(maker.policy, username, duration)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+
+	// Tokens of a maker without key IDs keep the footer they always had
+	var footer interface{}
+	if maker.currentKeyID != "" {
+		footer = &pasetoFooter{KeyID: maker.currentKeyID}
 	}
 
-	return maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
+	token, err := maker.paseto.Encrypt(maker.symmetricKeys[maker.currentKeyID], payload, footer)
+	return token, payload, err
 }
 
 // VerifyToken checks if the token is valid or not
 func (maker *PasetoMaker) VerifyToken(token string) (*Payload, error) {
+	// The footer is not encrypted, so the key can be picked before the token is decrypted
+	footer := &pasetoFooter{}
+	if err := paseto.ParseFooter(token, footer); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	symmetricKey, ok := maker.symmetricKeys[footer.KeyID]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
 	payload := &Payload{}
 
 	// Here, inside the Decrypt the check is performed whether token is valid or not
-	err := maker.paseto.Decrypt(token, maker.symmetricKey, payload, nil)
+	// The footer is authenticated together with the payload, so the key ID can't be swapped
+	err := maker.paseto.Decrypt(token, symmetricKey, payload, nil)
 	if err != nil {
 		return nil, ErrInvalidToken
 	}
 
-	// Here on the other hand we know that token is valid but check whether the token is not expired
-	err = payload.Valid()
+	// Here on the other hand we know that token is valid but check whether the token is not expired and was minted for us
+	err = payload.validate(maker.policy)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,201 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// pasetoV4PublicHeader starts every v4.public token, it is also a part of the signed message
+const pasetoV4PublicHeader = "v4.public."
+
+// PasetoV4Maker is a PASETO v4.public token maker
+// Tokens are signed with an Ed25519 private key, so anyone with the public key can verify them but not mint them
+type PasetoV4Maker struct {
+	PasetoV4Verifier
+	privateKey ed25519.PrivateKey
+}
+
+// NewPasetoV4Maker creates a new PasetoV4Maker from a hex encoded Ed25519 seed
+func NewPasetoV4Maker(privateKeyHex string) (Maker, error) {
+	return NewPasetoV4KeyringMaker(Keyring{Keys: []Key{{Secret: privateKeyHex}}}, ClaimsPolicy{})
+}
+
+// NewPasetoV4KeyringMaker creates a new PasetoV4Maker which signs tokens with the current key of the keyring
+// The secrets of the keys are hex encoded Ed25519 seeds
+// The ID of the key is put in the footer of the token, tokens without it are checked with the key with an empty ID
+func NewPasetoV4KeyringMaker(keyring Keyring, policy ClaimsPolicy) (Maker, error) {
+	keys, err := keyring.activeKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	maker := &PasetoV4Maker{
+		PasetoV4Verifier: PasetoV4Verifier{
+			policy:       policy,
+			currentKeyID: keyring.CurrentID,
+			publicKeys:   make(map[string]ed25519.PublicKey, len(keys)),
+		},
+	}
+
+	for id, privateKeyHex := range keys {
+		signer, err := parseEd25519Seed(privateKeyHex)
+		if err != nil {
+			return nil, err
+		}
+
+		privateKey := signer.(ed25519.PrivateKey)
+		maker.publicKeys[id] = privateKey.Public().(ed25519.PublicKey)
+		if id == keyring.CurrentID {
+			maker.privateKey = privateKey
+		}
+	}
+	return maker, nil
+}
+
+// CreateToken creates new token for a specific username and duration
+func (maker *PasetoV4Maker) CreateToken(username string, duration time.Duration) (string, *Payload, error) {
+	payload, err := newPolicyPayload(maker.policy, username, duration)
+	if err != nil {
+		return "", nil, err
+	}
+
+	message, err := json.Marshal(payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var footer []byte
+	if maker.currentKeyID != "" {
+		footer, err = json.Marshal(pasetoFooter{KeyID: maker.currentKeyID})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	signature := ed25519.Sign(maker.privateKey, preAuthEncode([]byte(pasetoV4PublicHeader), message, footer, nil))
+	token := pasetoV4PublicHeader + base64.RawURLEncoding.EncodeToString(append(message, signature...))
+	if len(footer) > 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(footer)
+	}
+	return token, payload, nil
+}
+
+// PasetoV4Verifier checks PASETO v4.public tokens with Ed25519 public keys
+type PasetoV4Verifier struct {
+	policy       ClaimsPolicy
+	currentKeyID string
+	publicKeys   map[string]ed25519.PublicKey
+}
+
+// NewPasetoV4Verifier creates a new PasetoV4Verifier from hex encoded Ed25519 public keys by their IDs
+func NewPasetoV4Verifier(publicKeysHex map[string]string, policy ClaimsPolicy) (Verifier, error) {
+	verifier := &PasetoV4Verifier{
+		policy:     policy,
+		publicKeys: make(map[string]ed25519.PublicKey, len(publicKeysHex)),
+	}
+
+	for id, publicKeyHex := range publicKeysHex {
+		publicKey, err := hex.DecodeString(publicKeyHex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %w", err)
+		}
+
+		if len(publicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid key size: must be exactly %d bytes long", ed25519.PublicKeySize)
+		}
+		verifier.publicKeys[id] = publicKey
+	}
+	return verifier, nil
+}
+
+// PublicKeys returns the hex encoded public keys by their IDs which downstream services pass to NewPasetoV4Verifier
+func (verifier *PasetoV4Verifier) PublicKeys() map[string]string {
+	publicKeys := make(map[string]string, len(verifier.publicKeys))
+	for id, publicKey := range verifier.publicKeys {
+		publicKeys[id] = hex.EncodeToString(publicKey)
+	}
+	return publicKeys
+}
+
+// VerifyToken checks if the token is valid or not
+func (verifier *PasetoV4Verifier) VerifyToken(token string) (*Payload, error) {
+	if !strings.HasPrefix(token, pasetoV4PublicHeader) {
+		return nil, ErrInvalidToken
+	}
+
+	encodedBody, encodedFooter, _ := strings.Cut(token[len(pasetoV4PublicHeader):], ".")
+	body, err := base64.RawURLEncoding.DecodeString(encodedBody)
+	if err != nil || len(body) < ed25519.SignatureSize {
+		return nil, ErrInvalidToken
+	}
+
+	footer, err := base64.RawURLEncoding.DecodeString(encodedFooter)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// The footer is not encrypted, so the key can be picked before the signature is checked
+	keyID := pasetoFooter{}
+	if len(footer) > 0 {
+		if err := json.Unmarshal(footer, &keyID); err != nil {
+			return nil, ErrInvalidToken
+		}
+	}
+
+	publicKey, ok := verifier.publicKeys[keyID.KeyID]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	// The footer is signed together with the payload, so the key ID can't be swapped
+	message := body[:len(body)-ed25519.SignatureSize]
+	signature := body[len(body)-ed25519.SignatureSize:]
+	if !ed25519.Verify(publicKey, preAuthEncode([]byte(pasetoV4PublicHeader), message, footer, nil), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	payload := &Payload{}
+	if err := json.Unmarshal(message, payload); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// The signature is valid at this point, but the token could still be expired or minted for someone else
+	err = payload.validate(verifier.policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// GenerateEd25519Key generates a new hex encoded Ed25519 seed accepted by NewPasetoV4Maker and NewJWTEdDSAMaker
+func GenerateEd25519Key() (string, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(seed), nil
+}
+
+// preAuthEncode is the PAE function of the PASETO specification
+// It encodes the pieces with their lengths, so the boundaries between them can't be moved without changing the signature
+func preAuthEncode(pieces ...[]byte) []byte {
+	output := make([]byte, 8)
+	binary.LittleEndian.PutUint64(output, uint64(len(pieces)))
+
+	for _, piece := range pieces {
+		var length [8]byte
+		// The most significant bit is cleared for interoperability with languages without unsigned integers
+		binary.LittleEndian.PutUint64(length[:], uint64(len(piece))&(^uint64(0)>>1))
+		output = append(output, length[:]...)
+		output = append(output, piece...)
+	}
+	return output
+}
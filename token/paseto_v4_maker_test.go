@@ -0,0 +1,172 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPasetoV4Maker(t *testing.T) Maker {
+	key, err := GenerateEd25519Key()
+	require.NoError(t, err)
+
+	maker, err := NewPasetoV4Maker(key)
+	require.NoError(t, err)
+	return maker
+}
+
+func TestPasetoV4Maker(t *testing.T) {
+	maker := newTestPasetoV4Maker(t)
+
+	username := util.RandomOwner()
+	duration := time.Minute
+
+	issuedAt := time.Now()
+	expiredAt := time.Now().Add(duration)
+
+	token, createdPayload, err := maker.CreateToken(username, duration)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	require.NotEmpty(t, createdPayload)
+	require.Contains(t, token, pasetoV4PublicHeader)
+
+	payload, err := maker.VerifyToken(token)
+	require.NoError(t, err)
+	require.NotEmpty(t, payload)
+
+	require.NotZero(t, payload.ID)
+	require.Equal(t, username, payload.Username)
+	require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
+	require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
+	require.Equal(t, createdPayload.ID, payload.ID)
+}
+
+func TestPasetoV4VerifierWithPublicKey(t *testing.T) {
+	maker := newTestPasetoV4Maker(t)
+
+	token, _, err := maker.CreateToken(util.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	// The verifier gets only the exported public key, it has no way to create tokens
+	verifier, err := NewPasetoV4Verifier(maker.(*PasetoV4Maker).PublicKeys(), ClaimsPolicy{})
+	require.NoError(t, err)
+	_, ok := verifier.(Maker)
+	require.False(t, ok)
+
+	payload, err := verifier.VerifyToken(token)
+	require.NoError(t, err)
+	require.NotEmpty(t, payload)
+
+	otherMaker := newTestPasetoV4Maker(t)
+	otherToken, _, err := otherMaker.CreateToken(util.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	payload, err = verifier.VerifyToken(otherToken)
+	require.EqualError(t, err, ErrInvalidToken.Error())
+	require.Nil(t, payload)
+}
+
+func TestExpiredPasetoV4Token(t *testing.T) {
+	maker := newTestPasetoV4Maker(t)
+
+	token, _, err := maker.CreateToken(util.RandomOwner(), -time.Minute)
+	require.NoError(t, err)
+
+	payload, err := maker.VerifyToken(token)
+	require.Error(t, err)
+	require.EqualError(t, err, ErrExpiredToken.Error())
+	require.Nil(t, payload)
+}
+
+func TestInvalidPasetoV4Token(t *testing.T) {
+	maker := newTestPasetoV4Maker(t)
+
+	token, _, err := maker.CreateToken(util.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	body, err := base64.RawURLEncoding.DecodeString(token[len(pasetoV4PublicHeader):])
+	require.NoError(t, err)
+
+	// The username in the payload is replaced while the signature stays the same
+	message := body[:len(body)-ed25519.SignatureSize]
+	payload := &Payload{}
+	require.NoError(t, json.Unmarshal(message, payload))
+	payload.Username = util.RandomOwner()
+	forgedMessage, err := json.Marshal(payload)
+	require.NoError(t, err)
+	forgedBody := append(forgedMessage, body[len(body)-ed25519.SignatureSize:]...)
+
+	testCases := []struct {
+		name  string
+		token string
+	}{
+		{
+			name:  "ForgedPayload",
+			token: pasetoV4PublicHeader + base64.RawURLEncoding.EncodeToString(forgedBody),
+		},
+		{
+			name:  "WrongHeader",
+			token: "v4.local." + token[len(pasetoV4PublicHeader):],
+		},
+		{
+			name:  "UnexpectedFooter",
+			token: token + "." + base64.RawURLEncoding.EncodeToString([]byte("footer")),
+		},
+		{
+			name:  "TooShort",
+			token: pasetoV4PublicHeader + base64.RawURLEncoding.EncodeToString([]byte("short")),
+		},
+		{
+			name:  "NotBase64",
+			token: pasetoV4PublicHeader + "!!!",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := maker.VerifyToken(tc.token)
+			require.EqualError(t, err, ErrInvalidToken.Error())
+			require.Nil(t, payload)
+		})
+	}
+}
+
+func TestInvalidKeyForPasetoV4Maker(t *testing.T) {
+	maker, err := NewPasetoV4Maker(hex.EncodeToString([]byte(util.RandomString(16))))
+	require.Error(t, err)
+	require.Nil(t, maker)
+
+	maker, err = NewPasetoV4Maker(util.RandomString(64))
+	require.Error(t, err)
+	require.Nil(t, maker)
+
+	verifier, err := NewPasetoV4Verifier(map[string]string{"": hex.EncodeToString([]byte(util.RandomString(16)))}, ClaimsPolicy{})
+	require.Error(t, err)
+	require.Nil(t, verifier)
+}
+
+// TestPasetoV4SpecVector checks the signing against the test vector 4-S-1 of the PASETO specification
+func TestPasetoV4SpecVector(t *testing.T) {
+	privateKey, err := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a37741eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2")
+	require.NoError(t, err)
+
+	message := []byte(`{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`)
+	signature := ed25519.Sign(privateKey, preAuthEncode([]byte(pasetoV4PublicHeader), message, nil, nil))
+	token := pasetoV4PublicHeader + base64.RawURLEncoding.EncodeToString(append(message, signature...))
+
+	require.Equal(t, "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA", token)
+}
+
+func TestPreAuthEncode(t *testing.T) {
+	require.Equal(t, []byte("\x00\x00\x00\x00\x00\x00\x00\x00"), preAuthEncode())
+	require.Equal(t, []byte("\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), preAuthEncode([]byte("")))
+	require.Equal(t, []byte("\x01\x00\x00\x00\x00\x00\x00\x00\x04\x00\x00\x00\x00\x00\x00\x00test"), preAuthEncode([]byte("test")))
+}
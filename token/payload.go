@@ -5,24 +5,51 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/igiai/simplebank/clock"
 )
 
 // Different types of error returned by the VerifyToken function
 var (
-	ErrInvalidToken = errors.New("token is invalid")
-	ErrExpiredToken = errors.New("token has expired")
+	ErrInvalidToken     = errors.New("token is invalid")
+	ErrExpiredToken     = errors.New("token has expired")
+	ErrTokenNotValidYet = errors.New("token is not valid yet")
 )
 
-// Payload contains the payload data of the token
+// Payload contains the payload data of the token, the PASETO tokens carry it as it is and the JWTs as jwtClaims
 type Payload struct {
 	ID        uuid.UUID `json:"id"`
 	Username  string    `json:"username"`
+	Issuer    string    `json:"iss,omitempty"`
+	Audience  string    `json:"aud,omitempty"`
 	IssuedAt  time.Time `json:"issued_at"`
+	NotBefore time.Time `json:"nbf"`
 	ExpiredAt time.Time `json:"expired_at"`
 }
 
+// ClaimsPolicy sets the issuer and audience a maker puts in its tokens and requires from the tokens it verifies
+// Leeway is the clock skew between services tolerated when the expiry and not-before times are checked
+// Clock is the time the tokens are issued and checked at, the time of the system when it is not set
+type ClaimsPolicy struct {
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+	Clock    clock.Clock
+}
+
+func (policy ClaimsPolicy) now() time.Time {
+	if policy.Clock == nil {
+		return time.Now()
+	}
+	return policy.Clock.Now()
+}
+
 // NewPayload creates a new token payload with a specific username and duration
 func NewPayload(username string, duration time.Duration) (*Payload, error) {
+	return newPayloadAt(username, duration, time.Now())
+}
+
+// newPayloadAt creates a new token payload issued at the given time
+func newPayloadAt(username string, duration time.Duration, now time.Time) (*Payload, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -31,16 +58,49 @@ func NewPayload(username string, duration time.Duration) (*Payload, error) {
 	payload := &Payload{
 		ID:        tokenID,
 		Username:  username,
-		IssuedAt:  time.Now(),
-		ExpiredAt: time.Now().Add(duration),
+		IssuedAt:  now,
+		NotBefore: now,
+		ExpiredAt: now.Add(duration),
+	}
+	return payload, nil
+}
+
+// newPolicyPayload creates a new token payload with the issuer and audience of the policy
+func newPolicyPayload(policy ClaimsPolicy, username string, duration time.Duration) (*Payload, error) {
+	payload, err := newPayloadAt(username, duration, policy.now())
+	if err != nil {
+		return nil, err
 	}
+
+	payload.Issuer = policy.Issuer
+	payload.Audience = policy.Audience
 	return payload, nil
 }
 
 // Valid checks if the token payload is valid or not
 func (payload *Payload) Valid() error {
-	if time.Now().After(payload.ExpiredAt) {
+	return payload.validate(ClaimsPolicy{})
+}
+
+// validate checks the time window of the payload with the leeway of the policy and its issuer and audience
+// The issuer and audience are checked only when the policy sets them
+func (payload *Payload) validate(policy ClaimsPolicy) error {
+	now := policy.now()
+	if now.After(payload.ExpiredAt.Add(policy.Leeway)) {
 		return ErrExpiredToken
 	}
+
+	// Tokens issued before the claim was introduced have no not-before time
+	if !payload.NotBefore.IsZero() && now.Add(policy.Leeway).Before(payload.NotBefore) {
+		return ErrTokenNotValidYet
+	}
+
+	if policy.Issuer != "" && payload.Issuer != policy.Issuer {
+		return ErrInvalidToken
+	}
+
+	if policy.Audience != "" && payload.Audience != policy.Audience {
+		return ErrInvalidToken
+	}
 	return nil
 }
@@ -0,0 +1,179 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/clock"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimsPolicy(t *testing.T) {
+	policy := ClaimsPolicy{
+		Issuer:   "simplebank-production",
+		Audience: "simplebank-api",
+		Leeway:   time.Minute,
+	}
+
+	for _, tc := range keyringMakers {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			keyring := Keyring{Keys: []Key{{Secret: tc.newSecret(t)}}}
+
+			maker, err := tc.newMaker(keyring, policy)
+			require.NoError(t, err)
+
+			username := util.RandomOwner()
+			token, _, err := maker.CreateToken(username, time.Minute)
+			require.NoError(t, err)
+
+			payload, err := maker.VerifyToken(token)
+			require.NoError(t, err)
+			require.Equal(t, username, payload.Username)
+			require.Equal(t, policy.Issuer, payload.Issuer)
+			require.Equal(t, policy.Audience, payload.Audience)
+			require.WithinDuration(t, payload.IssuedAt, payload.NotBefore, time.Second)
+
+			// A token which expired within the leeway is still accepted
+			token, _, err = maker.CreateToken(username, -time.Second)
+			require.NoError(t, err)
+			_, err = maker.VerifyToken(token)
+			require.NoError(t, err)
+
+			token, _, err = maker.CreateToken(username, -2*time.Minute)
+			require.NoError(t, err)
+			_, err = maker.VerifyToken(token)
+			require.EqualError(t, err, ErrExpiredToken.Error())
+
+			// A token minted for another environment or service is rejected even though the key is the same
+			for _, otherPolicy := range []ClaimsPolicy{
+				{Issuer: "simplebank-staging", Audience: policy.Audience},
+				{Issuer: policy.Issuer, Audience: "simplebank-reports"},
+				{},
+			} {
+				otherMaker, err := tc.newMaker(keyring, otherPolicy)
+				require.NoError(t, err)
+
+				token, _, err := otherMaker.CreateToken(username, time.Minute)
+				require.NoError(t, err)
+
+				payload, err := maker.VerifyToken(token)
+				require.EqualError(t, err, ErrInvalidToken.Error())
+				require.Nil(t, payload)
+			}
+		})
+	}
+}
+
+func TestPayloadValidate(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name      string
+		notBefore time.Time
+		expiredAt time.Time
+		leeway    time.Duration
+		err       error
+	}{
+		{
+			name:      "OK",
+			notBefore: now,
+			expiredAt: now.Add(time.Minute),
+		},
+		{
+			name:      "Expired",
+			notBefore: now.Add(-time.Hour),
+			expiredAt: now.Add(-time.Second),
+			err:       ErrExpiredToken,
+		},
+		{
+			name:      "ExpiredWithinLeeway",
+			notBefore: now.Add(-time.Hour),
+			expiredAt: now.Add(-time.Second),
+			leeway:    time.Minute,
+		},
+		{
+			name:      "NotValidYet",
+			notBefore: now.Add(time.Minute),
+			expiredAt: now.Add(time.Hour),
+			leeway:    time.Second,
+			err:       ErrTokenNotValidYet,
+		},
+		{
+			name:      "NotValidYetWithinLeeway",
+			notBefore: now.Add(time.Second),
+			expiredAt: now.Add(time.Hour),
+			leeway:    time.Minute,
+		},
+		{
+			name:      "NoNotBefore",
+			expiredAt: now.Add(time.Minute),
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			payload := &Payload{
+				Username:  util.RandomOwner(),
+				IssuedAt:  now,
+				NotBefore: tc.notBefore,
+				ExpiredAt: tc.expiredAt,
+			}
+
+			err := payload.validate(ClaimsPolicy{Leeway: tc.leeway})
+			if tc.err == nil {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.err.Error())
+			}
+		})
+	}
+}
+
+func TestClaimsPolicyClock(t *testing.T) {
+	issuedAt := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+
+	for _, tc := range keyringMakers {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			keyring := Keyring{Keys: []Key{{Secret: tc.newSecret(t)}}}
+
+			issuerClock := clock.NewFake(issuedAt)
+			issuer, err := tc.newMaker(keyring, ClaimsPolicy{Clock: issuerClock})
+			require.NoError(t, err)
+
+			token, payload, err := issuer.CreateToken(util.RandomOwner(), time.Minute)
+			require.NoError(t, err)
+			require.True(t, issuedAt.Equal(payload.IssuedAt))
+			require.True(t, issuedAt.Equal(payload.NotBefore))
+			require.True(t, issuedAt.Add(time.Minute).Equal(payload.ExpiredAt))
+
+			// The token is accepted up to the very end of its duration extended by the leeway
+			verifierClock := clock.NewFake(issuedAt)
+			verifier, err := tc.newMaker(keyring, ClaimsPolicy{Leeway: 5 * time.Second, Clock: verifierClock})
+			require.NoError(t, err)
+
+			verifierClock.Advance(time.Minute + 5*time.Second)
+			_, err = verifier.VerifyToken(token)
+			require.NoError(t, err)
+
+			verifierClock.Advance(time.Nanosecond)
+			_, err = verifier.VerifyToken(token)
+			require.EqualError(t, err, ErrExpiredToken.Error())
+
+			// A verifier whose clock is behind the issuer accepts the token only once the skew is within the leeway
+			verifierClock.Set(issuedAt.Add(-6 * time.Second))
+			_, err = verifier.VerifyToken(token)
+			require.EqualError(t, err, ErrTokenNotValidYet.Error())
+
+			verifierClock.Advance(time.Second)
+			_, err = verifier.VerifyToken(token)
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInsecureURL       = errors.New("webhook url must use https")
+	ErrDisallowedAddress = errors.New("webhook url must resolve to a public address")
+	errRedirect          = errors.New("webhook redirects are not followed")
+)
+
+// disallowedPrefixes are the special purpose ranges not covered by the checks of netip.Addr
+var disallowedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// ValidateURL checks that a webhook url uses https and doesn't point at the internal network
+// Hostnames are checked again once resolved, as a public name can resolve to an internal address
+func ValidateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" {
+		return ErrInsecureURL
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return errors.New("webhook url must have a host")
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrDisallowedAddress
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !allowedAddr(addr) {
+		return ErrDisallowedAddress
+	}
+	return nil
+}
+
+// allowedAddr reports whether the webhooks may be sent to the address
+func allowedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range disallowedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDialAddress is the Control hook of the dialer, it runs after the name is resolved and before connecting,
+// so a name resolving to an internal address is refused whatever the DNS answers at the time of the delivery
+func checkDialAddress(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("cannot parse dial address %s: %w", address, err)
+	}
+	if !allowedAddr(addrPort.Addr()) {
+		return fmt.Errorf("cannot dial %s: %w", address, ErrDisallowedAddress)
+	}
+	return nil
+}
+
+// newClient creates the client sending the webhooks
+// It refuses internal addresses after resolution, ignores the proxy settings of the environment and doesn't follow redirects
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: checkDialAddress,
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return errRedirect
+		},
+	}
+}
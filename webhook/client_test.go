@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateURL(t *testing.T) {
+	testCases := []struct {
+		url string
+		err error
+	}{
+		{url: "https://example.com/hooks"},
+		{url: "https://93.184.216.34:8443/hooks"},
+		{url: "http://example.com/hooks", err: ErrInsecureURL},
+		{url: "ftp://example.com/hooks", err: ErrInsecureURL},
+		{url: "https://localhost/hooks", err: ErrDisallowedAddress},
+		{url: "https://api.localhost/hooks", err: ErrDisallowedAddress},
+		{url: "https://127.0.0.1/hooks", err: ErrDisallowedAddress},
+		{url: "https://10.1.2.3/hooks", err: ErrDisallowedAddress},
+		{url: "https://172.16.0.1/hooks", err: ErrDisallowedAddress},
+		{url: "https://192.168.1.1/hooks", err: ErrDisallowedAddress},
+		{url: "https://169.254.169.254/latest/meta-data", err: ErrDisallowedAddress},
+		{url: "https://100.64.0.1/hooks", err: ErrDisallowedAddress},
+		{url: "https://0.0.0.0/hooks", err: ErrDisallowedAddress},
+		{url: "https://[::1]/hooks", err: ErrDisallowedAddress},
+		{url: "https://[fe80::1]/hooks", err: ErrDisallowedAddress},
+		{url: "https://[fd00::1]/hooks", err: ErrDisallowedAddress},
+		{url: "https://[::ffff:127.0.0.1]/hooks", err: ErrDisallowedAddress},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.url, func(t *testing.T) {
+			err := ValidateURL(tc.url)
+			if tc.err == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tc.err)
+			}
+		})
+	}
+
+	require.Error(t, ValidateURL("https:///hooks"))
+}
+
+func TestClientRefusesInternalAddress(t *testing.T) {
+	// The url passes as a hostname, the address it resolves to is checked when dialing
+	received := false
+	receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+	}))
+	defer receiver.Close()
+
+	client := newClient(time.Second)
+	_, err := client.Get(receiver.URL)
+	require.ErrorIs(t, err, ErrDisallowedAddress)
+	require.False(t, received)
+}
+
+func TestClientRefusesRedirect(t *testing.T) {
+	client := newClient(time.Second)
+	require.ErrorIs(t, client.CheckRedirect(nil, nil), errRedirect)
+}
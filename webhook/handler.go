@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/outbox"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// AccountPayload is the data of the account events delivered to webhooks
+type AccountPayload struct {
+	Account db.Account `json:"account"`
+}
+
+// TransferPayload is the data of the transfer events delivered to webhooks
+// Account and Entry are the side of the transfer which belongs to the owner of the webhook
+type TransferPayload struct {
+	Transfer db.Transfer `json:"transfer"`
+	Account  db.Account  `json:"account"`
+	Entry    db.Entry    `json:"entry"`
+}
+
+type eventHandler struct {
+	store db.Querier
+}
+
+// NewEventHandler creates the outbox handler queueing the webhook deliveries of the domain events
+// A redispatched event does not queue its deliveries twice, they are unique per outbox event
+func NewEventHandler(store db.Querier) outbox.Handler {
+	return &eventHandler{store: store}
+}
+
+func (handler *eventHandler) HandleEvent(ctx context.Context, envelope outbox.Envelope) error {
+	switch event := envelope.Event.(type) {
+	case *db.AccountCreated:
+		return handler.enqueue(ctx, envelope.ID, event.Account.Owner, util.AccountCreatedEvent, AccountPayload{
+			Account: event.Account,
+		})
+	case *db.TransferCreated:
+		err := handler.enqueue(ctx, envelope.ID, event.FromAccount.Owner, util.TransferSentEvent, TransferPayload{
+			Transfer: event.Transfer,
+			Account:  event.FromAccount,
+			Entry:    event.FromEntry,
+		})
+		if err != nil {
+			return err
+		}
+
+		return handler.enqueue(ctx, envelope.ID, event.ToAccount.Owner, util.TransferReceivedEvent, TransferPayload{
+			Transfer: event.Transfer,
+			Account:  event.ToAccount,
+			Entry:    event.ToEntry,
+		})
+	}
+	return nil
+}
+
+// enqueue queues a delivery of the event for every webhook of the owner subscribed to its type
+func (handler *eventHandler) enqueue(ctx context.Context, eventID int64, owner string, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = handler.store.EnqueueWebhookDeliveries(ctx, db.EnqueueWebhookDeliveriesParams{
+		EventID:   pgtype.Int8{Int64: eventID, Valid: true},
+		EventType: eventType,
+		Payload:   payload,
+		Owner:     owner,
+	})
+	return err
+}
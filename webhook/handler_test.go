@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/igiai/simplebank/db/mock"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/igiai/simplebank/outbox"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventHandlerTransferCreated(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	event := &db.TransferCreated{
+		Transfer:    db.Transfer{ID: util.RandomInt(1, 1000), Amount: 10},
+		FromAccount: db.Account{ID: 1, Owner: util.RandomOwner()},
+		ToAccount:   db.Account{ID: 2, Owner: util.RandomOwner()},
+		FromEntry:   db.Entry{ID: 3, AccountID: 1, Amount: -10},
+		ToEntry:     db.Entry{ID: 4, AccountID: 2, Amount: 10},
+	}
+	envelope := outbox.Envelope{ID: util.RandomInt(1, 1000), Event: event}
+
+	// Each owner is told about their own side of the transfer
+	store := mockdb.NewMockStore(ctrl)
+	for _, side := range []struct {
+		eventType string
+		account   db.Account
+		entry     db.Entry
+	}{
+		{util.TransferSentEvent, event.FromAccount, event.FromEntry},
+		{util.TransferReceivedEvent, event.ToAccount, event.ToEntry},
+	} {
+		side := side
+		store.EXPECT().
+			EnqueueWebhookDeliveries(gomock.Any(), gomock.Any()).
+			Times(1).
+			DoAndReturn(func(_ interface{}, arg db.EnqueueWebhookDeliveriesParams) (int64, error) {
+				require.Equal(t, pgtype.Int8{Int64: envelope.ID, Valid: true}, arg.EventID)
+				require.Equal(t, side.eventType, arg.EventType)
+				require.Equal(t, side.account.Owner, arg.Owner)
+
+				var payload TransferPayload
+				require.NoError(t, json.Unmarshal(arg.Payload, &payload))
+				require.Equal(t, event.Transfer, payload.Transfer)
+				require.Equal(t, side.account, payload.Account)
+				require.Equal(t, side.entry, payload.Entry)
+				return 1, nil
+			})
+	}
+
+	err := NewEventHandler(store).HandleEvent(context.Background(), envelope)
+	require.NoError(t, err)
+}
+
+func TestEventHandlerAccountCreated(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	account := db.Account{ID: util.RandomInt(1, 1000), Owner: util.RandomOwner(), Currency: util.RandomCurrency()}
+	envelope := outbox.Envelope{ID: util.RandomInt(1, 1000), Event: &db.AccountCreated{Account: account}}
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		EnqueueWebhookDeliveries(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.EnqueueWebhookDeliveriesParams) (int64, error) {
+			require.Equal(t, util.AccountCreatedEvent, arg.EventType)
+			require.Equal(t, account.Owner, arg.Owner)
+			return 0, nil
+		})
+
+	err := NewEventHandler(store).HandleEvent(context.Background(), envelope)
+	require.NoError(t, err)
+}
+
+func TestEventHandlerIgnoresOtherEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		EnqueueWebhookDeliveries(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	envelope := outbox.Envelope{ID: 1, Event: &db.UserCreated{Username: util.RandomOwner()}}
+	err := NewEventHandler(store).HandleEvent(context.Background(), envelope)
+	require.NoError(t, err)
+}
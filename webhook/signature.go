@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of every delivery, receivers check the signature before trusting the body
+const (
+	SignatureHeader = "X-Simplebank-Signature"
+	EventHeader     = "X-Simplebank-Event"
+	DeliveryHeader  = "X-Simplebank-Delivery"
+)
+
+var (
+	ErrInvalidSignature = errors.New("webhook signature is invalid")
+	ErrExpiredSignature = errors.New("webhook signature is too old")
+)
+
+// Sign returns the signature header of a delivery body sent at the given time
+// The timestamp is part of the signed message, so a captured delivery cannot be replayed later
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp.Unix(), computeSignature(secret, timestamp.Unix(), body))
+}
+
+// VerifySignature checks the signature header of a delivery body
+// Signatures older than tolerance are rejected, a zero tolerance accepts any age
+func VerifySignature(secret string, header string, body []byte, tolerance time.Duration) error {
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			var err error
+			timestamp, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidSignature
+			}
+		case "v1":
+			signature = value
+		}
+	}
+	if timestamp == 0 || signature == "" {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(computeSignature(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+
+	if tolerance > 0 && time.Since(time.Unix(timestamp, 0)) > tolerance {
+		return ErrExpiredSignature
+	}
+	return nil
+}
+
+func computeSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
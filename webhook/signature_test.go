@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignature(t *testing.T) {
+	secret := util.RandomString(32)
+	body := []byte(`{"id":1,"type":"transfer.received"}`)
+
+	header := Sign(secret, time.Now(), body)
+	require.NoError(t, VerifySignature(secret, header, body, time.Minute))
+
+	// The signature covers the body and depends on the secret
+	err := VerifySignature(secret, header, []byte(`{"id":2,"type":"transfer.received"}`), time.Minute)
+	require.EqualError(t, err, ErrInvalidSignature.Error())
+
+	err = VerifySignature(util.RandomString(32), header, body, time.Minute)
+	require.EqualError(t, err, ErrInvalidSignature.Error())
+}
+
+func TestExpiredSignature(t *testing.T) {
+	secret := util.RandomString(32)
+	body := []byte(`{}`)
+
+	header := Sign(secret, time.Now().Add(-time.Hour), body)
+	err := VerifySignature(secret, header, body, time.Minute)
+	require.EqualError(t, err, ErrExpiredSignature.Error())
+
+	// Without a tolerance the age is not checked
+	require.NoError(t, VerifySignature(secret, header, body, 0))
+}
+
+func TestMalformedSignature(t *testing.T) {
+	secret := util.RandomString(32)
+	body := []byte(`{}`)
+
+	for _, header := range []string{"", "v1=abc", "t=abc,v1=abc", "t=1700000000"} {
+		err := VerifySignature(secret, header, body, 0)
+		require.EqualError(t, err, ErrInvalidSignature.Error(), header)
+	}
+}
@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/igiai/simplebank/clock"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+)
+
+// maxBackoffDoublings caps the growth of the retry delay when no maximum is configured
+const maxBackoffDoublings = 16
+
+// maxErrorLength limits how much of a failed response is kept as the last error of a delivery
+const maxErrorLength = 256
+
+// Event is the body POSTed to the webhooks
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Worker delivers the webhook deliveries queued in the db
+// Several workers can run at once, each claims its own batch of deliveries
+type Worker struct {
+	store  db.Querier
+	client *http.Client
+	config util.Config
+	clock  clock.Clock
+}
+
+// NewWorker creates a worker delivering the queued webhooks with the configured retry policy
+// The claims and retries are scheduled and the events signed with the time of the clock
+func NewWorker(store db.Querier, config util.Config, clock clock.Clock) *Worker {
+	return &Worker{
+		store:  store,
+		client: newClient(config.WebhookTimeout),
+		config: config,
+		clock:  clock,
+	}
+}
+
+// Run delivers the due deliveries every poll interval until the context is canceled
+func (worker *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(worker.config.WebhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := worker.DeliverDue(ctx)
+			if err != nil {
+				log.Printf("cannot deliver webhooks: %v", err)
+			}
+			// A full batch means there may be more deliveries waiting
+			if err != nil || n == 0 || n < int(worker.config.WebhookBatchSize) {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue claims a batch of the due deliveries and sends them, it returns the number of claimed deliveries
+// The deliveries of the batch are sent at once and given a single timeout,
+// so all of them are settled before their claim runs out, whatever the size of the batch
+func (worker *Worker) DeliverDue(ctx context.Context) (int, error) {
+	// A claimed delivery is hidden from other workers for a while,
+	// if this worker dies before recording the outcome it becomes due again
+	deliveries, err := worker.store.ClaimWebhookDeliveries(ctx, db.ClaimWebhookDeliveriesParams{
+		LockedUntil: worker.clock.Now().Add(2 * worker.config.WebhookTimeout),
+		BatchSize:   worker.config.WebhookBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, worker.config.WebhookTimeout)
+	defer cancel()
+
+	errs := make([]error, len(deliveries))
+	var wg sync.WaitGroup
+	for i, delivery := range deliveries {
+		wg.Add(1)
+		go func(i int, delivery db.WebhookDelivery) {
+			defer wg.Done()
+			if err := worker.deliver(ctx, sendCtx, delivery); err != nil {
+				errs[i] = fmt.Errorf("cannot record outcome of delivery %d: %w", delivery.ID, err)
+			}
+		}(i, delivery)
+	}
+	wg.Wait()
+
+	return len(deliveries), errors.Join(errs...)
+}
+
+// deliver sends a delivery within the deadline of sendCtx and records whether it succeeded
+// Only the errors of the db are returned, failures of the receiver are recorded with the delivery
+func (worker *Worker) deliver(ctx context.Context, sendCtx context.Context, delivery db.WebhookDelivery) error {
+	subscription, err := worker.store.GetWebhookSubscription(ctx, delivery.SubscriptionID)
+	if err != nil {
+		return err
+	}
+
+	sendErr := worker.send(sendCtx, subscription, delivery)
+	if sendErr == nil {
+		return worker.store.MarkWebhookDelivered(ctx, delivery.ID)
+	}
+
+	lastError := sendErr.Error()
+	if len(lastError) > maxErrorLength {
+		lastError = lastError[:maxErrorLength]
+	}
+
+	attempts := delivery.Attempts + 1
+	if attempts >= worker.config.WebhookMaxAttempts {
+		return worker.store.DeadLetterWebhookDelivery(ctx, db.DeadLetterWebhookDeliveryParams{
+			ID:        delivery.ID,
+			LastError: lastError,
+		})
+	}
+
+	return worker.store.RetryWebhookDelivery(ctx, db.RetryWebhookDeliveryParams{
+		ID:            delivery.ID,
+		NextAttemptAt: worker.clock.Now().Add(Backoff(worker.config.WebhookBackoff, worker.config.WebhookMaxBackoff, attempts)),
+		LastError:     lastError,
+	})
+}
+
+// send POSTs the signed event to the webhook, any response other than 2xx is a failure
+func (worker *Worker) send(ctx context.Context, subscription db.WebhookSubscription, delivery db.WebhookDelivery) error {
+	body, err := json.Marshal(Event{
+		ID:        delivery.ID,
+		Type:      delivery.EventType,
+		CreatedAt: delivery.CreatedAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// Subscriptions created before https was required are not sent in plain text, the addresses are checked by the dialer
+	if request.URL.Scheme != "https" {
+		return ErrInsecureURL
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.EventType)
+	request.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	request.Header.Set(SignatureHeader, Sign(subscription.Secret, worker.clock.Now(), body))
+
+	response, err := worker.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorLength))
+		return fmt.Errorf("unexpected status %d: %s", response.StatusCode, message)
+	}
+	return nil
+}
+
+// Backoff returns how long to wait before the next attempt after the given number of failed attempts
+// The delay doubles with every failure up to max
+func Backoff(base time.Duration, max time.Duration, attempts int32) time.Duration {
+	duration := base
+	for i := int32(1); i < attempts && i < maxBackoffDoublings; i++ {
+		if max > 0 && duration >= max {
+			break
+		}
+		duration *= 2
+	}
+
+	if max > 0 && duration > max {
+		return max
+	}
+	return duration
+}
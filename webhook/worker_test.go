@@ -0,0 +1,291 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igiai/simplebank/clock"
+	mockdb "github.com/igiai/simplebank/db/mock"
+	db "github.com/igiai/simplebank/db/sqlc"
+	"github.com/igiai/simplebank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConfig() util.Config {
+	return util.Config{
+		WebhookPollInterval: time.Second,
+		WebhookBatchSize:    10,
+		WebhookTimeout:      time.Second,
+		WebhookMaxAttempts:  3,
+		WebhookBackoff:      time.Minute,
+		WebhookMaxBackoff:   time.Hour,
+	}
+}
+
+func randomSubscription(url string) db.WebhookSubscription {
+	return db.WebhookSubscription{
+		ID:         util.RandomInt(1, 1000),
+		Owner:      util.RandomOwner(),
+		Url:        url,
+		EventTypes: []string{util.TransferReceivedEvent},
+		Secret:     util.RandomString(32),
+		CreatedAt:  time.Now(),
+	}
+}
+
+func randomDelivery(subscriptionID int64) db.WebhookDelivery {
+	return db.WebhookDelivery{
+		ID:             util.RandomInt(1, 1000),
+		SubscriptionID: subscriptionID,
+		EventType:      util.TransferReceivedEvent,
+		Payload:        json.RawMessage(`{"transfer":{"id":1}}`),
+		Status:         "pending",
+		NextAttemptAt:  time.Now(),
+		CreatedAt:      time.Now(),
+	}
+}
+
+func TestWorkerDeliverDue(t *testing.T) {
+	testCases := []struct {
+		name       string
+		status     int
+		attempts   int32
+		buildStubs func(store *mockdb.MockStore, delivery db.WebhookDelivery, clk *clock.Fake)
+	}{
+		{
+			name:   "Delivered",
+			status: http.StatusNoContent,
+			buildStubs: func(store *mockdb.MockStore, delivery db.WebhookDelivery, clk *clock.Fake) {
+				store.EXPECT().
+					MarkWebhookDelivered(gomock.Any(), gomock.Eq(delivery.ID)).
+					Times(1).
+					Return(nil)
+				store.EXPECT().
+					RetryWebhookDelivery(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+		},
+		{
+			name:     "Retry",
+			status:   http.StatusInternalServerError,
+			attempts: 1,
+			buildStubs: func(store *mockdb.MockStore, delivery db.WebhookDelivery, clk *clock.Fake) {
+				store.EXPECT().
+					RetryWebhookDelivery(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.RetryWebhookDeliveryParams) error {
+						require.Equal(t, delivery.ID, arg.ID)
+						// The second failed attempt waits twice the base backoff
+						require.Equal(t, clk.Now().Add(2*time.Minute), arg.NextAttemptAt)
+						require.Contains(t, arg.LastError, "unexpected status 500")
+						return nil
+					})
+				store.EXPECT().
+					MarkWebhookDelivered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+		},
+		{
+			name:     "DeadLetter",
+			status:   http.StatusGone,
+			attempts: 2,
+			buildStubs: func(store *mockdb.MockStore, delivery db.WebhookDelivery, clk *clock.Fake) {
+				store.EXPECT().
+					DeadLetterWebhookDelivery(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.DeadLetterWebhookDeliveryParams) error {
+						require.Equal(t, delivery.ID, arg.ID)
+						require.Contains(t, arg.LastError, "unexpected status 410")
+						return nil
+					})
+				store.EXPECT().
+					RetryWebhookDelivery(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var subscription db.WebhookSubscription
+			received := 0
+			receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received++
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+
+				require.NoError(t, VerifySignature(subscription.Secret, r.Header.Get(SignatureHeader), body, time.Minute))
+				require.Equal(t, util.TransferReceivedEvent, r.Header.Get(EventHeader))
+
+				var event Event
+				require.NoError(t, json.Unmarshal(body, &event))
+				require.Equal(t, strconv.FormatInt(event.ID, 10), r.Header.Get(DeliveryHeader))
+				require.Equal(t, util.TransferReceivedEvent, event.Type)
+				require.JSONEq(t, `{"transfer":{"id":1}}`, string(event.Data))
+
+				w.WriteHeader(tc.status)
+			}))
+			defer receiver.Close()
+
+			subscription = randomSubscription(receiver.URL)
+			delivery := randomDelivery(subscription.ID)
+			delivery.Attempts = tc.attempts
+
+			// The signature is checked against the real time, so the clock starts there
+			clk := clock.NewFake(time.Now())
+
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().
+				ClaimWebhookDeliveries(gomock.Any(), gomock.Eq(db.ClaimWebhookDeliveriesParams{
+					LockedUntil: clk.Now().Add(2 * time.Second),
+					BatchSize:   10,
+				})).
+				Times(1).
+				Return([]db.WebhookDelivery{delivery}, nil)
+			store.EXPECT().
+				GetWebhookSubscription(gomock.Any(), gomock.Eq(subscription.ID)).
+				Times(1).
+				Return(subscription, nil)
+			tc.buildStubs(store, delivery, clk)
+
+			// The receiver listens on the loopback, which the client of the worker refuses
+			worker := NewWorker(store, newTestConfig(), clk)
+			worker.client = receiver.Client()
+			n, err := worker.DeliverDue(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 1, n)
+			require.Equal(t, 1, received)
+		})
+	}
+}
+
+func TestWorkerUnreachableReceiver(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The receiver is closed before the delivery, so the request fails without a response
+	receiver := httptest.NewTLSServer(http.NotFoundHandler())
+	receiver.Close()
+
+	subscription := randomSubscription(receiver.URL)
+	delivery := randomDelivery(subscription.ID)
+
+	clk := clock.NewFake(time.Now())
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		ClaimWebhookDeliveries(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return([]db.WebhookDelivery{delivery}, nil)
+	store.EXPECT().
+		GetWebhookSubscription(gomock.Any(), gomock.Eq(subscription.ID)).
+		Times(1).
+		Return(subscription, nil)
+	store.EXPECT().
+		RetryWebhookDelivery(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.RetryWebhookDeliveryParams) error {
+			require.Equal(t, clk.Now().Add(time.Minute), arg.NextAttemptAt)
+			require.NotEmpty(t, arg.LastError)
+			return nil
+		})
+
+	worker := NewWorker(store, newTestConfig(), clk)
+	worker.client = receiver.Client()
+	_, err := worker.DeliverDue(context.Background())
+	require.NoError(t, err)
+}
+
+func TestBackoff(t *testing.T) {
+	require.Equal(t, time.Minute, Backoff(time.Minute, time.Hour, 1))
+	require.Equal(t, 2*time.Minute, Backoff(time.Minute, time.Hour, 2))
+	require.Equal(t, 32*time.Minute, Backoff(time.Minute, time.Hour, 6))
+	require.Equal(t, time.Hour, Backoff(time.Minute, time.Hour, 7))
+	require.Equal(t, time.Hour, Backoff(time.Minute, time.Hour, 100))
+}
+
+func TestWorkerInsecureURL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Subscriptions created before https was required are not sent
+	subscription := randomSubscription("http://example.com/hooks")
+	delivery := randomDelivery(subscription.ID)
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		ClaimWebhookDeliveries(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return([]db.WebhookDelivery{delivery}, nil)
+	store.EXPECT().
+		GetWebhookSubscription(gomock.Any(), gomock.Eq(subscription.ID)).
+		Times(1).
+		Return(subscription, nil)
+	store.EXPECT().
+		RetryWebhookDelivery(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.RetryWebhookDeliveryParams) error {
+			require.Equal(t, ErrInsecureURL.Error(), arg.LastError)
+			return nil
+		})
+
+	worker := NewWorker(store, newTestConfig(), clock.Real{})
+	_, err := worker.DeliverDue(context.Background())
+	require.NoError(t, err)
+}
+
+func TestWorkerDeliversBatchConcurrently(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Every request waits for the others, so the batch is delivered only if the requests are sent at once
+	const batchSize = 3
+	var arrived sync.WaitGroup
+	arrived.Add(batchSize)
+	receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		arrived.Wait()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	subscription := randomSubscription(receiver.URL)
+	deliveries := make([]db.WebhookDelivery, batchSize)
+	for i := range deliveries {
+		deliveries[i] = randomDelivery(subscription.ID)
+		deliveries[i].ID = int64(i + 1)
+	}
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		ClaimWebhookDeliveries(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(deliveries, nil)
+	store.EXPECT().
+		GetWebhookSubscription(gomock.Any(), gomock.Eq(subscription.ID)).
+		Times(batchSize).
+		Return(subscription, nil)
+	store.EXPECT().
+		MarkWebhookDelivered(gomock.Any(), gomock.Any()).
+		Times(batchSize).
+		Return(nil)
+
+	worker := NewWorker(store, newTestConfig(), clock.Real{})
+	worker.client = receiver.Client()
+	n, err := worker.DeliverDue(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, batchSize, n)
+}